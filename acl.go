@@ -0,0 +1,210 @@
+package defs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bpfs/defs/core/acl"
+	"github.com/bpfs/defs/core/identity"
+	"github.com/bpfs/defs/core/manifest"
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/core/transport"
+	"github.com/bpfs/defs/util"
+)
+
+// did 返回本节点操作文件资产的身份，未设置身份时为空
+func (fs *FS) did() string {
+	if fs.opt.identity == nil {
+		return ""
+	}
+	return fs.opt.identity.DID()
+}
+
+// checkAccess 检查本节点的身份对文件资产是否拥有 perm 中的全部权限
+// 优先使用本地记录的访问控制；清单受访问控制时，由清单中的所有者开始重放网络宣告的签名操作，
+// 无法验证时拒绝访问；清单为空或不受访问控制时不受限制
+func (fs *FS) checkAccess(assetID string, m *manifest.Manifest, holders *transport.Holders, perm acl.Permission) error {
+	entry, err := fs.acl.Get(assetID)
+	if err != nil {
+		return err
+	}
+	if entry == nil && m != nil && m.Controlled {
+		if entry, err = remoteACL(assetID, m, holders, fs.acl.Policy()); err != nil {
+			return err
+		}
+	}
+	if entry == nil {
+		return nil
+	}
+	return entry.Check(fs.did(), perm)
+}
+
+// remoteACL 由清单中的所有者开始重放网络宣告的签名操作，返回验证后的访问控制
+// 清单不受访问控制时返回空；宣告中的操作缺失或任何一项无效时返回错误
+func remoteACL(assetID string, m *manifest.Manifest, holders *transport.Holders, policy acl.Policy) (*acl.Entry, error) {
+	if !m.Controlled {
+		return nil, nil
+	}
+	if holders == nil {
+		return nil, fmt.Errorf("文件资产 %s 的访问控制无法验证", assetID)
+	}
+	meta, err := decodeMeta(assetID, holders)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := acl.Replay(assetID, m.Owner, meta.ACL, policy)
+	if err != nil {
+		return nil, fmt.Errorf("文件资产 %s 的访问控制无法验证: %v", assetID, err)
+	}
+	return entry, nil
+}
+
+// credentialValidity 是请求者凭证的有效期，签名时间与本地时间相差更多的凭证被拒绝
+const credentialValidity = 5 * time.Minute
+
+// credentialBytes 返回请求者凭证签名的内容
+func credentialBytes(peerID, assetID string, index int, signed int64) ([]byte, error) {
+	return util.MergeFieldsForSigning("defs fetch shard", peerID, assetID, index, signed)
+}
+
+// credential 以本节点的身份为获取 peerID 上的文件片段签名，没有设置身份时返回空
+func (fs *FS) credential(peerID, assetID string, index int) *transport.Credential {
+	if fs.opt.identity == nil {
+		return nil
+	}
+	signed := time.Now().Unix()
+	data, err := credentialBytes(peerID, assetID, index, signed)
+	if err != nil {
+		return nil
+	}
+	return &transport.Credential{
+		DID:       fs.opt.identity.DID(),
+		Time:      signed,
+		Signature: fs.opt.identity.Sign(data),
+	}
+}
+
+// verifyCredential 检查凭证是否由请求者为获取本节点 peerID 上的文件片段签名，返回请求者的 DID
+// 没有凭证时返回空，视为匿名身份
+func verifyCredential(cred *transport.Credential, peerID, assetID string, index int, now time.Time) (string, error) {
+	if cred == nil {
+		return "", nil
+	}
+	if d := now.Sub(time.Unix(cred.Time, 0)); d > credentialValidity || d < -credentialValidity {
+		return "", fmt.Errorf("%w: 请求者的凭证已过期", acl.ErrDenied)
+	}
+	data, err := credentialBytes(peerID, assetID, index, cred.Time)
+	if err != nil {
+		return "", err
+	}
+	if !identity.VerifyDID(cred.DID, data, cred.Signature) {
+		return "", fmt.Errorf("%w: 请求者的凭证无效", acl.ErrDenied)
+	}
+	return cred.DID, nil
+}
+
+// ACL 返回文件资产的访问控制，没有记录所有者时返回空
+func (fs *FS) ACL(assetID string) (*acl.Entry, error) {
+	return fs.acl.Get(assetID)
+}
+
+// ApplyACL 验证并应用签名的访问控制操作，存在节点间传输时重新宣告文件资产信息
+// 需要多个签名的操作由调用方基于 ACL 返回的版本使用 acl.NewOp 创建，并收集各个身份的签名
+func (fs *FS) ApplyACL(ctx context.Context, op *acl.SignedOp) (*acl.Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	entry, err := fs.acl.Apply(op)
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.reannounce(ctx, op.AssetID); err != nil {
+		return entry, fmt.Errorf("宣告文件资产失败: %v", err)
+	}
+	return entry, nil
+}
+
+// Share 以本节点的身份签名，授予 did 对文件资产的权限
+// 已加密的文件资产授予读取权限时同时为 did 封装数据密钥，只有清单的所有者可以封装，否则分享失败
+func (fs *FS) Share(ctx context.Context, assetID, did string, perm acl.Permission) (*acl.Entry, error) {
+	op, err := fs.signOp(assetID, acl.ActionShare, []string{did}, perm)
+	if err != nil {
+		return nil, err
+	}
+	if perm&acl.Read != 0 {
+		m, err := fs.localManifest(assetID)
+		if err != nil {
+			return nil, err
+		}
+		if err := fs.grantDataKey(assetID, m, did); err != nil {
+			return nil, err
+		}
+	}
+	return fs.ApplyACL(ctx, op)
+}
+
+// Revoke 以本节点的身份签名，撤销 did 对文件资产的全部权限
+// 已加密的文件资产中为 did 封装的数据密钥不会移除，撤销后其他节点不再向其提供片段
+func (fs *FS) Revoke(ctx context.Context, assetID, did string) (*acl.Entry, error) {
+	return fs.signACL(ctx, assetID, acl.ActionRevoke, []string{did}, 0)
+}
+
+// SetCoOwners 以本节点的身份签名，替换文件资产的共同所有者
+// 策略要求多个签名时只有本节点的签名会失败，需要使用 ApplyACL
+func (fs *FS) SetCoOwners(ctx context.Context, assetID string, dids []string) (*acl.Entry, error) {
+	return fs.signACL(ctx, assetID, acl.ActionSetCoOwners, dids, 0)
+}
+
+// Transfer 以本节点的身份签名，将文件资产的所有权转让给 did
+// 策略要求多个签名时只有本节点的签名会失败，需要使用 ApplyACL
+func (fs *FS) Transfer(ctx context.Context, assetID, did string) (*acl.Entry, error) {
+	return fs.signACL(ctx, assetID, acl.ActionTransfer, []string{did}, 0)
+}
+
+// signACL 基于当前版本创建访问控制操作，以本节点的身份签名后应用
+func (fs *FS) signACL(ctx context.Context, assetID string, action acl.Action, targets []string, perm acl.Permission) (*acl.Entry, error) {
+	op, err := fs.signOp(assetID, action, targets, perm)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ApplyACL(ctx, op)
+}
+
+// signOp 基于当前版本创建访问控制操作并以本节点的身份签名，返回前检查操作可以生效
+func (fs *FS) signOp(assetID string, action acl.Action, targets []string, perm acl.Permission) (*acl.SignedOp, error) {
+	if fs.opt.identity == nil {
+		return nil, fmt.Errorf("没有设置本节点的身份")
+	}
+	entry, err := fs.acl.Get(assetID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("文件资产 %s 没有访问控制", assetID)
+	}
+
+	op := acl.NewOp(entry, action, targets, perm)
+	op.Sign(fs.opt.identity)
+	if _, err := entry.Apply(op, fs.acl.Policy()); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// reannounce 重新宣告本节点上传的文件资产信息，没有节点间传输或文件资产不是由本节点上传时不宣告
+func (fs *FS) reannounce(ctx context.Context, assetID string) error {
+	if fs.transport == nil {
+		return nil
+	}
+	record, err := sqlite.SelectOneFileDatabase(fs.db, assetID, sqlite.OperateUpload)
+	if err != nil {
+		return err
+	}
+	if record == nil || record.Status != sqlite.StatusSuccess {
+		return nil
+	}
+
+	return fs.announce(ctx, assetID, nil)
+}
@@ -0,0 +1,52 @@
+package defs
+
+import (
+	"github.com/bpfs/defs/core/sqlite"
+)
+
+// saveCatalog 将上传成功的文件资产加入文件目录，已在文件目录中时保留自定义名称、属性和标签
+func (fs *FS) saveCatalog(record *sqlite.FileRecord) error {
+	existing, err := sqlite.SelectCatalogDatabase(fs.db, record.AssetID)
+	if err != nil {
+		return err
+	}
+	entry := &sqlite.CatalogRecord{
+		AssetID:  record.AssetID,
+		Name:     record.Name,
+		Size:     record.Size,
+		Modified: record.Times,
+	}
+	if existing != nil {
+		entry.CustomName = existing.CustomName
+		entry.Metadata = existing.Metadata
+	}
+	return sqlite.SaveCatalogDatabase(fs.db, entry)
+}
+
+// catalogUploaded 将早期版本上传成功、尚未加入文件目录的文件资产加入文件目录
+func (fs *FS) catalogUploaded() error {
+	assetIDs, err := sqlite.SelectAssetIDsDatabase(fs.db, sqlite.OperateUpload, sqlite.StatusSuccess)
+	if err != nil {
+		return err
+	}
+	for _, assetID := range assetIDs {
+		existing, err := sqlite.SelectCatalogDatabase(fs.db, assetID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			continue
+		}
+		record, err := sqlite.SelectOneFileDatabase(fs.db, assetID, sqlite.OperateUpload)
+		if err != nil {
+			return err
+		}
+		if record == nil {
+			continue
+		}
+		if err := fs.saveCatalog(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package defs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bpfs/defs/core/acl"
+	"github.com/bpfs/defs/core/throttle"
+	"gopkg.in/yaml.v3"
+)
+
+// OptionsConfig 是配置文件中的文件存储选项，未设置的项保持默认值
+type OptionsConfig struct {
+	StorageMode        *string          `json:"storage_mode,omitempty" yaml:"storage_mode,omitempty"`                 // 存储模式，如 "RS_Proportion"
+	DefaultBufSize     *int64           `json:"default_buf_size,omitempty" yaml:"default_buf_size,omitempty"`         // 常用缓冲区的大小
+	MaxBufferSize      *int64           `json:"max_buffer_size,omitempty" yaml:"max_buffer_size,omitempty"`           // 最大缓冲区的大小
+	MaxSliceSize       *int64           `json:"max_slice_size,omitempty" yaml:"max_slice_size,omitempty"`             // 最大片段的大小
+	MinSliceSize       *int64           `json:"min_slice_size,omitempty" yaml:"min_slice_size,omitempty"`             // 最小片段的大小
+	DataShards         *int64           `json:"data_shards,omitempty" yaml:"data_shards,omitempty"`                   // 数据片段的数量
+	ParityShards       *int64           `json:"parity_shards,omitempty" yaml:"parity_shards,omitempty"`               // 奇偶校验片段的数量
+	ShardSize          *int64           `json:"shard_size,omitempty" yaml:"shard_size,omitempty"`                     // 文件片段的大小
+	ParityRatio        *float64         `json:"parity_ratio,omitempty" yaml:"parity_ratio,omitempty"`                 // 奇偶校验片段占比
+	RootPath           *string          `json:"root_path,omitempty" yaml:"root_path,omitempty"`                       // 根路径
+	DownloadPath       *string          `json:"download_path,omitempty" yaml:"download_path,omitempty"`               // 下载路径
+	MaxRetries         *int64           `json:"max_retries,omitempty" yaml:"max_retries,omitempty"`                   // 最大重试次数
+	RetryInterval      *string          `json:"retry_interval,omitempty" yaml:"retry_interval,omitempty"`             // 首次重试的间隔，如 "2s"
+	MaxRetryInterval   *string          `json:"max_retry_interval,omitempty" yaml:"max_retry_interval,omitempty"`     // 重试间隔的上限，如 "5m"
+	LocalStorage       *bool            `json:"local_storage,omitempty" yaml:"local_storage,omitempty"`               // 是否开启本地存储
+	Encryption         *bool            `json:"encryption,omitempty" yaml:"encryption,omitempty"`                     // 上传的文件是否在分片前加密
+	RoutingTableLow    *int64           `json:"routing_table_low,omitempty" yaml:"routing_table_low,omitempty"`       // 路由表中连接的最小节点数量
+	MaxConcurrency     *int64           `json:"max_concurrency,omitempty" yaml:"max_concurrency,omitempty"`           // 同时进行的片段传输总数
+	MaxTaskConcurrency *int64           `json:"max_task_concurrency,omitempty" yaml:"max_task_concurrency,omitempty"` // 单个任务同时进行的片段传输数
+	MaxPeerConcurrency *int64           `json:"max_peer_concurrency,omitempty" yaml:"max_peer_concurrency,omitempty"` // 与单个节点同时进行的片段传输数
+	MaxStatementJobs   *int64           `json:"max_statement_jobs,omitempty" yaml:"max_statement_jobs,omitempty"`     // 同时执行的异步语句任务数
+	UploadRate         *int64           `json:"upload_rate,omitempty" yaml:"upload_rate,omitempty"`                   // 全局上传速率(字节/秒)
+	DownloadRate       *int64           `json:"download_rate,omitempty" yaml:"download_rate,omitempty"`               // 全局下载速率(字节/秒)
+	RateSchedule       []RateRuleConfig `json:"rate_schedule,omitempty" yaml:"rate_schedule,omitempty"`               // 按时刻调整全局速率的规则
+	ScrubRate          *int64           `json:"scrub_rate,omitempty" yaml:"scrub_rate,omitempty"`                     // 巡检本地文件片段的读取速率(字节/秒)
+	ScrubInterval      *string          `json:"scrub_interval,omitempty" yaml:"scrub_interval,omitempty"`             // 两轮巡检的间隔，如 "24h"，"0s" 表示不定期巡检
+	RepairSpare        *int64           `json:"repair_spare,omitempty" yaml:"repair_spare,omitempty"`                 // 重建丢失片段的最小余量
+	RepairInterval     *string          `json:"repair_interval,omitempty" yaml:"repair_interval,omitempty"`           // 两轮检查持有情况的间隔，如 "1h"
+	ACLPolicy          *string          `json:"acl_policy,omitempty" yaml:"acl_policy,omitempty"`                     // 变更共同所有者的签名策略，如 "all"、"any"、"quorum:2"
+}
+
+// RateRuleConfig 是配置文件中一个时间段的全局速率
+type RateRuleConfig struct {
+	Start        string `json:"start" yaml:"start"`                                     // 时间段的开始，如 "09:00"
+	End          string `json:"end" yaml:"end"`                                         // 时间段的结束，如 "18:00"，早于开始时跨越零点
+	UploadRate   int64  `json:"upload_rate,omitempty" yaml:"upload_rate,omitempty"`     // 上传速率(字节/秒)，0 表示不限速
+	DownloadRate int64  `json:"download_rate,omitempty" yaml:"download_rate,omitempty"` // 下载速率(字节/秒)，0 表示不限速
+}
+
+// LoadOptions 从 YAML 或 JSON 配置文件加载选项，并在其后应用 opts
+// 扩展名为 .json 的文件按 JSON 解析，其余按 YAML 解析，未知的配置项视为错误
+func LoadOptions(path string, opts ...Option) (*Options, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := new(OptionsConfig)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(cfg)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(cfg); err != nil && len(bytes.TrimSpace(data)) == 0 {
+			err = nil // 空配置文件使用默认选项
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+	}
+
+	cfgOpts, err := cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewOptions(append(cfgOpts, opts...)...)
+}
+
+// Options 将配置转换为选项列表
+func (cfg *OptionsConfig) Options() ([]Option, error) {
+	var (
+		opts []Option
+		errs ValidationErrors
+	)
+
+	if cfg.StorageMode != nil {
+		mode, err := ParseStorageMode(*cfg.StorageMode)
+		if err != nil {
+			errs = append(errs, &ValidationError{Field: "storageMode", Message: err.Error()})
+		} else {
+			opts = append(opts, WithStorageMode(mode))
+		}
+	}
+	if cfg.RetryInterval != nil {
+		interval, err := time.ParseDuration(*cfg.RetryInterval)
+		if err != nil {
+			errs = append(errs, &ValidationError{Field: "retryInterval", Message: err.Error()})
+		} else {
+			opts = append(opts, WithRetryInterval(interval))
+		}
+	}
+	if cfg.MaxRetryInterval != nil {
+		interval, err := time.ParseDuration(*cfg.MaxRetryInterval)
+		if err != nil {
+			errs = append(errs, &ValidationError{Field: "maxRetryInterval", Message: err.Error()})
+		} else {
+			opts = append(opts, WithMaxRetryInterval(interval))
+		}
+	}
+	if cfg.ScrubInterval != nil {
+		interval, err := time.ParseDuration(*cfg.ScrubInterval)
+		if err != nil {
+			errs = append(errs, &ValidationError{Field: "scrubInterval", Message: err.Error()})
+		} else {
+			opts = append(opts, WithScrubInterval(interval))
+		}
+	}
+	if cfg.RepairInterval != nil {
+		interval, err := time.ParseDuration(*cfg.RepairInterval)
+		if err != nil {
+			errs = append(errs, &ValidationError{Field: "repairInterval", Message: err.Error()})
+		} else {
+			opts = append(opts, WithRepairInterval(interval))
+		}
+	}
+	if cfg.ACLPolicy != nil {
+		policy, err := acl.ParsePolicy(*cfg.ACLPolicy)
+		if err != nil {
+			errs = append(errs, &ValidationError{Field: "aclPolicy", Message: err.Error()})
+		} else {
+			opts = append(opts, WithACLPolicy(policy))
+		}
+	}
+	if cfg.RateSchedule != nil {
+		schedule := make(throttle.Schedule, 0, len(cfg.RateSchedule))
+		for _, rule := range cfg.RateSchedule {
+			start, err := throttle.ParseClock(rule.Start)
+			if err != nil {
+				errs = append(errs, &ValidationError{Field: "rateSchedule", Message: err.Error()})
+				continue
+			}
+			end, err := throttle.ParseClock(rule.End)
+			if err != nil {
+				errs = append(errs, &ValidationError{Field: "rateSchedule", Message: err.Error()})
+				continue
+			}
+			schedule = append(schedule, throttle.Rule{
+				Start:  start,
+				End:    end,
+				Limits: throttle.Limits{Upload: rule.UploadRate, Download: rule.DownloadRate},
+			})
+		}
+		opts = append(opts, WithRateSchedule(schedule))
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	if cfg.DefaultBufSize != nil {
+		opts = append(opts, WithDefaultBufSize(*cfg.DefaultBufSize))
+	}
+	if cfg.MaxBufferSize != nil {
+		opts = append(opts, WithMaxBufferSize(*cfg.MaxBufferSize))
+	}
+	if cfg.MaxSliceSize != nil {
+		opts = append(opts, WithMaxSliceSize(*cfg.MaxSliceSize))
+	}
+	if cfg.MinSliceSize != nil {
+		opts = append(opts, WithMinSliceSize(*cfg.MinSliceSize))
+	}
+	if cfg.DataShards != nil {
+		opts = append(opts, WithDataShards(*cfg.DataShards))
+	}
+	if cfg.ParityShards != nil {
+		opts = append(opts, WithParityShards(*cfg.ParityShards))
+	}
+	if cfg.ShardSize != nil {
+		opts = append(opts, WithShardSize(*cfg.ShardSize))
+	}
+	if cfg.ParityRatio != nil {
+		opts = append(opts, WithParityRatio(*cfg.ParityRatio))
+	}
+	if cfg.RootPath != nil {
+		opts = append(opts, WithRootPath(*cfg.RootPath))
+	}
+	if cfg.DownloadPath != nil {
+		opts = append(opts, WithDownloadPath(*cfg.DownloadPath))
+	}
+	if cfg.MaxRetries != nil {
+		opts = append(opts, WithMaxRetries(*cfg.MaxRetries))
+	}
+	if cfg.LocalStorage != nil {
+		opts = append(opts, WithLocalStorage(*cfg.LocalStorage))
+	}
+	if cfg.Encryption != nil {
+		opts = append(opts, WithEncryption(*cfg.Encryption))
+	}
+	if cfg.RoutingTableLow != nil {
+		opts = append(opts, WithRoutingTableLow(*cfg.RoutingTableLow))
+	}
+	if cfg.MaxConcurrency != nil {
+		opts = append(opts, WithMaxConcurrency(*cfg.MaxConcurrency))
+	}
+	if cfg.MaxTaskConcurrency != nil {
+		opts = append(opts, WithMaxTaskConcurrency(*cfg.MaxTaskConcurrency))
+	}
+	if cfg.MaxPeerConcurrency != nil {
+		opts = append(opts, WithMaxPeerConcurrency(*cfg.MaxPeerConcurrency))
+	}
+	if cfg.MaxStatementJobs != nil {
+		opts = append(opts, WithMaxStatementJobs(*cfg.MaxStatementJobs))
+	}
+	if cfg.UploadRate != nil {
+		opts = append(opts, WithUploadRate(*cfg.UploadRate))
+	}
+	if cfg.DownloadRate != nil {
+		opts = append(opts, WithDownloadRate(*cfg.DownloadRate))
+	}
+	if cfg.ScrubRate != nil {
+		opts = append(opts, WithScrubRate(*cfg.ScrubRate))
+	}
+	if cfg.RepairSpare != nil {
+		opts = append(opts, WithRepairSpare(*cfg.RepairSpare))
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,229 @@
+// Package acl 记录和检查文件资产的访问控制
+// 每个文件资产有一个所有者、若干共同所有者和若干分享授权，身份以 DID 表示。
+// 访问控制的变更是由相关身份签名的操作，按策略验证签名后才生效。
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrDenied 表示身份没有所需的权限
+var ErrDenied = errors.New("没有权限")
+
+// Permission 是一组权限
+type Permission uint8
+
+const (
+	Read     Permission = 1 << iota // 读取(下载)文件资产
+	Write                           // 修改或删除文件资产
+	Transfer                        // 转让文件资产的所有权
+
+	// All 是所有者和共同所有者拥有的全部权限
+	All = Read | Write | Transfer
+)
+
+// permissionNames 是各项权限的名称
+var permissionNames = []struct {
+	perm Permission
+	name string
+}{
+	{Read, "read"},
+	{Write, "write"},
+	{Transfer, "transfer"},
+}
+
+// String 返回以逗号分隔的权限名称
+func (p Permission) String() string {
+	var names []string
+	for _, n := range permissionNames {
+		if p&n.perm != 0 {
+			names = append(names, n.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// ParsePermission 解析以逗号分隔的权限名称，名称不区分大小写
+func ParsePermission(s string) (Permission, error) {
+	var p Permission
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, n := range permissionNames {
+			if strings.EqualFold(n.name, name) {
+				p |= n.perm
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("未知的权限 %q", name)
+		}
+	}
+	return p, nil
+}
+
+// PolicyMode 是变更共同所有者和转让所有权时要求的签名方式
+type PolicyMode int
+
+const (
+	PolicyAll    PolicyMode = iota // 所有者和全部共同所有者都签名
+	PolicyAny                      // 所有者或任意一个共同所有者签名
+	PolicyQuorum                   // 所有者和共同所有者中至少 Quorum 个签名
+)
+
+// Policy 是变更共同所有者和转让所有权时要求的签名策略
+type Policy struct {
+	Mode   PolicyMode
+	Quorum int // PolicyQuorum 要求的签名数量，超过所有者和共同所有者的总数时要求全部签名
+}
+
+// String 返回策略的名称，如 "all"、"any"、"quorum:2"
+func (p Policy) String() string {
+	switch p.Mode {
+	case PolicyAll:
+		return "all"
+	case PolicyAny:
+		return "any"
+	case PolicyQuorum:
+		return "quorum:" + strconv.Itoa(p.Quorum)
+	}
+	return fmt.Sprintf("PolicyMode(%d)", int(p.Mode))
+}
+
+// ParsePolicy 解析策略的名称，名称不区分大小写
+func ParsePolicy(s string) (Policy, error) {
+	name, quorum, hasQuorum := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+	switch {
+	case name == "all" && !hasQuorum:
+		return Policy{Mode: PolicyAll}, nil
+	case name == "any" && !hasQuorum:
+		return Policy{Mode: PolicyAny}, nil
+	case name == "quorum" && hasQuorum:
+		n, err := strconv.Atoi(quorum)
+		if err != nil {
+			return Policy{}, fmt.Errorf("非法的签名数量 %q", quorum)
+		}
+		policy := Policy{Mode: PolicyQuorum, Quorum: n}
+		return policy, policy.Validate()
+	}
+	return Policy{}, fmt.Errorf("未知的签名策略 %q", s)
+}
+
+// Validate 检查策略是否有效
+func (p Policy) Validate() error {
+	switch p.Mode {
+	case PolicyAll, PolicyAny:
+		return nil
+	case PolicyQuorum:
+		if p.Quorum < 1 {
+			return fmt.Errorf("签名数量 %d 不可小于 1", p.Quorum)
+		}
+		return nil
+	}
+	return fmt.Errorf("未知的签名策略 %d", int(p.Mode))
+}
+
+// satisfied 检查 signers 中的签名是否满足策略，controllers 是所有者和共同所有者
+func (p Policy) satisfied(controllers []string, signers map[string]bool) bool {
+	signed := 0
+	for _, did := range controllers {
+		if signers[did] {
+			signed++
+		}
+	}
+
+	switch p.Mode {
+	case PolicyAny:
+		return signed >= 1
+	case PolicyQuorum:
+		if p.Quorum < len(controllers) {
+			return signed >= p.Quorum
+		}
+	}
+	return signed == len(controllers)
+}
+
+// Entry 是文件资产的访问控制
+type Entry struct {
+	AssetID  string                `json:"assetID"`          // 文件资产的唯一标识
+	Owner    string                `json:"owner"`            // 所有者的DID
+	CoOwners []string              `json:"coOwners"`         // 共同所有者的DID
+	Grants   map[string]Permission `json:"grants,omitempty"` // 被分享者的DID -> 授予的权限
+	Version  uint64                `json:"version"`          // 访问控制的版本，每次变更后加一
+}
+
+// NewEntry 创建只有所有者的访问控制
+func NewEntry(assetID, owner string) *Entry {
+	return &Entry{AssetID: assetID, Owner: owner, Grants: make(map[string]Permission)}
+}
+
+// Controllers 返回所有者和共同所有者
+func (e *Entry) Controllers() []string {
+	return append([]string{e.Owner}, e.CoOwners...)
+}
+
+// isController 检查身份是否为所有者或共同所有者
+func (e *Entry) isController(did string) bool {
+	for _, controller := range e.Controllers() {
+		if controller == did {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions 返回身份拥有的权限，所有者和共同所有者拥有全部权限
+func (e *Entry) Permissions(did string) Permission {
+	if did == "" {
+		return 0
+	}
+	if e.isController(did) {
+		return All
+	}
+	return e.Grants[did]
+}
+
+// Check 检查身份是否拥有 perm 中的全部权限
+func (e *Entry) Check(did string, perm Permission) error {
+	if e.Permissions(did)&perm != perm {
+		if did == "" {
+			did = "匿名身份"
+		}
+		return fmt.Errorf("%w: %s 对文件资产 %s 没有 %s 权限", ErrDenied, did, e.AssetID, perm)
+	}
+	return nil
+}
+
+// clone 返回访问控制的副本
+func (e *Entry) clone() *Entry {
+	c := *e
+	c.CoOwners = append([]string(nil), e.CoOwners...)
+	c.Grants = make(map[string]Permission, len(e.Grants))
+	for did, perm := range e.Grants {
+		c.Grants[did] = perm
+	}
+	return &c
+}
+
+// normalize 去除重复的共同所有者和所有者本身，并按顺序排列
+func normalize(owner string, dids []string) []string {
+	seen := map[string]bool{owner: true}
+	var out []string
+	for _, did := range dids {
+		if did == "" || seen[did] {
+			continue
+		}
+		seen[did] = true
+		out = append(out, did)
+	}
+	sort.Strings(out)
+	return out
+}
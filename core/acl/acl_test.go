@@ -0,0 +1,253 @@
+package acl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bpfs/defs/core/identity"
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/sqlites"
+)
+
+// newIdentities 随机生成 n 个身份
+func newIdentities(t *testing.T, n int) []*identity.Identity {
+	t.Helper()
+
+	ids := make([]*identity.Identity, n)
+	for i := range ids {
+		id, err := identity.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+	}
+	return ids
+}
+
+// newManager 创建使用临时数据库的管理器
+func newManager(t *testing.T, policy Policy) *Manager {
+	t.Helper()
+
+	db, err := sqlites.NewSqliteDB(t.TempDir(), sqlite.DbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := sqlite.InitDBTable(db); err != nil {
+		t.Fatal(err)
+	}
+	return NewManager(db, policy)
+}
+
+// apply 由 signers 签名并应用操作
+func apply(m *Manager, action Action, targets []string, perm Permission, signers ...*identity.Identity) (*Entry, error) {
+	entry, err := m.Get("asset")
+	if err != nil {
+		return nil, err
+	}
+	op := NewOp(entry, action, targets, perm)
+	for _, id := range signers {
+		op.Sign(id)
+	}
+	return m.Apply(op)
+}
+
+func TestShareAndCheck(t *testing.T) {
+	ids := newIdentities(t, 3)
+	owner, reader, stranger := ids[0], ids[1], ids[2]
+	m := newManager(t, Policy{Mode: PolicyAll})
+
+	if err := m.Check("asset", stranger.DID(), Read); err != nil {
+		t.Fatalf("没有访问控制的文件资产受到限制: %v", err)
+	}
+	if _, err := m.Create("asset", owner.DID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Check("asset", owner.DID(), All); err != nil {
+		t.Fatalf("所有者没有全部权限: %v", err)
+	}
+	if err := m.Check("asset", reader.DID(), Read); !errors.Is(err, ErrDenied) {
+		t.Fatalf("未授权的身份检查返回 %v", err)
+	}
+
+	// 被分享者不能再分享给其他身份
+	if _, err := apply(m, ActionShare, []string{reader.DID()}, Read, owner); err != nil {
+		t.Fatalf("分享失败: %v", err)
+	}
+	if err := m.Check("asset", reader.DID(), Read); err != nil {
+		t.Fatalf("被分享者没有读取权限: %v", err)
+	}
+	if err := m.Check("asset", reader.DID(), Write); !errors.Is(err, ErrDenied) {
+		t.Fatalf("被分享者获得了写入权限: %v", err)
+	}
+	if _, err := apply(m, ActionShare, []string{stranger.DID()}, Read, reader); !errors.Is(err, ErrDenied) {
+		t.Fatalf("被分享者分享返回 %v", err)
+	}
+
+	// 已生效的操作不能重放
+	entry, _ := m.Get("asset")
+	op := NewOp(entry, ActionRevoke, []string{reader.DID()}, 0)
+	op.Sign(owner)
+	if _, err := m.Apply(op); err != nil {
+		t.Fatalf("撤销失败: %v", err)
+	}
+	if _, err := m.Apply(op); err == nil {
+		t.Fatal("重放的操作生效")
+	}
+	if err := m.Check("asset", reader.DID(), Read); !errors.Is(err, ErrDenied) {
+		t.Fatalf("撤销后检查返回 %v", err)
+	}
+
+	// 篡改的操作签名无效
+	entry, _ = m.Get("asset")
+	op = NewOp(entry, ActionShare, []string{reader.DID()}, Read)
+	op.Sign(owner)
+	op.Targets = []string{stranger.DID()}
+	if _, err := m.Apply(op); err == nil {
+		t.Fatal("篡改的操作生效")
+	}
+
+	// 访问控制保存在数据库中
+	entry, err := NewManager(m.db, m.policy).Get("asset")
+	if err != nil || entry.Owner != owner.DID() || entry.Version != 2 {
+		t.Fatalf("读取的访问控制为 %+v, %v", entry, err)
+	}
+}
+
+func TestCoOwnerPolicy(t *testing.T) {
+	ids := newIdentities(t, 4)
+	owner, a, b, c := ids[0], ids[1], ids[2], ids[3]
+
+	for _, tc := range []struct {
+		policy  Policy
+		signers []*identity.Identity // 有两个共同所有者时变更共同所有者的签名
+		ok      bool
+	}{
+		{Policy{Mode: PolicyAny}, []*identity.Identity{b}, true},
+		{Policy{Mode: PolicyAll}, []*identity.Identity{owner, a}, false},
+		{Policy{Mode: PolicyAll}, []*identity.Identity{owner, a, b}, true},
+		{Policy{Mode: PolicyQuorum, Quorum: 2}, []*identity.Identity{a, c}, false},
+		{Policy{Mode: PolicyQuorum, Quorum: 2}, []*identity.Identity{a, b}, true},
+	} {
+		m := newManager(t, tc.policy)
+		if _, err := m.Create("asset", owner.DID()); err != nil {
+			t.Fatal(err)
+		}
+		// 只有所有者时，任何策略都只需要所有者签名
+		if _, err := apply(m, ActionSetCoOwners, []string{a.DID(), b.DID(), owner.DID()}, 0, owner); err != nil {
+			t.Fatalf("%s: 设置共同所有者失败: %v", tc.policy, err)
+		}
+		if err := m.Check("asset", b.DID(), All); err != nil {
+			t.Fatalf("%s: 共同所有者没有全部权限: %v", tc.policy, err)
+		}
+
+		_, err := apply(m, ActionSetCoOwners, []string{c.DID()}, 0, tc.signers...)
+		if (err == nil) != tc.ok {
+			t.Fatalf("%s: 变更共同所有者返回 %v", tc.policy, err)
+		}
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	ids := newIdentities(t, 4)
+	owner, coOwner, agent, buyer := ids[0], ids[1], ids[2], ids[3]
+	m := newManager(t, Policy{Mode: PolicyAll})
+	if _, err := m.Create("asset", owner.DID()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apply(m, ActionSetCoOwners, []string{coOwner.DID()}, 0, owner); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := apply(m, ActionTransfer, []string{buyer.DID()}, 0, owner); !errors.Is(err, ErrDenied) {
+		t.Fatalf("缺少共同所有者签名时转让返回 %v", err)
+	}
+
+	// 被授予转让权限的身份可以单独转让
+	if _, err := apply(m, ActionShare, []string{agent.DID()}, Transfer, coOwner); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := apply(m, ActionTransfer, []string{buyer.DID()}, 0, agent)
+	if err != nil {
+		t.Fatalf("转让失败: %v", err)
+	}
+	if entry.Owner != buyer.DID() {
+		t.Fatalf("转让后的所有者为 %s", entry.Owner)
+	}
+	if err := m.Check("asset", owner.DID(), Read); !errors.Is(err, ErrDenied) {
+		t.Fatalf("原所有者检查返回 %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	ids := newIdentities(t, 4)
+	owner, coOwner, reader, stranger := ids[0], ids[1], ids[2], ids[3]
+	m := newManager(t, Policy{Mode: PolicyAll})
+	if _, err := m.Create("asset", owner.DID()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apply(m, ActionSetCoOwners, []string{coOwner.DID()}, 0, owner); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apply(m, ActionShare, []string{reader.DID()}, Read, coOwner); err != nil {
+		t.Fatal(err)
+	}
+	want, err := apply(m, ActionRevoke, []string{reader.DID()}, 0, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops, err := m.Ops("asset")
+	if err != nil || len(ops) != 3 {
+		t.Fatalf("读取的操作为 %d 项, %v", len(ops), err)
+	}
+	entry, err := Replay("asset", owner.DID(), ops, m.policy)
+	if err != nil {
+		t.Fatalf("重放失败: %v", err)
+	}
+	if entry.Version != want.Version || entry.Check(reader.DID(), Read) == nil || entry.Check(coOwner.DID(), All) != nil {
+		t.Fatalf("重放得到的访问控制为 %+v", entry)
+	}
+
+	// 所有者不同、缺少操作或操作被篡改时都无法重放
+	if _, err := Replay("asset", stranger.DID(), ops, m.policy); err == nil {
+		t.Fatal("以其他身份为所有者重放成功")
+	}
+	if _, err := Replay("asset", owner.DID(), ops[1:], m.policy); err == nil {
+		t.Fatal("缺少操作时重放成功")
+	}
+	ops[1].Targets = []string{stranger.DID()}
+	if _, err := Replay("asset", owner.DID(), ops, m.policy); err == nil {
+		t.Fatal("篡改的操作重放成功")
+	}
+
+	// 删除访问控制时一并删除操作
+	if err := m.Delete("asset"); err != nil {
+		t.Fatal(err)
+	}
+	if ops, err := m.Ops("asset"); err != nil || len(ops) != 0 {
+		t.Fatalf("删除后读取的操作为 %d 项, %v", len(ops), err)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, s := range []string{"all", "ANY", "quorum:3"} {
+		policy, err := ParsePolicy(s)
+		if err != nil {
+			t.Fatalf("解析 %q 失败: %v", s, err)
+		}
+		if back, _ := ParsePolicy(policy.String()); back != policy {
+			t.Fatalf("%q 解析后为 %v", s, back)
+		}
+	}
+	for _, s := range []string{"", "some", "quorum", "quorum:0", "all:2"} {
+		if _, err := ParsePolicy(s); err == nil {
+			t.Fatalf("解析 %q 成功", s)
+		}
+	}
+
+	perm, err := ParsePermission("read, Transfer")
+	if err != nil || perm != Read|Transfer || perm.String() != "read,transfer" {
+		t.Fatalf("解析权限为 %v, %v", perm, err)
+	}
+}
@@ -0,0 +1,156 @@
+package acl
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/sqlites"
+)
+
+// Manager 在数据库中保存文件资产的访问控制，并按策略应用签名的操作
+// 生效的操作按顺序保存，其他节点由清单中的所有者开始重放操作来验证访问控制
+type Manager struct {
+	db     *sqlites.SqliteDB
+	policy Policy
+
+	mu sync.Mutex // 串行化操作，保证版本检查和保存之间不被其他操作插入
+}
+
+// NewManager 创建使用 db 保存访问控制的管理器
+func NewManager(db *sqlites.SqliteDB, policy Policy) *Manager {
+	return &Manager{db: db, policy: policy}
+}
+
+// Policy 返回变更共同所有者和转让所有权时要求的签名策略
+func (m *Manager) Policy() Policy {
+	return m.policy
+}
+
+// Create 创建文件资产的访问控制，已存在时返回现有的访问控制
+func (m *Manager) Create(assetID, owner string) (*Entry, error) {
+	if owner == "" {
+		return nil, fmt.Errorf("所有者不能为空")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, err := m.get(assetID)
+	if err != nil || entry != nil {
+		return entry, err
+	}
+	entry = NewEntry(assetID, owner)
+	if err := m.save(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Get 返回文件资产的访问控制，不存在时返回空
+func (m *Manager) Get(assetID string) (*Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.get(assetID)
+}
+
+// Check 检查身份对文件资产是否拥有 perm 中的全部权限，没有访问控制的文件资产不受限制
+func (m *Manager) Check(assetID, did string, perm Permission) error {
+	entry, err := m.Get(assetID)
+	if err != nil || entry == nil {
+		return err
+	}
+	return entry.Check(did, perm)
+}
+
+// Apply 验证并应用签名的操作，返回变更后的访问控制
+func (m *Manager) Apply(op *SignedOp) (*Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, err := m.get(op.AssetID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("文件资产 %s 没有访问控制", op.AssetID)
+	}
+
+	next, err := entry.Apply(op, m.policy)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(op)
+	if err != nil {
+		return nil, err
+	}
+	if err := sqlite.InsertACLOpDatabase(m.db, op.AssetID, int64(op.Version), data); err != nil {
+		return nil, err
+	}
+	if err := m.save(next); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// Ops 返回文件资产已生效的签名操作，按版本升序排列
+func (m *Manager) Ops(assetID string) ([]*SignedOp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	records, err := sqlite.SelectACLOpsDatabase(m.db, assetID)
+	if err != nil {
+		return nil, err
+	}
+	ops := make([]*SignedOp, len(records))
+	for i, data := range records {
+		ops[i] = new(SignedOp)
+		if err := json.Unmarshal(data, ops[i]); err != nil {
+			return nil, fmt.Errorf("解析访问控制操作失败: %v", err)
+		}
+	}
+	return ops, nil
+}
+
+// Delete 删除文件资产的访问控制
+func (m *Manager) Delete(assetID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return sqlite.DeleteACLDatabase(m.db, assetID)
+}
+
+// get 从数据库读取访问控制
+func (m *Manager) get(assetID string) (*Entry, error) {
+	record, err := sqlite.SelectACLDatabase(m.db, assetID)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	entry := &Entry{
+		AssetID:  record.AssetID,
+		Owner:    record.Owner,
+		CoOwners: record.CoOwners,
+		Grants:   make(map[string]Permission, len(record.Grants)),
+		Version:  uint64(record.Version),
+	}
+	for did, perm := range record.Grants {
+		entry.Grants[did] = Permission(perm)
+	}
+	return entry, nil
+}
+
+// save 将访问控制写入数据库
+func (m *Manager) save(entry *Entry) error {
+	record := &sqlite.ACLRecord{
+		AssetID:  entry.AssetID,
+		Owner:    entry.Owner,
+		CoOwners: entry.CoOwners,
+		Grants:   make(map[string]int, len(entry.Grants)),
+		Version:  int64(entry.Version),
+	}
+	for did, perm := range entry.Grants {
+		record.Grants[did] = int(perm)
+	}
+	return sqlite.SaveACLDatabase(m.db, record)
+}
@@ -0,0 +1,208 @@
+package acl
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bpfs/defs/core/identity"
+)
+
+// Action 是访问控制的变更
+type Action string
+
+const (
+	ActionShare       Action = "share"         // 授予被分享者权限
+	ActionRevoke      Action = "revoke"        // 撤销被分享者的权限
+	ActionSetCoOwners Action = "set_co_owners" // 替换共同所有者
+	ActionTransfer    Action = "transfer"      // 转让所有权
+)
+
+// signingPrefix 区分访问控制操作的签名与其他用途的签名
+const signingPrefix = "defs acl op\n"
+
+// Op 是一项访问控制的变更，Version 必须等于变更前的版本，防止已生效的操作被重放
+type Op struct {
+	AssetID    string     `json:"assetID"`              // 文件资产的唯一标识
+	Action     Action     `json:"action"`               // 变更
+	Targets    []string   `json:"targets"`              // 被分享者、新的共同所有者或新的所有者的DID
+	Permission Permission `json:"permission,omitempty"` // 授予的权限，仅用于分享
+	Version    uint64     `json:"version"`              // 变更前的版本
+}
+
+// Signature 是一个身份对操作的签名
+type Signature struct {
+	DID       string `json:"did"`
+	Signature []byte `json:"signature"`
+}
+
+// SignedOp 是带有签名的访问控制操作
+type SignedOp struct {
+	Op
+	Signatures []Signature `json:"signatures"`
+}
+
+// NewOp 创建基于 entry 当前版本的操作
+func NewOp(entry *Entry, action Action, targets []string, perm Permission) *SignedOp {
+	return &SignedOp{Op: Op{
+		AssetID:    entry.AssetID,
+		Action:     action,
+		Targets:    targets,
+		Permission: perm,
+		Version:    entry.Version,
+	}}
+}
+
+// signingBytes 返回签名的内容
+func (op *Op) signingBytes() []byte {
+	data, _ := json.Marshal(op) // 只包含字符串、整数和切片，编码不会失败
+	return append([]byte(signingPrefix), data...)
+}
+
+// Sign 使用身份为操作签名，已有该身份的签名时替换
+func (op *SignedOp) Sign(id *identity.Identity) {
+	signature := Signature{DID: id.DID(), Signature: id.Sign(op.signingBytes())}
+	for i := range op.Signatures {
+		if op.Signatures[i].DID == signature.DID {
+			op.Signatures[i] = signature
+			return
+		}
+	}
+	op.Signatures = append(op.Signatures, signature)
+}
+
+// signers 验证全部签名并返回签名的身份，任何签名无效时返回错误
+func (op *SignedOp) signers() (map[string]bool, error) {
+	data := op.signingBytes()
+	signers := make(map[string]bool, len(op.Signatures))
+	for _, signature := range op.Signatures {
+		if !identity.VerifyDID(signature.DID, data, signature.Signature) {
+			return nil, fmt.Errorf("%s 的签名无效", signature.DID)
+		}
+		signers[signature.DID] = true
+	}
+	return signers, nil
+}
+
+// Apply 验证操作的签名和权限，返回变更后的访问控制，entry 本身不变
+// 分享和撤销需要所有者或任意一个共同所有者签名；变更共同所有者需要满足 policy 的签名；
+// 转让所有权需要满足 policy 的签名，或者由被授予转让权限的身份签名。
+func (e *Entry) Apply(op *SignedOp, policy Policy) (*Entry, error) {
+	if op.AssetID != e.AssetID {
+		return nil, fmt.Errorf("操作的文件资产 %s 与 %s 不一致", op.AssetID, e.AssetID)
+	}
+	if op.Version != e.Version {
+		return nil, fmt.Errorf("操作基于版本 %d，当前版本为 %d", op.Version, e.Version)
+	}
+	signers, err := op.signers()
+	if err != nil {
+		return nil, err
+	}
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("%w: 操作没有签名", ErrDenied)
+	}
+
+	controllers := e.Controllers()
+	byController := Policy{Mode: PolicyAny}.satisfied(controllers, signers)
+	byPolicy := policy.satisfied(controllers, signers)
+
+	next := e.clone()
+	switch op.Action {
+	case ActionShare:
+		if !byController {
+			return nil, fmt.Errorf("%w: 分享需要所有者或共同所有者签名", ErrDenied)
+		}
+		if op.Permission == 0 || op.Permission&^All != 0 {
+			return nil, fmt.Errorf("非法的权限 %d", op.Permission)
+		}
+		if len(op.Targets) == 0 {
+			return nil, fmt.Errorf("没有指定被分享者")
+		}
+		for _, did := range op.Targets {
+			if _, err := identity.ParseDID(did); err != nil {
+				return nil, err
+			}
+			next.Grants[did] |= op.Permission
+		}
+
+	case ActionRevoke:
+		if !byController {
+			return nil, fmt.Errorf("%w: 撤销需要所有者或共同所有者签名", ErrDenied)
+		}
+		if len(op.Targets) == 0 {
+			return nil, fmt.Errorf("没有指定被分享者")
+		}
+		for _, did := range op.Targets {
+			if op.Permission == 0 {
+				delete(next.Grants, did)
+				continue
+			}
+			if next.Grants[did] &^= op.Permission; next.Grants[did] == 0 {
+				delete(next.Grants, did)
+			}
+		}
+
+	case ActionSetCoOwners:
+		if !byPolicy {
+			return nil, fmt.Errorf("%w: 变更共同所有者的签名不满足策略 %s", ErrDenied, policy)
+		}
+		for _, did := range op.Targets {
+			if _, err := identity.ParseDID(did); err != nil {
+				return nil, err
+			}
+		}
+		next.CoOwners = normalize(e.Owner, op.Targets)
+
+	case ActionTransfer:
+		if !byPolicy && !e.grantedTransfer(signers) {
+			return nil, fmt.Errorf("%w: 转让的签名不满足策略 %s", ErrDenied, policy)
+		}
+		if len(op.Targets) != 1 {
+			return nil, fmt.Errorf("转让只能指定一个新的所有者")
+		}
+		owner := op.Targets[0]
+		if _, err := identity.ParseDID(owner); err != nil {
+			return nil, err
+		}
+		if owner == e.Owner {
+			return nil, fmt.Errorf("%s 已是所有者", owner)
+		}
+		next.Owner = owner
+		next.CoOwners = normalize(owner, e.CoOwners)
+		delete(next.Grants, owner)
+
+	default:
+		return nil, fmt.Errorf("未知的操作 %q", op.Action)
+	}
+
+	next.Version++
+	return next, nil
+}
+
+// Replay 从 owner 为所有者的访问控制开始，按顺序验证并应用签名的操作，返回最终的访问控制
+// owner 是文件资产最初的所有者，由所有者签名的清单确定；任何操作无效时返回错误，
+// 接收其他节点宣告的访问控制时据此验证，不信任未签名的访问控制
+func Replay(assetID, owner string, ops []*SignedOp, policy Policy) (*Entry, error) {
+	if owner == "" {
+		return nil, fmt.Errorf("所有者不能为空")
+	}
+
+	entry := NewEntry(assetID, owner)
+	for _, op := range ops {
+		next, err := entry.Apply(op, policy)
+		if err != nil {
+			return nil, fmt.Errorf("访问控制的第 %d 项操作无效: %w", entry.Version+1, err)
+		}
+		entry = next
+	}
+	return entry, nil
+}
+
+// grantedTransfer 检查签名的身份中是否有被授予转让权限的被分享者
+func (e *Entry) grantedTransfer(signers map[string]bool) bool {
+	for did := range signers {
+		if e.Grants[did]&Transfer != 0 {
+			return true
+		}
+	}
+	return false
+}
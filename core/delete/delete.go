@@ -1 +1,28 @@
 package delete
+
+import (
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/core/store"
+	"github.com/bpfs/defs/sqlites"
+)
+
+// Remove 删除文件资产在本地保存的所有文件片段及其数据库记录
+func Remove(db *sqlites.SqliteDB, s store.ShardStore, assetID string) error {
+	// 删除本地文件片段
+	if err := s.DeleteAll(assetID); err != nil {
+		return err
+	}
+
+	// 删除文件片段数据
+	if err := sqlite.DeleteSlicesDatabase(db, assetID); err != nil {
+		return err
+	}
+
+	// 删除签名清单
+	if err := sqlite.DeleteManifestDatabase(db, assetID); err != nil {
+		return err
+	}
+
+	// 删除文件数据
+	return sqlite.DeleteFilesDatabase(db, assetID)
+}
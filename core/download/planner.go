@@ -0,0 +1,184 @@
+package download
+
+import (
+	"sort"
+
+	"github.com/bpfs/defs/core/pool"
+)
+
+// Fetch 描述一次从节点获取文件片段的计划
+type Fetch struct {
+	Index  int    // 文件片段的索引
+	PeerID string // 获取片段的节点
+}
+
+// candidate 是尚未获取的文件片段
+type candidate struct {
+	index  int      // 文件片段的索引
+	parity bool     // 是否为奇偶校验片段
+	peers  []string // 尚未失败的持有节点
+	peer   string   // 正在获取片段的节点
+}
+
+// Planner 根据下载任务中各片段的持有节点，决定从哪些节点获取哪些文件片段
+// 只获取恢复文件所需的最少片段：数据片段优先于奇偶校验片段以免解码，
+// 同类片段中选择正在传输最少、失败最少的节点以分散负载；
+// 节点失败时，该片段改由其他持有节点获取，数据片段都不可用时再获取奇偶校验片段
+// Planner 不是并发安全的，由调用方串行使用
+type Planner struct {
+	dataPieces int                // 恢复文件所需的片段数量
+	verified   int                // 已获取并通过校验的片段数量
+	pending    []*candidate       // 等待获取的片段，数据片段在前，按索引排序
+	inflight   map[int]*candidate // 正在获取的片段
+	load       map[string]int     // 节点 -> 正在获取的片段数量
+	failures   map[string]int     // 节点 -> 获取失败的次数
+}
+
+// NewPlanner 根据下载任务创建获取计划，任务中已完成的片段计为已获取
+// exclude 中的节点(通常为本节点)不会被选择
+func NewPlanner(task *pool.DownloadTask, exclude ...string) *Planner {
+	task.Mu.RLock()
+	defer task.Mu.RUnlock()
+
+	p := &Planner{
+		dataPieces: task.DataPieces,
+		inflight:   make(map[int]*candidate),
+		load:       make(map[string]int),
+		failures:   make(map[string]int),
+	}
+
+	excluded := make(map[string]bool, len(exclude))
+	for _, peerID := range exclude {
+		excluded[peerID] = true
+	}
+
+	for index, info := range task.PieceInfo {
+		if index >= 0 && index < task.TotalPieces && task.Progress.IsSet(index) {
+			p.verified++
+			continue
+		}
+
+		c := &candidate{index: index, parity: info.RSCodes}
+		seen := make(map[string]bool, len(info.PeerID))
+		for _, peerID := range info.PeerID {
+			if peerID == "" || excluded[peerID] || seen[peerID] {
+				continue
+			}
+			seen[peerID] = true
+			c.peers = append(c.peers, peerID)
+		}
+		if len(c.peers) > 0 {
+			p.pending = append(p.pending, c)
+		}
+	}
+	sort.Slice(p.pending, func(i, j int) bool {
+		return p.pending[i].less(p.pending[j])
+	})
+
+	return p
+}
+
+// less 比较片段的获取顺序，数据片段在前，同类片段按索引排序
+func (c *candidate) less(other *candidate) bool {
+	if c.parity != other.parity {
+		return !c.parity
+	}
+	return c.index < other.index
+}
+
+// Next 返回下一次获取的计划
+// 已获取和正在获取的片段足以恢复文件，或没有可获取的片段时返回 false
+func (p *Planner) Next() (Fetch, bool) {
+	if p.verified+len(p.inflight) >= p.dataPieces || len(p.pending) == 0 {
+		return Fetch{}, false
+	}
+
+	// 只在同一类片段中选择，避免为了分散负载而获取奇偶校验片段
+	parity := p.pending[0].parity
+	best, bestPeer := -1, ""
+	for i, c := range p.pending {
+		if c.parity != parity {
+			break
+		}
+		peerID := p.pickPeer(c)
+		if best < 0 || p.busier(bestPeer, peerID) {
+			best, bestPeer = i, peerID
+		}
+	}
+
+	c := p.pending[best]
+	p.pending = append(p.pending[:best], p.pending[best+1:]...)
+	c.peer = bestPeer
+	p.inflight[c.index] = c
+	p.load[bestPeer]++
+
+	return Fetch{Index: c.index, PeerID: bestPeer}, true
+}
+
+// pickPeer 返回片段的持有节点中正在传输最少、失败最少的节点
+func (p *Planner) pickPeer(c *candidate) string {
+	best := c.peers[0]
+	for _, peerID := range c.peers[1:] {
+		if p.load[peerID] < p.load[best] ||
+			(p.load[peerID] == p.load[best] && p.failures[peerID] < p.failures[best]) {
+			best = peerID
+		}
+	}
+	return best
+}
+
+// busier 返回节点 peer 是否比节点 other 更繁忙，相同时保持片段原有的顺序
+func (p *Planner) busier(peer, other string) bool {
+	if p.load[peer] != p.load[other] {
+		return p.load[peer] > p.load[other]
+	}
+	return p.failures[peer] > p.failures[other]
+}
+
+// Succeed 记录文件片段已获取并通过校验，返回已获取的片段是否足以恢复文件
+func (p *Planner) Succeed(index int) bool {
+	if c, ok := p.inflight[index]; ok {
+		delete(p.inflight, index)
+		p.load[c.peer]--
+	}
+	p.verified++
+
+	return p.Done()
+}
+
+// Fail 记录从节点获取文件片段失败，该节点此后较少被选择，片段改由其他持有节点获取
+func (p *Planner) Fail(index int) {
+	c, ok := p.inflight[index]
+	if !ok {
+		return
+	}
+	delete(p.inflight, index)
+	p.load[c.peer]--
+	p.failures[c.peer]++
+
+	for i, peerID := range c.peers {
+		if peerID == c.peer {
+			c.peers = append(c.peers[:i], c.peers[i+1:]...)
+			break
+		}
+	}
+	c.peer = ""
+	if len(c.peers) == 0 {
+		return
+	}
+
+	i := sort.Search(len(p.pending), func(i int) bool { return c.less(p.pending[i]) })
+	p.pending = append(p.pending, nil)
+	copy(p.pending[i+1:], p.pending[i:])
+	p.pending[i] = c
+}
+
+// Done 返回已获取的片段是否足以恢复文件
+func (p *Planner) Done() bool {
+	return p.verified >= p.dataPieces
+}
+
+// Inflight 返回正在获取的片段数量
+func (p *Planner) Inflight() int {
+	return len(p.inflight)
+}
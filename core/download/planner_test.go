@@ -0,0 +1,149 @@
+package download
+
+import (
+	"testing"
+
+	"github.com/bpfs/defs/core/pool"
+)
+
+// newTestTask 创建 4 个数据片段和 2 个奇偶校验片段的下载任务，peers 为各片段的持有节点
+func newTestTask(peers map[int][]string) *pool.DownloadTask {
+	task := &pool.DownloadTask{
+		TotalPieces: 6,
+		DataPieces:  4,
+		Progress:    *pool.NewBitSet(6),
+		PieceInfo:   make(map[int]*pool.DownloadPieceInfo),
+	}
+	for index := 0; index < task.TotalPieces; index++ {
+		task.PieceInfo[index] = &pool.DownloadPieceInfo{
+			PeerID:  peers[index],
+			RSCodes: index >= task.DataPieces,
+		}
+	}
+	return task
+}
+
+// drain 取出计划中所有可以同时进行的获取
+func drain(p *Planner) []Fetch {
+	var fetches []Fetch
+	for {
+		f, ok := p.Next()
+		if !ok {
+			return fetches
+		}
+		fetches = append(fetches, f)
+	}
+}
+
+func TestPlannerPrefersDataShards(t *testing.T) {
+	all := []string{"a", "b", "c"}
+	task := newTestTask(map[int][]string{0: all, 1: all, 2: all, 3: all, 4: all, 5: all})
+	p := NewPlanner(task)
+
+	fetches := drain(p)
+	if len(fetches) != 4 {
+		t.Fatalf("计划获取 %d 个片段, 期望 4 个", len(fetches))
+	}
+	load := make(map[string]int)
+	for _, f := range fetches {
+		if f.Index >= 4 {
+			t.Fatalf("数据片段可用时计划获取奇偶校验片段 %d", f.Index)
+		}
+		load[f.PeerID]++
+	}
+	// 4 个片段分散到 3 个节点
+	for peerID, n := range load {
+		if n > 2 {
+			t.Fatalf("节点 %s 分配了 %d 个片段", peerID, n)
+		}
+	}
+
+	for i, f := range fetches {
+		if done := p.Succeed(f.Index); done != (i == len(fetches)-1) {
+			t.Fatalf("第 %d 个片段完成后 Done 为 %v", i+1, done)
+		}
+	}
+	if _, ok := p.Next(); ok {
+		t.Fatal("片段足够后仍有获取计划")
+	}
+}
+
+func TestPlannerFallsBack(t *testing.T) {
+	task := newTestTask(map[int][]string{
+		0: {"a"},
+		1: {"x", "b"},
+		2: {"x"},
+		3: {"a"},
+		4: {"b"},
+		5: {"c"},
+	})
+	p := NewPlanner(task, "self")
+
+	fetches := drain(p)
+	if len(fetches) != 4 {
+		t.Fatalf("计划获取 %d 个片段", len(fetches))
+	}
+	peerOf := make(map[int]string)
+	for _, f := range fetches {
+		peerOf[f.Index] = f.PeerID
+	}
+
+	// 节点 x 不可用：片段 1 改由节点 b 获取，片段 2 只能由奇偶校验片段补足
+	for _, index := range []int{1, 2} {
+		if peerOf[index] == "x" {
+			p.Fail(index)
+		} else {
+			p.Succeed(index)
+		}
+	}
+	next := drain(p)
+	for _, f := range next {
+		if f.PeerID == "x" {
+			t.Fatalf("失败的节点 x 再次被选择获取片段 %d", f.Index)
+		}
+		if f.Index == 1 && f.PeerID != "b" {
+			t.Fatalf("片段 1 由节点 %s 获取", f.PeerID)
+		}
+	}
+	if peerOf[2] == "x" {
+		var parity bool
+		for _, f := range next {
+			parity = parity || f.Index >= 4
+		}
+		if !parity {
+			t.Fatalf("数据片段 2 不可用时未计划奇偶校验片段, 计划为 %v", next)
+		}
+	}
+}
+
+func TestPlannerSkipsCompletedPieces(t *testing.T) {
+	all := []string{"a", "self"}
+	task := newTestTask(map[int][]string{0: all, 1: all, 2: all, 3: all, 4: all, 5: all})
+	task.Progress.Set(0)
+	task.Progress.Set(2)
+	p := NewPlanner(task, "self")
+
+	fetches := drain(p)
+	if len(fetches) != 2 || fetches[0].Index != 1 || fetches[1].Index != 3 {
+		t.Fatalf("计划为 %v, 期望获取片段 1 和 3", fetches)
+	}
+	for _, f := range fetches {
+		if f.PeerID != "a" {
+			t.Fatalf("从节点 %s 获取片段", f.PeerID)
+		}
+	}
+
+	// 所有持有节点都失败后没有可获取的片段
+	p.Fail(1)
+	p.Fail(3)
+	for {
+		f, ok := p.Next()
+		if !ok {
+			break
+		}
+		p.Fail(f.Index)
+	}
+	if p.Inflight() != 0 || p.Done() {
+		t.Fatalf("节点全部失败后 Inflight=%d Done=%v", p.Inflight(), p.Done())
+	}
+}
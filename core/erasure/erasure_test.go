@@ -1,56 +1,160 @@
 package erasure
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
 	"testing"
-
-	"github.com/sirupsen/logrus"
 )
 
-func TestXxx(t *testing.T) {
-	New("../合约 - 比特币.pdf", 3)
-	// New("../合约 - 比特币.pdf", 0)
-	// New("../合约 - 比特币.pdf", 5)
-	// New("../lantern-installer.dmg")
-}
+func TestEncodeReconstruct(t *testing.T) {
+	data := make([]byte, 50000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	shards, manifest, err := Encode(bytes.NewReader(data), Plan{DataShards: 5, ParityShards: 3, BlockSize: 4096})
+	if err != nil {
+		t.Fatalf("编码失败: %v", err)
+	}
+	if len(shards) != 8 || manifest.Size != int64(len(data)) {
+		t.Fatalf("编码得到 %d 个片段, 文件大小 %d", len(shards), manifest.Size)
+	}
+	for i, shard := range shards {
+		if shard.Index != i || shard.Parity != (i >= 5) || shard.Size != manifest.ShardSize || shard.Hash != manifest.ShardHashes[i] {
+			t.Fatalf("片段 %d 的描述为 %+v", i, shard)
+		}
+	}
 
-func TestYyy(t *testing.T) {
-	fi, err := ReadFile("../合约 - 比特币.pdf")
+	// 丢弃三个片段并打乱顺序后仍能恢复
+	rest := []Shard{shards[7], shards[1], shards[5], shards[3], shards[6]}
+	r, err := Reconstruct(rest, manifest)
+	if err != nil {
+		t.Fatalf("恢复失败: %v", err)
+	}
+	got, err := io.ReadAll(r)
 	if err != nil {
-		logrus.Printf("%v", err.Error())
-		return
-	}
-
-	logrus.Printf("Name\t%v", fi.name)
-	logrus.Printf("Size\t%v", fi.size)
-	// logrus.Printf("Mode\t%v", fi.Mode)
-	logrus.Printf("ModTime\t%v", fi.modTime)
-	// logrus.Printf("IsDir\t%v", fi.IsDir)
-	// logrus.Printf("Sys\t%v", fi.Sys)
-	logrus.Printf("Data\t%v", len(fi.data))
-	logrus.Printf("Hash\t%s", fi.hash)
-
-	for _, v := range fi.SubFileInfo {
-		logrus.Printf("\n")
-		logrus.Printf("==>\tsize\t%v", v.size)
-		logrus.Printf("==>\tdata\t%v", len(v.data))
-		logrus.Printf("==>\thash\t%v", v.hash)
-		logrus.Printf("==>\tmod\t%v", v.mod)
-	}
-
-	// fi2, err := ReadFile("../123.dmg")
-	// if err != nil {
-	// 	logrus.Printf("%v", err.Error())
-	// 	return
-	// }
-	// logrus.Printf("\n")
-	// logrus.Printf("Name\t%v", fi2.name)
-	// logrus.Printf("Size\t%v", fi2.size)
-	// logrus.Printf("ModTime\t%v", fi2.modTime)
-	// logrus.Printf("Data\t%v", len(fi2.data))
-	// logrus.Printf("Hash\t%s", fi2.hash)
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("恢复的内容与原文件不一致")
+	}
 
+	if _, err := Reconstruct(rest[:4], manifest); err == nil {
+		t.Fatal("片段不足时恢复成功")
+	}
+}
+
+func TestEncodeInvalidPlan(t *testing.T) {
+	if _, _, err := Encode(bytes.NewReader([]byte("defs")), Plan{DataShards: 0, ParityShards: 2}); err == nil {
+		t.Fatal("数据片段为 0 时编码成功")
+	}
+	if _, _, err := Encode(bytes.NewReader(nil), Plan{DataShards: 4, ParityShards: 2}); err == nil {
+		t.Fatal("编码空内容成功")
+	}
+	if _, err := Reconstruct(nil, Manifest{DataShards: 4, ParityShards: 2, BlockSize: 1024, Size: 10}); err == nil {
+		t.Fatal("片段哈希值缺失时恢复成功")
+	}
 }
 
 func TestAbcs(t *testing.T) {
 	Abcs()
 }
+
+func TestReconstructReportsCorruptShards(t *testing.T) {
+	data := make([]byte, 30000)
+	rand.New(rand.NewSource(2)).Read(data)
+	shards, manifest, err := Encode(bytes.NewReader(data), Plan{DataShards: 4, ParityShards: 3, BlockSize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 翻转片段 1 中的一位，并截断片段 4；片段 3 缺失
+	flipped := append([]byte(nil), shards[1].Data...)
+	flipped[500] ^= 0x40
+	given := []Shard{shards[0], {Index: 1, Data: flipped}, shards[2], {Index: 4, Data: shards[4].Data[:10]}, shards[5], shards[6]}
+
+	r, report, err := ReconstructReport(given, manifest)
+	if err != nil {
+		t.Fatalf("恢复失败: %v", err)
+	}
+	got, _ := io.ReadAll(r)
+	if !bytes.Equal(got, data) {
+		t.Fatal("存在损坏的片段时恢复的内容不一致")
+	}
+	if fmt.Sprint(report.Bad) != "[1 4]" || fmt.Sprint(report.Missing) != "[3]" {
+		t.Fatalf("检查结果为 Bad=%v Missing=%v", report.Bad, report.Missing)
+	}
+
+	// 再损坏一个片段后无法恢复，但仍报告损坏的片段
+	given[0] = Shard{Index: 0, Data: flipped}
+	if _, report, err := ReconstructReport(given, manifest); err == nil || fmt.Sprint(report.Unavailable()) != "[0 1 3 4]" {
+		t.Fatalf("片段不足时返回 %v, 检查结果 %+v", err, report)
+	}
+}
+
+func TestCheckShard(t *testing.T) {
+	data := make([]byte, 20000)
+	rand.New(rand.NewSource(3)).Read(data)
+	shards, manifest, err := Encode(bytes.NewReader(data), Plan{DataShards: 3, ParityShards: 2, BlockSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := append([]byte(nil), shards[2].Data...)
+	flipped[100] ^= 0x01
+	cases := []struct {
+		index int
+		data  []byte
+		ok    bool
+	}{
+		{2, shards[2].Data, true},
+		{2, flipped, false},
+		{1, shards[2].Data, false},
+		{3, shards[3].Data[:10], false},
+		{3, append(append([]byte(nil), shards[3].Data...), 0), false},
+	}
+	for i, c := range cases {
+		ok, err := CheckShard(bytes.NewReader(c.data), c.index, manifest)
+		if err != nil || ok != c.ok {
+			t.Fatalf("第 %d 项检查结果为 %v, %v", i, ok, err)
+		}
+	}
+
+	if _, err := CheckShard(bytes.NewReader(shards[0].Data), 5, manifest); err == nil {
+		t.Fatal("索引超出范围时应返回错误")
+	}
+}
+
+func TestRepair(t *testing.T) {
+	data := make([]byte, 30000)
+	rand.New(rand.NewSource(3)).Read(data)
+	shards, manifest, err := Encode(bytes.NewReader(data), Plan{DataShards: 4, ParityShards: 2, BlockSize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range [][]int{{1}, {0, 3}, {5}, {2, 4}} {
+		var given []Shard
+		for _, shard := range shards {
+			if shard.Index != want[0] && shard.Index != want[len(want)-1] {
+				given = append(given, shard)
+			}
+		}
+		repaired, _, err := Repair(given, manifest, want)
+		if err != nil {
+			t.Fatalf("重建片段 %v 失败: %v", want, err)
+		}
+		if len(repaired) != len(want) {
+			t.Fatalf("重建了 %d 个片段, 期望 %d 个", len(repaired), len(want))
+		}
+		for _, shard := range repaired {
+			if !bytes.Equal(shard.Data, shards[shard.Index].Data) || shard.Hash != shards[shard.Index].Hash {
+				t.Fatalf("重建的片段 %d 与原片段不一致", shard.Index)
+			}
+		}
+	}
+
+	if _, _, err := Repair(shards[3:], manifest, []int{0}); err == nil {
+		t.Fatal("片段不足时重建成功")
+	}
+}
@@ -0,0 +1,180 @@
+package erasure
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Report 描述根据清单检查片段的结果
+type Report struct {
+	Bad     []int // 内容与清单中的大小或哈希值不符的片段索引
+	Missing []int // 未提供的片段索引
+}
+
+// Unavailable 返回缺失和损坏的片段索引，按升序排列
+func (r *Report) Unavailable() []int {
+	indexes := append(append([]int(nil), r.Bad...), r.Missing...)
+	sort.Ints(indexes)
+	return indexes
+}
+
+// Check 根据 manifest 逐个检查片段的大小和哈希值
+// 返回按索引排列的片段内容，缺失或损坏的片段为 nil
+func Check(shards []Shard, manifest Manifest) ([][]byte, *Report, error) {
+	if err := manifest.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	data := make([][]byte, manifest.DataShards+manifest.ParityShards)
+	bad := make(map[int]bool)
+	for _, shard := range shards {
+		if len(shard.Data) == 0 {
+			continue
+		}
+		if shard.Index < 0 || shard.Index >= len(data) {
+			return nil, nil, fmt.Errorf("文件片段的索引 %d 超出范围", shard.Index)
+		}
+		if data[shard.Index] != nil {
+			continue
+		}
+		if int64(len(shard.Data)) != manifest.ShardSize || hashShard(shard.Data) != manifest.ShardHashes[shard.Index] {
+			bad[shard.Index] = true
+			continue
+		}
+		data[shard.Index] = shard.Data
+		delete(bad, shard.Index)
+	}
+
+	report := new(Report)
+	for i, shard := range data {
+		switch {
+		case shard != nil:
+		case bad[i]:
+			report.Bad = append(report.Bad, i)
+		default:
+			report.Missing = append(report.Missing, i)
+		}
+	}
+
+	return data, report, nil
+}
+
+// CheckShard 流式读取索引为 index 的片段，根据 manifest 检查其大小和哈希值，内容不符时返回 false
+// 清单无效、索引超出范围或读取失败时返回错误
+func CheckShard(r io.Reader, index int, manifest Manifest) (bool, error) {
+	if err := manifest.Validate(); err != nil {
+		return false, err
+	}
+	if index < 0 || index >= manifest.DataShards+manifest.ParityShards {
+		return false, fmt.Errorf("文件片段的索引 %d 超出范围", index)
+	}
+
+	hash := sha256.New()
+	// 多读一个字节，以便发现超出清单大小的片段
+	n, err := io.Copy(hash, io.LimitReader(r, manifest.ShardSize+1))
+	if err != nil {
+		return false, err
+	}
+	return n == manifest.ShardSize && hex.EncodeToString(hash.Sum(nil)) == manifest.ShardHashes[index], nil
+}
+
+// Repair 根据 manifest 重新生成 indexes 指定的片段，用于替换缺失或损坏的片段
+// 只重建需要的数据片段，需要奇偶校验片段时才重建全部缺失的片段；
+// 返回的片段已通过清单中哈希值的检查
+func Repair(shards []Shard, manifest Manifest, indexes []int) ([]Shard, *Report, error) {
+	data, report, err := Check(shards, manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+	enc, err := NewStreamEncoder(manifest.DataShards, manifest.ParityShards, manifest.BlockSize)
+	if err != nil {
+		return nil, report, err
+	}
+
+	total := len(data)
+	wanted := make(map[int]bool, len(indexes))
+	required := make([]bool, total)
+	parity := false
+	for _, index := range indexes {
+		if index < 0 || index >= total {
+			return nil, report, fmt.Errorf("文件片段的索引 %d 超出范围", index)
+		}
+		if data[index] != nil {
+			continue
+		}
+		wanted[index] = true
+		if index < manifest.DataShards {
+			required[index] = true
+		} else {
+			parity = true
+		}
+	}
+	if total-len(report.Bad)-len(report.Missing) < manifest.DataShards {
+		return nil, report, fmt.Errorf("可用的文件片段 %d 个，至少需要 %d 个", total-len(report.Bad)-len(report.Missing), manifest.DataShards)
+	}
+
+	repaired := make(map[int][]byte, len(wanted))
+	for index := range wanted {
+		repaired[index] = make([]byte, 0, manifest.ShardSize)
+	}
+
+	// 按条带重建，每个条带中的块在各片段中的位置相同
+	blocks := make([][]byte, total)
+	stripe := int64(manifest.DataShards * enc.blockSize)
+	var offset int64
+	for remaining := manifest.Size; remaining > 0; {
+		block := int64(enc.blockSize)
+		if remaining < stripe {
+			block = enc.lastBlock(remaining)
+		}
+
+		for i, shard := range data {
+			if shard == nil {
+				blocks[i] = nil
+				continue
+			}
+			blocks[i] = shard[offset : offset+block]
+		}
+		if parity {
+			err = enc.rs.Reconstruct(blocks)
+		} else {
+			err = enc.rs.ReconstructSome(blocks, required)
+		}
+		if err != nil {
+			return nil, report, fmt.Errorf("重建文件片段失败: %v", err)
+		}
+		for index := range wanted {
+			repaired[index] = append(repaired[index], blocks[index]...)
+		}
+
+		offset += block
+		remaining -= block * int64(manifest.DataShards)
+	}
+
+	out := make([]Shard, 0, len(repaired))
+	for index, shard := range repaired {
+		hash := hashShard(shard)
+		if hash != manifest.ShardHashes[index] {
+			return nil, report, fmt.Errorf("重建的文件片段 %d 与清单不符", index)
+		}
+		out = append(out, Shard{
+			Index:  index,
+			Size:   int64(len(shard)),
+			Hash:   hash,
+			Parity: index >= manifest.DataShards,
+			Data:   shard,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Index < out[j].Index })
+
+	return out, report, nil
+}
+
+// hashShard 计算片段内容的哈希值
+func hashShard(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,217 @@
+package erasure
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/bpfs/defs/reedsolomon"
+)
+
+// DefaultBlockSize 是条带中每个块的默认大小
+const DefaultBlockSize = 1 << 20
+
+// StreamEncoder 按条带流式地编码和解码文件，内存占用取决于条带大小而不是文件大小
+// 文件按 dataShards*blockSize 字节划分为条带，条带中的第 i 个块依次追加到第 i 个数据片段，
+// 由条带的数据块计算的奇偶校验块追加到对应的奇偶校验片段；
+// 最后一个不完整的条带按剩余大小均分为较小的块，不足的部分以零填充
+type StreamEncoder struct {
+	dataShards   int
+	parityShards int
+	blockSize    int
+	enc          reedsolomon.StreamEncoder // 编码奇偶校验片段
+	rs           reedsolomon.Encoder       // 按条带重建缺失的片段
+}
+
+// NewStreamEncoder 创建流式编码器，blockSize 不大于 0 时使用 DefaultBlockSize
+func NewStreamEncoder(dataShards, parityShards, blockSize int) (*StreamEncoder, error) {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+
+	enc, err := reedsolomon.NewStream(dataShards, parityShards, reedsolomon.WithStreamBlockSize(blockSize))
+	if err != nil {
+		return nil, fmt.Errorf("创建编码器失败: %v", err)
+	}
+	rs, err := reedsolomon.New(dataShards, parityShards)
+	if err != nil {
+		return nil, fmt.Errorf("创建编码器失败: %v", err)
+	}
+
+	return &StreamEncoder{
+		dataShards:   dataShards,
+		parityShards: parityShards,
+		blockSize:    blockSize,
+		enc:          enc,
+		rs:           rs,
+	}, nil
+}
+
+// EncodeResult 描述流式编码的结果
+type EncodeResult struct {
+	Size        int64    // 原始文件的大小
+	Hash        string   // 原始文件内容的哈希值
+	ShardSize   int64    // 每个片段的大小
+	ShardHashes []string // 各片段内容的哈希值，数据片段在前
+}
+
+// ShardSize 返回大小为 size 的文件编码后每个片段的大小
+func (e *StreamEncoder) ShardSize(size int64) int64 {
+	stripe := int64(e.dataShards * e.blockSize)
+	full, rest := size/stripe, size%stripe
+	return full*int64(e.blockSize) + e.lastBlock(rest)
+}
+
+// lastBlock 返回最后一个不完整条带中每个块的大小
+func (e *StreamEncoder) lastBlock(rest int64) int64 {
+	return (rest + int64(e.dataShards) - 1) / int64(e.dataShards)
+}
+
+// Encode 按条带读取 r，将数据片段和奇偶校验片段直接写入 shards，同时计算文件和各片段的哈希值
+// shards 的长度必须等于数据片段与奇偶校验片段的数量之和
+func (e *StreamEncoder) Encode(r io.Reader, shards []io.Writer) (*EncodeResult, error) {
+	total := e.dataShards + e.parityShards
+	if len(shards) != total {
+		return nil, fmt.Errorf("文件片段的数量 %d 与预期的 %d 不符", len(shards), total)
+	}
+
+	fileHash := sha256.New()
+	hashers := make([]hash.Hash, total)
+	writers := make([]io.Writer, total)
+	for i, w := range shards {
+		hashers[i] = sha256.New()
+		writers[i] = io.MultiWriter(w, hashers[i])
+	}
+
+	result := new(EncodeResult)
+	stripe := make([]byte, e.dataShards*e.blockSize)
+	data := make([]io.Reader, e.dataShards)
+	for {
+		n, err := io.ReadFull(r, stripe)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("读取文件失败: %v", err)
+		}
+		last := err == io.ErrUnexpectedEOF
+
+		fileHash.Write(stripe[:n])
+		result.Size += int64(n)
+
+		block := e.blockSize
+		if last {
+			// 最后一个条带按剩余大小均分，不足的部分以零填充
+			block = int(e.lastBlock(int64(n)))
+			for i := n; i < e.dataShards*block; i++ {
+				stripe[i] = 0
+			}
+		}
+
+		for i := 0; i < e.dataShards; i++ {
+			b := stripe[i*block : (i+1)*block]
+			if _, err := writers[i].Write(b); err != nil {
+				return nil, fmt.Errorf("写入文件片段 %d 失败: %v", i, err)
+			}
+			data[i] = bytes.NewReader(b)
+		}
+		if e.parityShards > 0 {
+			if err := e.enc.Encode(data, writers[e.dataShards:]); err != nil {
+				return nil, fmt.Errorf("编码奇偶校验片段失败: %v", err)
+			}
+		}
+		result.ShardSize += int64(block)
+
+		if last {
+			break
+		}
+	}
+	if result.Size == 0 {
+		return nil, fmt.Errorf("文件内容为空")
+	}
+
+	result.Hash = hex.EncodeToString(fileHash.Sum(nil))
+	result.ShardHashes = make([]string, total)
+	for i, h := range hashers {
+		result.ShardHashes[i] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	return result, nil
+}
+
+// Decode 按条带读取 shards 中的片段，恢复大小为 size 的文件内容并写入 w
+// 缺失的片段以 nil 表示，可用的片段不少于数据片段的数量时才能恢复；
+// 只在条带的数据块缺失时重建，每次只保留一个条带的数据
+func (e *StreamEncoder) Decode(w io.Writer, shards []io.Reader, size int64) error {
+	total := e.dataShards + e.parityShards
+	if len(shards) != total {
+		return fmt.Errorf("文件片段的数量 %d 与预期的 %d 不符", len(shards), total)
+	}
+
+	var available int
+	missingData := false
+	for i, r := range shards {
+		if r != nil {
+			available++
+		} else if i < e.dataShards {
+			missingData = true
+		}
+	}
+	if available < e.dataShards {
+		return fmt.Errorf("可用的文件片段 %d 个，至少需要 %d 个", available, e.dataShards)
+	}
+
+	buffers := make([][]byte, total)
+	for i := range buffers {
+		buffers[i] = make([]byte, e.blockSize)
+	}
+	blocks := make([][]byte, total)
+	// 缺失的奇偶校验片段也会被检查是否需要重建，长度与片段总数相同
+	required := make([]bool, total)
+	for i := 0; i < e.dataShards; i++ {
+		required[i] = shards[i] == nil
+	}
+
+	stripe := int64(e.dataShards * e.blockSize)
+	for remaining := size; remaining > 0; {
+		block := e.blockSize
+		if remaining < stripe {
+			block = int(e.lastBlock(remaining))
+		}
+
+		for i, r := range shards {
+			if r == nil {
+				// 长度为 0 的块视为缺失，重建时使用其容量
+				blocks[i] = buffers[i][:0]
+				continue
+			}
+			blocks[i] = buffers[i][:block]
+			if _, err := io.ReadFull(r, blocks[i]); err != nil {
+				return fmt.Errorf("读取文件片段 %d 失败: %v", i, err)
+			}
+		}
+
+		// 只重建缺失的数据块，奇偶校验块不需要
+		if missingData {
+			if err := e.rs.ReconstructSome(blocks, required); err != nil {
+				return fmt.Errorf("恢复文件片段失败: %v", err)
+			}
+		}
+
+		for i := 0; i < e.dataShards && remaining > 0; i++ {
+			n := int64(block)
+			if n > remaining {
+				n = remaining
+			}
+			if _, err := w.Write(blocks[i][:n]); err != nil {
+				return fmt.Errorf("写入文件失败: %v", err)
+			}
+			remaining -= n
+		}
+	}
+
+	return nil
+}
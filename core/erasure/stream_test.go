@@ -0,0 +1,100 @@
+package erasure
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// encodeStream 流式编码 data，返回编码结果和各片段的内容
+func encodeStream(t *testing.T, e *StreamEncoder, data []byte) (*EncodeResult, []*bytes.Buffer) {
+	t.Helper()
+
+	buffers := make([]*bytes.Buffer, e.dataShards+e.parityShards)
+	writers := make([]io.Writer, len(buffers))
+	for i := range buffers {
+		buffers[i] = new(bytes.Buffer)
+		writers[i] = buffers[i]
+	}
+
+	// 只通过 io.Reader 读取，编码器无法预先得知文件大小
+	result, err := e.Encode(io.LimitReader(bytes.NewReader(data), int64(len(data))), writers)
+	if err != nil {
+		t.Fatalf("编码失败: %v", err)
+	}
+	return result, buffers
+}
+
+func TestStreamEncodeDecode(t *testing.T) {
+	e, err := NewStreamEncoder(4, 2, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for _, size := range []int{1, 100, 4096, 4097, 3*4096 + 777} {
+		data := make([]byte, size)
+		rng.Read(data)
+
+		result, buffers := encodeStream(t, e, data)
+		sum := sha256.Sum256(data)
+		if result.Size != int64(size) || result.Hash != hex.EncodeToString(sum[:]) {
+			t.Fatalf("大小 %d 的编码结果为 %d/%s", size, result.Size, result.Hash)
+		}
+		if result.ShardSize != e.ShardSize(int64(size)) {
+			t.Fatalf("大小 %d 的片段大小为 %d, ShardSize 返回 %d", size, result.ShardSize, e.ShardSize(int64(size)))
+		}
+		for i, buf := range buffers {
+			if int64(buf.Len()) != result.ShardSize {
+				t.Fatalf("片段 %d 的大小为 %d", i, buf.Len())
+			}
+			sum := sha256.Sum256(buf.Bytes())
+			if result.ShardHashes[i] != hex.EncodeToString(sum[:]) {
+				t.Fatalf("片段 %d 的哈希值不匹配", i)
+			}
+		}
+
+		// 完整的片段，以及缺失两个片段(含数据片段)时都能恢复
+		for _, lost := range [][]int{nil, {0}, {1, 3}, {2, 5}, {4, 5}} {
+			readers := make([]io.Reader, len(buffers))
+			for i, buf := range buffers {
+				readers[i] = bytes.NewReader(buf.Bytes())
+			}
+			for _, i := range lost {
+				readers[i] = nil
+			}
+
+			var out bytes.Buffer
+			if err := e.Decode(&out, readers, int64(size)); err != nil {
+				t.Fatalf("大小 %d 缺失片段 %v 时解码失败: %v", size, lost, err)
+			}
+			if !bytes.Equal(out.Bytes(), data) {
+				t.Fatalf("大小 %d 缺失片段 %v 时解码的内容不一致", size, lost)
+			}
+		}
+	}
+}
+
+func TestStreamDecodeTooFewShards(t *testing.T) {
+	e, err := NewStreamEncoder(4, 2, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("defs"), 3000)
+	_, buffers := encodeStream(t, e, data)
+
+	readers := make([]io.Reader, len(buffers))
+	for i := 3; i < len(buffers); i++ {
+		readers[i] = bytes.NewReader(buffers[i].Bytes())
+	}
+	if err := e.Decode(io.Discard, readers, int64(len(data))); err == nil {
+		t.Fatal("缺失三个片段时解码成功")
+	}
+
+	if _, err := e.Encode(bytes.NewReader(nil), make([]io.Writer, 6)); err == nil {
+		t.Fatal("编码空文件成功")
+	}
+}
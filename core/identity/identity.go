@@ -0,0 +1,234 @@
+// Package identity 提供节点和用户的身份密钥
+// 身份使用 Ed25519 密钥对，可以随机生成，也可以由种子经 HKDF-SHA256 派生；
+// 公钥以 did:key 形式的 DID 表示，作为文件资产的所有者、共同所有者和被分享者的标识。
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// KeyType 是身份密钥的类型
+type KeyType string
+
+const (
+	// Ed25519 是默认的身份密钥类型
+	Ed25519 KeyType = "ed25519"
+)
+
+const (
+	// MinSeedSize 是派生身份密钥的种子的最小长度
+	MinSeedSize = 16
+
+	didPrefix = "did:key:z" // did:key 使用 base58btc 编码(前缀 z)
+)
+
+// hkdfSalt 区分身份密钥与其他由相同种子派生的密钥
+var hkdfSalt = []byte("defs identity")
+
+// deriveSalt 区分由身份的私钥派生的密钥与身份密钥
+var deriveSalt = []byte("defs derived key")
+
+// ed25519Codec 是 Ed25519 公钥的 multicodec 前缀
+var ed25519Codec = []byte{0xed, 0x01}
+
+// Identity 是一个身份的密钥对
+type Identity struct {
+	privateKey ed25519.PrivateKey
+}
+
+// Generate 随机生成一个身份
+func Generate() (*Identity, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成身份密钥失败: %v", err)
+	}
+	return &Identity{privateKey: privateKey}, nil
+}
+
+// FromSeed 由种子派生身份，相同的种子总是得到相同的身份
+// 种子的全部内容经 HKDF-SHA256 派生为 Ed25519 的私钥种子
+func FromSeed(seed []byte) (*Identity, error) {
+	if len(seed) < MinSeedSize {
+		return nil, fmt.Errorf("种子的长度 %d 不可小于 %d 字节", len(seed), MinSeedSize)
+	}
+
+	key := make([]byte, ed25519.SeedSize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, seed, hkdfSalt, []byte(Ed25519)), key); err != nil {
+		return nil, fmt.Errorf("派生身份密钥失败: %v", err)
+	}
+	return &Identity{privateKey: ed25519.NewKeyFromSeed(key)}, nil
+}
+
+// Type 返回身份密钥的类型
+func (id *Identity) Type() KeyType {
+	return Ed25519
+}
+
+// PublicKey 返回身份的公钥
+func (id *Identity) PublicKey() ed25519.PublicKey {
+	return id.privateKey.Public().(ed25519.PublicKey)
+}
+
+// DID 返回身份的 DID
+func (id *Identity) DID() string {
+	return DID(id.PublicKey())
+}
+
+// Sign 使用身份的私钥为数据签名
+func (id *Identity) Sign(data []byte) []byte {
+	return ed25519.Sign(id.privateKey, data)
+}
+
+// DeriveKey 由身份的私钥种子经 HKDF-SHA256 派生 size 字节的密钥，相同的身份和 info 总是得到相同的密钥
+func (id *Identity) DeriveKey(info []byte, size int) ([]byte, error) {
+	key := make([]byte, size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, id.privateKey.Seed(), deriveSalt, info), key); err != nil {
+		return nil, fmt.Errorf("派生密钥失败: %v", err)
+	}
+	return key, nil
+}
+
+// Verify 使用公钥验证数据的签名
+func Verify(publicKey ed25519.PublicKey, data, signature []byte) bool {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(publicKey, data, signature)
+}
+
+// VerifyDID 使用 DID 表示的公钥验证数据的签名
+func VerifyDID(did string, data, signature []byte) bool {
+	publicKey, err := ParseDID(did)
+	if err != nil {
+		return false
+	}
+	return Verify(publicKey, data, signature)
+}
+
+// DID 返回公钥的 did:key 表示
+func DID(publicKey ed25519.PublicKey) string {
+	return didPrefix + encodeBase58(append(append([]byte(nil), ed25519Codec...), publicKey...))
+}
+
+// ParseDID 解析 did:key 表示的公钥
+func ParseDID(did string) (ed25519.PublicKey, error) {
+	if !strings.HasPrefix(did, didPrefix) {
+		return nil, fmt.Errorf("不支持的 DID %q", did)
+	}
+	data, err := decodeBase58(did[len(didPrefix):])
+	if err != nil {
+		return nil, fmt.Errorf("非法的 DID %q: %v", did, err)
+	}
+	if len(data) != len(ed25519Codec)+ed25519.PublicKeySize || data[0] != ed25519Codec[0] || data[1] != ed25519Codec[1] {
+		return nil, fmt.Errorf("DID %q 不是 Ed25519 公钥", did)
+	}
+	return ed25519.PublicKey(data[len(ed25519Codec):]), nil
+}
+
+// MarshalPrivateKey 将身份的私钥编码为 PKCS#8 格式的 PEM
+func (id *Identity) MarshalPrivateKey() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(id.privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("编码私钥失败: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParsePrivateKey 解析 PKCS#8 格式的 PEM 编码的私钥
+func ParsePrivateKey(data []byte) (*Identity, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("非法的私钥格式")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析私钥失败: %v", err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("不支持的私钥类型 %T", key)
+	}
+	return &Identity{privateKey: privateKey}, nil
+}
+
+// MarshalPublicKey 将公钥编码为 PKIX 格式的 PEM
+func MarshalPublicKey(publicKey ed25519.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("编码公钥失败: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// ParsePublicKey 解析 PKIX 格式的 PEM 编码的公钥
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("非法的公钥格式")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析公钥失败: %v", err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("不支持的公钥类型 %T", key)
+	}
+	return publicKey, nil
+}
+
+// base58Alphabet 是 bitcoin 使用的 base58 字母表
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// encodeBase58 将数据编码为 base58，前导的零字节编码为 '1'
+func encodeBase58(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// decodeBase58 解码 base58 编码的数据
+func decodeBase58(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		i := strings.IndexRune(base58Alphabet, c)
+		if i < 0 {
+			return nil, fmt.Errorf("非法的 base58 字符 %q", c)
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(i)))
+	}
+
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
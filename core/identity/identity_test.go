@@ -0,0 +1,246 @@
+package identity
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFromSeed(t *testing.T) {
+	seed := []byte("a seed of at least sixteen bytes")
+	a, err := FromSeed(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := FromSeed(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.DID() != b.DID() {
+		t.Fatal("相同的种子派生了不同的身份")
+	}
+
+	// 种子的每个字节都参与派生
+	other := append([]byte(nil), seed...)
+	other[len(other)-1] ^= 1
+	if c, _ := FromSeed(other); c.DID() == a.DID() {
+		t.Fatal("不同的种子派生了相同的身份")
+	}
+
+	if _, err := FromSeed(seed[:MinSeedSize-1]); err == nil {
+		t.Fatal("过短的种子派生成功")
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	id, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("Hello, World!")
+	signature := id.Sign(data)
+
+	if !Verify(id.PublicKey(), data, signature) || !VerifyDID(id.DID(), data, signature) {
+		t.Fatal("签名验证失败")
+	}
+	if Verify(id.PublicKey(), []byte("Hello, World?"), signature) {
+		t.Fatal("篡改的数据验证成功")
+	}
+
+	publicKey, err := ParseDID(id.DID())
+	if err != nil || !bytes.Equal(publicKey, id.PublicKey()) {
+		t.Fatalf("解析 DID 失败: %v", err)
+	}
+	for _, did := range []string{"did:web:example.com", "did:key:z0OIl", "did:key:z6Mk"} {
+		if _, err := ParseDID(did); err == nil {
+			t.Fatalf("解析非法的 DID %q 成功", did)
+		}
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	id, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := id.DeriveKey([]byte("info"), 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := id.DeriveKey([]byte("info"), 32); !bytes.Equal(a, b) {
+		t.Fatal("相同的 info 派生了不同的密钥")
+	}
+	if c, _ := id.DeriveKey([]byte("other"), 32); bytes.Equal(a, c) {
+		t.Fatal("不同的 info 派生了相同的密钥")
+	}
+	other, _ := Generate()
+	if d, _ := other.DeriveKey([]byte("info"), 32); bytes.Equal(a, d) {
+		t.Fatal("不同的身份派生了相同的密钥")
+	}
+}
+
+func TestMarshalKeys(t *testing.T) {
+	id, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := id.MarshalPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParsePrivateKey(data)
+	if err != nil || parsed.DID() != id.DID() {
+		t.Fatalf("私钥编码后不一致: %v", err)
+	}
+
+	data, err = MarshalPublicKey(id.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := ParsePublicKey(data)
+	if err != nil || !bytes.Equal(publicKey, id.PublicKey()) {
+		t.Fatalf("公钥编码后不一致: %v", err)
+	}
+}
+
+func TestKeystore(t *testing.T) {
+	ks, err := OpenKeystore(filepath.Join(t.TempDir(), "keystore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.scryptN = 1 << 10 // 加快测试
+
+	id, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	passphrase := []byte("correct horse battery staple")
+	if err := ks.Save("node", id, passphrase); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := ks.Load("node", passphrase)
+	if err != nil || loaded.DID() != id.DID() {
+		t.Fatalf("读取身份失败: %v", err)
+	}
+	if _, err := ks.Load("node", []byte("wrong")); !errors.Is(err, ErrPassphrase) {
+		t.Fatalf("使用错误的口令读取返回 %v", err)
+	}
+	if _, err := ks.Load("missing", passphrase); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("读取不存在的身份返回 %v", err)
+	}
+	if err := ks.Save("../escape", id, passphrase); err == nil {
+		t.Fatal("使用非法的名称保存成功")
+	}
+
+	if names, err := ks.List(); err != nil || len(names) != 1 || names[0] != "node" {
+		t.Fatalf("身份列表为 %v, %v", names, err)
+	}
+	if err := ks.Delete("node"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Delete("node"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("删除不存在的身份返回 %v", err)
+	}
+}
+
+func TestKeystoreRejectsUnsafeParams(t *testing.T) {
+	ks, err := OpenKeystore(filepath.Join(t.TempDir(), "keystore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.scryptN = 1 << 10 // 加快测试
+
+	id, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	passphrase := []byte("passphrase")
+	if err := ks.Save("node", id, passphrase); err != nil {
+		t.Fatal(err)
+	}
+	path, err := ks.path("node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 密钥文件中被篡改的参数在派生密钥前被拒绝
+	tampers := map[string]func(*kdf){
+		"NTooLarge":    func(p *kdf) { p.N = 1 << 30 },
+		"NNotPowerOf2": func(p *kdf) { p.N = 1000 },
+		"RTooLarge":    func(p *kdf) { p.R = 1 << 20 },
+		"PTooLarge":    func(p *kdf) { p.P = 1 << 20 },
+		"EmptySalt":    func(p *kdf) { p.Salt = nil },
+	}
+	for name, tamper := range tampers {
+		t.Run(name, func(t *testing.T) {
+			var file keyFile
+			if err := json.Unmarshal(data, &file); err != nil {
+				t.Fatal(err)
+			}
+			tamper(&file.KDF)
+			tampered, err := json.Marshal(&file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tampered, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ks.Load("node", passphrase); err == nil {
+				t.Fatal("使用不安全的参数读取身份成功")
+			}
+		})
+	}
+}
+
+func TestWrapUnwrapKey(t *testing.T) {
+	id, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// DID 转换得到的 X25519 公钥与身份私钥派生的公钥一致
+	publicKey, err := x25519PublicKey(id.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := id.x25519PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(publicKey.Bytes(), privateKey.PublicKey().Bytes()) {
+		t.Fatal("转换的 X25519 公钥与私钥不匹配")
+	}
+
+	key := bytes.Repeat([]byte{7}, 32)
+	wrapped, err := WrapKey(id.DID(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unwrapped, err := id.UnwrapKey(wrapped)
+	if err != nil || !bytes.Equal(unwrapped, key) {
+		t.Fatalf("解开的数据密钥不一致: %v", err)
+	}
+
+	other, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.UnwrapKey(wrapped); err == nil {
+		t.Fatal("其他身份解开数据密钥成功")
+	}
+	wrapped[len(wrapped)-1] ^= 1
+	if _, err := id.UnwrapKey(wrapped); err == nil {
+		t.Fatal("篡改的数据密钥解开成功")
+	}
+	if _, err := WrapKey("did:web:example.com", key); err == nil {
+		t.Fatal("为非法的 DID 封装数据密钥成功")
+	}
+}
@@ -0,0 +1,254 @@
+package identity
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bpfs/defs/paths"
+	"golang.org/x/crypto/scrypt"
+)
+
+/**
+密钥库
+每个身份保存为密钥库目录下的一个 JSON 文件，文件名为身份的名称。
+私钥种子使用 AES-256-GCM 加密，密钥由口令经 scrypt 派生，DID 作为附加数据参与认证。
+*/
+
+var (
+	// ErrNotFound 表示密钥库中不存在该身份
+	ErrNotFound = errors.New("身份不存在")
+	// ErrPassphrase 表示口令错误或密钥文件被篡改
+	ErrPassphrase = errors.New("口令错误或密钥文件已损坏")
+)
+
+const (
+	keyFileVersion = 1
+	keyFileExt     = ".json"
+
+	// scrypt 的默认参数，派生一次约需 100ms
+	defaultScryptN = 1 << 15
+	scryptR        = 8
+	scryptP        = 1
+
+	// 读取密钥文件时接受的 scrypt 参数上限，防止篡改的参数耗尽内存或计算资源
+	maxScryptN = 1 << 20
+	maxScryptR = 32
+	maxScryptP = 16
+)
+
+// nameRegexp 限制身份的名称，防止名称被解释为路径
+var nameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// keyFile 是密钥库中保存的身份
+type keyFile struct {
+	Version    int     `json:"version"`    // 文件格式的版本
+	Type       KeyType `json:"type"`       // 身份密钥的类型
+	DID        string  `json:"did"`        // 身份的 DID
+	KDF        kdf     `json:"kdf"`        // 口令派生密钥的参数
+	Nonce      []byte  `json:"nonce"`      // AES-GCM 的 nonce
+	Ciphertext []byte  `json:"ciphertext"` // 加密的私钥种子
+}
+
+// kdf 描述 scrypt 的参数
+type kdf struct {
+	Name string `json:"name"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt []byte `json:"salt"`
+}
+
+// Keystore 是以口令加密保存身份的目录
+type Keystore struct {
+	dir     string
+	scryptN int
+}
+
+// OpenKeystore 打开目录 dir 下的密钥库，dir 为空时使用根路径下的密钥库目录
+func OpenKeystore(dir string) (*Keystore, error) {
+	if dir == "" {
+		dir = paths.Keystore
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建密钥库目录失败: %v", err)
+	}
+	return &Keystore{dir: dir, scryptN: defaultScryptN}, nil
+}
+
+// path 返回身份的密钥文件路径
+func (ks *Keystore) path(name string) (string, error) {
+	if !nameRegexp.MatchString(name) {
+		return "", fmt.Errorf("非法的身份名称 %q", name)
+	}
+	return filepath.Join(ks.dir, name+keyFileExt), nil
+}
+
+// check 检查 scrypt 的参数是否在安全范围内
+func (params kdf) check() error {
+	if params.N <= 1 || params.N > maxScryptN || params.N&(params.N-1) != 0 {
+		return fmt.Errorf("scrypt 参数 N=%d 必须是不大于 %d 的 2 的幂", params.N, maxScryptN)
+	}
+	if params.R <= 0 || params.R > maxScryptR {
+		return fmt.Errorf("scrypt 参数 r=%d 超出范围 [1, %d]", params.R, maxScryptR)
+	}
+	if params.P <= 0 || params.P > maxScryptP {
+		return fmt.Errorf("scrypt 参数 p=%d 超出范围 [1, %d]", params.P, maxScryptP)
+	}
+	if len(params.Salt) == 0 {
+		return fmt.Errorf("scrypt 的盐值为空")
+	}
+	return nil
+}
+
+// deriveKey 由口令派生加密私钥种子的密钥
+func deriveKey(passphrase []byte, params kdf) (cipher.AEAD, error) {
+	if err := params.check(); err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key(passphrase, params.Salt, params.N, params.R, params.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("派生密钥失败: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("创建cipher.Block失败: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Save 以口令加密身份并保存为 name，已存在的同名身份被覆盖
+func (ks *Keystore) Save(name string, id *Identity, passphrase []byte) error {
+	path, err := ks.path(name)
+	if err != nil {
+		return err
+	}
+
+	params := kdf{Name: "scrypt", N: ks.scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 32)}
+	if _, err := io.ReadFull(rand.Reader, params.Salt); err != nil {
+		return fmt.Errorf("生成盐值失败: %v", err)
+	}
+	gcm, err := deriveKey(passphrase, params)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("生成nonce失败: %v", err)
+	}
+
+	did := id.DID()
+	data, err := json.MarshalIndent(&keyFile{
+		Version:    keyFileVersion,
+		Type:       id.Type(),
+		DID:        did,
+		KDF:        params,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, id.privateKey.Seed(), []byte(did)),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// 先写入临时文件再替换，避免中断时留下不完整的密钥文件
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("保存密钥文件失败: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("保存密钥文件失败: %v", err)
+	}
+	return nil
+}
+
+// Load 使用口令解密并读取名为 name 的身份
+func (ks *Keystore) Load(name string, passphrase []byte) (*Identity, error) {
+	path, err := ks.path(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥文件失败: %v", err)
+	}
+
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析密钥文件失败: %v", err)
+	}
+	if file.Version != keyFileVersion {
+		return nil, fmt.Errorf("不支持的密钥文件版本 %d", file.Version)
+	}
+	if file.Type != Ed25519 {
+		return nil, fmt.Errorf("不支持的身份密钥类型 %q", file.Type)
+	}
+	if file.KDF.Name != "scrypt" {
+		return nil, fmt.Errorf("不支持的密钥派生函数 %q", file.KDF.Name)
+	}
+
+	gcm, err := deriveKey(passphrase, file.KDF)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Nonce) != gcm.NonceSize() {
+		return nil, ErrPassphrase
+	}
+	seed, err := gcm.Open(nil, file.Nonce, file.Ciphertext, []byte(file.DID))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, ErrPassphrase
+	}
+
+	id := &Identity{privateKey: ed25519.NewKeyFromSeed(seed)}
+	if id.DID() != file.DID {
+		return nil, ErrPassphrase
+	}
+	return id, nil
+}
+
+// List 返回密钥库中所有身份的名称，按名称排序
+func (ks *Keystore) List() ([]string, error) {
+	entries, err := os.ReadDir(ks.dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥库目录失败: %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), keyFileExt)
+		if entry.IsDir() || name == entry.Name() || !nameRegexp.MatchString(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delete 从密钥库中删除名为 name 的身份
+func (ks *Keystore) Delete(name string) error {
+	path, err := ks.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("删除密钥文件失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package identity
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+/**
+数据密钥的封装
+DID 中的 Ed25519 公钥按 RFC 7748 的双有理映射转换为 X25519 公钥，封装时生成临时的 X25519 密钥对，
+与接收者协商的共享密钥经 HKDF-SHA256 派生为 AES-256-GCM 密钥后加密数据密钥，
+只有持有 DID 对应私钥的身份才能解开。
+
+格式: 临时公钥(32 字节) | nonce(12 字节) | 密文
+*/
+
+// wrapInfo 绑定封装的用途，防止派生的密钥被用于其他协议
+var wrapInfo = []byte("defs data key")
+
+// curve25519P 是 Curve25519 的素数 2^255 - 19
+var curve25519P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// x25519PublicKey 将 Ed25519 公钥转换为 X25519 公钥，u = (1 + y) / (1 - y) mod p
+func x25519PublicKey(publicKey ed25519.PublicKey) (*ecdh.PublicKey, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("Ed25519 公钥的长度 %d 无效", len(publicKey))
+	}
+
+	// 公钥是小端序的 y 坐标，最高位为 x 的符号
+	le := append([]byte(nil), publicKey...)
+	le[31] &= 0x7f
+	y := new(big.Int).SetBytes(reverse(le))
+	if y.Cmp(curve25519P) >= 0 {
+		return nil, fmt.Errorf("Ed25519 公钥无效")
+	}
+
+	denominator := new(big.Int).Sub(big.NewInt(1), y)
+	denominator.Mod(denominator, curve25519P)
+	if denominator.Sign() == 0 {
+		return nil, fmt.Errorf("Ed25519 公钥无效")
+	}
+	u := new(big.Int).Add(big.NewInt(1), y)
+	u.Mul(u, denominator.ModInverse(denominator, curve25519P))
+	u.Mod(u, curve25519P)
+
+	out := make([]byte, 32)
+	u.FillBytes(out)
+	return ecdh.X25519().NewPublicKey(reverse(out))
+}
+
+// x25519PrivateKey 返回与身份对应的 X25519 私钥，即 Ed25519 私钥种子的 SHA-512 哈希值的前 32 字节
+func (id *Identity) x25519PrivateKey() (*ecdh.PrivateKey, error) {
+	h := sha512.Sum512(id.privateKey.Seed())
+	return ecdh.X25519().NewPrivateKey(h[:32])
+}
+
+// reverse 返回字节顺序相反的副本
+func reverse(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
+
+// wrapAEAD 由共享密钥派生封装使用的 AES-256-GCM，临时公钥和接收者公钥作为盐值
+func wrapAEAD(shared, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte(nil), ephemeral...), recipient...)
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, wrapInfo), key); err != nil {
+		return nil, fmt.Errorf("派生封装密钥失败: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// WrapKey 为 DID 表示的接收者封装数据密钥
+func WrapKey(did string, key []byte) ([]byte, error) {
+	publicKey, err := ParseDID(did)
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := x25519PublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成临时密钥失败: %v", err)
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, fmt.Errorf("协商共享密钥失败: %v", err)
+	}
+	gcm, err := wrapAEAD(shared, ephemeral.PublicKey().Bytes(), recipient.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("生成 nonce 失败: %v", err)
+	}
+	wrapped := append(ephemeral.PublicKey().Bytes(), nonce...)
+	return gcm.Seal(wrapped, nonce, key, nil), nil
+}
+
+// UnwrapKey 使用身份的私钥解开 WrapKey 为其封装的数据密钥
+func (id *Identity) UnwrapKey(wrapped []byte) ([]byte, error) {
+	privateKey, err := id.x25519PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < 32+12 {
+		return nil, fmt.Errorf("封装的数据密钥格式不正确")
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(wrapped[:32])
+	if err != nil {
+		return nil, fmt.Errorf("封装的数据密钥格式不正确")
+	}
+	shared, err := privateKey.ECDH(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("协商共享密钥失败: %v", err)
+	}
+	gcm, err := wrapAEAD(shared, wrapped[:32], privateKey.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := gcm.Open(nil, wrapped[32:32+gcm.NonceSize()], wrapped[32+gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("解开数据密钥失败: %v", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,190 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// magic 是清单二进制编码的文件头
+const magic = "DEFSMF"
+
+// MarshalBinary 将清单编码为规范的二进制格式
+// 字段按固定顺序排列，整数使用变长编码，字符串和字节切片带有长度前缀
+func (m *Manifest) MarshalBinary() ([]byte, error) {
+	var w binaryWriter
+	w.buf.WriteString(magic)
+	w.uvarint(uint64(m.Version))
+	w.string(m.Name)
+	w.varint(m.Size)
+	w.varint(m.ModTime.UnixNano())
+	w.string(m.ContentHash)
+	w.string(m.StorageMode)
+	w.uvarint(uint64(m.DataShards))
+	w.uvarint(uint64(m.ParityShards))
+	w.uvarint(uint64(m.BlockSize))
+	w.varint(m.ShardSize)
+	w.uvarint(uint64(len(m.Shards)))
+	for _, shard := range m.Shards {
+		w.string(shard.Hash)
+		if shard.Parity {
+			w.buf.WriteByte(1)
+		} else {
+			w.buf.WriteByte(0)
+		}
+	}
+	w.string(m.Encryption)
+	w.uvarint(uint64(m.ChunkSize))
+	w.uvarint(uint64(len(m.Keys)))
+	for _, grant := range m.Keys {
+		w.string(grant.Recipient)
+		w.bytes(grant.Key)
+	}
+	if m.Controlled {
+		w.buf.WriteByte(1)
+	} else {
+		w.buf.WriteByte(0)
+	}
+	w.string(m.Owner)
+	w.bytes(m.Signature)
+
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalBinary 解析 MarshalBinary 编码的清单
+func (m *Manifest) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return fmt.Errorf("不是有效的清单")
+	}
+	r := &binaryReader{r: bytes.NewReader(data[len(magic):])}
+
+	out := Manifest{Version: int(r.uvarint())}
+	if r.err == nil && (out.Version < minVersion || out.Version > Version) {
+		return fmt.Errorf("不支持的清单版本 %d", out.Version)
+	}
+	out.Name = r.string()
+	out.Size = r.varint()
+	out.ModTime = time.Unix(0, r.varint()).UTC()
+	out.ContentHash = r.string()
+	out.StorageMode = r.string()
+	out.DataShards = int(r.uvarint())
+	out.ParityShards = int(r.uvarint())
+	out.BlockSize = int(r.uvarint())
+	out.ShardSize = r.varint()
+
+	count := r.uvarint()
+	if r.err == nil && count > uint64(r.r.Len()) {
+		return fmt.Errorf("清单中的片段数量 %d 无效", count)
+	}
+	if count > 0 {
+		out.Shards = make([]ShardInfo, count)
+	}
+	for i := range out.Shards {
+		out.Shards[i].Hash = r.string()
+		out.Shards[i].Parity = r.byte() == 1
+	}
+	out.Encryption = r.string()
+	out.ChunkSize = int(r.uvarint())
+	count = r.uvarint()
+	if r.err == nil && count > uint64(r.r.Len()) {
+		return fmt.Errorf("清单中的数据密钥数量 %d 无效", count)
+	}
+	if count > 0 {
+		out.Keys = make([]KeyGrant, count)
+	}
+	for i := range out.Keys {
+		out.Keys[i].Recipient = r.string()
+		out.Keys[i].Key = r.bytes()
+	}
+	out.Controlled = r.byte() == 1
+	out.Owner = r.string()
+	out.Signature = r.bytes()
+
+	if r.err != nil {
+		return fmt.Errorf("解析清单失败: %v", r.err)
+	}
+	if r.r.Len() != 0 {
+		return fmt.Errorf("清单末尾有 %d 个多余的字节", r.r.Len())
+	}
+
+	*m = out
+	return nil
+}
+
+// binaryWriter 按清单的二进制格式写入字段
+type binaryWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *binaryWriter) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (w *binaryWriter) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func (w *binaryWriter) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.buf.Write(b)
+}
+
+func (w *binaryWriter) string(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+// binaryReader 按清单的二进制格式读取字段，出错后的读取返回零值
+type binaryReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(r.r)
+	r.err = err
+	return v
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(r.r)
+	r.err = err
+	return v
+}
+
+func (r *binaryReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	b, err := r.r.ReadByte()
+	r.err = err
+	return b
+}
+
+func (r *binaryReader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil || n == 0 {
+		return nil
+	}
+	if n > uint64(r.r.Len()) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := make([]byte, n)
+	_, r.err = io.ReadFull(r.r, b)
+	return b
+}
+
+func (r *binaryReader) string() string {
+	return string(r.bytes())
+}
@@ -0,0 +1,137 @@
+package manifest
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bpfs/defs/core/erasure"
+	"github.com/bpfs/defs/core/identity"
+	"github.com/bpfs/defs/util/crypto"
+)
+
+// grant 返回接收者的数据密钥在清单中的位置，不存在时返回 -1
+func (m *Manifest) grant(recipient string) int {
+	for i, grant := range m.Keys {
+		if grant.Recipient == recipient {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddRecipient 为 DID 表示的接收者封装数据密钥并加入清单，已有的接收者更新其数据密钥
+// 清单需要由所有者重新签名，唯一标识不变
+func (m *Manifest) AddRecipient(did string, dataKey []byte) error {
+	if m.Encryption == "" {
+		return fmt.Errorf("清单未加密")
+	}
+
+	wrapped, err := identity.WrapKey(did, dataKey)
+	if err != nil {
+		return err
+	}
+
+	grant := KeyGrant{Recipient: did, Key: wrapped}
+	if i := m.grant(did); i >= 0 {
+		m.Keys[i] = grant
+	} else {
+		m.Keys = append(m.Keys, grant)
+	}
+	return nil
+}
+
+// RemoveRecipient 从清单中移除接收者的数据密钥，不能移除所有者
+// 接收者此前获得的数据密钥仍然有效，撤销访问需要重新加密文件
+func (m *Manifest) RemoveRecipient(did string) error {
+	if did == m.Owner {
+		return fmt.Errorf("不能移除所有者的数据密钥")
+	}
+
+	i := m.grant(did)
+	if i < 0 {
+		return fmt.Errorf("清单中没有该接收者的数据密钥")
+	}
+	m.Keys = append(m.Keys[:i], m.Keys[i+1:]...)
+	return nil
+}
+
+// DataKey 使用接收者的身份解开清单中为其封装的数据密钥
+func (m *Manifest) DataKey(id *identity.Identity) ([]byte, error) {
+	if m.Encryption == "" {
+		return nil, fmt.Errorf("清单未加密")
+	}
+
+	i := m.grant(id.DID())
+	if i < 0 {
+		return nil, fmt.Errorf("清单中没有为该接收者封装的数据密钥")
+	}
+	return id.UnwrapKey(m.Keys[i].Key)
+}
+
+// sealedModTime 是加密的清单中记录的修改时间
+var sealedModTime = time.Unix(0, 0).UTC()
+
+// Seal 使用数据密钥分块加密 r 的内容，再按 plan 流式编码后写入 shards，dataKey 为空时生成随机的数据密钥
+// 数据密钥为所有者和 recipients 封装后保存在清单中，清单由所有者签名；
+// 片段中只有密文，清单中的哈希值和大小都来自密文，不记录文件名称和修改时间
+func Seal(r io.Reader, shards []io.Writer, storageMode string, plan erasure.Plan, dataKey []byte, owner *identity.Identity, recipients ...string) (*Manifest, error) {
+	if dataKey == nil {
+		var err error
+		if dataKey, err = crypto.NewDataKey(); err != nil {
+			return nil, err
+		}
+	}
+	encrypted, err := crypto.NewEncryptReader(r, dataKey, crypto.DefaultChunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := erasure.EncodeTo(encrypted, shards, plan)
+	if err != nil {
+		return nil, err
+	}
+
+	m := New("", sealedModTime, storageMode, encoded)
+	m.Encryption = EncryptionAESGCM
+	m.ChunkSize = crypto.DefaultChunkSize
+	for _, did := range append([]string{owner.DID()}, recipients...) {
+		if err := m.AddRecipient(did, dataKey); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.Sign(owner); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Unseal 从片段中按条带恢复密文，使用接收者的身份解开数据密钥后解密并写入 w
+// 缺失的片段以 nil 表示；解密时逐块认证，内容被篡改时返回错误，此时 w 中已写入的内容不可使用
+func Unseal(w io.Writer, shards []io.Reader, m *Manifest, id *identity.Identity) error {
+	dataKey, err := m.DataKey(id)
+	if err != nil {
+		return err
+	}
+
+	// 恢复的密文经由管道逐块解密，不保留整个文件
+	pr, pw := io.Pipe()
+	restored := make(chan error, 1)
+	go func() {
+		err := m.Restore(pw, shards)
+		pw.CloseWithError(err)
+		restored <- err
+	}()
+
+	r, err := crypto.NewDecryptReader(pr, dataKey)
+	if err == nil {
+		_, err = io.Copy(w, r)
+	}
+	// 解密失败时关闭管道，使恢复随即结束
+	pr.Close()
+	if restoreErr := <-restored; err == nil {
+		err = restoreErr
+	}
+	return err
+}
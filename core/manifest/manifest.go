@@ -0,0 +1,326 @@
+// 文件资产的签名清单
+package manifest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bpfs/defs/core/erasure"
+	"github.com/bpfs/defs/core/identity"
+	"github.com/bpfs/defs/util"
+)
+
+// Version 是当前清单格式的版本
+// 版本 2 增加了内容加密的参数和封装的数据密钥，版本 3 的所有者和接收者改为 DID，由 Ed25519 身份签名
+const Version = 3
+
+// minVersion 是支持的最低版本，更早的清单由 RSA 公钥签名，所有者无法与访问控制中的 DID 对应
+const minVersion = 3
+
+// EncryptionAESGCM 表示文件内容在分片前以分块的 AES-256-GCM 加密
+const EncryptionAESGCM = "AES-256-GCM"
+
+// ShardInfo 描述清单中的一个文件片段
+type ShardInfo struct {
+	Hash   string `json:"hash"`   // 文件片段内容的哈希值
+	Parity bool   `json:"parity"` // 是否为奇偶校验片段
+}
+
+// KeyGrant 是为一个接收者封装的数据密钥
+type KeyGrant struct {
+	Recipient string `json:"recipient"` // 接收者的 DID
+	Key       []byte `json:"key"`       // 使用接收者的身份封装的数据密钥
+}
+
+// Manifest 是文件资产的持久描述，由所有者签名，任何节点都可以在接收片段前验证
+// 文件资产的唯一标识由清单描述的内容计算，修改除数据密钥外的任何字段都会改变唯一标识；
+// 为共同所有者或被分享者增加数据密钥后需要重新签名，但唯一标识不变
+type Manifest struct {
+	Version      int         `json:"version"`              // 清单格式的版本
+	Name         string      `json:"name"`                 // 文件的基本名称，加密时为空
+	Size         int64       `json:"size"`                 // 文件的大小，加密时为密文的大小
+	ModTime      time.Time   `json:"mod_time"`             // 文件的修改时间，加密时为 Unix 纪元
+	ContentHash  string      `json:"content_hash"`         // 文件内容的哈希值，加密时为密文的哈希值
+	StorageMode  string      `json:"storage_mode"`         // 存储模式，如 "RS_Size"
+	DataShards   int         `json:"data_shards"`          // 数据片段的数量
+	ParityShards int         `json:"parity_shards"`        // 奇偶校验片段的数量
+	BlockSize    int         `json:"block_size"`           // 条带中每个块的大小，0 表示片段按顺序整块切分
+	ShardSize    int64       `json:"shard_size"`           // 每个片段的大小
+	Shards       []ShardInfo `json:"shards"`               // 各片段的描述，数据片段在前
+	Encryption   string      `json:"encryption,omitempty"` // 内容加密的方式，为空时片段保存明文
+	ChunkSize    int         `json:"chunk_size,omitempty"` // 分块加密时每块明文的大小
+	Keys         []KeyGrant  `json:"keys,omitempty"`       // 为所有者、共同所有者和被分享者封装的数据密钥
+	Controlled   bool        `json:"controlled,omitempty"` // 是否受访问控制，访问控制以 Owner 为最初的所有者
+	Owner        string      `json:"owner"`                // 所有者的 DID
+	Signature    []byte      `json:"signature"`            // 所有者的身份对清单的签名
+}
+
+// New 根据纠删码的编码结果创建未签名的清单
+func New(name string, modTime time.Time, storageMode string, encoded erasure.Manifest) *Manifest {
+	m := &Manifest{
+		Version:      Version,
+		Name:         name,
+		Size:         encoded.Size,
+		ModTime:      modTime.UTC(),
+		ContentHash:  encoded.Hash,
+		StorageMode:  storageMode,
+		DataShards:   encoded.DataShards,
+		ParityShards: encoded.ParityShards,
+		BlockSize:    encoded.BlockSize,
+		ShardSize:    encoded.ShardSize,
+		Shards:       make([]ShardInfo, len(encoded.ShardHashes)),
+	}
+	for i, hash := range encoded.ShardHashes {
+		m.Shards[i] = ShardInfo{Hash: hash, Parity: i >= encoded.DataShards}
+	}
+
+	return m
+}
+
+// Erasure 返回恢复文件所需的纠删码编码方式
+func (m *Manifest) Erasure() erasure.Manifest {
+	hashes := make([]string, len(m.Shards))
+	for i, shard := range m.Shards {
+		hashes[i] = shard.Hash
+	}
+
+	return erasure.Manifest{
+		Size:         m.Size,
+		Hash:         m.ContentHash,
+		DataShards:   m.DataShards,
+		ParityShards: m.ParityShards,
+		BlockSize:    m.BlockSize,
+		ShardSize:    m.ShardSize,
+		ShardHashes:  hashes,
+	}
+}
+
+// Validate 检查清单的字段是否有效，不检查签名
+func (m *Manifest) Validate() error {
+	if m.Version < minVersion || m.Version > Version {
+		return fmt.Errorf("不支持的清单版本 %d", m.Version)
+	}
+	if m.Name == "" && m.Encryption == "" {
+		return fmt.Errorf("文件名称为空")
+	}
+	if m.Size <= 0 {
+		return fmt.Errorf("文件的大小 %d 无效", m.Size)
+	}
+	if m.ContentHash == "" {
+		return fmt.Errorf("文件内容的哈希值为空")
+	}
+	if m.DataShards <= 0 || m.ParityShards < 0 {
+		return fmt.Errorf("数据片段 %d 个、奇偶校验片段 %d 个的分片方式无效", m.DataShards, m.ParityShards)
+	}
+	if m.BlockSize < 0 || m.ShardSize <= 0 {
+		return fmt.Errorf("块的大小 %d 或片段的大小 %d 无效", m.BlockSize, m.ShardSize)
+	}
+	if len(m.Shards) != m.DataShards+m.ParityShards {
+		return fmt.Errorf("片段描述的数量 %d 与片段的数量 %d 不符", len(m.Shards), m.DataShards+m.ParityShards)
+	}
+	for i, shard := range m.Shards {
+		if shard.Hash == "" {
+			return fmt.Errorf("文件片段 %d 的哈希值为空", i)
+		}
+		if shard.Parity != (i >= m.DataShards) {
+			return fmt.Errorf("文件片段 %d 的类型与分片方式不符", i)
+		}
+	}
+
+	switch m.Encryption {
+	case "":
+		if m.ChunkSize != 0 || len(m.Keys) > 0 {
+			return fmt.Errorf("未加密的清单不应包含加密参数")
+		}
+	case EncryptionAESGCM:
+		if m.Name != "" || !m.ModTime.Equal(sealedModTime) {
+			return fmt.Errorf("加密的清单不应包含文件名称和修改时间")
+		}
+		if m.ChunkSize <= 0 {
+			return fmt.Errorf("加密块的大小 %d 无效", m.ChunkSize)
+		}
+		if len(m.Keys) == 0 {
+			return fmt.Errorf("加密的清单中没有数据密钥")
+		}
+		for i, grant := range m.Keys {
+			if grant.Recipient == "" || len(grant.Key) == 0 {
+				return fmt.Errorf("第 %d 个数据密钥不完整", i)
+			}
+		}
+	default:
+		return fmt.Errorf("不支持的加密方式 %q", m.Encryption)
+	}
+	return nil
+}
+
+// contentFields 返回清单中描述文件内容的字段，文件资产的唯一标识由其计算
+// 修改时间以纳秒计，不受时区影响
+func (m *Manifest) contentFields() []interface{} {
+	hashes := make([]string, len(m.Shards))
+	parity := make([]bool, len(m.Shards))
+	for i, shard := range m.Shards {
+		hashes[i] = shard.Hash
+		parity[i] = shard.Parity
+	}
+
+	fields := []interface{}{
+		m.Version,
+		m.Name,
+		m.Size,
+		m.ModTime.UnixNano(),
+		m.ContentHash,
+		m.StorageMode,
+		m.DataShards,
+		m.ParityShards,
+		m.BlockSize,
+		m.ShardSize,
+		hashes,
+		parity,
+		m.Owner,
+		m.Encryption,
+		m.ChunkSize,
+		m.Controlled,
+	}
+	return fields
+}
+
+// contentBytes 返回计算唯一标识的内容
+func (m *Manifest) contentBytes() ([]byte, error) {
+	return util.MergeFieldsForSigning(m.contentFields()...)
+}
+
+// signingBytes 返回清单中需要签名的内容，包括封装的数据密钥，不含签名本身
+func (m *Manifest) signingBytes() ([]byte, error) {
+	recipients := make([]string, len(m.Keys))
+	keys := make([][]byte, len(m.Keys))
+	for i, grant := range m.Keys {
+		recipients[i] = grant.Recipient
+		keys[i] = grant.Key
+	}
+	return util.MergeFieldsForSigning(append(m.contentFields(), recipients, keys)...)
+}
+
+// Sign 使用所有者的身份为清单签名，并记录所有者的 DID
+func (m *Manifest) Sign(owner *identity.Identity) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	m.Owner = owner.DID()
+	// 加密的文件资产必须为所有者封装数据密钥，否则所有者无法解密
+	if m.Encryption != "" && m.grant(m.Owner) < 0 {
+		return fmt.Errorf("清单中没有为所有者封装的数据密钥")
+	}
+
+	data, err := m.signingBytes()
+	if err != nil {
+		return err
+	}
+	m.Signature = owner.Sign(data)
+
+	return nil
+}
+
+// Verify 检查清单的字段是否有效，以及签名是否与所有者的 DID 匹配
+func (m *Manifest) Verify() error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	if m.Owner == "" || len(m.Signature) == 0 {
+		return fmt.Errorf("清单未签名")
+	}
+
+	data, err := m.signingBytes()
+	if err != nil {
+		return err
+	}
+	if !identity.VerifyDID(m.Owner, data, m.Signature) {
+		return fmt.Errorf("清单的签名无效")
+	}
+
+	return nil
+}
+
+// AssetID 返回由清单内容计算的文件资产唯一标识，清单需先签名
+func (m *Manifest) AssetID() (string, error) {
+	if m.Owner == "" {
+		return "", fmt.Errorf("清单未签名")
+	}
+
+	data, err := m.contentBytes()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(util.CalculateHash(data)), nil
+}
+
+// VerifyShard 检查文件片段的内容是否与清单中的哈希值一致
+func (m *Manifest) VerifyShard(index int, data []byte) error {
+	if index < 0 || index >= len(m.Shards) {
+		return fmt.Errorf("文件片段的索引 %d 超出范围", index)
+	}
+	if int64(len(data)) != m.ShardSize {
+		return fmt.Errorf("文件片段 %d 的大小 %d 与预期的 %d 不符", index, len(data), m.ShardSize)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != m.Shards[index].Hash {
+		return fmt.Errorf("文件片段 %d 的哈希值不匹配", index)
+	}
+	return nil
+}
+
+// Restore 从片段中按条带恢复文件内容并写入 w，加密的文件资产写入的是密文
+// 缺失的片段以 nil 表示；恢复后检查内容的哈希值，不一致时返回错误，此时 w 中已写入的内容不可使用
+func (m *Manifest) Restore(w io.Writer, shards []io.Reader) error {
+	// 块的大小为 0 时片段按顺序整块切分，相当于只有一个条带
+	blockSize := m.BlockSize
+	if blockSize == 0 {
+		blockSize = int(m.ShardSize)
+	}
+	enc, err := erasure.NewStreamEncoder(m.DataShards, m.ParityShards, blockSize)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	if err := enc.Decode(io.MultiWriter(w, hash), shards, m.Size); err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != m.ContentHash {
+		return fmt.Errorf("恢复的文件内容与清单中的哈希值不符")
+	}
+	return nil
+}
+
+// MarshalJSON 将清单编码为 JSON，修改时间统一为 UTC
+func (m *Manifest) MarshalJSON() ([]byte, error) {
+	type plain Manifest
+	c := plain(*m)
+	c.ModTime = c.ModTime.UTC()
+	return json.Marshal(&c)
+}
+
+// Decode 解析二进制或 JSON 编码的清单，不检查签名
+func Decode(data []byte) (*Manifest, error) {
+	m := new(Manifest)
+	if bytes.HasPrefix(data, []byte(magic)) {
+		if err := m.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("解析清单失败: %v", err)
+	}
+	if m.Version < minVersion || m.Version > Version {
+		return nil, fmt.Errorf("不支持的清单版本 %d", m.Version)
+	}
+	m.ModTime = m.ModTime.UTC()
+	return m, nil
+}
@@ -0,0 +1,323 @@
+package manifest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/core/erasure"
+	"github.com/bpfs/defs/core/identity"
+)
+
+// newSignedManifest 编码 data 并创建已签名的清单
+func newSignedManifest(t *testing.T, key *identity.Identity, data []byte) (*Manifest, []erasure.Shard) {
+	t.Helper()
+
+	shards, encoded, err := erasure.Encode(bytes.NewReader(data), erasure.Plan{DataShards: 4, ParityShards: 2, BlockSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2024, 5, 1, 8, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	m := New("report.pdf", modTime, "RS_Size", encoded)
+	if err := m.Sign(key); err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	return m, shards
+}
+
+func TestManifestSignVerify(t *testing.T) {
+	key, err := identity.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 20000)
+	rand.Read(data)
+	m, shards := newSignedManifest(t, key, data)
+
+	if err := m.Verify(); err != nil {
+		t.Fatalf("验证失败: %v", err)
+	}
+	assetID, err := m.AssetID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, shard := range shards {
+		if err := m.VerifyShard(shard.Index, shard.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	corrupt := append([]byte(nil), shards[2].Data...)
+	corrupt[0] ^= 1
+	if err := m.VerifyShard(2, corrupt); err == nil {
+		t.Fatal("损坏的片段通过验证")
+	}
+
+	// 篡改任何字段都会使签名失效并改变唯一标识
+	tampered := *m
+	tampered.Shards = append([]ShardInfo(nil), m.Shards...)
+	tampered.Shards[1].Hash = m.Shards[5].Hash
+	if err := tampered.Verify(); err == nil {
+		t.Fatal("篡改片段哈希值后验证成功")
+	}
+	if id, _ := tampered.AssetID(); id == assetID {
+		t.Fatal("篡改后唯一标识未变化")
+	}
+	// 去掉访问控制的标记同样使签名失效
+	uncontrolled := *m
+	uncontrolled.Controlled = !m.Controlled
+	if err := uncontrolled.Verify(); err == nil {
+		t.Fatal("修改访问控制的标记后验证成功")
+	}
+	if id, _ := uncontrolled.AssetID(); id == assetID {
+		t.Fatal("修改访问控制的标记后唯一标识未变化")
+	}
+
+	// 其他人重新签名后唯一标识也不同
+	other, err := identity.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resigned := *m
+	if err := resigned.Sign(other); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := resigned.AssetID(); id == assetID {
+		t.Fatal("不同所有者的唯一标识相同")
+	}
+}
+
+func TestManifestEncoding(t *testing.T) {
+	key, err := identity.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := newSignedManifest(t, key, bytes.Repeat([]byte("defs"), 3000))
+	m.Controlled = true
+	if err := m.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	assetID, _ := m.AssetID()
+
+	bin, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"binary": bin, "json": js} {
+		got, err := Decode(data)
+		if err != nil {
+			t.Fatalf("%s 解析失败: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Fatalf("%s 解析的清单与原清单不一致:\n%+v\n%+v", name, got, m)
+		}
+		if err := got.Verify(); err != nil {
+			t.Fatalf("%s 解析后验证失败: %v", name, err)
+		}
+		if id, _ := got.AssetID(); id != assetID {
+			t.Fatalf("%s 解析后唯一标识变化", name)
+		}
+	}
+
+	// 二进制编码是规范的，重复编码的结果相同
+	again, _ := m.MarshalBinary()
+	if !bytes.Equal(bin, again) {
+		t.Fatal("重复编码的结果不同")
+	}
+	if _, err := Decode(bin[:len(bin)-1]); err == nil {
+		t.Fatal("截断的清单解析成功")
+	}
+
+	future := *m
+	future.Version = Version + 1
+	data, _ := future.MarshalBinary()
+	if _, err := Decode(data); err == nil {
+		t.Fatal("解析了未来版本的清单")
+	}
+}
+
+// writers 返回写入各片段的缓冲区
+func writers(n int) ([]*bytes.Buffer, []io.Writer) {
+	buffers := make([]*bytes.Buffer, n)
+	out := make([]io.Writer, n)
+	for i := range buffers {
+		buffers[i] = new(bytes.Buffer)
+		out[i] = buffers[i]
+	}
+	return buffers, out
+}
+
+// readers 返回读取各片段的 Reader，missing 中的片段为 nil
+func readers(buffers []*bytes.Buffer, missing ...int) []io.Reader {
+	out := make([]io.Reader, len(buffers))
+	for i, buf := range buffers {
+		out[i] = bytes.NewReader(buf.Bytes())
+	}
+	for _, i := range missing {
+		out[i] = nil
+	}
+	return out
+}
+
+func TestRestore(t *testing.T) {
+	key, err := identity.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 20000)
+	rand.Read(data)
+	m, shards := newSignedManifest(t, key, data)
+
+	buffers := make([]*bytes.Buffer, len(shards))
+	for i, shard := range shards {
+		buffers[i] = bytes.NewBuffer(shard.Data)
+	}
+	var out bytes.Buffer
+	if err := m.Restore(&out, readers(buffers, 0, 4)); err != nil || !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("恢复的内容与原文件不一致: %v", err)
+	}
+
+	// 片段的内容被篡改时，恢复的内容与清单中的哈希值不符
+	buffers[1].Bytes()[0] ^= 1
+	if err := m.Restore(io.Discard, readers(buffers)); err == nil {
+		t.Fatal("篡改片段后恢复成功")
+	}
+}
+
+func TestSealUnseal(t *testing.T) {
+	owner, err := identity.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	coOwner, err := identity.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger, err := identity.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("confidential "), 20000)
+	plan := erasure.Plan{DataShards: 4, ParityShards: 2, BlockSize: 4096}
+	buffers, shards := writers(6)
+	m, err := Seal(bytes.NewReader(data), shards, "RS_Size", plan, nil, owner, coOwner.DID())
+	if err != nil {
+		t.Fatalf("加密失败: %v", err)
+	}
+	if err := m.Verify(); err != nil {
+		t.Fatalf("验证失败: %v", err)
+	}
+	// 清单中没有文件名称和修改时间，哈希值来自密文
+	if sum := sha256.Sum256(data); m.Name != "" || m.ContentHash == hex.EncodeToString(sum[:]) {
+		t.Fatal("加密的清单中包含明文的信息")
+	}
+	named := *m
+	named.Name = "secret.txt"
+	if err := named.Validate(); err == nil {
+		t.Fatal("包含文件名称的加密清单通过检查")
+	}
+	// 片段中只有密文
+	for i, buf := range buffers {
+		if bytes.Contains(buf.Bytes(), []byte("confidential")) {
+			t.Fatalf("片段 %d 中包含明文", i)
+		}
+	}
+
+	// 所有者和共同所有者都能解密，缺失两个片段时仍能恢复
+	for _, id := range []*identity.Identity{owner, coOwner} {
+		var got bytes.Buffer
+		if err := Unseal(&got, readers(buffers, 0, 1), m, id); err != nil || !bytes.Equal(got.Bytes(), data) {
+			t.Fatalf("解密的内容与原文件不一致: %v", err)
+		}
+	}
+	if err := Unseal(io.Discard, readers(buffers), m, stranger); err == nil {
+		t.Fatal("没有数据密钥的身份解密成功")
+	}
+
+	// 相同的数据密钥得到相同的密文和唯一标识
+	dataKey, err := m.DataKey(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, again := writers(6)
+	same, err := Seal(bytes.NewReader(data), again, "RS_Size", plan, dataKey, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same.ContentHash != m.ContentHash {
+		t.Fatal("相同的数据密钥得到不同的密文")
+	}
+
+	// 分享给其他人后重新签名，唯一标识不变
+	assetID, _ := m.AssetID()
+	if err := m.AddRecipient(stranger.DID(), dataKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Verify(); err == nil {
+		t.Fatal("增加数据密钥后未重新签名即验证成功")
+	}
+	if err := m.Sign(owner); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := m.AssetID(); id != assetID {
+		t.Fatal("分享后唯一标识变化")
+	}
+	if err := Unseal(io.Discard, readers(buffers), m, stranger); err != nil {
+		t.Fatalf("被分享者解密失败: %v", err)
+	}
+	if err := m.RemoveRecipient(owner.DID()); err == nil {
+		t.Fatal("移除了所有者的数据密钥")
+	}
+	if err := m.RemoveRecipient(stranger.DID()); err != nil || len(m.Keys) != 2 {
+		t.Fatalf("移除被分享者的数据密钥失败: %v", err)
+	}
+
+	// 加密参数和数据密钥在两种编码中保持不变
+	if err := m.Sign(owner); err != nil {
+		t.Fatal(err)
+	}
+	bin, _ := m.MarshalBinary()
+	js, _ := json.Marshal(m)
+	for name, data := range map[string][]byte{"binary": bin, "json": js} {
+		got, err := Decode(data)
+		if err != nil {
+			t.Fatalf("%s 解析失败: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, m) || got.Verify() != nil {
+			t.Fatalf("%s 解析的加密清单与原清单不一致", name)
+		}
+	}
+}
+
+func TestDecodeEarlierVersion(t *testing.T) {
+	key, err := identity.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := newSignedManifest(t, key, []byte("version two"))
+
+	// 版本 2 及更早的清单由 RSA 公钥签名，不再支持
+	m.Version = 2
+	bin, _ := m.MarshalBinary()
+	if _, err := Decode(bin); err == nil {
+		t.Fatal("解析了版本 2 的清单")
+	}
+	js, _ := json.Marshal(m)
+	if _, err := Decode(js); err == nil {
+		t.Fatal("解析了版本 2 的 JSON 清单")
+	}
+	if err := m.Validate(); err == nil {
+		t.Fatal("版本 2 的清单通过检查")
+	}
+}
@@ -0,0 +1,221 @@
+package pool
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bpfs/defs/core/sqlite"
+)
+
+// EventType 表示进度事件的类型
+type EventType int
+
+const (
+	EventPieceCompleted EventType = iota // 文件片段已完成
+	EventPieceFailed                     // 文件片段失败
+	EventPaused                          // 任务已暂停
+	EventResumed                         // 任务已恢复
+	EventCompleted                       // 任务已完成
+	EventCancelled                       // 任务已取消
+	EventFailed                          // 任务因片段超过重试次数而失败
+)
+
+// String 返回事件类型的名称
+func (t EventType) String() string {
+	switch t {
+	case EventPieceCompleted:
+		return "piece-completed"
+	case EventPieceFailed:
+		return "piece-failed"
+	case EventPaused:
+		return "paused"
+	case EventResumed:
+		return "resumed"
+	case EventCompleted:
+		return "completed"
+	case EventCancelled:
+		return "cancelled"
+	case EventFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("EventType(%d)", int(t))
+	}
+}
+
+// ProgressEvent 描述上传或下载任务的一次进度变化
+type ProgressEvent struct {
+	AssetID     string    // 文件资产的唯一标识
+	Operates    int       // 操作(0:下载、1:上传)
+	Type        EventType // 事件类型
+	PieceIndex  int       // 相关的文件片段索引，与片段无关的事件为 -1
+	PiecesDone  int       // 已完成的片段数量
+	TotalPieces int       // 完成任务所需的片段数量
+	BytesDone   int64     // 已完成的字节数
+	TotalBytes  int64     // 完成任务所需的字节数(文件大小未知时为 0)
+	Throughput  float64   // 本次运行以来的平均速度(字节/秒)
+	Rate        float64   // 最近几秒内的速度(字节/秒)，未设置 RateFunc 时为 0
+	Err         error     // 片段或任务失败的原因
+	Time        time.Time // 事件发生的时间
+}
+
+// RateFunc 返回任务最近几秒内的速度(字节/秒)
+type RateFunc func(assetID string, operates int) float64
+
+// SetRateFunc 设置为进度事件提供任务当前速度的函数，通常由限速器统计
+func (pool *MemoryPool) SetRateFunc(f RateFunc) {
+	pool.subMu.Lock()
+	defer pool.subMu.Unlock()
+	pool.rateFunc = f
+}
+
+// subscriberBuffer 是每个订阅通道的缓冲大小
+const subscriberBuffer = 64
+
+// Subscribe 订阅文件资产的进度事件，assetID 为空时订阅所有任务
+// 订阅单个文件资产时，任务完成、取消或失败后通道被关闭；订阅者处理不及时时会丢弃较早的片段事件
+func (pool *MemoryPool) Subscribe(assetID string) <-chan ProgressEvent {
+	pool.subMu.Lock()
+	defer pool.subMu.Unlock()
+
+	if pool.subs == nil {
+		pool.subs = make(map[string][]chan ProgressEvent)
+	}
+	ch := make(chan ProgressEvent, subscriberBuffer)
+	pool.subs[assetID] = append(pool.subs[assetID], ch)
+
+	return ch
+}
+
+// Unsubscribe 取消订阅并关闭通道
+func (pool *MemoryPool) Unsubscribe(sub <-chan ProgressEvent) {
+	pool.subMu.Lock()
+	defer pool.subMu.Unlock()
+
+	for assetID, chans := range pool.subs {
+		for i, ch := range chans {
+			if ch == sub {
+				pool.subs[assetID] = append(chans[:i], chans[i+1:]...)
+				if len(pool.subs[assetID]) == 0 {
+					delete(pool.subs, assetID)
+				}
+				close(ch)
+				return
+			}
+		}
+	}
+}
+
+// publish 将事件发送给订阅者，任务结束时关闭该文件资产的订阅通道
+func (pool *MemoryPool) publish(event ProgressEvent) {
+	pool.subMu.Lock()
+	defer pool.subMu.Unlock()
+
+	if len(pool.subs) == 0 {
+		return
+	}
+	if pool.rateFunc != nil {
+		event.Rate = pool.rateFunc(event.AssetID, event.Operates)
+	}
+
+	// 片段事件可以丢弃，任务级事件在缓冲区已满时挤掉最早的事件
+	important := event.Type != EventPieceCompleted && event.Type != EventPieceFailed
+	for _, ch := range pool.subs[""] {
+		deliver(ch, event, important)
+	}
+	for _, ch := range pool.subs[event.AssetID] {
+		deliver(ch, event, important)
+	}
+
+	if event.Type == EventCompleted || event.Type == EventCancelled || event.Type == EventFailed {
+		for _, ch := range pool.subs[event.AssetID] {
+			close(ch)
+		}
+		delete(pool.subs, event.AssetID)
+	}
+}
+
+// deliver 以非阻塞方式发送事件
+func deliver(ch chan ProgressEvent, event ProgressEvent, important bool) {
+	select {
+	case ch <- event:
+		return
+	default:
+	}
+	if !important {
+		return
+	}
+
+	select {
+	case <-ch:
+	default:
+	}
+	select {
+	case ch <- event:
+	default:
+	}
+}
+
+// event 根据上传任务的状态创建进度事件，调用方需持有任务的锁
+func (task *UploadTask) event(assetID string, typ EventType, pieceIndex int, err error) ProgressEvent {
+	done := countSet(&task.Progress, task.TotalPieces)
+	pieceSize := pieceSizeOf(task.Size, task.DataPieces)
+
+	return newEvent(assetID, sqlite.OperateUpload, typ, pieceIndex, err,
+		done, task.TotalPieces, pieceSize, task.startedPieces, task.startedAt)
+}
+
+// event 根据下载任务的状态创建进度事件，调用方需持有任务的锁
+func (task *DownloadTask) event(assetID string, typ EventType, pieceIndex int, err error) ProgressEvent {
+	done := countSet(&task.Progress, task.TotalPieces)
+	pieceSize := pieceSizeOf(task.Size, task.DataPieces)
+
+	// 下载只需获取与数据片段数量相同的片段
+	return newEvent(assetID, sqlite.OperateDownload, typ, pieceIndex, err,
+		done, task.DataPieces, pieceSize, task.startedPieces, task.startedAt)
+}
+
+// newEvent 计算字节进度和速度并创建进度事件
+func newEvent(assetID string, operates int, typ EventType, pieceIndex int, err error,
+	done, total int, pieceSize int64, startedPieces int, startedAt time.Time) ProgressEvent {
+	now := time.Now()
+	if done > total && total > 0 {
+		done = total
+	}
+
+	event := ProgressEvent{
+		AssetID:     assetID,
+		Operates:    operates,
+		Type:        typ,
+		PieceIndex:  pieceIndex,
+		PiecesDone:  done,
+		TotalPieces: total,
+		BytesDone:   int64(done) * pieceSize,
+		TotalBytes:  int64(total) * pieceSize,
+		Err:         err,
+		Time:        now,
+	}
+	if elapsed := now.Sub(startedAt).Seconds(); elapsed > 0 && done > startedPieces {
+		event.Throughput = float64(int64(done-startedPieces)*pieceSize) / elapsed
+	}
+
+	return event
+}
+
+// pieceSizeOf 根据文件大小和数据片段数量计算每个片段的大小，未知时返回 0
+func pieceSizeOf(size int64, dataPieces int) int64 {
+	if size <= 0 || dataPieces <= 0 {
+		return 0
+	}
+	return (size + int64(dataPieces) - 1) / int64(dataPieces)
+}
+
+// countSet 计算进度中已完成的片段数量
+func countSet(b *BitSet, size int) int {
+	n := 0
+	for i := 0; i < size; i++ {
+		if b.IsSet(i) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,131 @@
+package pool
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bpfs/defs/core/sqlite"
+)
+
+// collect 读取通道中的全部事件，直到通道被关闭
+func collect(t *testing.T, ch <-chan ProgressEvent) []ProgressEvent {
+	t.Helper()
+
+	var events []ProgressEvent
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		default:
+			t.Fatalf("通道未关闭, 已收到 %d 个事件", len(events))
+		}
+	}
+}
+
+func TestUploadProgressEvents(t *testing.T) {
+	pool := New()
+	if err := pool.AddUploadTask("asset", 3); err != nil {
+		t.Fatal(err)
+	}
+	pool.SetUploadTaskSize("asset", 200, 2)
+	ch := pool.Subscribe("asset")
+
+	pool.MarkUploadPieceComplete("asset", 0)
+	if err := pool.PauseUploadTask("asset"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.ResumeUploadTask("asset"); err != nil {
+		t.Fatal(err)
+	}
+	pool.MarkUploadPieceFailed("asset", 1, fmt.Errorf("发送失败"))
+	pool.MarkUploadPieceComplete("asset", 1)
+	pool.MarkUploadPieceComplete("asset", 2)
+
+	events := collect(t, ch)
+	want := []EventType{
+		EventPieceCompleted,
+		EventPaused,
+		EventResumed,
+		EventPieceFailed,
+		EventPieceCompleted,
+		EventPieceCompleted,
+		EventCompleted,
+	}
+	if len(events) != len(want) {
+		t.Fatalf("收到 %d 个事件, 期望 %d 个: %v", len(events), len(want), events)
+	}
+	for i, event := range events {
+		if event.Type != want[i] {
+			t.Fatalf("第 %d 个事件为 %v, 期望 %v", i, event.Type, want[i])
+		}
+		if event.AssetID != "asset" || event.Operates != sqlite.OperateUpload {
+			t.Fatalf("事件 %+v 的文件资产或操作错误", event)
+		}
+	}
+
+	first, last := events[0], events[len(events)-1]
+	if first.PieceIndex != 0 || first.PiecesDone != 1 || first.BytesDone != 100 || first.TotalBytes != 300 {
+		t.Fatalf("第一个事件为 %+v", first)
+	}
+	if events[3].Err == nil || events[3].PieceIndex != 1 {
+		t.Fatalf("片段失败事件为 %+v", events[3])
+	}
+	if last.PieceIndex != -1 || last.PiecesDone != 3 || last.BytesDone != 300 {
+		t.Fatalf("完成事件为 %+v", last)
+	}
+}
+
+func TestDownloadCancelledEvent(t *testing.T) {
+	pool := New()
+	all := pool.Subscribe("")
+	defer pool.Unsubscribe(all)
+
+	if err := pool.AddDownloadTask("asset"); err != nil {
+		t.Fatal(err)
+	}
+	pool.UpdateDownloadPieceInfo("", "asset", "file.bin", 200, map[int]HashTable{
+		0: {Hash: "h0"},
+		1: {Hash: "h1"},
+		2: {Hash: "h2", RsCodes: true},
+	}, nil)
+	ch := pool.Subscribe("asset")
+
+	pool.MarkDownloadPieceComplete("asset", 2)
+	pool.DeleteDownloadTask("asset")
+
+	events := collect(t, ch)
+	if len(events) != 2 || events[0].Type != EventPieceCompleted || events[1].Type != EventCancelled {
+		t.Fatalf("收到的事件为 %v", events)
+	}
+	if events[0].TotalPieces != 2 || events[0].BytesDone != 100 {
+		t.Fatalf("片段完成事件为 %+v", events[0])
+	}
+
+	// 订阅所有任务的通道不会因单个任务结束而关闭
+	if len(all) != 2 {
+		t.Fatalf("订阅所有任务的通道收到 %d 个事件", len(all))
+	}
+}
+
+func TestSlowSubscriberKeepsTaskEvents(t *testing.T) {
+	pool := New()
+	if err := pool.AddUploadTask("asset", subscriberBuffer+10); err != nil {
+		t.Fatal(err)
+	}
+	ch := pool.Subscribe("asset")
+
+	for i := 0; i < subscriberBuffer+10; i++ {
+		pool.MarkUploadPieceComplete("asset", i)
+	}
+
+	events := collect(t, ch)
+	if len(events) != subscriberBuffer {
+		t.Fatalf("收到 %d 个事件, 期望 %d 个", len(events), subscriberBuffer)
+	}
+	if events[len(events)-1].Type != EventCompleted {
+		t.Fatal("缓冲区已满时完成事件不应丢失")
+	}
+}
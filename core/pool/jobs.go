@@ -0,0 +1,175 @@
+package pool
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bpfs/defs/core/sqlite"
+)
+
+// StatementJob 描述一条异步执行的 FQL 语句
+// 任务在工作池中运行，状态保存在内存池中，设置数据库时同时写入数据库的 jobs 表。
+type StatementJob struct {
+	ID        string    // 任务的唯一标识
+	Statement string    // FQL 语句的原文
+	Status    int       // 状态(0:失败、1:成功、2:待开始、3:进行中、4:已取消)
+	Err       string    // 失败的原因
+	AssetIDs  []string  // 创建或受影响的文件资产
+	Created   time.Time // 提交的时间
+	Updated   time.Time // 状态最后变化的时间
+}
+
+// Finished 检查任务是否已结束
+func (job *StatementJob) Finished() bool {
+	return job.Status != sqlite.StatusPending && job.Status != sqlite.StatusInProgress
+}
+
+// AddStatementJob 添加一个待开始的异步语句任务
+func (pool *MemoryPool) AddStatementJob(id, statement string) error {
+	pool.Mu.Lock()
+	defer pool.Mu.Unlock()
+
+	if _, exists := pool.Jobs[id]; exists {
+		return fmt.Errorf("任务 %s 已存在", id)
+	}
+	now := time.Now()
+	job := &StatementJob{ID: id, Statement: statement, Status: sqlite.StatusPending, Created: now, Updated: now}
+	pool.Jobs[id] = job
+
+	return pool.saveStatementJob(job)
+}
+
+// StartStatementJob 将待开始的任务标记为进行中，任务已取消时返回错误
+func (pool *MemoryPool) StartStatementJob(id string) error {
+	pool.Mu.Lock()
+	defer pool.Mu.Unlock()
+
+	job, exists := pool.Jobs[id]
+	if !exists {
+		return fmt.Errorf("任务 %s 不存在", id)
+	}
+	if job.Status != sqlite.StatusPending {
+		return fmt.Errorf("任务 %s 不是待开始的状态", id)
+	}
+	job.Status = sqlite.StatusInProgress
+	job.Updated = time.Now()
+
+	return pool.saveStatementJob(job)
+}
+
+// FinishStatementJob 记录任务的结果，err 为空时成功；已取消的任务保持取消的状态
+func (pool *MemoryPool) FinishStatementJob(id string, assetIDs []string, err error) {
+	pool.Mu.Lock()
+	defer pool.Mu.Unlock()
+
+	job, exists := pool.Jobs[id]
+	if !exists || job.Finished() {
+		return
+	}
+	job.AssetIDs = assetIDs
+	job.Updated = time.Now()
+	if err == nil {
+		job.Status = sqlite.StatusSuccess
+	} else {
+		job.Status = sqlite.StatusFailed
+		job.Err = err.Error()
+	}
+
+	logSaveError(id, pool.saveStatementJob(job))
+}
+
+// CancelStatementJob 将待开始或进行中的任务标记为已取消，由调用方中断正在运行的语句
+func (pool *MemoryPool) CancelStatementJob(id string) error {
+	pool.Mu.Lock()
+	defer pool.Mu.Unlock()
+
+	job, exists := pool.Jobs[id]
+	if !exists {
+		return fmt.Errorf("任务 %s 不存在", id)
+	}
+	if job.Finished() {
+		return fmt.Errorf("任务 %s 已结束", id)
+	}
+	job.Status = sqlite.StatusCancelled
+	job.Updated = time.Now()
+
+	return pool.saveStatementJob(job)
+}
+
+// GetStatementJob 返回任务状态的副本
+func (pool *MemoryPool) GetStatementJob(id string) (StatementJob, bool) {
+	pool.Mu.RLock()
+	defer pool.Mu.RUnlock()
+
+	job, exists := pool.Jobs[id]
+	if !exists {
+		return StatementJob{}, false
+	}
+	return *job, true
+}
+
+// StatementJobs 返回所有任务状态的副本，按提交的顺序排列
+func (pool *MemoryPool) StatementJobs() []StatementJob {
+	pool.Mu.RLock()
+	jobs := make([]StatementJob, 0, len(pool.Jobs))
+	for _, job := range pool.Jobs {
+		jobs = append(jobs, *job)
+	}
+	pool.Mu.RUnlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].Created.Equal(jobs[j].Created) {
+			return jobs[i].Created.Before(jobs[j].Created)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs
+}
+
+// loadStatementJobs 从数据库恢复任务，进程退出前未结束的任务标记为失败
+func (pool *MemoryPool) loadStatementJobs() error {
+	records, err := sqlite.SelectJobsDatabase(pool.db)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		job := &StatementJob{
+			ID:        record.JobID,
+			Statement: record.Statement,
+			Status:    record.Status,
+			Err:       record.Error,
+			AssetIDs:  record.AssetIDs,
+			Created:   record.Created,
+			Updated:   record.Updated,
+		}
+		if !job.Finished() {
+			job.Status = sqlite.StatusFailed
+			job.Err = "进程退出时任务未完成"
+			job.Updated = time.Now()
+			if err := pool.saveStatementJob(job); err != nil {
+				return err
+			}
+		}
+		pool.Jobs[job.ID] = job
+	}
+	return nil
+}
+
+// saveStatementJob 保存任务的状态，调用方需持有内存池的锁
+func (pool *MemoryPool) saveStatementJob(job *StatementJob) error {
+	if pool.db == nil {
+		return nil
+	}
+
+	return sqlite.SaveJobDatabase(pool.db, &sqlite.JobRecord{
+		JobID:     job.ID,
+		Statement: job.Statement,
+		Status:    job.Status,
+		Error:     job.Err,
+		AssetIDs:  job.AssetIDs,
+		Created:   job.Created,
+		Updated:   job.Updated,
+	})
+}
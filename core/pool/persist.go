@@ -0,0 +1,185 @@
+package pool
+
+import (
+	"time"
+
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/sqlites"
+	"github.com/sirupsen/logrus"
+)
+
+// 任务状态在每次变化后写入数据库的 files/slices 表，进程重启后由 NewWithDB 恢复。
+// 片段信息总是先于进度写入，进程在两次写入之间退出时只会重复处理该片段，而不会遗漏。
+
+// NewWithDB 初始化一个由数据库持久化的内存池，并从数据库恢复未完成的任务
+func NewWithDB(db *sqlites.SqliteDB) (*MemoryPool, error) {
+	pool := New()
+	pool.db = db
+
+	if err := pool.load(); err != nil {
+		return nil, err
+	}
+	if err := pool.loadStatementJobs(); err != nil {
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+// load 从数据库恢复未完成的上传和下载任务
+func (pool *MemoryPool) load() error {
+	records, err := sqlite.SelectTasksDatabase(pool.db)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		slices, err := sqlite.SelectTaskSlicesDatabase(pool.db, record.AssetID, record.Operates)
+		if err != nil {
+			return err
+		}
+
+		switch record.Operates {
+		case sqlite.OperateUpload:
+			task := &UploadTask{
+				TotalPieces: int(record.TotalPieces),
+				Progress:    bitSetFromBytes(int(record.TotalPieces), record.Progress),
+				PieceInfo:   make(map[string]*UploadPieceInfo),
+				RetryCounts: make(map[int]int),
+				Paused:      record.Paused,
+				Size:        record.Size,
+				DataPieces:  int(record.DataPieces),
+				startedAt:   time.Now(),
+			}
+			task.startedPieces = countSet(&task.Progress, task.TotalPieces)
+			for _, slice := range slices {
+				task.PieceInfo[slice.SliceHash] = &UploadPieceInfo{
+					Index:  slice.SliceIndex,
+					PeerID: slice.PeerIDs,
+				}
+				if slice.Retries > 0 {
+					task.RetryCounts[slice.SliceIndex] = slice.Retries
+				}
+			}
+			pool.UploadTasks[record.AssetID] = task
+
+		case sqlite.OperateDownload:
+			task := &DownloadTask{
+				FileHash:    record.FileHash,
+				Name:        record.Name,
+				Size:        record.Size,
+				TotalPieces: int(record.TotalPieces),
+				DataPieces:  int(record.DataPieces),
+				Progress:    bitSetFromBytes(int(record.TotalPieces), record.Progress),
+				PieceInfo:   make(map[int]*DownloadPieceInfo),
+				Paused:      record.Paused,
+				startedAt:   time.Now(),
+			}
+			task.startedPieces = countSet(&task.Progress, task.TotalPieces)
+			task.completed = task.DataPieces > 0 && task.startedPieces >= task.DataPieces
+			for _, slice := range slices {
+				task.PieceInfo[slice.SliceIndex] = &DownloadPieceInfo{
+					Hash:    slice.SliceHash,
+					PeerID:  slice.PeerIDs,
+					RSCodes: slice.RsCodes,
+				}
+			}
+			pool.DownloadTasks[record.AssetID] = task
+		}
+	}
+
+	return nil
+}
+
+// saveUploadTask 保存上传任务的进度和暂停状态，调用方需持有任务的锁
+func (pool *MemoryPool) saveUploadTask(assetID string, task *UploadTask) error {
+	if pool.db == nil {
+		return nil
+	}
+
+	return sqlite.SaveTaskDatabase(pool.db, &sqlite.TaskRecord{
+		FileRecord: sqlite.FileRecord{
+			AssetID:     assetID,
+			Size:        task.Size,
+			TotalPieces: int64(task.TotalPieces),
+			DataPieces:  int64(task.DataPieces),
+			Operates:    sqlite.OperateUpload,
+		},
+		Progress: task.Progress.bits,
+		Paused:   task.Paused,
+	})
+}
+
+// saveUploadPiece 保存上传任务中文件片段的信息，调用方需持有任务的锁
+func (pool *MemoryPool) saveUploadPiece(assetID string, task *UploadTask, pieceHash string) error {
+	if pool.db == nil {
+		return nil
+	}
+
+	info := task.PieceInfo[pieceHash]
+	return sqlite.SaveTaskSliceDatabase(pool.db, assetID, sqlite.OperateUpload, &sqlite.TaskSliceRecord{
+		SliceHash:  pieceHash,
+		SliceIndex: info.Index,
+		PeerIDs:    info.PeerID,
+		Retries:    task.RetryCounts[info.Index],
+	})
+}
+
+// saveDownloadTask 保存下载任务的进度和暂停状态，调用方需持有任务的锁
+func (pool *MemoryPool) saveDownloadTask(assetID string, task *DownloadTask) error {
+	if pool.db == nil {
+		return nil
+	}
+
+	return sqlite.SaveTaskDatabase(pool.db, &sqlite.TaskRecord{
+		FileRecord: sqlite.FileRecord{
+			AssetID:     assetID,
+			Name:        task.Name,
+			Size:        task.Size,
+			FileHash:    task.FileHash,
+			TotalPieces: int64(task.TotalPieces),
+			DataPieces:  int64(task.DataPieces),
+			Operates:    sqlite.OperateDownload,
+		},
+		Progress: task.Progress.bits,
+		Paused:   task.Paused,
+	})
+}
+
+// saveDownloadPiece 保存下载任务中文件片段的信息，调用方需持有任务的锁
+func (pool *MemoryPool) saveDownloadPiece(assetID string, task *DownloadTask, index int) error {
+	if pool.db == nil {
+		return nil
+	}
+
+	info := task.PieceInfo[index]
+	return sqlite.SaveTaskSliceDatabase(pool.db, assetID, sqlite.OperateDownload, &sqlite.TaskSliceRecord{
+		SliceHash:  info.Hash,
+		SliceIndex: index,
+		RsCodes:    info.RSCodes,
+		PeerIDs:    info.PeerID,
+	})
+}
+
+// clearTask 清除任务在数据库中的状态
+func (pool *MemoryPool) clearTask(assetID string, operates int) error {
+	if pool.db == nil {
+		return nil
+	}
+
+	return sqlite.ClearTaskDatabase(pool.db, assetID, operates)
+}
+
+// logSaveError 记录无法返回给调用方的持久化错误
+func logSaveError(assetID string, err error) {
+	if err != nil {
+		logrus.Errorf("保存任务 %s 的状态失败: %v", assetID, err)
+	}
+}
+
+// bitSetFromBytes 根据数据库中保存的位图恢复指定大小的进度
+func bitSetFromBytes(size int, data []byte) BitSet {
+	b := NewBitSet(size)
+	copy(b.bits, data)
+	return *b
+}
@@ -0,0 +1,189 @@
+package pool
+
+import (
+	"testing"
+
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/sqlites"
+)
+
+// openTestDB 在临时目录中打开业务数据库
+func openTestDB(t *testing.T) *sqlites.SqliteDB {
+	t.Helper()
+
+	db, err := sqlites.NewSqliteDB(t.TempDir(), sqlite.DbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := sqlite.InitDBTable(db); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestPersistUploadTask(t *testing.T) {
+	db := openTestDB(t)
+
+	pool, err := NewWithDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.AddUploadTask("asset", 10); err != nil {
+		t.Fatal(err)
+	}
+	pool.UpdateUploadPieceInfo("asset", "hash3", &UploadPieceInfo{Index: 3, PeerID: []string{"a", "b"}})
+	pool.UpdateUploadPieceInfo("asset", "hash9", &UploadPieceInfo{Index: 9})
+	pool.MarkUploadPieceComplete("asset", 3)
+	pool.MarkUploadPieceComplete("asset", 9)
+	if n := pool.RecordUploadRetry("asset", 3); n != 1 {
+		t.Fatalf("重试次数为 %d", n)
+	}
+	pool.RecordUploadRetry("asset", 3)
+	if err := pool.PauseUploadTask("asset"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟进程重启
+	restored, err := NewWithDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, exists := restored.UploadTasks["asset"]
+	if !exists {
+		t.Fatal("上传任务未恢复")
+	}
+	if task.TotalPieces != 10 || !task.Paused {
+		t.Fatalf("上传任务恢复为 %d 片, 暂停 %v", task.TotalPieces, task.Paused)
+	}
+	for i := 0; i < 10; i++ {
+		if want := i == 3 || i == 9; task.Progress.IsSet(i) != want {
+			t.Fatalf("片段 %d 的进度为 %v", i, task.Progress.IsSet(i))
+		}
+	}
+	if info := task.PieceInfo["hash3"]; info == nil || info.Index != 3 || len(info.PeerID) != 2 {
+		t.Fatalf("片段信息恢复为 %+v", info)
+	}
+	if task.RetryCounts[3] != 2 {
+		t.Fatalf("重试次数恢复为 %d", task.RetryCounts[3])
+	}
+
+	// 删除任务后不再恢复
+	restored.DeleteUploadTask("asset")
+	again, err := NewWithDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := again.UploadTasks["asset"]; exists {
+		t.Fatal("已删除的上传任务不应恢复")
+	}
+}
+
+func TestPersistDownloadTask(t *testing.T) {
+	db := openTestDB(t)
+
+	pool, err := NewWithDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.AddDownloadTask("asset", "filehash"); err != nil {
+		t.Fatal(err)
+	}
+	sliceTable := map[int]HashTable{
+		0: {Hash: "h0"},
+		1: {Hash: "h1"},
+		2: {Hash: "h2", RsCodes: true},
+	}
+	pool.UpdateDownloadPieceInfo("", "asset", "file.bin", 300, sliceTable, nil, "filehash")
+	pool.UpdateDownloadPieceInfo("peer", "asset", "", 0, nil, map[int]string{1: "h1"})
+	pool.MarkDownloadPieceComplete("asset", 1)
+
+	restored, err := NewWithDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, exists := restored.DownloadTasks["asset"]
+	if !exists {
+		t.Fatal("下载任务未恢复")
+	}
+	if task.Name != "file.bin" || task.Size != 300 || task.FileHash != "filehash" {
+		t.Fatalf("下载任务恢复为 %s, %d, %s", task.Name, task.Size, task.FileHash)
+	}
+	if task.TotalPieces != 3 || task.DataPieces != 2 {
+		t.Fatalf("下载任务恢复为 %d 片, 数据片段 %d", task.TotalPieces, task.DataPieces)
+	}
+	if !task.Progress.IsSet(1) || task.Progress.IsSet(0) {
+		t.Fatal("下载进度未正确恢复")
+	}
+	if info := task.PieceInfo[2]; info == nil || info.Hash != "h2" || !info.RSCodes {
+		t.Fatalf("片段信息恢复为 %+v", info)
+	}
+	if info := task.PieceInfo[1]; len(info.PeerID) != 1 || info.PeerID[0] != "peer" {
+		t.Fatalf("片段持有者恢复为 %v", info.PeerID)
+	}
+
+	restored.DeleteDownloadTask("asset")
+	again, err := NewWithDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := again.DownloadTasks["asset"]; exists {
+		t.Fatal("已删除的下载任务不应恢复")
+	}
+}
+
+func TestPersistStatementJobs(t *testing.T) {
+	db := openTestDB(t)
+
+	pool, err := NewWithDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"done", "cancelled", "running"} {
+		if err := pool.AddStatementJob(id, "ASYNC CREATE FILE "+id+" OWNED_BY=did"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pool.AddStatementJob("done", ""); err == nil {
+		t.Fatal("重复添加任务应失败")
+	}
+	if err := pool.StartStatementJob("done"); err != nil {
+		t.Fatal(err)
+	}
+	pool.FinishStatementJob("done", []string{"a1", "a2"}, nil)
+	if err := pool.CancelStatementJob("cancelled"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.StartStatementJob("cancelled"); err == nil {
+		t.Fatal("已取消的任务不应开始")
+	}
+	if err := pool.CancelStatementJob("done"); err == nil {
+		t.Fatal("已结束的任务不应取消")
+	}
+	if err := pool.StartStatementJob("running"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启后未结束的任务标记为失败
+	restored, err := NewWithDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := restored.StatementJobs()
+	if len(jobs) != 3 {
+		t.Fatalf("恢复了 %d 个任务", len(jobs))
+	}
+	want := map[string]int{"done": sqlite.StatusSuccess, "cancelled": sqlite.StatusCancelled, "running": sqlite.StatusFailed}
+	for _, job := range jobs {
+		if job.Status != want[job.ID] {
+			t.Errorf("任务 %s 的状态为 %d，期望 %d", job.ID, job.Status, want[job.ID])
+		}
+	}
+	if job, _ := restored.GetStatementJob("done"); len(job.AssetIDs) != 2 || job.Statement != "ASYNC CREATE FILE done OWNED_BY=did" {
+		t.Errorf("恢复的任务为 %+v", job)
+	}
+	if job, _ := restored.GetStatementJob("running"); job.Err == "" {
+		t.Error("未结束的任务没有失败的原因")
+	}
+}
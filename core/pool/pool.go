@@ -3,7 +3,10 @@ package pool
 import (
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/sqlites"
 	"go.uber.org/fx"
 )
 
@@ -11,7 +14,13 @@ import (
 type MemoryPool struct {
 	UploadTasks   map[string]*UploadTask   // 上传任务池
 	DownloadTasks map[string]*DownloadTask // 下载任务池
+	Jobs          map[string]*StatementJob // 异步语句的任务
 	Mu            sync.RWMutex             // 读写互斥锁
+	db            *sqlites.SqliteDB        // 持久化任务状态的数据库(为空时仅保存在内存中)
+
+	subMu    sync.Mutex                      // 控制对订阅者的并发访问
+	subs     map[string][]chan ProgressEvent // 文件资产 -> 进度事件的订阅者(空字符串订阅所有任务)
+	rateFunc RateFunc                        // 提供任务当前速度的函数
 }
 
 // UploadTask 表示单个文件资产的上传状态
@@ -22,6 +31,11 @@ type UploadTask struct {
 	Mu          sync.RWMutex                // 控制对Progress的并发访问
 	RetryCounts map[int]int                 // 记录失败重试次数的映射
 	Paused      bool                        // 是否暂停上传
+	Size        int64                       // 文件的长度(以字节为单位，未知时为 0)
+	DataPieces  int                         // 数据片段的数量
+
+	startedAt     time.Time // 本次运行中任务开始的时间
+	startedPieces int       // 本次运行开始时已完成的片段数量
 }
 
 // UploadPieceInfo 表示单个文件片段的信息
@@ -41,6 +55,10 @@ type DownloadTask struct {
 	PieceInfo   map[int]*DownloadPieceInfo // 存储每个文件片段的哈希和对应节点ID
 	Mu          sync.RWMutex               // 控制对Progress的并发访问
 	Paused      bool                       // 是否暂停上传
+
+	startedAt     time.Time // 本次运行中任务开始的时间
+	startedPieces int       // 本次运行开始时已完成的片段数量
+	completed     bool      // 是否已获取足够的片段
 }
 
 // DownloadPieceInfo 表示单个文件片段的信息和对应的节点ID
@@ -50,28 +68,47 @@ type DownloadPieceInfo struct {
 	RSCodes bool     // 是否为纠删码
 }
 
+// HashTable 描述文件片段的哈希值及其类型
+type HashTable struct {
+	Hash    string // 文件片段的哈希值
+	RsCodes bool   // 是否为纠删码
+}
+
+type NewMemoryPoolInput struct {
+	fx.In
+	LC fx.Lifecycle
+	DB *sqlites.SqliteDB `optional:"true"` // 业务数据库，提供时持久化任务状态
+}
+
 type NewMemoryPoolOutput struct {
 	fx.Out
 	Pool *MemoryPool // 文件上传内存池
 }
 
 // NewMemoryPool 初始化一个新的文件上传内存池
-func NewMemoryPool(lc fx.Lifecycle) (out NewMemoryPoolOutput, err error) {
-	out.Pool = &MemoryPool{
-		UploadTasks:   make(map[string]*UploadTask),
-		DownloadTasks: make(map[string]*DownloadTask),
+// 提供业务数据库时，从数据库恢复进程退出前未完成的任务
+func NewMemoryPool(in NewMemoryPoolInput) (out NewMemoryPoolOutput, err error) {
+	if in.DB == nil {
+		out.Pool = New()
+		return out, nil
+	}
+
+	if out.Pool, err = NewWithDB(in.DB); err != nil {
+		return out, err
 	}
 
 	return out, nil
 }
 
-// NewMemoryPool 初始化一个新的内存池
-// func NewMemoryPool() *MemoryPool {
-// 	return &MemoryPool{
-// 		UploadTasks:   make(map[string]*UploadTask),
-// 		DownloadTasks: make(map[string]*DownloadTask),
-// 	}
-// }
+// New 初始化一个新的内存池
+func New() *MemoryPool {
+	return &MemoryPool{
+		UploadTasks:   make(map[string]*UploadTask),
+		DownloadTasks: make(map[string]*DownloadTask),
+		Jobs:          make(map[string]*StatementJob),
+		subs:          make(map[string][]chan ProgressEvent),
+	}
+}
 
 // AddUploadTask 添加一个新的上传任务
 func (pool *MemoryPool) AddUploadTask(assetID string, totalPieces int) error {
@@ -82,13 +119,19 @@ func (pool *MemoryPool) AddUploadTask(assetID string, totalPieces int) error {
 		return fmt.Errorf("upload task for assetID '%s' already exists", assetID)
 	}
 
-	pool.UploadTasks[assetID] = &UploadTask{
+	task := &UploadTask{
 		TotalPieces: totalPieces,
 		Progress:    *NewBitSet(totalPieces),
 		PieceInfo:   make(map[string]*UploadPieceInfo),
 		RetryCounts: make(map[int]int),
 		Paused:      false,
+		startedAt:   time.Now(),
 	}
+	if err := pool.saveUploadTask(assetID, task); err != nil {
+		return err
+	}
+
+	pool.UploadTasks[assetID] = task
 	return nil
 }
 
@@ -105,6 +148,7 @@ func (pool *MemoryPool) UpdateUploadPieceInfo(assetID string, pieceHash string,
 	task.Mu.Lock()
 	defer task.Mu.Unlock()
 	task.PieceInfo[pieceHash] = pieceInfo
+	logSaveError(assetID, pool.saveUploadPiece(assetID, task, pieceHash))
 }
 
 // MarkUploadPieceComplete 标记上传任务中的一个片段为完成，并返回是否所有片段都已上传
@@ -120,7 +164,10 @@ func (pool *MemoryPool) MarkUploadPieceComplete(assetID string, pieceIndex int)
 	task.Mu.Lock()
 	defer task.Mu.Unlock()
 
+	wasSet := task.Progress.IsSet(pieceIndex)
 	task.Progress.Set(pieceIndex)
+	logSaveError(assetID, pool.saveUploadTask(assetID, task))
+	pool.publish(task.event(assetID, EventPieceCompleted, pieceIndex, nil))
 
 	// 检查所有片段是否已上传
 	for i := 0; i < task.TotalPieces; i++ {
@@ -128,9 +175,73 @@ func (pool *MemoryPool) MarkUploadPieceComplete(assetID string, pieceIndex int)
 			return false // 如果有任何片段未上传，则返回 false
 		}
 	}
+	if !wasSet {
+		pool.publish(task.event(assetID, EventCompleted, -1, nil))
+	}
 	return true // 所有片段已上传
 }
 
+// MarkUploadPieceFailed 通知订阅者上传任务中的一个片段失败
+func (pool *MemoryPool) MarkUploadPieceFailed(assetID string, pieceIndex int, err error) {
+	pool.Mu.RLock()
+	task, exists := pool.UploadTasks[assetID]
+	pool.Mu.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	task.Mu.RLock()
+	defer task.Mu.RUnlock()
+	pool.publish(task.event(assetID, EventPieceFailed, pieceIndex, err))
+}
+
+// SetUploadTaskSize 设置上传任务的文件大小和数据片段数量，用于计算字节进度
+func (pool *MemoryPool) SetUploadTaskSize(assetID string, size int64, dataPieces int) {
+	pool.Mu.RLock()
+	task, exists := pool.UploadTasks[assetID]
+	pool.Mu.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	task.Mu.Lock()
+	defer task.Mu.Unlock()
+	task.Size = size
+	task.DataPieces = dataPieces
+}
+
+// GetUploadTaskPieces 获取上传任务的文件总片数，任务不存在时返回 false
+func (pool *MemoryPool) GetUploadTaskPieces(assetID string) (int, bool) {
+	pool.Mu.RLock()
+	task, exists := pool.UploadTasks[assetID]
+	pool.Mu.RUnlock()
+
+	if !exists {
+		return 0, false
+	}
+
+	task.Mu.RLock()
+	defer task.Mu.RUnlock()
+	return task.TotalPieces, true
+}
+
+// IsUploadPieceComplete 检查上传任务中的一个片段是否已完成
+func (pool *MemoryPool) IsUploadPieceComplete(assetID string, pieceIndex int) bool {
+	pool.Mu.RLock()
+	task, exists := pool.UploadTasks[assetID]
+	pool.Mu.RUnlock()
+
+	if !exists {
+		return false
+	}
+
+	task.Mu.RLock()
+	defer task.Mu.RUnlock()
+	return pieceIndex >= 0 && pieceIndex < task.TotalPieces && task.Progress.IsSet(pieceIndex)
+}
+
 // IsUploadComplete 检查指定文件资产的上传是否完成
 func (pool *MemoryPool) IsUploadComplete(assetID string) bool {
 	pool.Mu.RLock()
@@ -186,10 +297,11 @@ func (pool *MemoryPool) PauseUploadTask(assetID string) error {
 	}
 
 	task.Mu.Lock()
+	defer task.Mu.Unlock()
 	task.Paused = true
-	task.Mu.Unlock()
+	pool.publish(task.event(assetID, EventPaused, -1, nil))
 
-	return nil
+	return pool.saveUploadTask(assetID, task)
 }
 
 // ResumeUploadTask 恢复指定的上传任务
@@ -203,10 +315,11 @@ func (pool *MemoryPool) ResumeUploadTask(assetID string) error {
 	}
 
 	task.Mu.Lock()
+	defer task.Mu.Unlock()
 	task.Paused = false
-	task.Mu.Unlock()
+	pool.publish(task.event(assetID, EventResumed, -1, nil))
 
-	return nil
+	return pool.saveUploadTask(assetID, task)
 }
 
 // IsUploadTaskPaused 检查指定的上传任务是否已暂停
@@ -224,11 +337,44 @@ func (pool *MemoryPool) IsUploadTaskPaused(assetID string) (bool, error) {
 	return task.Paused, nil
 }
 
-// DeleteUploadTask 删除指定资产的上传任务
+// RecordUploadRetry 记录上传任务中一个片段的失败重试，并返回该片段累计的重试次数
+func (pool *MemoryPool) RecordUploadRetry(assetID string, pieceIndex int) int {
+	pool.Mu.RLock()
+	task, exists := pool.UploadTasks[assetID]
+	pool.Mu.RUnlock()
+
+	if !exists {
+		return 0
+	}
+
+	task.Mu.Lock()
+	defer task.Mu.Unlock()
+
+	task.RetryCounts[pieceIndex]++
+	for hash, pieceInfo := range task.PieceInfo {
+		if pieceInfo.Index == pieceIndex {
+			logSaveError(assetID, pool.saveUploadPiece(assetID, task, hash))
+			break
+		}
+	}
+
+	return task.RetryCounts[pieceIndex]
+}
+
+// DeleteUploadTask 删除指定资产的上传任务，任务未完成时通知订阅者任务已取消
 func (pool *MemoryPool) DeleteUploadTask(assetID string) {
 	pool.Mu.Lock()
 	defer pool.Mu.Unlock()
+
+	if task, exists := pool.UploadTasks[assetID]; exists {
+		task.Mu.RLock()
+		if countSet(&task.Progress, task.TotalPieces) < task.TotalPieces {
+			pool.publish(task.event(assetID, EventCancelled, -1, nil))
+		}
+		task.Mu.RUnlock()
+	}
 	delete(pool.UploadTasks, assetID)
+	logSaveError(assetID, pool.clearTask(assetID, sqlite.OperateUpload))
 }
 
 // AddDownloadTask 添加一个新的下载任务。如果任务已存在，返回错误。
@@ -247,12 +393,16 @@ func (pool *MemoryPool) AddDownloadTask(assetID string, fileHash ...string) erro
 		Progress:    *NewBitSet(0),
 		PieceInfo:   make(map[int]*DownloadPieceInfo),
 		Paused:      false,
+		startedAt:   time.Now(),
 	}
 
 	// 如果提供了文件哈希值，设置它
 	if len(fileHash) > 0 {
 		newTask.FileHash = fileHash[0]
 	}
+	if err := pool.saveDownloadTask(assetID, newTask); err != nil {
+		return err
+	}
 
 	pool.DownloadTasks[assetID] = newTask
 	return nil
@@ -305,18 +455,43 @@ func (pool *MemoryPool) UpdateDownloadPieceInfo(peerID string, assetID, name str
 
 		downloadTask.Name = name // 文件的基本名称
 		downloadTask.Size = size // 常规文件的长度(以字节为单位)
+
+		for index := range downloadTask.PieceInfo {
+			logSaveError(assetID, pool.saveDownloadPiece(assetID, downloadTask, index))
+		}
+		logSaveError(assetID, pool.saveDownloadTask(assetID, downloadTask))
 	}
 
 	// 更新每个文件片段的节点信息
 	for _, hash := range pieceHashes {
 		for index, piece := range downloadTask.PieceInfo {
-			if piece.Hash == hash {
+			if piece.Hash == hash && !containsPeer(piece.PeerID, peerID) {
 				downloadTask.PieceInfo[index].PeerID = append(downloadTask.PieceInfo[index].PeerID, peerID)
+				logSaveError(assetID, pool.saveDownloadPiece(assetID, downloadTask, index))
 			}
 		}
 	}
 }
 
+// containsPeer 检查节点是否已在片段的节点列表中
+func containsPeer(peers []string, peerID string) bool {
+	for _, id := range peers {
+		if id == peerID {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDownloadTask 获取指定的下载任务
+func (pool *MemoryPool) GetDownloadTask(assetID string) (*DownloadTask, bool) {
+	pool.Mu.RLock()
+	defer pool.Mu.RUnlock()
+
+	task, exists := pool.DownloadTasks[assetID]
+	return task, exists
+}
+
 // MarkDownloadPieceComplete 标记下载任务中的一个片段为完成，并返回是否所有片段都已下载
 func (pool *MemoryPool) MarkDownloadPieceComplete(assetID string, pieceIndex int) bool {
 	pool.Mu.RLock()
@@ -331,15 +506,40 @@ func (pool *MemoryPool) MarkDownloadPieceComplete(assetID string, pieceIndex int
 	defer task.Mu.Unlock()
 
 	task.Progress.Set(pieceIndex)
+	logSaveError(assetID, pool.saveDownloadTask(assetID, task))
+
+	return pool.downloadPieceCompleted(assetID, task, pieceIndex)
+}
+
+// downloadPieceCompleted 通知订阅者下载任务中的一个片段已完成，并返回是否已获取足够的片段
+// 调用方需持有任务的锁
+func (pool *MemoryPool) downloadPieceCompleted(assetID string, task *DownloadTask, pieceIndex int) bool {
+	pool.publish(task.event(assetID, EventPieceCompleted, pieceIndex, nil))
 
 	// 计算已下载的片段数量
-	downloadedPieces := 0
-	for i := 0; i < task.TotalPieces; i++ {
-		if task.Progress.IsSet(i) {
-			downloadedPieces++
-		}
+	downloadedPieces := countSet(&task.Progress, task.TotalPieces)
+	enough := downloadedPieces >= task.DataPieces // 检查是否达到数据片段的数量
+	if enough && !task.completed {
+		task.completed = true
+		pool.publish(task.event(assetID, EventCompleted, -1, nil))
 	}
-	return downloadedPieces >= task.DataPieces // 检查是否达到数据片段的数量
+
+	return enough
+}
+
+// MarkDownloadPieceFailed 通知订阅者下载任务中的一个片段失败
+func (pool *MemoryPool) MarkDownloadPieceFailed(assetID string, pieceIndex int, err error) {
+	pool.Mu.RLock()
+	task, exists := pool.DownloadTasks[assetID]
+	pool.Mu.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	task.Mu.RLock()
+	defer task.Mu.RUnlock()
+	pool.publish(task.event(assetID, EventPieceFailed, pieceIndex, err))
 }
 
 // MarkDownloadPieceCompleteByHash 根据文件片段的哈希值标记下载任务中的一个片段为完成，并返回是否所有片段都已下载
@@ -356,27 +556,15 @@ func (pool *MemoryPool) MarkDownloadPieceCompleteByHash(assetID, pieceHash strin
 	defer task.Mu.Unlock()
 
 	// 查找哈希值对应的片段索引
-	found := false
 	for index, pieceInfo := range task.PieceInfo {
 		if pieceInfo.Hash == pieceHash {
 			task.Progress.Set(index) // 更新进度
-			found = true
-			break
+			logSaveError(assetID, pool.saveDownloadTask(assetID, task))
+			return pool.downloadPieceCompleted(assetID, task, index)
 		}
 	}
 
-	if !found {
-		return false // 如果没有找到对应的哈希值，则返回 false
-	}
-
-	// 计算已下载的片段数量
-	downloadedPieces := 0
-	for i := 0; i < task.TotalPieces; i++ {
-		if task.Progress.IsSet(i) {
-			downloadedPieces++
-		}
-	}
-	return downloadedPieces >= task.DataPieces // 检查是否达到数据片段的数量
+	return false // 如果没有找到对应的哈希值，则返回 false
 }
 
 // IsDownloadComplete 检查指定文件资产的下载是否完成
@@ -456,12 +644,21 @@ func (pool *MemoryPool) ResetDownloadTask(assetID string) error {
 	}
 
 	// 重置下载任务
-	pool.DownloadTasks[assetID] = &DownloadTask{
+	task := &DownloadTask{
 		TotalPieces: 0,
 		Progress:    *NewBitSet(0),
 		PieceInfo:   make(map[int]*DownloadPieceInfo),
 		Paused:      false,
+		startedAt:   time.Now(),
 	}
+	if err := pool.clearTask(assetID, sqlite.OperateDownload); err != nil {
+		return err
+	}
+	if err := pool.saveDownloadTask(assetID, task); err != nil {
+		return err
+	}
+
+	pool.DownloadTasks[assetID] = task
 	return nil
 }
 
@@ -475,10 +672,13 @@ func (pool *MemoryPool) RevertDownloadPieceProgress(assetID, pieceHash string) e
 		return fmt.Errorf("download task not found: %s", assetID)
 	}
 
+	task.Mu.Lock()
+	defer task.Mu.Unlock()
+
 	for index, pieceInfo := range task.PieceInfo {
 		if pieceInfo.Hash == pieceHash {
 			task.Progress.Clear(index) // 清除该片段的进度
-			return nil
+			return pool.saveDownloadTask(assetID, task)
 		}
 	}
 	return fmt.Errorf("piece hash not found in download task: %s", pieceHash)
@@ -495,10 +695,11 @@ func (pool *MemoryPool) PauseDownloadTask(assetID string) error {
 	}
 
 	task.Mu.Lock()
+	defer task.Mu.Unlock()
 	task.Paused = true
-	task.Mu.Unlock()
+	pool.publish(task.event(assetID, EventPaused, -1, nil))
 
-	return nil
+	return pool.saveDownloadTask(assetID, task)
 }
 
 // ResumeDownloadTask 恢复指定的下载任务
@@ -512,10 +713,11 @@ func (pool *MemoryPool) ResumeDownloadTask(assetID string) error {
 	}
 
 	task.Mu.Lock()
+	defer task.Mu.Unlock()
 	task.Paused = false
-	task.Mu.Unlock()
+	pool.publish(task.event(assetID, EventResumed, -1, nil))
 
-	return nil
+	return pool.saveDownloadTask(assetID, task)
 }
 
 // IsDownloadTaskPaused 检查指定的下载任务是否已暂停
@@ -533,11 +735,20 @@ func (pool *MemoryPool) IsDownloadTaskPaused(assetID string) (bool, error) {
 	return task.Paused, nil
 }
 
-// DeleteDownloadTask 删除指定资产的下载任务
+// DeleteDownloadTask 删除指定资产的下载任务，任务未完成时通知订阅者任务已取消
 func (pool *MemoryPool) DeleteDownloadTask(assetID string) {
 	pool.Mu.Lock()
 	defer pool.Mu.Unlock()
+
+	if task, exists := pool.DownloadTasks[assetID]; exists {
+		task.Mu.RLock()
+		if !task.completed {
+			pool.publish(task.event(assetID, EventCancelled, -1, nil))
+		}
+		task.Mu.RUnlock()
+	}
 	delete(pool.DownloadTasks, assetID)
+	logSaveError(assetID, pool.clearTask(assetID, sqlite.OperateDownload))
 }
 
 // BitSet 实现
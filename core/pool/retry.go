@@ -0,0 +1,422 @@
+package pool
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/core/sqlite"
+)
+
+// RetryPolicy 描述失败片段的重试策略
+type RetryPolicy struct {
+	MaxRetries   int           // 每个片段的最大重试次数
+	BaseInterval time.Duration // 首次重试的间隔，之后每次翻倍
+	MaxInterval  time.Duration // 重试间隔的上限(为 0 时不设上限)
+	Jitter       float64       // 随机抖动的比例(0~1)，间隔在 [d*(1-Jitter), d] 之间
+}
+
+// DefaultRetryPolicy 返回推荐的重试策略
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:   5,
+		BaseInterval: 2 * time.Second,
+		MaxInterval:  5 * time.Minute,
+		Jitter:       0.5,
+	}
+}
+
+// Backoff 返回第 attempt 次重试前的等待时间(attempt 从 1 开始)
+// r 为空时不添加随机抖动
+func (p RetryPolicy) Backoff(attempt int, r *rand.Rand) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	d := p.BaseInterval
+	for i := 1; i < attempt; i++ {
+		if p.MaxInterval > 0 && d >= p.MaxInterval {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxInterval > 0 && d > p.MaxInterval {
+		d = p.MaxInterval
+	}
+
+	if r != nil && p.Jitter > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		d -= time.Duration(float64(d) * jitter * r.Float64())
+	}
+
+	return d
+}
+
+// Retry 描述一个到期需要重新处理的文件片段
+type Retry struct {
+	AssetID    string // 文件资产的唯一标识
+	Operates   int    // 操作(0:下载、1:上传)
+	PieceIndex int    // 文件片段的索引
+	Attempt    int    // 第几次重试
+
+	epoch uint64 // 交付时文件资产被取消的次数
+}
+
+// PieceFailure 描述文件片段的失败情况
+type PieceFailure struct {
+	Operates   int       // 操作(0:下载、1:上传)
+	PieceIndex int       // 文件片段的索引
+	Attempts   int       // 已失败的次数
+	Reason     string    // 最近一次失败的原因
+	FailedAt   time.Time // 最近一次失败的时间
+	NextRetry  time.Time // 下一次重试的时间(已放弃时为零值)
+}
+
+// retryKey 标识一个任务中的文件片段
+type retryKey struct {
+	assetID    string
+	operates   int
+	pieceIndex int
+}
+
+// retryItem 是重试队列中的一项
+type retryItem struct {
+	key     retryKey
+	attempt int
+	due     time.Time
+}
+
+// retryQueue 是按到期时间排序的最小堆
+type retryQueue []*retryItem
+
+func (q retryQueue) Len() int            { return len(q) }
+func (q retryQueue) Less(i, j int) bool  { return q[i].due.Before(q[j].due) }
+func (q retryQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *retryQueue) Push(x interface{}) { *q = append(*q, x.(*retryItem)) }
+func (q *retryQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// RetryScheduler 按指数退避重新排队失败的文件片段
+// 超过最大重试次数后，任务在数据库中被标记为失败
+type RetryScheduler struct {
+	pool   *MemoryPool
+	policy RetryPolicy
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	queue    retryQueue
+	failures map[retryKey]*PieceFailure
+	held     map[string]int    // 文件资产 -> 暂停重试的 Hold 调用数
+	epochs   map[string]uint64 // 文件资产 -> 被取消的次数，用于丢弃取消前已交付的重试
+	ready    chan *Retry
+	wake     chan struct{}
+}
+
+// NewRetryScheduler 创建一个重试调度器
+func NewRetryScheduler(pool *MemoryPool, policy RetryPolicy) *RetryScheduler {
+	return &RetryScheduler{
+		pool:     pool,
+		policy:   policy,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		failures: make(map[retryKey]*PieceFailure),
+		held:     make(map[string]int),
+		epochs:   make(map[string]uint64),
+		ready:    make(chan *Retry),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Failure 记录文件片段的一次失败，返回下一次重试前的等待时间
+// 超过最大重试次数时返回 false，并将任务标记为失败
+func (s *RetryScheduler) Failure(assetID string, operates, pieceIndex int, reason error) (time.Duration, bool) {
+	key := retryKey{assetID: assetID, operates: operates, pieceIndex: pieceIndex}
+	if reason == nil {
+		reason = fmt.Errorf("未知错误")
+	}
+
+	// 上传任务的重试次数保存在内存池中，进程重启后延续
+	attempts := 0
+	if operates == sqlite.OperateUpload {
+		attempts = s.pool.RecordUploadRetry(assetID, pieceIndex)
+	}
+
+	s.mu.Lock()
+	failure, exists := s.failures[key]
+	if !exists {
+		failure = &PieceFailure{Operates: operates, PieceIndex: pieceIndex}
+		s.failures[key] = failure
+	}
+	if attempts == 0 {
+		attempts = failure.Attempts + 1
+	}
+	failure.Attempts = attempts
+	failure.Reason = reason.Error()
+	failure.FailedAt = time.Now()
+	failure.NextRetry = time.Time{}
+
+	exhausted := attempts > s.policy.MaxRetries
+	var delay time.Duration
+	if !exhausted {
+		delay = s.policy.Backoff(attempts, s.rand)
+		failure.NextRetry = failure.FailedAt.Add(delay)
+	}
+	s.mu.Unlock()
+
+	s.pool.markPieceFailed(assetID, operates, pieceIndex, reason)
+	if exhausted {
+		err := fmt.Errorf("文件片段 %d 已失败 %d 次: %v", pieceIndex, attempts, reason)
+		logSaveError(assetID, s.pool.MarkTaskFailed(assetID, operates, err))
+		return 0, false
+	}
+
+	return delay, true
+}
+
+// Requeue 记录文件片段的一次失败，并在退避时间到期后通过 Ready 重新交付
+// 超过最大重试次数，或文件资产的重试被 Hold 暂停时返回 false，暂停时不记录失败
+func (s *RetryScheduler) Requeue(assetID string, operates, pieceIndex int, reason error) bool {
+	s.mu.Lock()
+	held := s.held[assetID] > 0
+	s.mu.Unlock()
+	if held {
+		return false
+	}
+
+	delay, ok := s.Failure(assetID, operates, pieceIndex, reason)
+	if !ok {
+		return false
+	}
+
+	key := retryKey{assetID: assetID, operates: operates, pieceIndex: pieceIndex}
+	s.mu.Lock()
+	attempt := s.failures[key].Attempts
+	heap.Push(&s.queue, &retryItem{key: key, attempt: attempt, due: time.Now().Add(delay)})
+	s.mu.Unlock()
+
+	s.notify()
+	return true
+}
+
+// Succeed 清除文件片段的失败记录
+func (s *RetryScheduler) Succeed(assetID string, operates, pieceIndex int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failures, retryKey{assetID: assetID, operates: operates, pieceIndex: pieceIndex})
+}
+
+// Failures 返回文件资产中各片段的失败情况，按操作和片段索引排序
+func (s *RetryScheduler) Failures(assetID string) []PieceFailure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var failures []PieceFailure
+	for key, failure := range s.failures {
+		if key.assetID == assetID {
+			failures = append(failures, *failure)
+		}
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		if failures[i].Operates != failures[j].Operates {
+			return failures[i].Operates < failures[j].Operates
+		}
+		return failures[i].PieceIndex < failures[j].PieceIndex
+	})
+
+	return failures
+}
+
+// Cancel 取消文件资产所有等待中的重试，失败记录保留以便查询
+// 已从 Ready 交付但尚未经由 Dispatch 处理的重试同样被丢弃
+func (s *RetryScheduler) Cancel(assetID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancel(assetID)
+}
+
+// cancel 丢弃文件资产等待中的重试，调用方需持有锁
+func (s *RetryScheduler) cancel(assetID string) {
+	s.epochs[assetID]++
+	queue := s.queue[:0]
+	for _, item := range s.queue {
+		if item.key.assetID != assetID {
+			queue = append(queue, item)
+		}
+	}
+	s.queue = queue
+	heap.Init(&s.queue)
+}
+
+// Hold 取消文件资产所有等待中的重试，并在返回的函数被调用前忽略其重新排队和交付
+// 用于等待文件资产正在运行的传输结束，这些传输的失败不再产生重试
+func (s *RetryScheduler) Hold(assetID string) func() {
+	s.mu.Lock()
+	s.cancel(assetID)
+	s.held[assetID]++
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			if s.held[assetID]--; s.held[assetID] <= 0 {
+				delete(s.held, assetID)
+			}
+			s.mu.Unlock()
+		})
+	}
+}
+
+// Dispatch 在重试交付后没有被取消或暂停时调用 submit，submit 执行期间不会被取消
+// 从 Ready 接收的重试需要经由 Dispatch 提交，保证 Cancel 返回后不再提交此前交付的重试
+func (s *RetryScheduler) Dispatch(retry *Retry, submit func(*Retry)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.held[retry.AssetID] > 0 || retry.epoch != s.epochs[retry.AssetID] {
+		return false
+	}
+	submit(retry)
+	return true
+}
+
+// Reset 取消文件资产所有等待中的重试并清除失败记录
+func (s *RetryScheduler) Reset(assetID string) {
+	s.Cancel(assetID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.failures {
+		if key.assetID == assetID {
+			delete(s.failures, key)
+		}
+	}
+}
+
+// Ready 返回到期需要重新处理的文件片段，需要同时运行 Run
+func (s *RetryScheduler) Ready() <-chan *Retry {
+	return s.ready
+}
+
+// Run 在上下文结束前持续交付到期的重试，已暂停任务的重试推迟一个基础间隔
+func (s *RetryScheduler) Run(ctx context.Context) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		var (
+			next  *retryItem
+			epoch uint64
+		)
+		wait := time.Hour
+		if len(s.queue) > 0 {
+			if wait = time.Until(s.queue[0].due); wait <= 0 {
+				// 取出时记录取消的次数，此后的 Cancel 使其在 Dispatch 时被丢弃
+				next = heap.Pop(&s.queue).(*retryItem)
+				epoch = s.epochs[next.key.assetID]
+			}
+		}
+		s.mu.Unlock()
+
+		if next != nil {
+			if s.pool.isTaskPaused(next.key.assetID, next.key.operates) {
+				next.due = time.Now().Add(s.policy.BaseInterval)
+				s.mu.Lock()
+				heap.Push(&s.queue, next)
+				s.mu.Unlock()
+				continue
+			}
+
+			retry := &Retry{
+				AssetID:    next.key.assetID,
+				Operates:   next.key.operates,
+				PieceIndex: next.key.pieceIndex,
+				Attempt:    next.attempt,
+				epoch:      epoch,
+			}
+			select {
+			case s.ready <- retry:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// notify 唤醒 Run 重新检查队列
+func (s *RetryScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// MarkTaskFailed 将任务在数据库中标记为失败，并通知订阅者
+func (pool *MemoryPool) MarkTaskFailed(assetID string, operates int, reason error) error {
+	pool.Mu.RLock()
+	upload, uploadExists := pool.UploadTasks[assetID]
+	download, downloadExists := pool.DownloadTasks[assetID]
+	pool.Mu.RUnlock()
+
+	switch {
+	case operates == sqlite.OperateUpload && uploadExists:
+		upload.Mu.RLock()
+		pool.publish(upload.event(assetID, EventFailed, -1, reason))
+		upload.Mu.RUnlock()
+	case operates == sqlite.OperateDownload && downloadExists:
+		download.Mu.RLock()
+		pool.publish(download.event(assetID, EventFailed, -1, reason))
+		download.Mu.RUnlock()
+	}
+
+	if pool.db == nil {
+		return nil
+	}
+	return sqlite.UpdateFileDatabaseStatus(pool.db, assetID, operates, sqlite.StatusFailed)
+}
+
+// markPieceFailed 通知订阅者任务中的一个片段失败
+func (pool *MemoryPool) markPieceFailed(assetID string, operates, pieceIndex int, reason error) {
+	if operates == sqlite.OperateUpload {
+		pool.MarkUploadPieceFailed(assetID, pieceIndex, reason)
+	} else {
+		pool.MarkDownloadPieceFailed(assetID, pieceIndex, reason)
+	}
+}
+
+// isTaskPaused 检查任务是否已暂停，任务不存在时返回 false
+func (pool *MemoryPool) isTaskPaused(assetID string, operates int) bool {
+	var paused bool
+	if operates == sqlite.OperateUpload {
+		paused, _ = pool.IsUploadTaskPaused(assetID)
+	} else {
+		paused, _ = pool.IsDownloadTaskPaused(assetID)
+	}
+	return paused
+}
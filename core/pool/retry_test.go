@@ -0,0 +1,194 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/core/sqlite"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		MaxRetries:   10,
+		BaseInterval: time.Second,
+		MaxInterval:  10 * time.Second,
+		Jitter:       0.5,
+	}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, d := range want {
+		if got := policy.Backoff(i+1, nil); got != d {
+			t.Fatalf("第 %d 次重试的间隔为 %v, 期望 %v", i+1, got, d)
+		}
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for attempt := 1; attempt <= 6; attempt++ {
+		max := policy.Backoff(attempt, nil)
+		for i := 0; i < 100; i++ {
+			got := policy.Backoff(attempt, r)
+			if got > max || got < max/2 {
+				t.Fatalf("第 %d 次重试的间隔 %v 超出 [%v, %v]", attempt, got, max/2, max)
+			}
+		}
+	}
+}
+
+func TestRetrySchedulerRequeue(t *testing.T) {
+	pool := New()
+	if err := pool.AddUploadTask("asset", 3); err != nil {
+		t.Fatal(err)
+	}
+	s := NewRetryScheduler(pool, RetryPolicy{MaxRetries: 3, BaseInterval: 20 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	start := time.Now()
+	if !s.Requeue("asset", sqlite.OperateUpload, 2, fmt.Errorf("节点不可达")) {
+		t.Fatal("首次失败不应放弃")
+	}
+
+	select {
+	case retry := <-s.Ready():
+		if retry.AssetID != "asset" || retry.PieceIndex != 2 || retry.Attempt != 1 {
+			t.Fatalf("收到的重试为 %+v", retry)
+		}
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Fatalf("重试在 %v 后交付, 早于退避时间", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("未收到到期的重试")
+	}
+
+	failures := s.Failures("asset")
+	if len(failures) != 1 || failures[0].PieceIndex != 2 || failures[0].Attempts != 1 || failures[0].Reason != "节点不可达" {
+		t.Fatalf("失败情况为 %+v", failures)
+	}
+	if pool.UploadTasks["asset"].RetryCounts[2] != 1 {
+		t.Fatal("重试次数未记录到上传任务")
+	}
+
+	s.Succeed("asset", sqlite.OperateUpload, 2)
+	if failures := s.Failures("asset"); len(failures) != 0 {
+		t.Fatalf("成功后仍有失败记录 %+v", failures)
+	}
+}
+
+func TestRetrySchedulerHold(t *testing.T) {
+	pool := New()
+	if err := pool.AddUploadTask("asset", 3); err != nil {
+		t.Fatal(err)
+	}
+	s := NewRetryScheduler(pool, RetryPolicy{MaxRetries: 3, BaseInterval: time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	// 取消前已交付的重试不再提交
+	s.Requeue("asset", sqlite.OperateUpload, 0, fmt.Errorf("节点不可达"))
+	retry := <-s.Ready()
+	s.Cancel("asset")
+	if s.Dispatch(retry, func(*Retry) { t.Fatal("提交了取消前交付的重试") }) {
+		t.Fatal("取消前交付的重试被提交")
+	}
+
+	// 暂停期间的失败不再重新排队
+	release := s.Hold("asset")
+	if s.Requeue("asset", sqlite.OperateUpload, 1, fmt.Errorf("节点不可达")) {
+		t.Fatal("暂停期间的失败重新排队")
+	}
+	release()
+	release()
+
+	s.Requeue("asset", sqlite.OperateUpload, 2, fmt.Errorf("节点不可达"))
+	submitted := false
+	if !s.Dispatch(<-s.Ready(), func(retry *Retry) { submitted = retry.PieceIndex == 2 }) || !submitted {
+		t.Fatal("恢复后的重试未被提交")
+	}
+}
+
+func TestRetrySchedulerPausedTask(t *testing.T) {
+	pool := New()
+	if err := pool.AddDownloadTask("asset"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.PauseDownloadTask("asset"); err != nil {
+		t.Fatal(err)
+	}
+	s := NewRetryScheduler(pool, RetryPolicy{MaxRetries: 3, BaseInterval: 10 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	s.Requeue("asset", sqlite.OperateDownload, 0, fmt.Errorf("校验失败"))
+	select {
+	case retry := <-s.Ready():
+		t.Fatalf("已暂停任务的重试被交付 %+v", retry)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := pool.ResumeDownloadTask("asset"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-s.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("任务恢复后未收到重试")
+	}
+}
+
+func TestRetrySchedulerExhausted(t *testing.T) {
+	db := openTestDB(t)
+	pool, err := NewWithDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.AddUploadTask("asset", 2); err != nil {
+		t.Fatal(err)
+	}
+	pool.UpdateUploadPieceInfo("asset", "hash1", &UploadPieceInfo{Index: 1})
+	ch := pool.Subscribe("asset")
+
+	s := NewRetryScheduler(pool, RetryPolicy{MaxRetries: 2, BaseInterval: time.Millisecond})
+	for i := 0; i < 2; i++ {
+		if _, ok := s.Failure("asset", sqlite.OperateUpload, 1, fmt.Errorf("超时")); !ok {
+			t.Fatalf("第 %d 次失败不应放弃", i+1)
+		}
+	}
+	if s.Requeue("asset", sqlite.OperateUpload, 1, fmt.Errorf("超时")) {
+		t.Fatal("超过最大重试次数后应放弃")
+	}
+	if len(s.queue) != 0 {
+		t.Fatal("放弃的片段不应进入重试队列")
+	}
+
+	record, err := sqlite.SelectOneFileDatabase(db, "asset", sqlite.OperateUpload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != sqlite.StatusFailed {
+		t.Fatalf("任务状态为 %d, 期望失败", record.Status)
+	}
+
+	events := collect(t, ch)
+	last := events[len(events)-1]
+	if last.Type != EventFailed || last.Err == nil {
+		t.Fatalf("最后一个事件为 %+v", last)
+	}
+
+	// 重试次数已持久化，进程重启后继续累计
+	restored, err := NewWithDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := restored.UploadTasks["asset"].RetryCounts[1]; n != 3 {
+		t.Fatalf("恢复的重试次数为 %d", n)
+	}
+}
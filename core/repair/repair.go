@@ -0,0 +1,403 @@
+// 文件片段在网络中的持有情况跟踪和丢失片段的重建
+package repair
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/core/transport"
+	"github.com/bpfs/defs/reedsolomon"
+	"github.com/bpfs/defs/util"
+	"github.com/sirupsen/logrus"
+)
+
+// Asset 描述需要维持冗余的文件资产
+type Asset struct {
+	ID           string   // 文件资产的唯一标识
+	DataShards   int      // 数据片段的数量
+	ParityShards int      // 奇偶校验片段的数量
+	Hashes       []string // 各片段内容的哈希值，用于校验获取和重建的片段，为空时不校验
+}
+
+// Validate 检查文件资产的描述是否有效
+func (a *Asset) Validate() error {
+	if a.ID == "" {
+		return fmt.Errorf("文件资产的唯一标识不可为空")
+	}
+	if a.DataShards <= 0 || a.ParityShards < 0 {
+		return fmt.Errorf("数据片段 %d 个、奇偶校验片段 %d 个的编码方式无效", a.DataShards, a.ParityShards)
+	}
+	if len(a.Hashes) > 0 && len(a.Hashes) != a.DataShards+a.ParityShards {
+		return fmt.Errorf("片段哈希值的数量 %d 与片段的数量 %d 不符", len(a.Hashes), a.DataShards+a.ParityShards)
+	}
+	return nil
+}
+
+// verify 检查片段内容与记录的哈希值是否一致
+func (a *Asset) verify(index int, data []byte) bool {
+	if len(a.Hashes) == 0 {
+		return true
+	}
+	return hex.EncodeToString(util.CalculateHash(data)) == a.Hashes[index]
+}
+
+// Health 是文件资产在网络中的持有情况
+type Health struct {
+	AssetID string    // 文件资产的唯一标识
+	Holders []int     // 各片段在线持有者的数量
+	Live    int       // 至少有一个在线持有者的片段数
+	Spare   int       // 可用片段超出数据片段数量的余量，小于 0 时文件无法恢复
+	Time    time.Time // 查询的时间
+}
+
+// Missing 返回没有在线持有者的片段索引
+func (h *Health) Missing() []int {
+	var missing []int
+	for index, n := range h.Holders {
+		if n == 0 {
+			missing = append(missing, index)
+		}
+	}
+	return missing
+}
+
+// Result 描述一次修复的结果
+type Result struct {
+	Health   *Health        // 修复前的持有情况
+	Repaired map[int]string // 重建的片段索引 -> 接收片段的节点
+}
+
+// Coordinator 跟踪文件资产各片段的在线持有者，
+// 余量低于阈值时获取足够的片段，重建丢失的片段并发送给新的节点
+type Coordinator struct {
+	transport transport.Transport
+	local     transport.Store // 本节点的文件片段存储，为空时只从其他节点获取
+	minSpare  int
+	interval  time.Duration
+
+	mu     sync.Mutex
+	assets map[string]*Asset  // 跟踪的文件资产
+	health map[string]*Health // 最近一次查询的持有情况
+	locks  map[string]*sync.Mutex
+}
+
+// New 创建修复协调器
+// minSpare 为可用片段超出数据片段数量的最小余量，余量低于该值时修复，不大于 0 或超过奇偶校验片段的数量时，任何片段丢失都会修复；
+// interval 为两轮检查的间隔，为 0 时不定期检查；获取受访问控制的片段时，请求者的凭证由 t 签名
+func New(t transport.Transport, local transport.Store, minSpare int, interval time.Duration) *Coordinator {
+	return &Coordinator{
+		transport: t,
+		local:     local,
+		minSpare:  minSpare,
+		interval:  interval,
+		assets:    make(map[string]*Asset),
+		health:    make(map[string]*Health),
+		locks:     make(map[string]*sync.Mutex),
+	}
+}
+
+// Watch 开始跟踪文件资产，已跟踪的文件资产更新其描述
+func (c *Coordinator) Watch(asset Asset) error {
+	if err := asset.Validate(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	asset.Hashes = append([]string(nil), asset.Hashes...)
+	c.assets[asset.ID] = &asset
+	if _, exists := c.locks[asset.ID]; !exists {
+		c.locks[asset.ID] = new(sync.Mutex)
+	}
+	return nil
+}
+
+// Unwatch 停止跟踪文件资产
+func (c *Coordinator) Unwatch(assetID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.assets, assetID)
+	delete(c.health, assetID)
+	delete(c.locks, assetID)
+}
+
+// Assets 返回跟踪的文件资产的唯一标识，按字典序排列
+func (c *Coordinator) Assets() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ids := make([]string, 0, len(c.assets))
+	for id := range c.assets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Health 返回最近一次查询的文件资产持有情况，未查询过时返回 nil
+func (c *Coordinator) Health(assetID string) *Health {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.health[assetID]
+}
+
+// asset 返回跟踪的文件资产及其修复锁
+func (c *Coordinator) asset(assetID string) (*Asset, *sync.Mutex, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	asset, exists := c.assets[assetID]
+	if !exists {
+		return nil, nil, fmt.Errorf("文件资产 %s 未被跟踪", assetID)
+	}
+	return asset, c.locks[assetID], nil
+}
+
+// threshold 返回文件资产需要维持的最小余量
+func (c *Coordinator) threshold(asset *Asset) int {
+	if c.minSpare <= 0 || c.minSpare > asset.ParityShards {
+		return asset.ParityShards
+	}
+	return c.minSpare
+}
+
+// Check 查询文件资产各片段的在线持有者
+func (c *Coordinator) Check(ctx context.Context, assetID string) (*Health, error) {
+	asset, _, err := c.asset(assetID)
+	if err != nil {
+		return nil, err
+	}
+	health, _, err := c.query(ctx, asset)
+	return health, err
+}
+
+// query 查询并记录文件资产的持有情况
+func (c *Coordinator) query(ctx context.Context, asset *Asset) (*Health, *transport.Holders, error) {
+	holders, err := c.transport.QueryHolders(ctx, asset.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("查询文件资产 %s 的持有情况失败: %v", asset.ID, err)
+	}
+
+	health := &Health{
+		AssetID: asset.ID,
+		Holders: make([]int, asset.DataShards+asset.ParityShards),
+		Time:    time.Now(),
+	}
+	for index := range health.Holders {
+		if health.Holders[index] = len(holders.Peers[index]); health.Holders[index] > 0 {
+			health.Live++
+		}
+	}
+	health.Spare = health.Live - asset.DataShards
+
+	c.mu.Lock()
+	if _, exists := c.assets[asset.ID]; exists {
+		c.health[asset.ID] = health
+	}
+	c.mu.Unlock()
+
+	return health, holders, nil
+}
+
+// Repair 检查文件资产的持有情况，余量低于阈值时重建丢失的片段并发送给新的节点
+// 余量充足时返回的结果中没有重建的片段
+func (c *Coordinator) Repair(ctx context.Context, assetID string) (*Result, error) {
+	asset, lock, err := c.asset(assetID)
+	if err != nil {
+		return nil, err
+	}
+	// 同一文件资产同时只进行一次修复，避免重复发送
+	lock.Lock()
+	defer lock.Unlock()
+
+	health, holders, err := c.query(ctx, asset)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Health: health, Repaired: make(map[int]string)}
+	if health.Spare >= c.threshold(asset) {
+		return result, nil
+	}
+	if health.Spare < 0 {
+		return result, fmt.Errorf("文件资产 %s 可用的片段 %d 个，至少需要 %d 个", assetID, health.Live, asset.DataShards)
+	}
+
+	shards, err := c.regenerate(ctx, asset, holders)
+	if err != nil {
+		return result, err
+	}
+
+	// 丢失的片段依次发送给持有该文件资产片段最少的节点
+	load := c.load(holders)
+	for _, index := range health.Missing() {
+		peerID, err := c.push(ctx, asset, index, shards[index], load)
+		if err != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			return result, err
+		}
+		result.Repaired[index] = peerID
+		load[peerID]++
+	}
+
+	return result, nil
+}
+
+// regenerate 获取数据片段数量的可用片段，并重建其余的片段
+func (c *Coordinator) regenerate(ctx context.Context, asset *Asset, holders *transport.Holders) ([][]byte, error) {
+	total := asset.DataShards + asset.ParityShards
+	shards := make([][]byte, total)
+
+	// 优先获取数据片段，数据片段齐全时重建只需要计算奇偶校验片段
+	fetched := 0
+	for index := 0; index < total && fetched < asset.DataShards; index++ {
+		data, err := c.fetch(ctx, asset, index, holders.Peers[index])
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			logrus.Warnf("获取文件资产 %s 的片段 %d 失败: %v", asset.ID, index, err)
+			continue
+		}
+		shards[index] = data
+		fetched++
+	}
+	if fetched < asset.DataShards {
+		return nil, fmt.Errorf("文件资产 %s 获取到的片段 %d 个，至少需要 %d 个", asset.ID, fetched, asset.DataShards)
+	}
+
+	enc, err := reedsolomon.New(asset.DataShards, asset.ParityShards)
+	if err != nil {
+		return nil, fmt.Errorf("创建编码器失败: %v", err)
+	}
+	if err := enc.Reconstruct(shards); err != nil {
+		return nil, fmt.Errorf("重建文件片段失败: %v", err)
+	}
+	for index, shard := range shards {
+		if !asset.verify(index, shard) {
+			return nil, fmt.Errorf("重建的片段 %d 与记录的哈希值不符", index)
+		}
+	}
+
+	return shards, nil
+}
+
+// fetch 依次从本地存储和持有片段的节点获取片段，跳过与记录的哈希值不符的片段
+func (c *Coordinator) fetch(ctx context.Context, asset *Asset, index int, peers []string) ([]byte, error) {
+	if c.local != nil {
+		if data, err := c.local.Get(asset.ID, index); err == nil && asset.verify(index, data) {
+			return data, nil
+		}
+	}
+
+	err := fmt.Errorf("没有在线的持有者")
+	for _, peerID := range peers {
+		if peerID == c.transport.ID() {
+			continue
+		}
+		data, ferr := c.transport.FetchShard(ctx, peerID, asset.ID, index, nil)
+		if ferr != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			err = ferr
+			continue
+		}
+		if !asset.verify(index, data) {
+			err = fmt.Errorf("节点 %s 的片段与记录的哈希值不符", peerID)
+			continue
+		}
+		return data, nil
+	}
+
+	return nil, err
+}
+
+// load 统计各在线节点持有的该文件资产的片段数量
+func (c *Coordinator) load(holders *transport.Holders) map[string]int {
+	load := make(map[string]int)
+	for _, peerID := range c.transport.Peers() {
+		load[peerID] = 0
+	}
+	for _, peers := range holders.Peers {
+		for _, peerID := range peers {
+			if _, online := load[peerID]; online {
+				load[peerID]++
+			}
+		}
+	}
+	return load
+}
+
+// push 将重建的片段发送给持有该文件资产片段最少的节点，失败时尝试下一个节点
+func (c *Coordinator) push(ctx context.Context, asset *Asset, index int, data []byte, load map[string]int) (string, error) {
+	peers := make([]string, 0, len(load))
+	for peerID := range load {
+		peers = append(peers, peerID)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		if load[peers[i]] != load[peers[j]] {
+			return load[peers[i]] < load[peers[j]]
+		}
+		return peers[i] < peers[j]
+	})
+
+	for _, peerID := range peers {
+		if err := c.transport.SendShard(ctx, peerID, asset.ID, index, data); err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			logrus.Warnf("发送重建的片段 %d 给节点 %s 失败: %v", index, peerID, err)
+			continue
+		}
+		return peerID, nil
+	}
+
+	return "", fmt.Errorf("没有节点接收重建的片段 %d", index)
+}
+
+// RepairAll 依次修复所有跟踪的文件资产，返回各文件资产的修复结果
+func (c *Coordinator) RepairAll(ctx context.Context) map[string]*Result {
+	results := make(map[string]*Result)
+	for _, assetID := range c.Assets() {
+		if ctx.Err() != nil {
+			break
+		}
+		result, err := c.Repair(ctx, assetID)
+		if err != nil {
+			logrus.Errorf("修复文件资产 %s 失败: %v", assetID, err)
+		}
+		if result != nil {
+			results[assetID] = result
+			if len(result.Repaired) > 0 {
+				logrus.Infof("文件资产 %s 重建了 %d 个片段", assetID, len(result.Repaired))
+			}
+		}
+	}
+	return results
+}
+
+// Run 每隔 interval 检查并修复所有跟踪的文件资产，直到上下文结束
+func (c *Coordinator) Run(ctx context.Context) {
+	if c.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.RepairAll(ctx)
+		}
+	}
+}
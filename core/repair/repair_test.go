@@ -0,0 +1,135 @@
+package repair
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/bpfs/defs/core/erasure"
+	"github.com/bpfs/defs/core/store"
+	"github.com/bpfs/defs/core/transport"
+)
+
+// setupNetwork 创建协调节点和持有节点，将 4+2 编码的片段依次分发给持有节点
+func setupNetwork(t *testing.T, holders []string) (*transport.Network, *transport.Node, map[string]*store.MemoryStore, Asset, []erasure.Shard) {
+	t.Helper()
+
+	network := transport.NewNetwork()
+	coordinator, err := network.NewNode("coordinator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := make(map[string]*store.MemoryStore)
+	for _, id := range holders {
+		node, err := network.NewNode(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores[id] = store.NewMemoryStore()
+		node.Serve(transport.StoreHandler(stores[id]))
+	}
+
+	data := make([]byte, 20000)
+	rand.New(rand.NewSource(1)).Read(data)
+	pieces, _, err := erasure.Encode(bytes.NewReader(data), erasure.Plan{DataShards: 4, ParityShards: 2, BlockSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	asset := Asset{ID: "asset", DataShards: 4, ParityShards: 2}
+	for _, piece := range pieces {
+		asset.Hashes = append(asset.Hashes, piece.Hash)
+		peerID := holders[piece.Index%len(holders)]
+		if err := coordinator.SendShard(context.Background(), peerID, asset.ID, piece.Index, piece.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return network, coordinator, stores, asset, pieces
+}
+
+func TestRepairRegeneratesLostShards(t *testing.T) {
+	ctx := context.Background()
+	network, node, stores, asset, pieces := setupNetwork(t, []string{"a", "b", "c", "d", "e", "f", "g", "h"})
+	c := New(node, nil, 0, 0)
+	if err := c.Watch(asset); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := c.Repair(ctx, asset.ID)
+	if err != nil || len(result.Repaired) != 0 || result.Health.Spare != 2 {
+		t.Fatalf("片段齐全时修复返回 %+v, %v", result, err)
+	}
+
+	// 持有数据片段 1 和奇偶校验片段 5 的节点离线
+	network.Disconnect("b")
+	network.Disconnect("f")
+	if health, err := c.Check(ctx, asset.ID); err != nil || health.Spare != 0 || len(health.Missing()) != 2 {
+		t.Fatalf("离线后的持有情况为 %+v, %v", health, err)
+	}
+
+	result, err = c.Repair(ctx, asset.ID)
+	if err != nil {
+		t.Fatalf("修复失败: %v", err)
+	}
+	if len(result.Repaired) != 2 {
+		t.Fatalf("重建了 %v", result.Repaired)
+	}
+	for index, peerID := range result.Repaired {
+		// 重建的片段发送给没有持有该文件资产片段的节点
+		if peerID != "g" && peerID != "h" {
+			t.Fatalf("片段 %d 发送给了节点 %s", index, peerID)
+		}
+		got, err := stores[peerID].Get(asset.ID, index)
+		if err != nil || !bytes.Equal(got, pieces[index].Data) {
+			t.Fatalf("节点 %s 保存的片段 %d 不正确: %v", peerID, index, err)
+		}
+	}
+
+	if health, _ := c.Check(ctx, asset.ID); health.Spare != 2 || c.Health(asset.ID) != health {
+		t.Fatalf("修复后的持有情况为 %+v", health)
+	}
+}
+
+func TestRepairThresholdAndCorruptHolders(t *testing.T) {
+	ctx := context.Background()
+	network, node, stores, asset, pieces := setupNetwork(t, []string{"a", "b", "c", "d", "e", "f", "g"})
+
+	// 余量不低于 1 时，丢失一个片段不修复
+	c := New(node, nil, 1, 0)
+	if err := c.Watch(asset); err != nil {
+		t.Fatal(err)
+	}
+	network.Disconnect("a")
+	if result, err := c.Repair(ctx, asset.ID); err != nil || len(result.Repaired) != 0 {
+		t.Fatalf("余量充足时修复返回 %+v, %v", result, err)
+	}
+
+	// 节点 c 的片段损坏，获取时跳过并改从节点 g 获取
+	if err := node.SendShard(ctx, "g", asset.ID, 2, pieces[2].Data); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores["c"].Put(asset.ID, 2, []byte("rotten")); err != nil {
+		t.Fatal(err)
+	}
+	network.Disconnect("b")
+	result, err := c.Repair(ctx, asset.ID)
+	if err != nil {
+		t.Fatalf("修复失败: %v", err)
+	}
+	if len(result.Repaired) != 2 || result.Repaired[0] == "" || result.Repaired[1] == "" {
+		t.Fatalf("重建了 %v", result.Repaired)
+	}
+
+	// 在线的片段不足时无法修复
+	network.Disconnect("d")
+	network.Disconnect("e")
+	network.Disconnect("g")
+	if _, err := c.Repair(ctx, asset.ID); err == nil {
+		t.Fatal("片段不足时修复成功")
+	}
+
+	if _, err := c.Repair(ctx, "unknown"); err == nil {
+		t.Fatal("修复未跟踪的文件资产成功")
+	}
+}
@@ -0,0 +1,225 @@
+// 本地文件片段的后台巡检
+package scrub
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/core/store"
+	"github.com/bpfs/defs/core/throttle"
+	"github.com/bpfs/defs/sqlites"
+	"github.com/bpfs/defs/util"
+	"github.com/sirupsen/logrus"
+)
+
+// Event 描述巡检发现的损坏片段，损坏的片段已被隔离，需要重新获取
+type Event struct {
+	AssetID string    // 文件资产的唯一标识
+	Index   int       // 文件片段的索引
+	Hash    string    // 数据库中记录的片段哈希值，没有记录时为空
+	Err     error     // 损坏的原因
+	Time    time.Time // 发现损坏的时间
+}
+
+// Stats 是巡检的累计统计
+type Stats struct {
+	Passes   int64     // 完成的巡检轮数
+	Scanned  int64     // 检查的片段数
+	Bytes    int64     // 读取的字节数
+	Corrupt  int64     // 发现的损坏片段数
+	LastPass time.Time // 上一轮巡检完成的时间
+}
+
+// Scrubber 按限定的速率逐个读取本地文件片段，校验段文件的CRC32和数据库中记录的哈希值，
+// 隔离损坏的片段，将其在 slices 表中的状态标记为失败，并通过 Events 通知需要修复
+type Scrubber struct {
+	store    store.Scrubbable
+	db       *sqlites.SqliteDB // 为空时只校验存储本身的校验和
+	limiter  *throttle.Limiter
+	interval time.Duration
+	events   chan Event
+
+	running sync.Mutex // 同一时刻只进行一轮巡检
+	mu      sync.Mutex
+	stats   Stats
+}
+
+// New 创建巡检服务，rate 为读取速率(字节/秒)，为 0 时不限速；interval 为两轮巡检的间隔，为 0 时不定期巡检
+func New(s store.Scrubbable, db *sqlites.SqliteDB, rate int64, interval time.Duration) *Scrubber {
+	return &Scrubber{
+		store:    s,
+		db:       db,
+		limiter:  throttle.NewLimiter(rate),
+		interval: interval,
+		events:   make(chan Event, 16),
+	}
+}
+
+// Events 返回损坏片段的通知，调用方需要持续接收，否则巡检会在发现损坏时等待
+func (s *Scrubber) Events() <-chan Event {
+	return s.events
+}
+
+// SetRate 修改读取速率(字节/秒)，为 0 时不限速
+func (s *Scrubber) SetRate(rate int64) {
+	s.limiter.SetRate(rate)
+}
+
+// Stats 返回巡检的累计统计
+func (s *Scrubber) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Run 每隔 interval 进行一轮巡检，直到上下文结束
+func (s *Scrubber) Run(ctx context.Context) {
+	if s.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Scrub(ctx); err != nil && ctx.Err() == nil {
+				logrus.Errorf("巡检文件片段失败: %v", err)
+			}
+		}
+	}
+}
+
+// shardRef 是一个待检查的文件片段
+type shardRef struct {
+	assetID string
+	index   int
+}
+
+// Scrub 立即进行一轮巡检，正在进行的巡检结束后才开始
+func (s *Scrubber) Scrub(ctx context.Context) error {
+	s.running.Lock()
+	defer s.running.Unlock()
+
+	// 先收集片段再逐个检查，检查期间存储可以正常读写
+	var shards []shardRef
+	if err := s.store.Walk(func(assetID string, index int) error {
+		shards = append(shards, shardRef{assetID: assetID, index: index})
+		return nil
+	}); err != nil {
+		return fmt.Errorf("遍历文件片段失败: %v", err)
+	}
+
+	var (
+		current string
+		hashes  map[int]string
+	)
+	for _, shard := range shards {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// 片段按文件资产的顺序排列，每个文件资产只查询一次数据库
+		if shard.assetID != current || hashes == nil {
+			current, hashes = shard.assetID, s.sliceHashes(shard.assetID)
+		}
+		if err := s.check(ctx, shard, hashes[shard.index]); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.stats.Passes++
+	s.stats.LastPass = time.Now()
+	s.mu.Unlock()
+
+	return nil
+}
+
+// sliceHashes 查询数据库中记录的文件资产各片段的哈希值
+func (s *Scrubber) sliceHashes(assetID string) map[int]string {
+	hashes := make(map[int]string)
+	if s.db == nil {
+		return hashes
+	}
+
+	slices, err := sqlite.SelectSlicesDatabase(s.db, assetID)
+	if err != nil {
+		logrus.Warnf("查询文件资产 %s 的片段记录失败: %v", assetID, err)
+		return hashes
+	}
+	for _, slice := range slices {
+		hashes[slice.SliceIndex] = slice.SliceHash
+	}
+
+	return hashes
+}
+
+// check 读取并校验一个文件片段，损坏时隔离并发出通知
+func (s *Scrubber) check(ctx context.Context, shard shardRef, want string) error {
+	data, err := s.store.Get(shard.assetID, shard.index)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		// 遍历之后已被删除或隔离
+		return nil
+	case err != nil && !errors.Is(err, store.ErrCorrupt):
+		logrus.Warnf("读取文件资产 %s 的片段 %d 失败: %v", shard.assetID, shard.index, err)
+		return nil
+	}
+
+	if err == nil {
+		if err := s.limiter.WaitN(ctx, len(data)); err != nil {
+			return err
+		}
+		if got := hex.EncodeToString(util.CalculateHash(data)); want != "" && got != want {
+			err = fmt.Errorf("%w: 哈希值 %s 与记录的 %s 不符", store.ErrCorrupt, got, want)
+		}
+	}
+
+	s.mu.Lock()
+	s.stats.Scanned++
+	s.stats.Bytes += int64(len(data))
+	if err != nil {
+		s.stats.Corrupt++
+	}
+	s.mu.Unlock()
+
+	if err == nil {
+		return nil
+	}
+	return s.quarantine(ctx, shard, want, err)
+}
+
+// quarantine 隔离损坏的文件片段，更新数据库中的状态并通知需要修复
+func (s *Scrubber) quarantine(ctx context.Context, shard shardRef, hash string, reason error) error {
+	logrus.Warnf("文件资产 %s 的片段 %d 已损坏: %v", shard.assetID, shard.index, reason)
+
+	if err := s.store.Quarantine(shard.assetID, shard.index); err != nil && !errors.Is(err, store.ErrNotFound) {
+		logrus.Errorf("隔离文件资产 %s 的片段 %d 失败: %v", shard.assetID, shard.index, err)
+	}
+	if hash != "" {
+		if err := sqlite.UpdateSlicesDatabaseStatus(s.db, shard.assetID, hash, sqlite.StatusFailed); err != nil {
+			logrus.Errorf("更新文件资产 %s 的片段 %d 的状态失败: %v", shard.assetID, shard.index, err)
+		}
+	}
+
+	event := Event{
+		AssetID: shard.assetID,
+		Index:   shard.index,
+		Hash:    hash,
+		Err:     reason,
+		Time:    time.Now(),
+	}
+	select {
+	case s.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,153 @@
+package scrub
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/core/store"
+	"github.com/bpfs/defs/sqlites"
+	"github.com/bpfs/defs/util"
+)
+
+func TestScrub(t *testing.T) {
+	db, err := sqlites.NewSqliteDB(t.TempDir(), sqlite.DbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := sqlite.InitDBTable(db); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	s, err := store.NewSegmentStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 片段 0 完好，片段 1 的段文件发生位翻转，片段 2 的内容与记录的哈希值不符
+	shards := make([][]byte, 3)
+	for i := range shards {
+		shards[i] = make([]byte, 4096)
+		for j := range shards[i] {
+			shards[i][j] = byte(i + j)
+		}
+		if err := s.Put("asset", i, shards[i]); err != nil {
+			t.Fatal(err)
+		}
+		if err := sqlite.InsertSlicesDatabase(db, "asset", sliceHash(shards[i]), i, sqlite.StatusSuccess); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 没有数据库记录的片段只校验CRC32
+	if err := s.Put("other", 0, shards[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "asset", "1")
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[len(raw)/2] ^= 0x10
+	if err := os.WriteFile(path, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("asset", 2, shards[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	scrubber := New(s, db, 0, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := scrubber.Scrub(ctx); err != nil {
+		t.Fatalf("巡检失败: %v", err)
+	}
+
+	for _, want := range []int{1, 2} {
+		select {
+		case event := <-scrubber.Events():
+			if event.AssetID != "asset" || event.Index != want || !errors.Is(event.Err, store.ErrCorrupt) {
+				t.Fatalf("片段 %d 的通知为 %+v", want, event)
+			}
+		default:
+			t.Fatalf("没有收到片段 %d 损坏的通知", want)
+		}
+	}
+	select {
+	case event := <-scrubber.Events():
+		t.Fatalf("收到多余的通知 %+v", event)
+	default:
+	}
+
+	// 损坏的片段被隔离，数据库中的状态标记为失败
+	for i, want := range []bool{true, false, false} {
+		if ok, _ := s.Has("asset", i); ok != want {
+			t.Fatalf("片段 %d 存在为 %v", i, ok)
+		}
+	}
+	if _, err := os.Stat(path + ".corrupt"); err != nil {
+		t.Fatalf("没有保留隔离的片段: %v", err)
+	}
+	slices, err := sqlite.SelectSlicesDatabase(db, "asset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, slice := range slices {
+		want := sqlite.StatusFailed
+		if slice.SliceIndex == 0 {
+			want = sqlite.StatusSuccess
+		}
+		if slice.Status != want {
+			t.Fatalf("片段 %d 的状态为 %d", slice.SliceIndex, slice.Status)
+		}
+	}
+
+	stats := scrubber.Stats()
+	if stats.Passes != 1 || stats.Scanned != 4 || stats.Corrupt != 2 {
+		t.Fatalf("巡检统计为 %+v", stats)
+	}
+
+	// 隔离后的片段不再被检查
+	if err := scrubber.Scrub(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stats := scrubber.Stats(); stats.Scanned != 6 || stats.Corrupt != 2 {
+		t.Fatalf("第二轮巡检统计为 %+v", stats)
+	}
+}
+
+func TestScrubRate(t *testing.T) {
+	s := store.NewMemoryStore()
+	for i := 0; i < 8; i++ {
+		if err := s.Put("asset", i, make([]byte, 64<<10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 以 256KB/s 读取 512KB，令牌桶容量之外的 256KB 约需等待 1 秒
+	scrubber := New(s, nil, 256<<10, 0)
+	start := time.Now()
+	if err := scrubber.Scrub(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Fatalf("限速后巡检只用了 %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := scrubber.Scrub(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("上下文取消后巡检返回 %v", err)
+	}
+}
+
+func sliceHash(data []byte) string {
+	return hex.EncodeToString(util.CalculateHash(data))
+}
@@ -0,0 +1,156 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/bpfs/defs/sqlites"
+)
+
+// ACLRecord 描述文件资产的访问控制
+type ACLRecord struct {
+	AssetID  string         // 文件资产的唯一标识
+	Owner    string         // 所有者的DID
+	CoOwners []string       // 共同所有者的DID
+	Grants   map[string]int // 被分享者的DID -> 授予的权限
+	Version  int64          // 访问控制的版本
+}
+
+// SaveACLDatabase 保存文件资产的访问控制，已存在时整体替换
+func SaveACLDatabase(db *sqlites.SqliteDB, record *ACLRecord) error {
+	conditions := []string{"assetID = ?"}
+	args := []interface{}{record.AssetID}
+
+	exists, err := db.Exists("acl", conditions, args)
+	if err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"owner":    record.Owner,
+		"coOwners": strings.Join(record.CoOwners, ","),
+		"version":  record.Version,
+	}
+	if exists {
+		err = db.Update("acl", data, conditions, args)
+	} else {
+		data["assetID"] = record.AssetID
+		err = db.Insert("acl", data)
+	}
+	if err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	if err := db.Delete("acl_grants", conditions, args); err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+	for did, permissions := range record.Grants {
+		if err := db.Insert("acl_grants", map[string]interface{}{
+			"assetID":     record.AssetID,
+			"did":         did,
+			"permissions": permissions,
+		}); err != nil {
+			return fmt.Errorf("数据库操作失败: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// SelectACLDatabase 查询文件资产的访问控制，不存在时返回空
+func SelectACLDatabase(db *sqlites.SqliteDB, assetID string) (*ACLRecord, error) {
+	conditions := []string{"assetID=?"}
+	args := []interface{}{assetID}
+
+	row, err := db.SelectOne("acl", []string{"owner", "coOwners", "version"}, conditions, args)
+	if err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	record := &ACLRecord{AssetID: assetID, Grants: make(map[string]int)}
+	var coOwners string
+	if err := row.Scan(&record.Owner, &coOwners, &record.Version); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+	if coOwners != "" {
+		record.CoOwners = strings.Split(coOwners, ",")
+	}
+
+	rows, err := db.Select("acl_grants", []string{"did", "permissions"}, conditions, args, 0, 0, "id ASC")
+	if err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			did         string
+			permissions int
+		)
+		if err := rows.Scan(&did, &permissions); err != nil {
+			return nil, fmt.Errorf("数据库操作失败: %v", err)
+		}
+		record.Grants[did] = permissions
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	return record, nil
+}
+
+// DeleteACLDatabase 删除文件资产的访问控制
+func DeleteACLDatabase(db *sqlites.SqliteDB, assetID string) error {
+	conditions := []string{"assetID = ?"}
+	args := []interface{}{assetID}
+
+	if err := db.Delete("acl", conditions, args); err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+	if err := db.Delete("acl_grants", conditions, args); err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+	if err := db.Delete("acl_ops", conditions, args); err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+	return nil
+}
+
+// InsertACLOpDatabase 追加文件资产的一项签名的访问控制操作，version 为操作基于的版本
+func InsertACLOpDatabase(db *sqlites.SqliteDB, assetID string, version int64, op []byte) error {
+	if err := db.Insert("acl_ops", map[string]interface{}{
+		"assetID": assetID,
+		"version": version,
+		"op":      op,
+	}); err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+	return nil
+}
+
+// SelectACLOpsDatabase 查询文件资产的全部签名的访问控制操作，按版本升序排列
+func SelectACLOpsDatabase(db *sqlites.SqliteDB, assetID string) ([][]byte, error) {
+	rows, err := db.Select("acl_ops", []string{"op"}, []string{"assetID=?"}, []interface{}{assetID}, 0, 0, "version ASC")
+	if err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+	defer rows.Close()
+
+	var ops [][]byte
+	for rows.Next() {
+		var op []byte
+		if err := rows.Scan(&op); err != nil {
+			return nil, fmt.Errorf("数据库操作失败: %v", err)
+		}
+		ops = append(ops, op)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	return ops, nil
+}
@@ -0,0 +1,162 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bpfs/defs/sqlites"
+)
+
+// CatalogRecord 描述文件目录中的一个文件，SHOW FILES 在文件目录中查询
+type CatalogRecord struct {
+	AssetID    string            // 文件资产的唯一标识
+	Name       string            // 文件的基本名称
+	CustomName string            // 为文件设定的自定义名称
+	Size       int64             // 文件的长度(以字节为单位)
+	Modified   time.Time         // 文件的最后修改时间
+	Metadata   map[string]string // 为文件附加的额外信息或属性
+}
+
+// SaveCatalogDatabase 保存文件目录中的文件，已存在时替换文件信息并保留标签
+func SaveCatalogDatabase(db *sqlites.SqliteDB, record *CatalogRecord) error {
+	conditions := []string{"assetID = ?"}
+	args := []interface{}{record.AssetID}
+
+	exists, err := db.Exists("catalog", conditions, args)
+	if err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	metadata, err := json.Marshal(record.Metadata)
+	if err != nil {
+		return fmt.Errorf("编码文件属性失败: %v", err)
+	}
+	data := map[string]interface{}{
+		"name":       record.Name,
+		"customName": record.CustomName,
+		"size":       record.Size,
+		"modified":   record.Modified.Unix(),
+		"metadata":   string(metadata),
+	}
+	if exists {
+		err = db.Update("catalog", data, conditions, args)
+	} else {
+		data["assetID"] = record.AssetID
+		err = db.Insert("catalog", data)
+	}
+	if err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+	return nil
+}
+
+// SelectCatalogDatabase 查询文件目录中的文件，不存在时返回空
+func SelectCatalogDatabase(db *sqlites.SqliteDB, assetID string) (*CatalogRecord, error) {
+	columns := []string{"name", "customName", "size", "modified", "metadata"}
+	row, err := db.SelectOne("catalog", columns, []string{"assetID=?"}, []interface{}{assetID})
+	if err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	record := &CatalogRecord{AssetID: assetID}
+	var (
+		modified int64
+		metadata string
+	)
+	if err := row.Scan(&record.Name, &record.CustomName, &record.Size, &modified, &metadata); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+	record.Modified = time.Unix(modified, 0)
+	if err := json.Unmarshal([]byte(metadata), &record.Metadata); err != nil {
+		return nil, fmt.Errorf("解析文件属性失败: %v", err)
+	}
+	return record, nil
+}
+
+// SelectCatalogAssetIDsDatabase 查询文件目录中名称或自定义名称为 name 的文件资产
+func SelectCatalogAssetIDsDatabase(db *sqlites.SqliteDB, name string) ([]string, error) {
+	conditions := []string{"(name = ? OR customName = ?)"}
+	args := []interface{}{name, name}
+
+	rows, err := db.Select("catalog", []string{"assetID"}, conditions, args, 0, 0, "id ASC")
+	if err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+	defer rows.Close()
+
+	var assetIDs []string
+	for rows.Next() {
+		var assetID string
+		if err := rows.Scan(&assetID); err != nil {
+			return nil, fmt.Errorf("数据库操作失败: %v", err)
+		}
+		assetIDs = append(assetIDs, assetID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	return assetIDs, nil
+}
+
+// AddCatalogTagsDatabase 为文件目录中的文件添加标签，已有的标签保持不变
+func AddCatalogTagsDatabase(db *sqlites.SqliteDB, assetID string, tags []string) error {
+	for _, tag := range tags {
+		exists, err := db.Exists("catalog_tags", []string{"assetID = ?", "tag = ?"}, []interface{}{assetID, tag})
+		if err != nil {
+			return fmt.Errorf("数据库操作失败: %v", err)
+		}
+		if exists {
+			continue
+		}
+		if err := db.Insert("catalog_tags", map[string]interface{}{
+			"assetID": assetID,
+			"tag":     tag,
+		}); err != nil {
+			return fmt.Errorf("数据库操作失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// SelectCatalogTagsDatabase 查询文件目录中的文件的标签，按添加的顺序排列
+func SelectCatalogTagsDatabase(db *sqlites.SqliteDB, assetID string) ([]string, error) {
+	rows, err := db.Select("catalog_tags", []string{"tag"}, []string{"assetID=?"}, []interface{}{assetID}, 0, 0, "id ASC")
+	if err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("数据库操作失败: %v", err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	return tags, nil
+}
+
+// DeleteCatalogDatabase 从文件目录中删除文件及其标签
+func DeleteCatalogDatabase(db *sqlites.SqliteDB, assetID string) error {
+	conditions := []string{"assetID = ?"}
+	args := []interface{}{assetID}
+
+	if err := db.Delete("catalog", conditions, args); err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+	if err := db.Delete("catalog_tags", conditions, args); err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+	return nil
+}
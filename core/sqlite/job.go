@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bpfs/defs/sqlites"
+)
+
+// JobRecord 描述一条异步执行的 FQL 语句的任务
+type JobRecord struct {
+	JobID     string    // 任务的唯一标识
+	Statement string    // FQL 语句的原文
+	Status    int       // 状态(0:失败、1:成功、2:待开始、3:进行中、4:已取消)
+	Error     string    // 失败的原因
+	AssetIDs  []string  // 创建或受影响的文件资产
+	Created   time.Time // 提交的时间
+	Updated   time.Time // 状态最后变化的时间
+}
+
+// SaveJobDatabase 保存任务的状态，不存在时插入
+func SaveJobDatabase(db *sqlites.SqliteDB, record *JobRecord) error {
+	conditions := []string{"jobID = ?"}
+	args := []interface{}{record.JobID}
+
+	exists, err := db.Exists("jobs", conditions, args)
+	if err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"status":   record.Status,
+		"error":    record.Error,
+		"assetIDs": strings.Join(record.AssetIDs, ","),
+		"updated":  record.Updated,
+	}
+	if exists {
+		err = db.Update("jobs", data, conditions, args)
+	} else {
+		data["jobID"] = record.JobID
+		data["statement"] = record.Statement
+		data["created"] = record.Created
+		err = db.Insert("jobs", data)
+	}
+	if err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+	return nil
+}
+
+// SelectJobsDatabase 查询所有任务，按提交的顺序排列
+func SelectJobsDatabase(db *sqlites.SqliteDB) ([]*JobRecord, error) {
+	columns := []string{"jobID", "statement", "status", "error", "assetIDs", "created", "updated"}
+	rows, err := db.Select("jobs", columns, nil, nil, 0, 0, "id ASC")
+	if err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+	defer rows.Close()
+
+	var records []*JobRecord
+	for rows.Next() {
+		var (
+			r        JobRecord
+			assetIDs string
+		)
+		if err := rows.Scan(&r.JobID, &r.Statement, &r.Status, &r.Error, &assetIDs, &r.Created, &r.Updated); err != nil {
+			return nil, fmt.Errorf("数据库操作失败: %v", err)
+		}
+		if assetIDs != "" {
+			r.AssetIDs = strings.Split(assetIDs, ",")
+		}
+		records = append(records, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	return records, nil
+}
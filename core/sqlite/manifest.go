@@ -0,0 +1,56 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/bpfs/defs/sqlites"
+)
+
+// SaveManifestDatabase 保存文件资产的签名清单，已存在时替换
+func SaveManifestDatabase(db *sqlites.SqliteDB, assetID string, manifest []byte) error {
+	conditions := []string{"assetID = ?"}
+	args := []interface{}{assetID}
+
+	exists, err := db.Exists("manifests", conditions, args)
+	if err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	data := map[string]interface{}{"manifest": manifest}
+	if exists {
+		err = db.Update("manifests", data, conditions, args)
+	} else {
+		data["assetID"] = assetID
+		err = db.Insert("manifests", data)
+	}
+	if err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+	return nil
+}
+
+// SelectManifestDatabase 查询文件资产的签名清单，不存在时返回空
+func SelectManifestDatabase(db *sqlites.SqliteDB, assetID string) ([]byte, error) {
+	row, err := db.SelectOne("manifests", []string{"manifest"}, []string{"assetID=?"}, []interface{}{assetID})
+	if err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	var manifest []byte
+	if err := row.Scan(&manifest); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+	return manifest, nil
+}
+
+// DeleteManifestDatabase 删除文件资产的签名清单
+func DeleteManifestDatabase(db *sqlites.SqliteDB, assetID string) error {
+	if err := db.Delete("manifests", []string{"assetID = ?"}, []interface{}{assetID}); err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+	return nil
+}
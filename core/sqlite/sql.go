@@ -8,14 +8,38 @@ import (
 	"github.com/bpfs/defs/sqlites"
 )
 
+// FileRecord 描述文件数据库表中的一条记录
+type FileRecord struct {
+	AssetID     string    // 文件资产的唯一标识
+	Name        string    // 文件的基本名称
+	Size        int64     // 文件的长度(以字节为单位)
+	FileHash    string    // 文件内容的哈希值
+	TotalPieces int64     // 文件片段的总量
+	DataPieces  int64     // 数据片段的数量
+	Operates    int       // 操作(0:下载、1:上传)
+	Status      int       // 状态(0:失败、1:成功、2:待开始、3:进行中)
+	Times       time.Time // 时间
+}
+
+// SliceRecord 描述文件片段数据库表中的一条记录
+type SliceRecord struct {
+	SliceHash  string // 文件片段的哈希值
+	SliceIndex int    // 文件片段的索引
+	Status     int    // 状态(0:失败、1:成功)
+}
+
 // InsertFilesDatabase 插入文件数据
-func InsertFilesDatabase(db *sqlites.SqliteDB, assetID string, totalPieces int64, operates, status int, modTime time.Time) error {
+func InsertFilesDatabase(db *sqlites.SqliteDB, record *FileRecord) error {
 	data := map[string]interface{}{
-		"assetID":     assetID,     // 文件资产的唯一标识
-		"totalPieces": totalPieces, // 文件片段的总量
-		"operates":    operates,    // 操作
-		"status":      status,      // 状态
-		"times":       modTime,     // 时间
+		"assetID":     record.AssetID,     // 文件资产的唯一标识
+		"name":        record.Name,        // 文件的基本名称
+		"size":        record.Size,        // 文件的长度
+		"fileHash":    record.FileHash,    // 文件内容的哈希值
+		"totalPieces": record.TotalPieces, // 文件片段的总量
+		"dataPieces":  record.DataPieces,  // 数据片段的数量
+		"operates":    record.Operates,    // 操作
+		"status":      record.Status,      // 状态
+		"times":       record.Times,       // 时间
 	}
 
 	if err := db.Insert("files", data); err != nil {
@@ -25,6 +49,133 @@ func InsertFilesDatabase(db *sqlites.SqliteDB, assetID string, totalPieces int64
 	return nil
 }
 
+// SelectOneFileDatabase 查询指定文件资产在指定操作下的文件数据，不存在时返回 nil
+func SelectOneFileDatabase(db *sqlites.SqliteDB, assetID string, operates int) (*FileRecord, error) {
+	columns := []string{
+		"assetID",     // 文件资产的唯一标识
+		"name",        // 文件的基本名称
+		"size",        // 文件的长度
+		"fileHash",    // 文件内容的哈希值
+		"totalPieces", // 文件片段的总量
+		"dataPieces",  // 数据片段的数量
+		"operates",    // 操作
+		"status",      // 状态
+		"times",       // 时间
+	}
+	conditions := []string{"assetID=?", "operates=?"} // 查询条件
+	args := []interface{}{assetID, operates}          // 查询条件对应的值
+
+	row, err := db.SelectOne("files", columns, conditions, args)
+	if err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	var r FileRecord
+	if err := row.Scan(
+		&r.AssetID,
+		&r.Name,
+		&r.Size,
+		&r.FileHash,
+		&r.TotalPieces,
+		&r.DataPieces,
+		&r.Operates,
+		&r.Status,
+		&r.Times,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	return &r, nil
+}
+
+// SelectAssetIDsDatabase 查询指定操作和状态的所有文件资产的唯一标识
+func SelectAssetIDsDatabase(db *sqlites.SqliteDB, operates, status int) ([]string, error) {
+	columns := []string{"assetID"}                   // 文件资产的唯一标识
+	conditions := []string{"operates=?", "status=?"} // 查询条件
+	args := []interface{}{operates, status}          // 查询条件对应的值
+
+	rows, err := db.Select("files", columns, conditions, args, 0, 0, "assetID ASC")
+	if err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+	defer rows.Close()
+
+	var assetIDs []string
+	for rows.Next() {
+		var assetID string
+		if err := rows.Scan(&assetID); err != nil {
+			return nil, fmt.Errorf("数据库操作失败: %v", err)
+		}
+		assetIDs = append(assetIDs, assetID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	return assetIDs, nil
+}
+
+// SelectUploadsByFileDatabase 查询指定名称和长度的文件的所有上传记录
+func SelectUploadsByFileDatabase(db *sqlites.SqliteDB, name string, size int64) ([]*FileRecord, error) {
+	columns := []string{
+		"assetID",     // 文件资产的唯一标识
+		"name",        // 文件的基本名称
+		"size",        // 文件的长度
+		"fileHash",    // 文件内容的哈希值
+		"totalPieces", // 文件片段的总量
+		"dataPieces",  // 数据片段的数量
+		"operates",    // 操作
+		"status",      // 状态
+		"times",       // 时间
+	}
+	conditions := []string{"operates=?", "name=?", "size=?"} // 查询条件
+	args := []interface{}{OperateUpload, name, size}         // 查询条件对应的值
+
+	rows, err := db.Select("files", columns, conditions, args, 0, 0, "assetID ASC")
+	if err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+	defer rows.Close()
+
+	var records []*FileRecord
+	for rows.Next() {
+		var r FileRecord
+		if err := rows.Scan(
+			&r.AssetID,
+			&r.Name,
+			&r.Size,
+			&r.FileHash,
+			&r.TotalPieces,
+			&r.DataPieces,
+			&r.Operates,
+			&r.Status,
+			&r.Times,
+		); err != nil {
+			return nil, fmt.Errorf("数据库操作失败: %v", err)
+		}
+		records = append(records, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	return records, nil
+}
+
+// DeleteFilesDatabase 删除指定文件资产的所有文件数据
+func DeleteFilesDatabase(db *sqlites.SqliteDB, assetID string) error {
+	conditions := []string{"assetID = ?"}
+	args := []interface{}{assetID}
+
+	if err := db.Delete("files", conditions, args); err != nil {
+		return fmt.Errorf("数据库操作失败")
+	}
+	return nil
+}
+
 // UpdateFileDatabaseStatus 更新文件数据对象的状态
 // operates	操作(0:下载、1:上传)
 // status	状态(0:失败、1:成功、2:待开始、3:进行中)
@@ -41,13 +192,32 @@ func UpdateFileDatabaseStatus(db *sqlites.SqliteDB, assetID string, operates, st
 	return nil
 }
 
-// InsertSlicesDatabase 插入文件片段数据
+// InsertSlicesDatabase 插入上传的文件片段数据，相同索引的片段数据已存在时更新它
 func InsertSlicesDatabase(db *sqlites.SqliteDB, assetID, sliceHash string, current, status int) error {
+	conditions := []string{"assetID = ?", "operates = ?", "sliceIndex = ?"}
+	args := []interface{}{assetID, OperateUpload, current}
+
+	exists, err := db.Exists("slices", conditions, args)
+	if err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+	if exists {
+		data := map[string]interface{}{
+			"sliceHash": sliceHash, // 文件片段的哈希值
+			"status":    status,    // 状态
+		}
+		if err := db.Update("slices", data, conditions, args); err != nil {
+			return fmt.Errorf("数据库操作失败")
+		}
+		return nil
+	}
+
 	data := map[string]interface{}{
-		"assetID":    assetID,   // 文件资产的唯一标识
-		"sliceHash":  sliceHash, // 文件片段的哈希值
-		"sliceIndex": current,   // 文件片段的索引
-		"status":     status,    // 状态
+		"assetID":    assetID,       // 文件资产的唯一标识
+		"sliceHash":  sliceHash,     // 文件片段的哈希值
+		"sliceIndex": current,       // 文件片段的索引
+		"status":     status,        // 状态
+		"operates":   OperateUpload, // 操作
 	}
 
 	if err := db.Insert("slices", data); err != nil {
@@ -106,6 +276,52 @@ func SelectOneSlicesDatabaseStatus(db *sqlites.SqliteDB, assetID string) (*struc
 	return &s, nil
 }
 
+// SelectSlicesDatabase 查询指定文件资产上传的所有文件片段数据，按片段索引升序排列
+func SelectSlicesDatabase(db *sqlites.SqliteDB, assetID string) ([]*SliceRecord, error) {
+	columns := []string{
+		"sliceHash",  // 文件片段的哈希值
+		"sliceIndex", // 文件片段的索引
+		"status",     // 状态
+	}
+	conditions := []string{"assetID=?", "operates=?"} // 查询条件
+	args := []interface{}{assetID, OperateUpload}     // 查询条件对应的值
+
+	rows, err := db.Select("slices", columns, conditions, args, 0, 0, "sliceIndex ASC")
+	if err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+	defer rows.Close()
+
+	var records []*SliceRecord
+	for rows.Next() {
+		r := new(SliceRecord)
+		if err := rows.Scan(
+			&r.SliceHash,
+			&r.SliceIndex,
+			&r.Status,
+		); err != nil {
+			return nil, fmt.Errorf("数据库操作失败: %v", err)
+		}
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	return records, nil
+}
+
+// DeleteSlicesDatabase 删除指定文件资产的所有文件片段数据
+func DeleteSlicesDatabase(db *sqlites.SqliteDB, assetID string) error {
+	conditions := []string{"assetID = ?"}
+	args := []interface{}{assetID}
+
+	if err := db.Delete("slices", conditions, args); err != nil {
+		return fmt.Errorf("数据库操作失败")
+	}
+	return nil
+}
+
 // SelectOneAssetID 查询制定的文件资产是否存在
 func SelectOneAssetID(db *sqlites.SqliteDB, assetID string) bool {
 	columns := []string{
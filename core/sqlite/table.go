@@ -10,6 +10,22 @@ const (
 	DbFile = "database.db"
 )
 
+// 操作
+const (
+	OperateDownload  = 0 // 下载
+	OperateUpload    = 1 // 上传
+	OperateStatement = 2 // 异步执行的 FQL 语句(仅用于工作池和任务表)
+)
+
+// 状态
+const (
+	StatusFailed     = 0 // 失败
+	StatusSuccess    = 1 // 成功
+	StatusPending    = 2 // 待开始
+	StatusInProgress = 3 // 进行中
+	StatusCancelled  = 4 // 已取消(仅用于任务表)
+)
+
 // InitDBTable 数据库表
 func InitDBTable(db *sqlites.SqliteDB) error {
 	// 创建文件资产数据库表
@@ -22,6 +38,63 @@ func InitDBTable(db *sqlites.SqliteDB) error {
 		return err
 	}
 
+	// 创建签名清单数据库表
+	if err := createManifestTable(db); err != nil {
+		return err
+	}
+
+	// 创建访问控制数据库表
+	if err := createACLTable(db); err != nil {
+		return err
+	}
+
+	// 创建文件目录数据库表
+	if err := createCatalogTable(db); err != nil {
+		return err
+	}
+
+	// 创建异步语句的任务数据库表
+	if err := createJobTable(db); err != nil {
+		return err
+	}
+
+	// 为早期版本创建的数据库表补充任务状态的列
+	if err := db.AddColumnsIfNotExists("files", map[string]string{
+		"name":       "TEXT",
+		"size":       "INTEGER",
+		"fileHash":   "VARCHAR(64)",
+		"dataPieces": "INTEGER",
+		"progress":   "BLOB",
+		"paused":     "INTEGER",
+	}); err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+	if err := db.AddColumnsIfNotExists("slices", map[string]string{
+		"operates": "INTEGER",
+		"rsCodes":  "INTEGER",
+		"peerIDs":  "TEXT",
+		"retries":  "INTEGER",
+	}); err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	// 补充的列在早期版本的记录中为 NULL，填充默认值以便按非空类型读取
+	for _, fill := range []struct {
+		table, column string
+		value         interface{}
+	}{
+		{"files", "name", ""},
+		{"files", "size", 0},
+		{"files", "fileHash", ""},
+		{"files", "dataPieces", 0},
+		{"slices", "operates", OperateUpload}, // 早期版本只记录上传的文件片段
+	} {
+		data := map[string]interface{}{fill.column: fill.value}
+		if err := db.Update(fill.table, data, []string{fill.column + " IS NULL"}, nil); err != nil {
+			return fmt.Errorf("数据库操作失败: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -30,10 +103,16 @@ func createUploadFileInfoTable(db *sqlites.SqliteDB) error {
 	table := []string{
 		"id INTEGER PRIMARY KEY AUTOINCREMENT", // id主键自动增长
 		"assetID VARCHAR(60)",                  // 文件资产的唯一标识(外部标识)
+		"name TEXT",                            // 文件的基本名称
+		"size INTEGER",                         // 文件的长度(以字节为单位)
+		"fileHash VARCHAR(64)",                 // 文件内容的哈希值(内部标识)
 		"totalPieces INTEGER ",                 // 文件片段的总量
+		"dataPieces INTEGER",                   // 数据片段的数量
 		"operates INTEGER ",                    // 操作(0:下载、1:上传)
 		"status INTEGER ",                      // 状态(0:失败、1:成功、2:待开始、3:进行中)
 		"times TIMESTAMP",                      // 时间
+		"progress BLOB",                        // 任务进度(为空时表示没有进行中的任务)
+		"paused INTEGER",                       // 任务是否暂停(0:否、1:是)
 	}
 
 	// 创建表
@@ -52,6 +131,10 @@ func createUploadSliceInfoTable(db *sqlites.SqliteDB) error {
 		"sliceHash VARCHAR(60)",                // 文件片段的哈希值(外部标识)
 		"sliceIndex INTEGER",                   // 文件片段的索引(该片段在文件中的顺序位置)
 		"status INTEGER",                       // 状态(0:失败、1:成功)
+		"operates INTEGER",                     // 操作(0:下载、1:上传)
+		"rsCodes INTEGER",                      // 是否为纠删码(0:否、1:是)
+		"peerIDs TEXT",                         // 持有该片段的节点(以逗号分隔)
+		"retries INTEGER",                      // 失败重试次数
 	}
 
 	// 创建表
@@ -61,3 +144,101 @@ func createUploadSliceInfoTable(db *sqlites.SqliteDB) error {
 
 	return nil
 }
+
+// 创建签名清单数据库表
+func createManifestTable(db *sqlites.SqliteDB) error {
+	table := []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT", // id主键自动增长
+		"assetID VARCHAR(60)",                  // 文件资产的唯一标识(外部标识)
+		"manifest BLOB",                        // 二进制编码的签名清单
+	}
+
+	// 创建表
+	if err := db.CreateTable("manifests", table); err != nil {
+		return fmt.Errorf("数据库操作失败")
+	}
+
+	return nil
+}
+
+// 创建访问控制数据库表
+func createACLTable(db *sqlites.SqliteDB) error {
+	table := []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT", // id主键自动增长
+		"assetID VARCHAR(60)",                  // 文件资产的唯一标识(外部标识)
+		"owner TEXT",                           // 所有者的DID
+		"coOwners TEXT",                        // 共同所有者的DID(以逗号分隔)
+		"version INTEGER",                      // 访问控制的版本，每次变更后加一
+	}
+	if err := db.CreateTable("acl", table); err != nil {
+		return fmt.Errorf("数据库操作失败")
+	}
+
+	grants := []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT", // id主键自动增长
+		"assetID VARCHAR(60)",                  // 文件资产的唯一标识(外部标识)
+		"did TEXT",                             // 被分享者的DID
+		"permissions INTEGER",                  // 授予的权限(1:读取、2:写入、4:转让)
+	}
+	if err := db.CreateTable("acl_grants", grants); err != nil {
+		return fmt.Errorf("数据库操作失败")
+	}
+
+	ops := []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT", // id主键自动增长
+		"assetID VARCHAR(60)",                  // 文件资产的唯一标识(外部标识)
+		"version INTEGER",                      // 操作基于的版本
+		"op BLOB",                              // 签名的操作(JSON)
+	}
+	if err := db.CreateTable("acl_ops", ops); err != nil {
+		return fmt.Errorf("数据库操作失败")
+	}
+
+	return nil
+}
+
+// 创建文件目录数据库表
+func createCatalogTable(db *sqlites.SqliteDB) error {
+	table := []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT", // id主键自动增长
+		"assetID VARCHAR(60)",                  // 文件资产的唯一标识(外部标识)
+		"name TEXT",                            // 文件的基本名称
+		"customName TEXT",                      // 为文件设定的自定义名称
+		"size INTEGER",                         // 文件的长度(以字节为单位)
+		"modified INTEGER",                     // 文件的最后修改时间(Unix时间戳，以秒为单位)
+		"metadata TEXT",                        // 为文件附加的额外信息或属性(JSON)
+	}
+	if err := db.CreateTable("catalog", table); err != nil {
+		return fmt.Errorf("数据库操作失败")
+	}
+
+	tags := []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT", // id主键自动增长
+		"assetID VARCHAR(60)",                  // 文件资产的唯一标识(外部标识)
+		"tag TEXT",                             // 文件的标签
+	}
+	if err := db.CreateTable("catalog_tags", tags); err != nil {
+		return fmt.Errorf("数据库操作失败")
+	}
+
+	return nil
+}
+
+// 创建异步语句的任务数据库表
+func createJobTable(db *sqlites.SqliteDB) error {
+	table := []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT", // id主键自动增长
+		"jobID VARCHAR(32)",                    // 任务的唯一标识
+		"statement TEXT",                       // FQL 语句的原文
+		"status INTEGER",                       // 状态(0:失败、1:成功、2:待开始、3:进行中、4:已取消)
+		"error TEXT",                           // 失败的原因
+		"assetIDs TEXT",                        // 创建或受影响的文件资产(以逗号分隔)
+		"created TIMESTAMP",                    // 提交的时间
+		"updated TIMESTAMP",                    // 状态最后变化的时间
+	}
+	if err := db.CreateTable("jobs", table); err != nil {
+		return fmt.Errorf("数据库操作失败")
+	}
+
+	return nil
+}
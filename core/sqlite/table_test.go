@@ -0,0 +1,73 @@
+package sqlite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/sqlites"
+)
+
+func TestInitDBTableMigratesBaseline(t *testing.T) {
+	db, err := sqlites.NewSqliteDB(t.TempDir(), DbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// 早期版本创建的数据库表和记录
+	if err := db.CreateTable("files", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"assetID VARCHAR(60)",
+		"totalPieces INTEGER ",
+		"operates INTEGER ",
+		"status INTEGER ",
+		"times TIMESTAMP",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateTable("slices", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"assetID VARCHAR(60)",
+		"sliceHash VARCHAR(60)",
+		"sliceIndex INTEGER",
+		"status INTEGER",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Insert("files", map[string]interface{}{
+		"assetID": "asset", "totalPieces": 3, "operates": OperateUpload, "status": StatusSuccess, "times": time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for i, hash := range []string{"h0", "h1", "h2"} {
+		if err := db.Insert("slices", map[string]interface{}{
+			"assetID": "asset", "sliceHash": hash, "sliceIndex": i, "status": StatusSuccess,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := InitDBTable(db); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := SelectOneFileDatabase(db, "asset", OperateUpload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record == nil || record.TotalPieces != 3 || record.Name != "" || record.Size != 0 {
+		t.Fatalf("迁移后的文件数据为 %+v", record)
+	}
+	slices, err := SelectSlicesDatabase(db, "asset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slices) != 3 || slices[2].SliceHash != "h2" {
+		t.Fatalf("迁移后的文件片段数据为 %+v", slices)
+	}
+
+	// 迁移后可以写入新的记录
+	if err := InsertFilesDatabase(db, &FileRecord{AssetID: "new", Name: "a.txt", Size: 1, Operates: OperateUpload, Times: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,268 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bpfs/defs/sqlites"
+)
+
+// TaskRecord 描述内存池中一个任务的持久化状态
+type TaskRecord struct {
+	FileRecord
+	Progress []byte // 任务进度的位图
+	Paused   bool   // 是否暂停
+}
+
+// TaskSliceRecord 描述任务中单个文件片段的持久化状态
+type TaskSliceRecord struct {
+	SliceHash  string   // 文件片段的哈希值
+	SliceIndex int      // 文件片段的索引
+	RsCodes    bool     // 是否为纠删码
+	PeerIDs    []string // 持有该片段的节点
+	Retries    int      // 失败重试次数
+}
+
+// SaveTaskDatabase 保存任务的进度和暂停状态，文件数据不存在时插入一条进行中的记录
+func SaveTaskDatabase(db *sqlites.SqliteDB, record *TaskRecord) error {
+	conditions := []string{"assetID = ?", "operates = ?"}
+	args := []interface{}{record.AssetID, record.Operates}
+
+	exists, err := db.Exists("files", conditions, args)
+	if err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	progress := record.Progress
+	if progress == nil {
+		progress = []byte{} // 空位图与没有任务的 NULL 相区分
+	}
+
+	if exists {
+		data := map[string]interface{}{
+			"progress": progress,
+			"paused":   boolToInt(record.Paused),
+		}
+		// 下载任务在获取片段信息后才知道文件的详细信息
+		if record.TotalPieces > 0 {
+			data["totalPieces"] = record.TotalPieces
+		}
+		if record.DataPieces > 0 {
+			data["dataPieces"] = record.DataPieces
+		}
+		if record.Name != "" {
+			data["name"] = record.Name
+		}
+		if record.Size > 0 {
+			data["size"] = record.Size
+		}
+		if record.FileHash != "" {
+			data["fileHash"] = record.FileHash
+		}
+		if err := db.Update("files", data, conditions, args); err != nil {
+			return fmt.Errorf("数据库操作失败: %v", err)
+		}
+		return nil
+	}
+
+	times := record.Times
+	if times.IsZero() {
+		times = time.Now()
+	}
+	data := map[string]interface{}{
+		"assetID":     record.AssetID,
+		"name":        record.Name,
+		"size":        record.Size,
+		"fileHash":    record.FileHash,
+		"totalPieces": record.TotalPieces,
+		"dataPieces":  record.DataPieces,
+		"operates":    record.Operates,
+		"status":      StatusInProgress,
+		"times":       times,
+		"progress":    progress,
+		"paused":      boolToInt(record.Paused),
+	}
+	if err := db.Insert("files", data); err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	return nil
+}
+
+// SaveTaskSliceDatabase 保存任务中文件片段的状态，片段数据不存在时插入一条待开始的记录
+func SaveTaskSliceDatabase(db *sqlites.SqliteDB, assetID string, operates int, slice *TaskSliceRecord) error {
+	conditions := []string{"assetID = ?", "operates = ?", "sliceIndex = ?"}
+	args := []interface{}{assetID, operates, slice.SliceIndex}
+
+	exists, err := db.Exists("slices", conditions, args)
+	if err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"sliceHash": slice.SliceHash,
+		"rsCodes":   boolToInt(slice.RsCodes),
+		"peerIDs":   strings.Join(slice.PeerIDs, ","),
+		"retries":   slice.Retries,
+	}
+	if exists {
+		if err := db.Update("slices", data, conditions, args); err != nil {
+			return fmt.Errorf("数据库操作失败: %v", err)
+		}
+		return nil
+	}
+
+	data["assetID"] = assetID
+	data["sliceIndex"] = slice.SliceIndex
+	data["operates"] = operates
+	data["status"] = StatusPending
+	if err := db.Insert("slices", data); err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	return nil
+}
+
+// ClearTaskDatabase 清除任务的持久化状态
+// 上传的文件片段数据属于上传记录而保留，下载任务的文件片段数据一并删除
+func ClearTaskDatabase(db *sqlites.SqliteDB, assetID string, operates int) error {
+	conditions := []string{"assetID = ?", "operates = ?"}
+	args := []interface{}{assetID, operates}
+
+	data := map[string]interface{}{
+		"progress": nil,
+		"paused":   0,
+	}
+	if err := db.Update("files", data, conditions, args); err != nil {
+		return fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	if operates == OperateDownload {
+		if err := db.Delete("slices", conditions, args); err != nil {
+			return fmt.Errorf("数据库操作失败: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// SelectTasksDatabase 查询所有未清除的任务
+func SelectTasksDatabase(db *sqlites.SqliteDB) ([]*TaskRecord, error) {
+	columns := []string{
+		"assetID",     // 文件资产的唯一标识
+		"name",        // 文件的基本名称
+		"size",        // 文件的长度
+		"fileHash",    // 文件内容的哈希值
+		"totalPieces", // 文件片段的总量
+		"dataPieces",  // 数据片段的数量
+		"operates",    // 操作
+		"status",      // 状态
+		"progress",    // 任务进度
+		"paused",      // 是否暂停
+	}
+	conditions := []string{"progress IS NOT NULL"}
+
+	rows, err := db.Select("files", columns, conditions, nil, 0, 0, "id ASC")
+	if err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+	defer rows.Close()
+
+	var records []*TaskRecord
+	for rows.Next() {
+		var (
+			r        TaskRecord
+			name     sql.NullString
+			size     sql.NullInt64
+			fileHash sql.NullString
+			total    sql.NullInt64
+			data     sql.NullInt64
+			paused   sql.NullInt64
+		)
+		if err := rows.Scan(
+			&r.AssetID,
+			&name,
+			&size,
+			&fileHash,
+			&total,
+			&data,
+			&r.Operates,
+			&r.Status,
+			&r.Progress,
+			&paused,
+		); err != nil {
+			return nil, fmt.Errorf("数据库操作失败: %v", err)
+		}
+		r.Name = name.String
+		r.Size = size.Int64
+		r.FileHash = fileHash.String
+		r.TotalPieces = total.Int64
+		r.DataPieces = data.Int64
+		r.Paused = paused.Int64 != 0
+		records = append(records, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	return records, nil
+}
+
+// SelectTaskSlicesDatabase 查询任务中所有文件片段的状态，按片段索引升序排列
+func SelectTaskSlicesDatabase(db *sqlites.SqliteDB, assetID string, operates int) ([]*TaskSliceRecord, error) {
+	columns := []string{
+		"sliceHash",  // 文件片段的哈希值
+		"sliceIndex", // 文件片段的索引
+		"rsCodes",    // 是否为纠删码
+		"peerIDs",    // 持有该片段的节点
+		"retries",    // 失败重试次数
+	}
+	conditions := []string{"assetID=?", "operates=?"}
+	args := []interface{}{assetID, operates}
+
+	rows, err := db.Select("slices", columns, conditions, args, 0, 0, "sliceIndex ASC")
+	if err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+	defer rows.Close()
+
+	var records []*TaskSliceRecord
+	for rows.Next() {
+		var (
+			r       TaskSliceRecord
+			rsCodes sql.NullInt64
+			peerIDs sql.NullString
+			retries sql.NullInt64
+		)
+		if err := rows.Scan(
+			&r.SliceHash,
+			&r.SliceIndex,
+			&rsCodes,
+			&peerIDs,
+			&retries,
+		); err != nil {
+			return nil, fmt.Errorf("数据库操作失败: %v", err)
+		}
+		r.RsCodes = rsCodes.Int64 != 0
+		if peerIDs.String != "" {
+			r.PeerIDs = strings.Split(peerIDs.String, ",")
+		}
+		r.Retries = int(retries.Int64)
+		records = append(records, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+
+	return records, nil
+}
+
+// boolToInt 将布尔值转换为数据库中的整数
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
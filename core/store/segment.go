@@ -0,0 +1,391 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/segment"
+)
+
+// SliceDataSegment 是段文件中保存文件片段内容的段类型
+const SliceDataSegment = "SLICEDATA"
+
+// SegmentStore 以段文件格式将文件片段保存在本地磁盘
+// 每个文件资产对应一个子目录，每个文件片段对应一个段文件，片段内容带有CRC32校验和
+type SegmentStore struct {
+	fs *afero.FileStore
+}
+
+// NewSegmentStore 在 basePath 下创建一个新的段文件片段存储
+func NewSegmentStore(basePath string) (*SegmentStore, error) {
+	fs, err := afero.NewFileStore(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SegmentStore{fs: fs}, nil
+}
+
+// sliceName 返回文件片段的文件名
+func sliceName(index int) string {
+	return strconv.Itoa(index)
+}
+
+// corruptName 返回已隔离的文件片段的文件名
+func corruptName(index int) string {
+	return sliceName(index) + ".corrupt"
+}
+
+// Put 保存文件资产中指定索引的文件片段
+func (s *SegmentStore) Put(assetID string, index int, data []byte) error {
+	dir := filepath.Join(s.fs.BasePath, assetID)
+	if err := s.fs.Fs.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// 先写入临时文件，完成后再重命名，避免中途失败留下残缺的片段
+	tmpName := sliceName(index) + ".tmp"
+	file, err := os.Create(filepath.Join(dir, tmpName))
+	if err != nil {
+		return err
+	}
+
+	xref := segment.NewFileXref()
+	if err := segment.WriteSegmentToFile(file, SliceDataSegment, data, xref); err != nil {
+		file.Close()
+		_ = s.fs.Delete(assetID, tmpName)
+		return err
+	}
+
+	// 保存 xref 表和关闭文件
+	if err := segment.SaveAndClose(file, xref); err != nil {
+		_ = s.fs.Delete(assetID, tmpName)
+		return err
+	}
+
+	return s.fs.RenameFile(assetID, tmpName, assetID, sliceName(index))
+}
+
+// Get 读取文件资产中指定索引的文件片段
+func (s *SegmentStore) Get(assetID string, index int) ([]byte, error) {
+	exists, err := s.Has(assetID, index)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	file, err := s.fs.OpenFile(assetID, sliceName(index))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// 加载 xref 表并读取片段内容，读取时会校验CRC32
+	xref, err := segment.LoadXref(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	data, err := segment.ReadSegmentToFile(file, SliceDataSegment, xref)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	return data, nil
+}
+
+// Create 创建文件资产中指定索引的文件片段，内容直接写入临时文件，Close 时补全段头和 xref 表后重命名
+func (s *SegmentStore) Create(assetID string, index int) (ShardWriter, error) {
+	dir := filepath.Join(s.fs.BasePath, assetID)
+	if err := s.fs.Fs.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	tmpName := sliceName(index) + ".tmp"
+	file, err := os.Create(filepath.Join(dir, tmpName))
+	if err != nil {
+		return nil, err
+	}
+
+	// 段位于文件开头，长度和校验和在写入完成后回填
+	var header bytes.Buffer
+	binary.Write(&header, binary.BigEndian, uint32(len(SliceDataSegment)))
+	header.WriteString(SliceDataSegment)
+	binary.Write(&header, binary.BigEndian, [2]uint32{})
+	if _, err := file.Write(header.Bytes()); err != nil {
+		file.Close()
+		_ = s.fs.Delete(assetID, tmpName)
+		return nil, err
+	}
+
+	return &segmentWriter{
+		s:       s,
+		assetID: assetID,
+		index:   index,
+		tmpName: tmpName,
+		file:    file,
+		crc:     crc32.NewIEEE(),
+	}, nil
+}
+
+// Open 打开文件资产中指定索引的文件片段，读取到末尾时校验CRC32
+func (s *SegmentStore) Open(assetID string, index int) (io.ReadCloser, error) {
+	exists, err := s.Has(assetID, index)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	file, err := s.fs.OpenFile(assetID, sliceName(index))
+	if err != nil {
+		return nil, err
+	}
+	length, checksum, err := seekSliceData(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	return &segmentReader{
+		file:     file,
+		r:        io.LimitReader(file, int64(length)),
+		crc:      crc32.NewIEEE(),
+		length:   int64(length),
+		checksum: checksum,
+	}, nil
+}
+
+// seekSliceData 根据文件末尾的 xref 表定位片段内容，返回内容的长度和CRC32校验和
+// 只读取 xref 表和段头，不加载片段内容
+func seekSliceData(file *os.File) (uint32, uint32, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// 文件末尾为 "startxref" 和 xref 表的起始位置
+	const trailer = "startxref"
+	tail := make([]byte, len(trailer)+8)
+	end := info.Size() - int64(len(tail))
+	if end < 0 {
+		return 0, 0, fmt.Errorf("文件过短")
+	}
+	if _, err := file.ReadAt(tail, end); err != nil {
+		return 0, 0, err
+	}
+	if string(tail[:len(trailer)]) != trailer {
+		return 0, 0, fmt.Errorf("没有找到 xref 表")
+	}
+	start := int64(binary.BigEndian.Uint64(tail[len(trailer):]))
+	if start < 0 || start > end {
+		return 0, 0, fmt.Errorf("xref 表的位置 %d 无效", start)
+	}
+
+	var entry *segment.XrefEntry
+	r := io.NewSectionReader(file, start, end-start)
+	for entry == nil {
+		var typeLen uint32
+		if err := binary.Read(r, binary.BigEndian, &typeLen); err != nil {
+			return 0, 0, fmt.Errorf("xref 表中没有片段内容")
+		}
+		if typeLen > uint32(end-start) {
+			return 0, 0, fmt.Errorf("xref 表已损坏")
+		}
+		segmentType := make([]byte, typeLen)
+		if _, err := io.ReadFull(r, segmentType); err != nil {
+			return 0, 0, err
+		}
+		var e segment.XrefEntry
+		if err := binary.Read(r, binary.BigEndian, &e); err != nil {
+			return 0, 0, err
+		}
+		if string(segmentType) == SliceDataSegment {
+			entry = &e
+		}
+	}
+
+	// 段头: 段类型的长度 | 段类型 | 内容的长度 | CRC32校验和
+	header := make([]byte, 4+len(SliceDataSegment)+8)
+	if _, err := file.ReadAt(header, entry.Offset); err != nil {
+		return 0, 0, err
+	}
+	if int(binary.BigEndian.Uint32(header)) != len(SliceDataSegment) || string(header[4:4+len(SliceDataSegment)]) != SliceDataSegment {
+		return 0, 0, fmt.Errorf("段头与 xref 表不符")
+	}
+	length := binary.BigEndian.Uint32(header[4+len(SliceDataSegment):])
+	checksum := binary.BigEndian.Uint32(header[8+len(SliceDataSegment):])
+	if length != entry.Length || entry.Offset+int64(len(header))+int64(length) > start {
+		return 0, 0, fmt.Errorf("片段内容的长度 %d 无效", length)
+	}
+	if _, err := file.Seek(entry.Offset+int64(len(header)), io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+
+	return length, checksum, nil
+}
+
+// segmentWriter 将片段内容流式写入段文件
+type segmentWriter struct {
+	s       *SegmentStore
+	assetID string
+	index   int
+	tmpName string
+	file    *os.File
+	crc     hash.Hash32
+	size    int64
+}
+
+func (w *segmentWriter) Write(p []byte) (int, error) {
+	// 段头中的长度为 32 位
+	if w.size+int64(len(p)) > math.MaxUint32 {
+		return 0, fmt.Errorf("文件片段的大小超过 %d", uint32(math.MaxUint32))
+	}
+	n, err := w.file.Write(p)
+	w.crc.Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+// Close 回填段头中的长度和校验和，写入 xref 表后将临时文件重命名为片段
+func (w *segmentWriter) Close() error {
+	if w.size == 0 {
+		w.Abort()
+		return fmt.Errorf("文件片段的内容为空")
+	}
+
+	var fields [2]uint32
+	fields[0], fields[1] = uint32(w.size), w.crc.Sum32()
+	if _, err := w.file.Seek(int64(4+len(SliceDataSegment)), io.SeekStart); err != nil {
+		w.Abort()
+		return err
+	}
+	if err := binary.Write(w.file, binary.BigEndian, fields); err != nil {
+		w.Abort()
+		return err
+	}
+
+	xref := segment.NewFileXref()
+	xref.XrefTable[SliceDataSegment] = segment.XrefEntry{Offset: 0, Length: uint32(w.size)}
+	if err := segment.SaveAndClose(w.file, xref); err != nil {
+		_ = w.s.fs.Delete(w.assetID, w.tmpName)
+		return err
+	}
+
+	return w.s.fs.RenameFile(w.assetID, w.tmpName, w.assetID, sliceName(w.index))
+}
+
+// Abort 关闭并删除临时文件
+func (w *segmentWriter) Abort() {
+	w.file.Close()
+	_ = w.s.fs.Delete(w.assetID, w.tmpName)
+}
+
+// segmentReader 读取段文件中的片段内容，读取到末尾时校验长度和CRC32
+type segmentReader struct {
+	file     *os.File
+	r        io.Reader
+	crc      hash.Hash32
+	read     int64
+	length   int64
+	checksum uint32
+}
+
+func (r *segmentReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.crc.Write(p[:n])
+	r.read += int64(n)
+	if err == io.EOF && (r.read != r.length || r.crc.Sum32() != r.checksum) {
+		return n, fmt.Errorf("%w: 校验和不匹配", ErrCorrupt)
+	}
+	return n, err
+}
+
+func (r *segmentReader) Close() error {
+	return r.file.Close()
+}
+
+// Has 检查文件资产中指定索引的文件片段是否存在
+func (s *SegmentStore) Has(assetID string, index int) (bool, error) {
+	return s.fs.Exists(assetID, sliceName(index))
+}
+
+// Delete 删除文件资产中指定索引的文件片段
+func (s *SegmentStore) Delete(assetID string, index int) error {
+	for _, name := range []string{sliceName(index), corruptName(index)} {
+		if err := s.fs.Delete(assetID, name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteAll 删除文件资产的所有文件片段
+func (s *SegmentStore) DeleteAll(assetID string) error {
+	// 防止误删整个存储目录
+	if assetID == "" {
+		return fmt.Errorf("文件资产的唯一标识不可为空")
+	}
+
+	return s.fs.DeleteAll(assetID)
+}
+
+// Walk 按顺序遍历所有未隔离的文件片段，跳过写入中的临时文件和已隔离的文件
+func (s *SegmentStore) Walk(fn func(assetID string, index int) error) error {
+	dirs, err := afero.ReadDir(s.fs.Fs, s.fs.BasePath)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		files, err := s.fs.ListFiles(dir.Name())
+		if err != nil {
+			return err
+		}
+
+		var indexes []int
+		for _, name := range files {
+			if index, err := strconv.Atoi(name); err == nil && sliceName(index) == name {
+				indexes = append(indexes, index)
+			}
+		}
+		sort.Ints(indexes)
+
+		for _, index := range indexes {
+			if err := fn(dir.Name(), index); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Quarantine 将文件片段重命名为隔离文件，之后保存的同一片段不受影响
+func (s *SegmentStore) Quarantine(assetID string, index int) error {
+	exists, err := s.Has(assetID, index)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	return s.fs.RenameFile(assetID, sliceName(index), assetID, corruptName(index))
+}
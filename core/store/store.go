@@ -0,0 +1,216 @@
+// 文件片段的本地存储
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// ErrNotFound 表示请求的文件片段不存在
+var ErrNotFound = fmt.Errorf("文件片段不存在")
+
+// ErrCorrupt 表示文件片段的内容已损坏，例如校验和不匹配
+var ErrCorrupt = fmt.Errorf("文件片段已损坏")
+
+// ShardStore 定义了文件片段的本地存储接口
+type ShardStore interface {
+	// Put 保存文件资产中指定索引的文件片段
+	Put(assetID string, index int, data []byte) error
+	// Get 读取文件资产中指定索引的文件片段，不存在时返回 ErrNotFound
+	Get(assetID string, index int) ([]byte, error)
+	// Has 检查文件资产中指定索引的文件片段是否存在
+	Has(assetID string, index int) (bool, error)
+	// Delete 删除文件资产中指定索引的文件片段
+	Delete(assetID string, index int) error
+	// DeleteAll 删除文件资产的所有文件片段
+	DeleteAll(assetID string) error
+}
+
+// Scrubbable 是支持巡检的文件片段存储，可以遍历所有片段并隔离损坏的片段
+type Scrubbable interface {
+	ShardStore
+	// Walk 按文件资产和片段索引的顺序遍历所有未隔离的文件片段，fn 返回错误时停止遍历
+	Walk(fn func(assetID string, index int) error) error
+	// Quarantine 隔离损坏的文件片段，隔离后不再读取，但保留其内容以便排查
+	Quarantine(assetID string, index int) error
+}
+
+// ShardWriter 写入一个文件片段，Close 成功后片段才可以读取
+type ShardWriter interface {
+	io.WriteCloser
+	// Abort 丢弃已写入的内容，调用后不需要再调用 Close
+	Abort()
+}
+
+// Streamer 是支持流式读写的文件片段存储，读写时不需要将整个片段保留在内存中
+type Streamer interface {
+	ShardStore
+	// Create 创建文件资产中指定索引的文件片段，Close 成功后替换已有的片段
+	Create(assetID string, index int) (ShardWriter, error)
+	// Open 打开文件资产中指定索引的文件片段，不存在时返回 ErrNotFound，内容损坏时读取返回 ErrCorrupt
+	Open(assetID string, index int) (io.ReadCloser, error)
+}
+
+// Create 创建文件片段的写入，存储不支持流式写入时在内存中缓冲，Close 时一次保存
+func Create(s ShardStore, assetID string, index int) (ShardWriter, error) {
+	if st, ok := s.(Streamer); ok {
+		return st.Create(assetID, index)
+	}
+	return &bufferedWriter{s: s, assetID: assetID, index: index}, nil
+}
+
+// Open 打开文件片段的读取，存储不支持流式读取时一次读取整个片段
+func Open(s ShardStore, assetID string, index int) (io.ReadCloser, error) {
+	if st, ok := s.(Streamer); ok {
+		return st.Open(assetID, index)
+	}
+	data, err := s.Get(assetID, index)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// bufferedWriter 在内存中缓冲文件片段，Close 时保存到不支持流式写入的存储
+type bufferedWriter struct {
+	s       ShardStore
+	assetID string
+	index   int
+	buf     bytes.Buffer
+}
+
+func (w *bufferedWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *bufferedWriter) Close() error {
+	return w.s.Put(w.assetID, w.index, w.buf.Bytes())
+}
+
+func (w *bufferedWriter) Abort() {
+	w.buf.Reset()
+}
+
+// MemoryStore 是基于内存的文件片段存储，适用于测试和临时节点
+type MemoryStore struct {
+	mu          sync.RWMutex
+	shards      map[string]map[int][]byte // 文件资产 -> 片段索引 -> 片段内容
+	quarantined map[string]map[int][]byte // 已隔离的文件片段
+}
+
+// NewMemoryStore 创建一个新的内存文件片段存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		shards:      make(map[string]map[int][]byte),
+		quarantined: make(map[string]map[int][]byte),
+	}
+}
+
+// Put 保存文件资产中指定索引的文件片段
+func (s *MemoryStore) Put(assetID string, index int, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.shards[assetID]; !exists {
+		s.shards[assetID] = make(map[int][]byte)
+	}
+	s.shards[assetID][index] = append([]byte(nil), data...)
+
+	return nil
+}
+
+// Get 读取文件资产中指定索引的文件片段
+func (s *MemoryStore) Get(assetID string, index int) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, exists := s.shards[assetID][index]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	return append([]byte(nil), data...), nil
+}
+
+// Has 检查文件资产中指定索引的文件片段是否存在
+func (s *MemoryStore) Has(assetID string, index int) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, exists := s.shards[assetID][index]
+	return exists, nil
+}
+
+// Delete 删除文件资产中指定索引的文件片段
+func (s *MemoryStore) Delete(assetID string, index int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.shards[assetID], index)
+	if len(s.shards[assetID]) == 0 {
+		delete(s.shards, assetID)
+	}
+
+	return nil
+}
+
+// DeleteAll 删除文件资产的所有文件片段
+func (s *MemoryStore) DeleteAll(assetID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.shards, assetID)
+	delete(s.quarantined, assetID)
+	return nil
+}
+
+// Walk 按顺序遍历所有未隔离的文件片段，遍历期间 fn 可以读写存储
+func (s *MemoryStore) Walk(fn func(assetID string, index int) error) error {
+	s.mu.RLock()
+	assets := make([]string, 0, len(s.shards))
+	indexes := make(map[string][]int, len(s.shards))
+	for assetID, shards := range s.shards {
+		assets = append(assets, assetID)
+		for index := range shards {
+			indexes[assetID] = append(indexes[assetID], index)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Strings(assets)
+	for _, assetID := range assets {
+		sort.Ints(indexes[assetID])
+		for _, index := range indexes[assetID] {
+			if err := fn(assetID, index); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Quarantine 隔离文件资产中指定索引的文件片段
+func (s *MemoryStore) Quarantine(assetID string, index int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.shards[assetID][index]
+	if !exists {
+		return ErrNotFound
+	}
+	if _, exists := s.quarantined[assetID]; !exists {
+		s.quarantined[assetID] = make(map[int][]byte)
+	}
+	s.quarantined[assetID][index] = data
+
+	delete(s.shards[assetID], index)
+	if len(s.shards[assetID]) == 0 {
+		delete(s.shards, assetID)
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testShardStore(t *testing.T, s ShardStore) {
+	data := []byte("hello shard")
+
+	if err := s.Put("asset", 3, data); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	if ok, err := s.Has("asset", 3); err != nil || !ok {
+		t.Fatalf("片段应当存在: %v, %v", ok, err)
+	}
+
+	got, err := s.Get("asset", 3)
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("读取的内容 %q 与保存的内容 %q 不一致", got, data)
+	}
+
+	if _, err := s.Get("asset", 4); err != ErrNotFound {
+		t.Fatalf("读取不存在的片段应当返回 ErrNotFound, 实际为 %v", err)
+	}
+
+	if err := s.Delete("asset", 3); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if ok, _ := s.Has("asset", 3); ok {
+		t.Fatal("删除后片段不应存在")
+	}
+
+	if err := s.Put("asset", 0, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteAll("asset"); err != nil {
+		t.Fatalf("删除全部片段失败: %v", err)
+	}
+	if ok, _ := s.Has("asset", 0); ok {
+		t.Fatal("删除全部片段后片段不应存在")
+	}
+}
+
+func testScrubbable(t *testing.T, s Scrubbable) {
+	for _, shard := range []struct {
+		assetID string
+		index   int
+	}{{"b", 0}, {"a", 10}, {"a", 2}, {"b", 1}} {
+		if err := s.Put(shard.assetID, shard.index, []byte("shard")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	walk := func() string {
+		var got []string
+		if err := s.Walk(func(assetID string, index int) error {
+			got = append(got, fmt.Sprintf("%s/%d", assetID, index))
+			return nil
+		}); err != nil {
+			t.Fatalf("遍历失败: %v", err)
+		}
+		return fmt.Sprint(got)
+	}
+	if got := walk(); got != "[a/2 a/10 b/0 b/1]" {
+		t.Fatalf("遍历的片段为 %s", got)
+	}
+
+	if err := s.Quarantine("a", 10); err != nil {
+		t.Fatalf("隔离失败: %v", err)
+	}
+	if _, err := s.Get("a", 10); err != ErrNotFound {
+		t.Fatalf("读取已隔离的片段返回 %v", err)
+	}
+	if err := s.Quarantine("a", 10); err != ErrNotFound {
+		t.Fatalf("重复隔离返回 %v", err)
+	}
+	if got := walk(); got != "[a/2 b/0 b/1]" {
+		t.Fatalf("隔离后遍历的片段为 %s", got)
+	}
+
+	// 重新保存后片段恢复可用
+	if err := s.Put("a", 10, []byte("repaired")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get("a", 10); err != nil || string(got) != "repaired" {
+		t.Fatalf("重新保存后读取到 %q, %v", got, err)
+	}
+}
+
+func testStreaming(t *testing.T, s ShardStore) {
+	data := bytes.Repeat([]byte("streamed shard "), 5000)
+
+	w, err := Create(s, "asset", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 分多次写入，Close 前片段不可读取
+	for i := 0; i < len(data); i += 4096 {
+		end := i + 4096
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := w.Write(data[i:end]); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if ok, _ := s.Has("asset", 1); ok {
+		t.Fatal("写入完成前片段已存在")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	// 流式写入的片段可以整体读取，整体保存的片段也可以流式读取
+	if got, err := s.Get("asset", 1); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("读取流式写入的片段失败: %v", err)
+	}
+	if err := s.Put("asset", 2, data); err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range []int{1, 2} {
+		r, err := Open(s, "asset", index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("流式读取片段 %d 失败: %v", index, err)
+		}
+	}
+	if _, err := Open(s, "asset", 3); err != ErrNotFound {
+		t.Fatalf("打开不存在的片段返回 %v", err)
+	}
+
+	// 放弃的写入不留下片段
+	w, err = Create(s, "asset", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	w.Abort()
+	if ok, _ := s.Has("asset", 3); ok {
+		t.Fatal("放弃写入后片段存在")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testShardStore(t, NewMemoryStore())
+	testScrubbable(t, NewMemoryStore())
+	testStreaming(t, NewMemoryStore())
+}
+
+func TestSegmentStore(t *testing.T) {
+	s, err := NewSegmentStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testShardStore(t, s)
+
+	if s, err = NewSegmentStore(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	testScrubbable(t, s)
+}
+
+func TestSegmentStoreStreaming(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSegmentStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStreaming(t, s)
+
+	// 片段内容被修改时，读取到末尾返回 ErrCorrupt
+	file := filepath.Join(dir, "asset", "1")
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[len(raw)/2] ^= 0x01
+	if err := os.WriteFile(file, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.Open("asset", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("读取损坏的片段返回 %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+// 上传和下载的带宽限制
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// minBurst 是令牌桶的最小容量，避免低速率下小片段也要逐字节等待
+const minBurst = 64 << 10
+
+// meterWindow 是计算吞吐量的时间窗口(秒)
+const meterWindow = 5
+
+// Limiter 是以字节为单位的令牌桶限速器，速率为 0 时不限速
+// 请求超过桶中令牌时先行扣除，调用方等待欠下的令牌补足，因此任意大小的片段都能通过
+type Limiter struct {
+	mu     sync.Mutex
+	rate   int64     // 每秒补充的令牌数(字节/秒)
+	burst  int64     // 令牌桶的容量
+	tokens float64   // 当前的令牌数，可以为负
+	last   time.Time // 上一次补充令牌的时间
+	meter  meter     // 最近通过的字节数
+	now    func() time.Time
+}
+
+// NewLimiter 创建一个每秒允许 rate 字节的限速器
+func NewLimiter(rate int64) *Limiter {
+	l := &Limiter{now: time.Now}
+	l.SetRate(rate)
+	return l
+}
+
+// SetRate 修改限速器的速率，已在等待的请求按原速率计算的时间返回
+func (l *Limiter) SetRate(rate int64) {
+	if rate < 0 {
+		rate = 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.advance(l.now())
+	unlimited := l.rate == 0
+	l.rate = rate
+	l.burst = rate
+	if l.burst < minBurst {
+		l.burst = minBurst
+	}
+	// 从不限速切换为限速时以满桶开始
+	if unlimited || l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+}
+
+// Rate 返回限速器的速率，0 表示不限速
+func (l *Limiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// WaitN 等待 n 个字节的令牌，上下文结束时归还令牌并返回错误
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	wait := l.reserve(l.now(), n)
+	l.mu.Unlock()
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			l.mu.Lock()
+			l.tokens += float64(n)
+			if l.tokens > float64(l.burst) {
+				l.tokens = float64(l.burst)
+			}
+			l.mu.Unlock()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	l.mu.Lock()
+	l.meter.add(l.now(), int64(n))
+	l.mu.Unlock()
+	return nil
+}
+
+// Throughput 返回最近几秒内通过限速器的平均速度(字节/秒)
+func (l *Limiter) Throughput() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.meter.rate(l.now())
+}
+
+// reserve 扣除 n 个令牌并返回需要等待的时间，调用方需持有锁
+func (l *Limiter) reserve(now time.Time, n int) time.Duration {
+	if l.rate == 0 {
+		return 0
+	}
+
+	l.advance(now)
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+}
+
+// advance 按经过的时间补充令牌，调用方需持有锁
+func (l *Limiter) advance(now time.Time) {
+	if !l.last.IsZero() && now.After(l.last) && l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+	}
+	l.last = now
+}
+
+// meter 按秒统计最近 meterWindow 秒内通过的字节数
+type meter struct {
+	bytes   [meterWindow]int64
+	seconds [meterWindow]int64
+}
+
+// add 记录当前时间通过的字节数
+func (m *meter) add(now time.Time, n int64) {
+	sec := now.Unix()
+	i := sec % meterWindow
+	if m.seconds[i] != sec {
+		m.seconds[i] = sec
+		m.bytes[i] = 0
+	}
+	m.bytes[i] += n
+}
+
+// rate 计算时间窗口内的平均速度
+func (m *meter) rate(now time.Time) float64 {
+	sec := now.Unix()
+	var total int64
+	for i := range m.bytes {
+		if m.seconds[i] > sec-meterWindow && m.seconds[i] <= sec {
+			total += m.bytes[i]
+		}
+	}
+	return float64(total) / meterWindow
+}
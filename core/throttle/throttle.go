@@ -0,0 +1,235 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limits 描述上传和下载的速率(字节/秒)，0 表示不限速
+type Limits struct {
+	Upload   int64 // 上传速率
+	Download int64 // 下载速率
+}
+
+// Rule 描述一天中某个时间段的全局限速
+type Rule struct {
+	Start  time.Duration // 时间段的开始，相对于当天零点
+	End    time.Duration // 时间段的结束，小于开始时跨越零点
+	Limits               // 时间段内的速率
+}
+
+// contains 检查一天中的时刻是否在时间段内
+func (r *Rule) contains(clock time.Duration) bool {
+	if r.Start <= r.End {
+		return clock >= r.Start && clock < r.End
+	}
+	return clock >= r.Start || clock < r.End
+}
+
+// Schedule 是按一天中的时刻生效的限速规则，多条规则重叠时先出现的优先
+// 不在任何时间段内时使用基础速率
+type Schedule []Rule
+
+// Validate 检查规则的时间段是否有效
+func (s Schedule) Validate() error {
+	for i, rule := range s {
+		if rule.Start < 0 || rule.Start >= 24*time.Hour || rule.End < 0 || rule.End > 24*time.Hour {
+			return fmt.Errorf("第 %d 条限速规则的时间段 %v-%v 无效", i+1, rule.Start, rule.End)
+		}
+		if rule.Start == rule.End {
+			return fmt.Errorf("第 %d 条限速规则的开始和结束时间相同", i+1)
+		}
+		if rule.Upload < 0 || rule.Download < 0 {
+			return fmt.Errorf("第 %d 条限速规则的速率不可小于 0", i+1)
+		}
+	}
+	return nil
+}
+
+// match 返回 t 所在时间段的规则，没有时返回空
+func (s Schedule) match(t time.Time) *Rule {
+	y, m, d := t.Date()
+	clock := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	for i := range s {
+		if s[i].contains(clock) {
+			return &s[i]
+		}
+	}
+	return nil
+}
+
+// ParseClock 解析 "HH:MM" 格式的时刻，返回相对于当天零点的时长
+func ParseClock(s string) (time.Duration, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(s, "%d:%d", &hour, &minute); err != nil {
+		return 0, fmt.Errorf("无效的时刻 %q: %v", s, err)
+	}
+	if hour < 0 || hour > 24 || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("无效的时刻 %q", s)
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
+
+// taskLimiter 是单个任务的限速器
+type taskLimiter struct {
+	up, down *Limiter
+}
+
+// Throttle 管理全局和各任务的上传下载速率
+// 片段先经过任务自身的限速，再经过全局限速；全局速率随时刻表变化
+type Throttle struct {
+	mu       sync.Mutex
+	base     Limits // 不在时刻表时间段内的全局速率
+	schedule Schedule
+	applied  Limits // 当前生效的全局速率
+	up, down *Limiter
+	tasks    map[string]*taskLimiter
+	now      func() time.Time
+}
+
+// New 创建一个以 base 为全局速率、按 schedule 调整的限速管理器
+func New(base Limits, schedule Schedule) (*Throttle, error) {
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+
+	t := &Throttle{
+		base:     base,
+		schedule: schedule,
+		up:       NewLimiter(0),
+		down:     NewLimiter(0),
+		tasks:    make(map[string]*taskLimiter),
+		now:      time.Now,
+	}
+	t.refresh()
+
+	return t, nil
+}
+
+// SetLimits 修改全局的基础速率，立即生效
+func (t *Throttle) SetLimits(base Limits) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.base = base
+	t.refresh()
+}
+
+// SetSchedule 修改全局速率的时刻表，立即生效
+func (t *Throttle) SetSchedule(schedule Schedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.schedule = schedule
+	t.refresh()
+	return nil
+}
+
+// Limits 返回当前生效的全局速率
+func (t *Throttle) Limits() Limits {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.refresh()
+	return t.applied
+}
+
+// SetTaskLimits 设置文件资产的任务速率，该任务同时受全局速率限制
+func (t *Throttle) SetTaskLimits(assetID string, limits Limits) {
+	t.mu.Lock()
+	task := t.task(assetID)
+	t.mu.Unlock()
+
+	task.up.SetRate(limits.Upload)
+	task.down.SetRate(limits.Download)
+}
+
+// RemoveTask 移除文件资产的任务速率和统计，任务结束时调用
+func (t *Throttle) RemoveTask(assetID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.tasks, assetID)
+}
+
+// WaitUpload 等待文件资产上传 n 个字节的配额，assetID 为空时只受全局速率限制
+func (t *Throttle) WaitUpload(ctx context.Context, assetID string, n int) error {
+	task, global := t.limiters(assetID)
+	if task != nil {
+		if err := task.up.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	return global.up.WaitN(ctx, n)
+}
+
+// WaitDownload 等待文件资产下载 n 个字节的配额，assetID 为空时只受全局速率限制
+func (t *Throttle) WaitDownload(ctx context.Context, assetID string, n int) error {
+	task, global := t.limiters(assetID)
+	if task != nil {
+		if err := task.down.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	return global.down.WaitN(ctx, n)
+}
+
+// Throughput 返回最近几秒内全局的上传和下载速度(字节/秒)
+func (t *Throttle) Throughput() (upload, download float64) {
+	return t.up.Throughput(), t.down.Throughput()
+}
+
+// TaskThroughput 返回最近几秒内文件资产的上传和下载速度(字节/秒)
+func (t *Throttle) TaskThroughput(assetID string) (upload, download float64) {
+	t.mu.Lock()
+	task, exists := t.tasks[assetID]
+	t.mu.Unlock()
+
+	if !exists {
+		return 0, 0
+	}
+	return task.up.Throughput(), task.down.Throughput()
+}
+
+// limiters 返回任务和全局的限速器，并按时刻表更新全局速率，assetID 为空时任务限速器为空
+func (t *Throttle) limiters(assetID string) (*taskLimiter, *taskLimiter) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.refresh()
+	global := &taskLimiter{up: t.up, down: t.down}
+	if assetID == "" {
+		return nil, global
+	}
+	return t.task(assetID), global
+}
+
+// task 返回文件资产的任务限速器，不存在时创建不限速的限速器，调用方需持有锁
+func (t *Throttle) task(assetID string) *taskLimiter {
+	task, exists := t.tasks[assetID]
+	if !exists {
+		task = &taskLimiter{up: NewLimiter(0), down: NewLimiter(0)}
+		t.tasks[assetID] = task
+	}
+	return task
+}
+
+// refresh 根据当前时刻计算全局速率，变化时更新限速器，调用方需持有锁
+func (t *Throttle) refresh() {
+	limits := t.base
+	if rule := t.schedule.match(t.now()); rule != nil {
+		limits = rule.Limits
+	}
+	if limits == t.applied {
+		return
+	}
+
+	t.applied = limits
+	t.up.SetRate(limits.Upload)
+	t.down.SetRate(limits.Download)
+}
@@ -0,0 +1,181 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClock 是可以手动推进的时钟
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func TestLimiterReserve(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewLimiter(100 << 10)
+	l.now = clock.now
+	l.last = clock.t
+
+	// 桶满时立即通过，超出部分按速率等待
+	if wait := l.reserve(clock.t, 100<<10); wait != 0 {
+		t.Fatalf("桶满时等待 %v", wait)
+	}
+	if wait := l.reserve(clock.t, 50<<10); wait != 500*time.Millisecond {
+		t.Fatalf("欠下半秒的令牌时等待 %v", wait)
+	}
+
+	// 一秒后补充 100KB，偿还欠下的 50KB 后剩余 50KB
+	clock.t = clock.t.Add(time.Second)
+	if wait := l.reserve(clock.t, 50<<10); wait != 0 {
+		t.Fatalf("令牌补足后等待 %v", wait)
+	}
+
+	// 速率为 0 时不限速
+	l.SetRate(0)
+	if wait := l.reserve(clock.t, 1<<30); wait != 0 {
+		t.Fatalf("不限速时等待 %v", wait)
+	}
+}
+
+func TestLimiterWaitN(t *testing.T) {
+	l := NewLimiter(1 << 20)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.WaitN(context.Background(), 512<<10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 桶中 1MB 立即通过，剩余 512KB 以 1MB/s 等待约半秒
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("1.5MB 以 1MB/s 通过耗时 %v", elapsed)
+	}
+	if tp := l.Throughput(); tp != float64(3*512<<10)/meterWindow {
+		t.Fatalf("吞吐量为 %v", tp)
+	}
+
+	// 上下文结束时归还令牌
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.WaitN(ctx, 4<<20); err == nil {
+		t.Fatal("上下文结束时应返回错误")
+	}
+	l.mu.Lock()
+	tokens := l.tokens
+	l.mu.Unlock()
+	if tokens < -float64(1<<20) {
+		t.Fatalf("取消的请求未归还令牌, 剩余 %v", tokens)
+	}
+}
+
+func TestScheduleMatch(t *testing.T) {
+	night, err := ParseClock("22:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	morning, err := ParseClock("07:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseClock("25:00"); err == nil {
+		t.Fatal("无效的时刻应当报错")
+	}
+
+	schedule := Schedule{
+		{Start: night, End: morning, Limits: Limits{}},                               // 夜间不限速
+		{Start: 9 * time.Hour, End: 18 * time.Hour, Limits: Limits{Upload: 1 << 20}}, // 工作时间限制上传
+	}
+	if err := schedule.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		clock time.Duration
+		rule  int
+	}{
+		{23 * time.Hour, 0},
+		{time.Hour, 0},
+		{7*time.Hour + 30*time.Minute, -1},
+		{12 * time.Hour, 1},
+		{18 * time.Hour, -1},
+	}
+	for _, tt := range tests {
+		rule := schedule.match(day.Add(tt.clock))
+		switch {
+		case tt.rule < 0 && rule != nil:
+			t.Fatalf("%v 匹配了规则 %+v", tt.clock, rule)
+		case tt.rule >= 0 && rule != &schedule[tt.rule]:
+			t.Fatalf("%v 未匹配第 %d 条规则", tt.clock, tt.rule+1)
+		}
+	}
+
+	if err := (Schedule{{Start: time.Hour, End: time.Hour}}).Validate(); err == nil {
+		t.Fatal("开始和结束时间相同的规则应当无效")
+	}
+}
+
+func TestThrottleSchedule(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local)}
+	throttle, err := New(Limits{Upload: 4 << 20, Download: 8 << 20}, Schedule{
+		{Start: 9 * time.Hour, End: 18 * time.Hour, Limits: Limits{Upload: 1 << 20, Download: 8 << 20}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	throttle.now = clock.now
+
+	if limits := throttle.Limits(); limits.Upload != 4<<20 {
+		t.Fatalf("时间段外的速率为 %+v", limits)
+	}
+	clock.t = clock.t.Add(2 * time.Hour)
+	if limits := throttle.Limits(); limits.Upload != 1<<20 || throttle.up.Rate() != 1<<20 {
+		t.Fatalf("时间段内的速率为 %+v", limits)
+	}
+
+	// 运行时修改基础速率，在时间段外生效
+	throttle.SetLimits(Limits{Upload: 2 << 20})
+	clock.t = clock.t.Add(10 * time.Hour)
+	if limits := throttle.Limits(); limits.Upload != 2<<20 || limits.Download != 0 {
+		t.Fatalf("修改后的速率为 %+v", limits)
+	}
+}
+
+func TestThrottleTaskLimits(t *testing.T) {
+	throttle, err := New(Limits{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	throttle.SetTaskLimits("slow", Limits{Upload: 1 << 20})
+
+	ctx := context.Background()
+	start := time.Now()
+	if err := throttle.WaitUpload(ctx, "fast", 4<<20); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("未限速的任务等待了 %v", elapsed)
+	}
+
+	start = time.Now()
+	if err := throttle.WaitUpload(ctx, "slow", 1<<20+256<<10); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("限速的任务只等待了 %v", elapsed)
+	}
+
+	up, _ := throttle.TaskThroughput("fast")
+	total, _ := throttle.Throughput()
+	if up != float64(4<<20)/meterWindow || total != float64(4<<20+1<<20+256<<10)/meterWindow {
+		t.Fatalf("任务吞吐量为 %v, 全局吞吐量为 %v", up, total)
+	}
+
+	throttle.RemoveTask("fast")
+	if up, _ := throttle.TaskThroughput("fast"); up != 0 {
+		t.Fatalf("移除后的任务吞吐量为 %v", up)
+	}
+}
@@ -0,0 +1,243 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Network 是进程内的多节点模拟网络，可模拟延迟、丢包和节点离线
+type Network struct {
+	mu       sync.RWMutex
+	nodes    map[string]*Node                       // 节点ID -> 节点
+	offline  map[string]bool                        // 已离线的节点
+	holders  map[string]map[int]map[string]struct{} // 文件资产 -> 片段索引 -> 持有节点
+	meta     map[string][]byte                      // 文件资产 -> 描述信息
+	latency  time.Duration                          // 每次请求的延迟
+	dropRate float64                                // 请求丢失的概率(0~1)
+	rand     *rand.Rand                             // 用于模拟丢包的随机数
+	randMu   sync.Mutex                             // 控制对 rand 的并发访问
+}
+
+// NewNetwork 创建一个新的模拟网络
+func NewNetwork() *Network {
+	return &Network{
+		nodes:   make(map[string]*Node),
+		offline: make(map[string]bool),
+		holders: make(map[string]map[int]map[string]struct{}),
+		meta:    make(map[string][]byte),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetLatency 设置每次请求的延迟
+func (n *Network) SetLatency(latency time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.latency = latency
+}
+
+// SetDropRate 设置请求丢失的概率，seed 用于复现丢包序列
+func (n *Network) SetDropRate(rate float64, seed int64) {
+	n.mu.Lock()
+	n.dropRate = rate
+	n.mu.Unlock()
+
+	n.randMu.Lock()
+	n.rand = rand.New(rand.NewSource(seed))
+	n.randMu.Unlock()
+}
+
+// NewNode 在网络中创建一个新节点
+func (n *Network) NewNode(id string) (*Node, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, exists := n.nodes[id]; exists {
+		return nil, fmt.Errorf("节点 %s 已存在", id)
+	}
+
+	node := &Node{id: id, network: n}
+	n.nodes[id] = node
+	return node, nil
+}
+
+// Disconnect 使节点离线，离线节点不可达且不再作为持有者返回
+func (n *Network) Disconnect(id string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.offline[id] = true
+}
+
+// Reconnect 使离线节点重新上线
+func (n *Network) Reconnect(id string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.offline, id)
+}
+
+// deliver 模拟一次请求的传输，返回目标节点的处理器
+func (n *Network) deliver(ctx context.Context, from, to string) (Handler, error) {
+	n.mu.RLock()
+	latency, dropRate := n.latency, n.dropRate
+	target, exists := n.nodes[to]
+	unreachable := !exists || n.offline[to] || n.offline[from]
+	n.mu.RUnlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if unreachable {
+		return nil, ErrUnreachable
+	}
+
+	if dropRate > 0 {
+		n.randMu.Lock()
+		dropped := n.rand.Float64() < dropRate
+		n.randMu.Unlock()
+		if dropped {
+			return nil, ErrDropped
+		}
+	}
+
+	target.mu.RLock()
+	handler := target.handler
+	target.mu.RUnlock()
+	if handler == nil {
+		return nil, fmt.Errorf("节点 %s 未提供服务", to)
+	}
+
+	return handler, nil
+}
+
+// addHolder 记录节点持有文件资产的片段
+func (n *Network) addHolder(assetID string, index int, peerID string) {
+	if _, exists := n.holders[assetID]; !exists {
+		n.holders[assetID] = make(map[int]map[string]struct{})
+	}
+	if _, exists := n.holders[assetID][index]; !exists {
+		n.holders[assetID][index] = make(map[string]struct{})
+	}
+	n.holders[assetID][index][peerID] = struct{}{}
+}
+
+// Node 是模拟网络中的一个节点，实现了 Transport 接口
+type Node struct {
+	id      string
+	network *Network
+	mu      sync.RWMutex
+	handler Handler
+}
+
+// ID 返回本节点的标识
+func (node *Node) ID() string {
+	return node.id
+}
+
+// Peers 返回当前在线的其他节点，按节点ID排序
+func (node *Node) Peers() []string {
+	node.network.mu.RLock()
+	defer node.network.mu.RUnlock()
+
+	var peers []string
+	for id := range node.network.nodes {
+		if id != node.id && !node.network.offline[id] {
+			peers = append(peers, id)
+		}
+	}
+	sort.Strings(peers)
+
+	return peers
+}
+
+// Serve 设置处理其他节点请求的本地处理器
+func (node *Node) Serve(h Handler) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	node.handler = h
+}
+
+// SendShard 将文件片段发送给指定节点保存，保存成功后该节点成为片段的持有者
+func (node *Node) SendShard(ctx context.Context, peerID, assetID string, index int, data []byte) error {
+	handler, err := node.network.deliver(ctx, node.id, peerID)
+	if err != nil {
+		return err
+	}
+
+	if err := handler.Put(assetID, index, append([]byte(nil), data...)); err != nil {
+		return err
+	}
+
+	node.network.mu.Lock()
+	node.network.addHolder(assetID, index, peerID)
+	node.network.mu.Unlock()
+
+	return nil
+}
+
+// FetchShard 从指定节点获取文件片段，凭证原样交给该节点的处理器
+func (node *Node) FetchShard(ctx context.Context, peerID, assetID string, index int, cred *Credential) ([]byte, error) {
+	handler, err := node.network.deliver(ctx, node.id, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler.Get(assetID, index, cred)
+}
+
+// Announce 向网络宣告本节点持有的文件资产片段
+func (node *Node) Announce(ctx context.Context, a *Announcement) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	node.network.mu.Lock()
+	defer node.network.mu.Unlock()
+
+	if node.network.offline[node.id] {
+		return ErrUnreachable
+	}
+	for _, index := range a.Indexes {
+		node.network.addHolder(a.AssetID, index, node.id)
+	}
+	if len(a.Meta) > 0 {
+		node.network.meta[a.AssetID] = append([]byte(nil), a.Meta...)
+	}
+
+	return nil
+}
+
+// QueryHolders 查询文件资产的持有情况，离线节点不会被返回
+func (node *Node) QueryHolders(ctx context.Context, assetID string) (*Holders, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	node.network.mu.RLock()
+	defer node.network.mu.RUnlock()
+
+	holders := &Holders{
+		Peers: make(map[int][]string),
+		Meta:  append([]byte(nil), node.network.meta[assetID]...),
+	}
+	for index, peers := range node.network.holders[assetID] {
+		for peerID := range peers {
+			if !node.network.offline[peerID] {
+				holders.Peers[index] = append(holders.Peers[index], peerID)
+			}
+		}
+		sort.Strings(holders.Peers[index])
+	}
+
+	return holders, nil
+}
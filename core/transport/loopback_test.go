@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/core/store"
+)
+
+// newTestNodes 在网络中创建多个提供内存存储服务的节点
+func newTestNodes(t *testing.T, network *Network, ids ...string) []*Node {
+	t.Helper()
+
+	nodes := make([]*Node, 0, len(ids))
+	for _, id := range ids {
+		node, err := network.NewNode(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.Serve(StoreHandler(store.NewMemoryStore()))
+		nodes = append(nodes, node)
+	}
+
+	return nodes
+}
+
+func TestLoopbackSendAndFetch(t *testing.T) {
+	ctx := context.Background()
+	network := NewNetwork()
+	nodes := newTestNodes(t, network, "a", "b", "c")
+
+	if _, err := network.NewNode("a"); err == nil {
+		t.Fatal("重复创建节点应当失败")
+	}
+	if peers := nodes[0].Peers(); len(peers) != 2 || peers[0] != "b" || peers[1] != "c" {
+		t.Fatalf("节点 a 的对等节点为 %v", peers)
+	}
+
+	data := []byte("shard data")
+	if err := nodes[0].SendShard(ctx, "b", "asset", 1, data); err != nil {
+		t.Fatalf("发送片段失败: %v", err)
+	}
+	if err := nodes[0].Announce(ctx, &Announcement{AssetID: "asset", Indexes: []int{0}, Meta: []byte("meta")}); err != nil {
+		t.Fatalf("宣告失败: %v", err)
+	}
+
+	got, err := nodes[2].FetchShard(ctx, "b", "asset", 1, nil)
+	if err != nil {
+		t.Fatalf("获取片段失败: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("获取的片段 %q 与发送的片段 %q 不一致", got, data)
+	}
+
+	holders, err := nodes[2].QueryHolders(ctx, "asset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(holders.Meta) != "meta" {
+		t.Fatalf("描述信息为 %q", holders.Meta)
+	}
+	if p := holders.Peers[0]; len(p) != 1 || p[0] != "a" {
+		t.Fatalf("片段 0 的持有者为 %v", p)
+	}
+	if p := holders.Peers[1]; len(p) != 1 || p[0] != "b" {
+		t.Fatalf("片段 1 的持有者为 %v", p)
+	}
+}
+
+func TestLoopbackDisconnect(t *testing.T) {
+	ctx := context.Background()
+	network := NewNetwork()
+	nodes := newTestNodes(t, network, "a", "b")
+
+	if err := nodes[0].SendShard(ctx, "b", "asset", 0, []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	network.Disconnect("b")
+	if err := nodes[0].SendShard(ctx, "b", "asset", 1, []byte("y")); err != ErrUnreachable {
+		t.Fatalf("向离线节点发送片段应当返回 ErrUnreachable, 实际为 %v", err)
+	}
+	if peers := nodes[0].Peers(); len(peers) != 0 {
+		t.Fatalf("离线节点不应作为对等节点返回: %v", peers)
+	}
+	holders, err := nodes[0].QueryHolders(ctx, "asset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holders.Peers[0]) != 0 {
+		t.Fatalf("离线节点不应作为持有者返回: %v", holders.Peers[0])
+	}
+
+	network.Reconnect("b")
+	if _, err := nodes[0].FetchShard(ctx, "b", "asset", 0, nil); err != nil {
+		t.Fatalf("重新上线后获取片段失败: %v", err)
+	}
+}
+
+func TestLoopbackDropAndLatency(t *testing.T) {
+	network := NewNetwork()
+	nodes := newTestNodes(t, network, "a", "b")
+
+	network.SetDropRate(1, 1)
+	if err := nodes[0].SendShard(context.Background(), "b", "asset", 0, []byte("x")); err != ErrDropped {
+		t.Fatalf("丢包率为 1 时应当返回 ErrDropped, 实际为 %v", err)
+	}
+
+	network.SetDropRate(0, 1)
+	network.SetLatency(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := nodes[0].SendShard(ctx, "b", "asset", 0, []byte("x")); err != context.DeadlineExceeded {
+		t.Fatalf("延迟超过上下文期限时应当返回 DeadlineExceeded, 实际为 %v", err)
+	}
+}
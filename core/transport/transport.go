@@ -0,0 +1,82 @@
+// 节点之间传输文件片段的网络接口
+package transport
+
+import (
+	"context"
+	"fmt"
+)
+
+var (
+	// ErrUnreachable 表示目标节点不可达
+	ErrUnreachable = fmt.Errorf("节点不可达")
+	// ErrDropped 表示请求在传输过程中丢失
+	ErrDropped = fmt.Errorf("请求丢失")
+)
+
+// Credential 证明获取文件片段的请求来自 DID 表示的身份，由请求者签名
+// 签名的内容包括文件资产、片段索引、目标节点和时间，不能用于其他请求
+type Credential struct {
+	DID       string // 请求者的 DID
+	Time      int64  // 签名的时间(Unix 时间戳，以秒为单位)
+	Signature []byte // 请求者的签名
+}
+
+// Handler 处理其他节点发来的文件片段请求
+type Handler interface {
+	// Put 保存其他节点发送的文件片段
+	Put(assetID string, index int, data []byte) error
+	// Get 读取其他节点请求的文件片段，cred 为请求者的凭证，没有设置身份的请求者为空
+	Get(assetID string, index int, cred *Credential) ([]byte, error)
+}
+
+// Store 保存和读取文件片段，store.ShardStore 满足该接口
+type Store interface {
+	Put(assetID string, index int, data []byte) error
+	Get(assetID string, index int) ([]byte, error)
+}
+
+// storeHandler 直接使用存储处理请求，不检查请求者的凭证
+type storeHandler struct {
+	Store
+}
+
+// Get 读取文件片段，忽略请求者的凭证
+func (h storeHandler) Get(assetID string, index int, _ *Credential) ([]byte, error) {
+	return h.Store.Get(assetID, index)
+}
+
+// StoreHandler 返回直接使用 s 处理请求的处理器，不检查请求者的凭证，只用于没有访问控制的存储
+func StoreHandler(s Store) Handler {
+	return storeHandler{s}
+}
+
+// Announcement 描述节点向网络宣告的文件资产
+type Announcement struct {
+	AssetID string // 文件资产的唯一标识
+	Indexes []int  // 本节点持有的文件片段索引
+	Meta    []byte // 文件资产的描述信息，为空时不更新
+}
+
+// Holders 描述文件资产的持有情况
+type Holders struct {
+	Peers map[int][]string // 文件片段索引 -> 持有该片段的节点
+	Meta  []byte           // 文件资产的描述信息
+}
+
+// Transport 定义了文件服务所需的节点间传输能力
+type Transport interface {
+	// ID 返回本节点的标识
+	ID() string
+	// Peers 返回当前可连接的其他节点
+	Peers() []string
+	// Serve 设置处理其他节点请求的本地处理器
+	Serve(h Handler)
+	// SendShard 将文件片段发送给指定节点保存
+	SendShard(ctx context.Context, peerID, assetID string, index int, data []byte) error
+	// FetchShard 从指定节点获取文件片段，cred 为本节点的凭证，没有设置身份时为空
+	FetchShard(ctx context.Context, peerID, assetID string, index int, cred *Credential) ([]byte, error)
+	// Announce 向网络宣告本节点持有的文件资产片段
+	Announce(ctx context.Context, a *Announcement) error
+	// QueryHolders 查询文件资产的持有情况
+	QueryHolders(ctx context.Context, assetID string) (*Holders, error)
+}
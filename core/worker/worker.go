@@ -0,0 +1,528 @@
+// 文件片段传输的并发调度
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/core/pool"
+	"github.com/bpfs/defs/core/sqlite"
+)
+
+// ErrClosed 表示工作池已关闭
+var ErrClosed = fmt.Errorf("工作池已关闭")
+
+// ErrCancelled 表示任务已取消或失败，排队中的片段不再处理
+var ErrCancelled = fmt.Errorf("任务已取消")
+
+// Priority 表示片段传输的优先级，数值越小越优先
+type Priority int
+
+const (
+	PriorityInteractive Priority = iota // 交互式下载
+	PriorityNormal                      // 上传及其重试
+	PriorityBackground                  // 后台修复和刷新
+
+	numPriorities = int(PriorityBackground) + 1
+)
+
+// Limits 描述工作池的并发限制，为 0 时不限制
+type Limits struct {
+	Global  int // 同时运行的片段传输总数
+	PerTask int // 单个任务同时运行的片段传输数
+	PerPeer int // 与单个节点同时进行的片段传输数
+	// Detached 同时运行的不占用全局名额的任务数，与 Global 分别计算
+	Detached int
+}
+
+// Job 描述一次文件片段传输
+type Job struct {
+	AssetID    string   // 文件资产的唯一标识
+	Operates   int      // 操作(0:下载、1:上传、2:异步语句)
+	PieceIndex int      // 文件片段的索引
+	PeerID     string   // 传输的目标节点，为空时不受单节点并发限制
+	Priority   Priority // 优先级
+	// Detached 为真时不占用全局并发名额，用于自身等待其他片段传输的任务(如异步语句)，
+	// 避免这类任务占满名额后等待的片段传输无法开始，这类任务另受 Limits.Detached 限制
+	Detached bool
+
+	// Run 执行传输，任务暂停时 ctx 被取消，返回后片段重新排队等待任务恢复
+	Run func(ctx context.Context) error
+	// Done 在传输结束、任务取消或工作池关闭时被调用一次，可以为空
+	Done func(err error)
+
+	queuedAt  time.Time // 提交的时间
+	cancelled bool      // 是否已被 Cancel 中断
+}
+
+// Stats 描述工作池的当前状态
+type Stats struct {
+	Running int // 正在运行的片段传输数
+	Queued  int // 排队中的片段传输数
+}
+
+// taskKey 标识一个上传或下载任务
+type taskKey struct {
+	assetID  string
+	operates int
+}
+
+// taskQueue 保存一个任务在某一优先级下排队的片段
+type taskQueue struct {
+	key  taskKey
+	jobs []*Job
+}
+
+// taskState 记录任务的暂停状态和正在运行的片段
+type taskState struct {
+	paused  bool
+	running map[*Job]context.CancelFunc
+}
+
+// Pool 是有界并发的片段传输工作池
+// 同一优先级内各任务轮流获得执行机会，暂停的任务立即释放其占用的并发名额
+type Pool struct {
+	limits Limits
+	tasks  *pool.MemoryPool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	closed   bool
+	queues   [numPriorities][]*taskQueue // 每个优先级下有排队片段的任务，按轮转顺序排列
+	states   map[taskKey]*taskState
+	peers    map[string]int // 节点 -> 正在进行的传输数
+	running  int
+	detached int // 正在运行的不占用全局名额的任务数
+	wake     chan struct{}
+	idle     *sync.Cond // 片段传输结束时广播，Cancel 据此等待任务正在运行的传输返回
+}
+
+// New 创建工作池，并根据内存池的进度事件跟踪任务的暂停、恢复和取消
+func New(limits Limits, tasks *pool.MemoryPool) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		limits: limits,
+		tasks:  tasks,
+		ctx:    ctx,
+		cancel: cancel,
+		states: make(map[taskKey]*taskState),
+		peers:  make(map[string]int),
+		wake:   make(chan struct{}, 1),
+	}
+	p.idle = sync.NewCond(&p.mu)
+
+	events := tasks.Subscribe("")
+	p.wg.Add(2)
+	go p.dispatch()
+	go p.watch(events)
+
+	return p
+}
+
+// Submit 提交一次片段传输
+func (p *Pool) Submit(job *Job) error {
+	if job.Run == nil {
+		return fmt.Errorf("片段传输缺少执行函数")
+	}
+	if job.Priority < 0 || int(job.Priority) >= numPriorities {
+		return fmt.Errorf("无效的优先级 %d", job.Priority)
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	job.queuedAt = time.Now()
+	p.stateOf(taskKey{job.AssetID, job.Operates})
+	p.enqueue(job, false)
+	p.mu.Unlock()
+
+	p.notify()
+	return nil
+}
+
+// Stats 返回工作池的当前状态
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := Stats{Running: p.running}
+	for _, queues := range p.queues {
+		for _, q := range queues {
+			stats.Queued += len(q.jobs)
+		}
+	}
+	return stats
+}
+
+// Close 停止工作池，取消正在运行的传输并等待其返回，排队中的片段以 ErrClosed 结束
+func (p *Pool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	var dropped []*Job
+	for prio := range p.queues {
+		for _, q := range p.queues[prio] {
+			dropped = append(dropped, q.jobs...)
+		}
+		p.queues[prio] = nil
+	}
+	p.mu.Unlock()
+
+	p.cancel()
+	p.wg.Wait()
+
+	for _, job := range dropped {
+		finish(job, ErrClosed)
+	}
+}
+
+// Cancel 丢弃任务排队中的片段并中断其正在运行的传输，等待正在运行的传输返回后才返回
+// 排队中的片段以 ErrCancelled 结束，正在运行的片段以其执行函数返回的错误结束；
+// 不能在该任务的片段传输中调用
+func (p *Pool) Cancel(assetID string, operates int) {
+	key := taskKey{assetID, operates}
+	p.drop(key, time.Now())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		state, exists := p.states[key]
+		if !exists || len(state.running) == 0 {
+			return
+		}
+		// 等待期间开始运行的片段同样中断
+		for job, cancel := range state.running {
+			job.cancelled = true
+			cancel()
+		}
+		p.idle.Wait()
+	}
+}
+
+// CancelJobs 丢弃指定的排队中片段并中断其中正在运行的传输，同一任务的其他片段不受影响
+// 用于调用方只结束自己提交的片段，如交互式下载结束时保留同一文件资产的后台刷新
+func (p *Pool) CancelJobs(jobs ...*Job) {
+	targets := make(map[*Job]bool, len(jobs))
+	for _, job := range jobs {
+		targets[job] = true
+	}
+
+	p.mu.Lock()
+	keys := make(map[taskKey]bool)
+	for job := range targets {
+		key := taskKey{job.AssetID, job.Operates}
+		keys[key] = true
+		if state, exists := p.states[key]; exists {
+			if cancel, running := state.running[job]; running {
+				job.cancelled = true
+				cancel()
+			}
+		}
+	}
+	var dropped []*Job
+	for prio, queues := range p.queues {
+		rest := queues[:0]
+		for _, q := range queues {
+			if keys[q.key] {
+				remaining := q.jobs[:0]
+				for _, job := range q.jobs {
+					if targets[job] {
+						dropped = append(dropped, job)
+					} else {
+						remaining = append(remaining, job)
+					}
+				}
+				if q.jobs = remaining; len(remaining) == 0 {
+					continue
+				}
+			}
+			rest = append(rest, q)
+		}
+		p.queues[prio] = rest
+	}
+	for key := range keys {
+		p.release(key)
+	}
+	p.mu.Unlock()
+
+	for _, job := range dropped {
+		finish(job, ErrCancelled)
+	}
+}
+
+// dispatch 在并发名额允许时启动排队中的片段传输
+func (p *Pool) dispatch() {
+	defer p.wg.Done()
+
+	for {
+		p.mu.Lock()
+		for {
+			job := p.next()
+			if job == nil {
+				break
+			}
+			p.start(job)
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-p.wake:
+		}
+	}
+}
+
+// next 按优先级和任务轮转选出下一个可运行的片段，调用方需持有锁
+func (p *Pool) next() *Job {
+	if p.closed {
+		return nil
+	}
+	full := p.limits.Global > 0 && p.running >= p.limits.Global
+	detachedFull := p.limits.Detached > 0 && p.detached >= p.limits.Detached
+
+	for prio := range p.queues {
+		queues := p.queues[prio]
+		for i, q := range queues {
+			state := p.states[q.key]
+			if state.paused || (p.limits.PerTask > 0 && len(state.running) >= p.limits.PerTask) {
+				continue
+			}
+
+			for j, job := range q.jobs {
+				if (job.Detached && detachedFull) || (!job.Detached && full) {
+					continue
+				}
+				if job.PeerID != "" && p.limits.PerPeer > 0 && p.peers[job.PeerID] >= p.limits.PerPeer {
+					continue
+				}
+
+				q.jobs = append(q.jobs[:j], q.jobs[j+1:]...)
+				// 被选中的任务移到队尾，其他任务获得下一次机会
+				rest := append(queues[:i:i], queues[i+1:]...)
+				if len(q.jobs) > 0 {
+					rest = append(rest, q)
+				}
+				p.queues[prio] = rest
+				return job
+			}
+		}
+	}
+
+	return nil
+}
+
+// start 启动片段传输，调用方需持有锁
+func (p *Pool) start(job *Job) {
+	key := taskKey{job.AssetID, job.Operates}
+	ctx, cancel := context.WithCancel(p.ctx)
+	p.stateOf(key).running[job] = cancel
+	if job.Detached {
+		p.detached++
+	} else {
+		p.running++
+	}
+	if job.PeerID != "" {
+		p.peers[job.PeerID]++
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		err := job.Run(ctx)
+		cancel()
+
+		p.mu.Lock()
+		state := p.states[key]
+		delete(state.running, job)
+		p.idle.Broadcast()
+		if job.Detached {
+			p.detached--
+		} else {
+			p.running--
+		}
+		if job.PeerID != "" {
+			if p.peers[job.PeerID]--; p.peers[job.PeerID] == 0 {
+				delete(p.peers, job.PeerID)
+			}
+		}
+		// 任务暂停导致的中断不算结束，片段回到队首等待任务恢复
+		requeue := state.paused && !p.closed && !job.cancelled && errors.Is(err, context.Canceled)
+		if requeue {
+			p.enqueue(job, true)
+		} else {
+			p.release(key)
+		}
+		if p.closed && errors.Is(err, context.Canceled) {
+			err = ErrClosed
+		}
+		p.mu.Unlock()
+
+		if !requeue {
+			finish(job, err)
+		}
+		p.notify()
+	}()
+}
+
+// watch 根据内存池的进度事件更新任务状态
+func (p *Pool) watch(events <-chan pool.ProgressEvent) {
+	defer p.wg.Done()
+	defer p.tasks.Unsubscribe(events)
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			key := taskKey{event.AssetID, event.Operates}
+			switch event.Type {
+			case pool.EventPaused:
+				p.pause(key)
+			case pool.EventResumed:
+				p.resume(key)
+			case pool.EventCancelled, pool.EventFailed:
+				p.drop(key, event.Time)
+			}
+		}
+	}
+}
+
+// pause 暂停任务并中断其正在运行的片段传输
+func (p *Pool) pause(key taskKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state, exists := p.states[key]
+	if !exists {
+		return
+	}
+	state.paused = true
+	for _, cancel := range state.running {
+		cancel()
+	}
+}
+
+// resume 恢复任务并唤醒调度
+func (p *Pool) resume(key taskKey) {
+	p.mu.Lock()
+	if state, exists := p.states[key]; exists {
+		state.paused = false
+	}
+	p.mu.Unlock()
+
+	p.notify()
+}
+
+// drop 丢弃任务在 before 之前提交且仍在排队的片段，正在运行的传输不受影响
+// 同一文件资产重新开始的任务在事件之后提交的片段得以保留
+func (p *Pool) drop(key taskKey, before time.Time) {
+	p.mu.Lock()
+	var dropped []*Job
+	for prio, queues := range p.queues {
+		rest := queues[:0]
+		for _, q := range queues {
+			if q.key == key {
+				jobs := q.jobs[:0]
+				for _, job := range q.jobs {
+					if job.queuedAt.Before(before) {
+						dropped = append(dropped, job)
+					} else {
+						jobs = append(jobs, job)
+					}
+				}
+				if q.jobs = jobs; len(jobs) == 0 {
+					continue
+				}
+			}
+			rest = append(rest, q)
+		}
+		p.queues[prio] = rest
+	}
+	p.release(key)
+	p.mu.Unlock()
+
+	for _, job := range dropped {
+		finish(job, ErrCancelled)
+	}
+}
+
+// release 在任务没有排队和运行中的片段时释放其状态，调用方需持有锁
+// 任务的暂停状态以内存池为准，再次提交片段时重新读取
+func (p *Pool) release(key taskKey) {
+	state, exists := p.states[key]
+	if !exists || len(state.running) > 0 {
+		return
+	}
+	for _, queues := range p.queues {
+		for _, q := range queues {
+			if q.key == key {
+				return
+			}
+		}
+	}
+	delete(p.states, key)
+}
+
+// stateOf 返回任务的状态，不存在时根据内存池创建，调用方需持有锁
+func (p *Pool) stateOf(key taskKey) *taskState {
+	state, exists := p.states[key]
+	if !exists {
+		state = &taskState{running: make(map[*Job]context.CancelFunc)}
+		switch key.operates {
+		case sqlite.OperateUpload:
+			state.paused, _ = p.tasks.IsUploadTaskPaused(key.assetID)
+		case sqlite.OperateDownload:
+			state.paused, _ = p.tasks.IsDownloadTaskPaused(key.assetID)
+		}
+		p.states[key] = state
+	}
+	return state
+}
+
+// enqueue 将片段加入其任务的队列，front 为真时插入队首，调用方需持有锁
+func (p *Pool) enqueue(job *Job, front bool) {
+	key := taskKey{job.AssetID, job.Operates}
+	prio := int(job.Priority)
+
+	for _, q := range p.queues[prio] {
+		if q.key == key {
+			if front {
+				q.jobs = append([]*Job{job}, q.jobs...)
+			} else {
+				q.jobs = append(q.jobs, job)
+			}
+			return
+		}
+	}
+	p.queues[prio] = append(p.queues[prio], &taskQueue{key: key, jobs: []*Job{job}})
+}
+
+// notify 唤醒调度
+func (p *Pool) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// finish 通知片段传输已结束
+func finish(job *Job, err error) {
+	if job.Done != nil {
+		job.Done(err)
+	}
+}
@@ -0,0 +1,449 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/core/pool"
+	"github.com/bpfs/defs/core/sqlite"
+)
+
+// recorder 记录片段传输的执行顺序和最大并发数
+type recorder struct {
+	mu      sync.Mutex
+	order   []string
+	running int32
+	peak    int32
+}
+
+// job 创建一个在 release 关闭前阻塞的片段传输
+func (r *recorder) job(assetID string, index int, peerID string, prio Priority, release <-chan struct{}, done chan<- error) *Job {
+	return &Job{
+		AssetID:    assetID,
+		Operates:   sqlite.OperateUpload,
+		PieceIndex: index,
+		PeerID:     peerID,
+		Priority:   prio,
+		Run: func(ctx context.Context) error {
+			n := atomic.AddInt32(&r.running, 1)
+			defer atomic.AddInt32(&r.running, -1)
+			for {
+				peak := atomic.LoadInt32(&r.peak)
+				if n <= peak || atomic.CompareAndSwapInt32(&r.peak, peak, n) {
+					break
+				}
+			}
+
+			r.mu.Lock()
+			r.order = append(r.order, fmt.Sprintf("%s%d", assetID, index))
+			r.mu.Unlock()
+
+			select {
+			case <-release:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+		Done: func(err error) { done <- err },
+	}
+}
+
+// newTestPool 创建带有上传任务的内存池和工作池
+func newTestPool(t *testing.T, limits Limits, assets ...string) (*pool.MemoryPool, *Pool) {
+	t.Helper()
+
+	tasks := pool.New()
+	for _, assetID := range assets {
+		if err := tasks.AddUploadTask(assetID, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := New(limits, tasks)
+	t.Cleanup(p.Close)
+
+	return tasks, p
+}
+
+// waitDone 等待 n 个片段传输结束
+func waitDone(t *testing.T, done <-chan error, n int) []error {
+	t.Helper()
+
+	errs := make([]error, 0, n)
+	for i := 0; i < n; i++ {
+		select {
+		case err := <-done:
+			errs = append(errs, err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("等待片段传输结束超时, 已结束 %d 个", i)
+		}
+	}
+	return errs
+}
+
+// waitRunning 等待正在运行的片段传输数达到 n
+func waitRunning(t *testing.T, p *Pool, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Stats().Running != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("正在运行的片段传输数为 %d, 期望 %d", p.Stats().Running, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolLimits(t *testing.T) {
+	_, p := newTestPool(t, Limits{Global: 4, PerTask: 3, PerPeer: 1}, "a", "b")
+	r := new(recorder)
+	release := make(chan struct{})
+	done := make(chan error, 10)
+
+	// 任务 a 的 5 个片段发往 3 个节点，任务 b 的 5 个片段不限节点
+	peers := []string{"p1", "p2", "p3"}
+	for i := 0; i < 5; i++ {
+		if err := p.Submit(r.job("a", i, peers[i%len(peers)], PriorityNormal, release, done)); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Submit(r.job("b", i, "", PriorityNormal, release, done)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitRunning(t, p, 4)
+	time.Sleep(20 * time.Millisecond)
+	if stats := p.Stats(); stats.Running != 4 || stats.Queued != 6 {
+		t.Fatalf("工作池状态为 %+v", stats)
+	}
+
+	close(release)
+	for _, err := range waitDone(t, done, 10) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r.peak > 4 {
+		t.Fatalf("最大并发数为 %d", r.peak)
+	}
+}
+
+func TestPoolPerPeerLimit(t *testing.T) {
+	_, p := newTestPool(t, Limits{PerPeer: 2}, "a", "b")
+	r := new(recorder)
+	release := make(chan struct{})
+	done := make(chan error, 10)
+
+	for i := 0; i < 3; i++ {
+		p.Submit(r.job("a", i, "p1", PriorityNormal, release, done))
+		p.Submit(r.job("b", i, "p1", PriorityNormal, release, done))
+	}
+	p.Submit(r.job("b", 9, "p2", PriorityNormal, release, done))
+
+	// 节点 p1 最多 2 个传输，发往 p2 的片段不受影响
+	waitRunning(t, p, 3)
+	time.Sleep(20 * time.Millisecond)
+	if running := p.Stats().Running; running != 3 {
+		t.Fatalf("正在运行的片段传输数为 %d", running)
+	}
+
+	close(release)
+	waitDone(t, done, 7)
+}
+
+func TestPoolPriorityAndFairness(t *testing.T) {
+	_, p := newTestPool(t, Limits{Global: 1}, "a", "b", "c", "x")
+	r := new(recorder)
+	done := make(chan error, 10)
+
+	// 先占用唯一的名额，再提交其他片段
+	block := make(chan struct{})
+	p.Submit(r.job("x", 0, "", PriorityNormal, block, done))
+	waitRunning(t, p, 1)
+
+	released := make(chan struct{})
+	close(released)
+	for i := 0; i < 3; i++ {
+		p.Submit(r.job("a", i, "", PriorityBackground, released, done))
+	}
+	for i := 0; i < 2; i++ {
+		p.Submit(r.job("b", i, "", PriorityBackground, released, done))
+	}
+	p.Submit(r.job("c", 0, "", PriorityInteractive, released, done))
+
+	close(block)
+	waitDone(t, done, 7)
+
+	want := []string{"x0", "c0", "a0", "b0", "a1", "b1", "a2"}
+	if fmt.Sprint(r.order) != fmt.Sprint(want) {
+		t.Fatalf("执行顺序为 %v, 期望 %v", r.order, want)
+	}
+}
+
+func TestPoolPauseReleasesSlots(t *testing.T) {
+	tasks, p := newTestPool(t, Limits{Global: 1}, "a", "b")
+	r := new(recorder)
+	release := make(chan struct{})
+	done := make(chan error, 10)
+
+	var runs int32
+	job := r.job("a", 0, "", PriorityNormal, release, done)
+	run := job.Run
+	job.Run = func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return run(ctx)
+	}
+	p.Submit(job)
+	waitRunning(t, p, 1)
+
+	other := make(chan struct{})
+	p.Submit(r.job("b", 0, "", PriorityNormal, other, done))
+
+	// 暂停任务 a 后，其名额立即让给任务 b
+	if err := tasks.PauseUploadTask("a"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r.mu.Lock()
+		started := len(r.order) == 2
+		r.mu.Unlock()
+		if started {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("暂停的任务未释放名额")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(other)
+	if errs := waitDone(t, done, 1); errs[0] != nil {
+		t.Fatal(errs[0])
+	}
+
+	// 任务恢复后，被中断的片段重新执行
+	if err := tasks.ResumeUploadTask("a"); err != nil {
+		t.Fatal(err)
+	}
+	waitRunning(t, p, 1)
+	close(release)
+	if errs := waitDone(t, done, 1); errs[0] != nil {
+		t.Fatal(errs[0])
+	}
+	if n := atomic.LoadInt32(&runs); n != 2 {
+		t.Fatalf("片段执行了 %d 次", n)
+	}
+}
+
+func TestPoolCancelledTaskDropsQueuedJobs(t *testing.T) {
+	tasks, p := newTestPool(t, Limits{Global: 1}, "a")
+	r := new(recorder)
+	release := make(chan struct{})
+	done := make(chan error, 10)
+
+	for i := 0; i < 3; i++ {
+		p.Submit(r.job("a", i, "", PriorityNormal, release, done))
+	}
+	waitRunning(t, p, 1)
+
+	tasks.DeleteUploadTask("a")
+	errs := waitDone(t, done, 2)
+	for _, err := range errs {
+		if !errors.Is(err, ErrCancelled) {
+			t.Fatalf("排队中的片段以 %v 结束", err)
+		}
+	}
+
+	// 正在运行的片段不受影响
+	close(release)
+	if errs := waitDone(t, done, 1); errs[0] != nil {
+		t.Fatal(errs[0])
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	_, p := newTestPool(t, Limits{Global: 1}, "a")
+	r := new(recorder)
+	release := make(chan struct{})
+	done := make(chan error, 10)
+
+	p.Submit(r.job("a", 0, "", PriorityNormal, release, done))
+	p.Submit(r.job("a", 1, "", PriorityNormal, release, done))
+	waitRunning(t, p, 1)
+
+	p.Close()
+	for _, err := range waitDone(t, done, 2) {
+		if !errors.Is(err, ErrClosed) {
+			t.Fatalf("关闭后片段以 %v 结束", err)
+		}
+	}
+	if err := p.Submit(r.job("a", 2, "", PriorityNormal, release, done)); !errors.Is(err, ErrClosed) {
+		t.Fatalf("关闭后提交返回 %v", err)
+	}
+}
+
+func TestPoolCancel(t *testing.T) {
+	tasks, p := newTestPool(t, Limits{Global: 1}, "a")
+	r := new(recorder)
+	release := make(chan struct{})
+	done := make(chan error, 10)
+
+	for i := 0; i < 3; i++ {
+		p.Submit(r.job("a", i, "", PriorityNormal, release, done))
+	}
+	waitRunning(t, p, 1)
+
+	// 暂停中的任务被取消后，中断的片段不再重新排队
+	if err := tasks.PauseUploadTask("a"); err != nil {
+		t.Fatal(err)
+	}
+	p.Cancel("a", sqlite.OperateUpload)
+
+	errs := waitDone(t, done, 3)
+	for _, err := range errs {
+		if !errors.Is(err, ErrCancelled) && !errors.Is(err, context.Canceled) {
+			t.Fatalf("取消后片段以 %v 结束", err)
+		}
+	}
+	if stats := p.Stats(); stats.Running != 0 || stats.Queued != 0 {
+		t.Fatalf("取消后工作池状态为 %+v", stats)
+	}
+}
+
+func TestPoolCancelWaitsForRunningJobs(t *testing.T) {
+	_, p := newTestPool(t, Limits{}, "a")
+
+	var exited int32
+	started := make(chan struct{})
+	p.Submit(&Job{
+		AssetID:  "a",
+		Operates: sqlite.OperateUpload,
+		Priority: PriorityNormal,
+		Run: func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			// 中断后仍需一段时间才返回
+			time.Sleep(50 * time.Millisecond)
+			atomic.StoreInt32(&exited, 1)
+			return ctx.Err()
+		},
+	})
+	<-started
+
+	p.Cancel("a", sqlite.OperateUpload)
+	if atomic.LoadInt32(&exited) != 1 {
+		t.Fatal("Cancel 在正在运行的片段返回前返回")
+	}
+}
+
+func TestPoolCancelJobs(t *testing.T) {
+	_, p := newTestPool(t, Limits{Global: 2}, "a")
+	r := new(recorder)
+	release := make(chan struct{})
+	cancelled := make(chan error, 10)
+	kept := make(chan error, 10)
+
+	// 只取消指定的片段，同一任务中其他调用方提交的片段继续运行
+	own := []*Job{
+		r.job("a", 0, "", PriorityInteractive, release, cancelled),
+		r.job("a", 1, "", PriorityInteractive, release, cancelled),
+		r.job("a", 2, "", PriorityInteractive, release, cancelled),
+	}
+	for _, job := range own {
+		p.Submit(job)
+	}
+	other := r.job("a", 3, "", PriorityBackground, release, kept)
+	p.Submit(other)
+	waitRunning(t, p, 2)
+
+	p.CancelJobs(own...)
+	for _, err := range waitDone(t, cancelled, 3) {
+		if !errors.Is(err, ErrCancelled) && !errors.Is(err, context.Canceled) {
+			t.Fatalf("取消后片段以 %v 结束", err)
+		}
+	}
+	waitRunning(t, p, 1)
+	close(release)
+	if err := waitDone(t, kept, 1)[0]; err != nil {
+		t.Fatalf("未取消的片段以 %v 结束", err)
+	}
+}
+
+func TestPoolDetachedJob(t *testing.T) {
+	_, p := newTestPool(t, Limits{Global: 1}, "a")
+	r := new(recorder)
+	release := make(chan struct{})
+	done := make(chan error, 10)
+
+	// 不占用名额的任务在全局名额已满时仍可运行，并等待其提交的片段传输
+	if err := p.Submit(r.job("a", 0, "", PriorityNormal, release, done)); err != nil {
+		t.Fatal(err)
+	}
+	waitRunning(t, p, 1)
+
+	inner := make(chan error, 1)
+	detached := &Job{
+		AssetID:  "statement",
+		Operates: sqlite.OperateStatement,
+		Priority: PriorityBackground,
+		Detached: true,
+		Run: func(ctx context.Context) error {
+			if err := p.Submit(r.job("a", 1, "", PriorityNormal, release, inner)); err != nil {
+				return err
+			}
+			return <-inner
+		},
+		Done: func(err error) { done <- err },
+	}
+	if err := p.Submit(detached); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if stats := p.Stats(); stats.Running != 1 || stats.Queued != 1 {
+		t.Fatalf("工作池状态为 %+v", stats)
+	}
+
+	close(release)
+	for _, err := range waitDone(t, done, 2) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPoolDetachedLimit(t *testing.T) {
+	_, p := newTestPool(t, Limits{Global: 1, Detached: 2})
+	release := make(chan struct{})
+	done := make(chan error, 10)
+
+	// 不占用全局名额的任务另受其自身的并发限制
+	for i := 0; i < 5; i++ {
+		p.Submit(&Job{
+			AssetID:  fmt.Sprintf("statement%d", i),
+			Operates: sqlite.OperateStatement,
+			Priority: PriorityNormal,
+			Detached: true,
+			Run: func(ctx context.Context) error {
+				<-release
+				return nil
+			},
+			Done: func(err error) { done <- err },
+		})
+	}
+	time.Sleep(20 * time.Millisecond)
+	if stats := p.Stats(); stats.Queued != 3 {
+		t.Fatalf("工作池状态为 %+v, 期望 3 个任务排队", stats)
+	}
+
+	close(release)
+	for _, err := range waitDone(t, done, 5) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -2,27 +2,216 @@ package defs
 
 import (
 	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
 
+	"github.com/bpfs/defs/core/acl"
+	"github.com/bpfs/defs/core/identity"
 	"github.com/bpfs/defs/core/pool"
+	"github.com/bpfs/defs/core/repair"
+	"github.com/bpfs/defs/core/scrub"
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/core/store"
+	"github.com/bpfs/defs/core/throttle"
+	"github.com/bpfs/defs/core/transport"
+	"github.com/bpfs/defs/core/worker"
 	"github.com/bpfs/defs/eventbus"
+	"github.com/bpfs/defs/paths"
 
 	"github.com/bpfs/defs/sqlites"
-	"github.com/bpfs/dep2p"
-	"github.com/bpfs/dep2p/pubsub"
 	"github.com/dgraph-io/ristretto"
 )
 
 // FS提供了与DeFS交互所需的各种函数
 type FS struct {
-	ctx          context.Context     // 全局上下文
-	opt          *Options            // 文件存储选项配置
-	p2p          *dep2p.DeP2P        // DeP2P网络主机
-	pubsub       *pubsub.DeP2PPubSub // DeP2P网络订阅
-	db           *sqlites.SqliteDB   // sqlite数据库服务
-	uploadChan   chan *uploadChan    // 用于刷新上传的通道
-	downloadChan chan *downloadChan  // 用于刷新下载的通道
+	ctx       context.Context     // 全局上下文
+	cancel    context.CancelFunc  // 关闭文件服务时取消全局上下文
+	opt       *Options            // 文件存储选项配置
+	transport transport.Transport // 节点间传输(为空时仅使用本地存储)
+	db        *sqlites.SqliteDB   // sqlite数据库服务
 
 	registry *eventbus.EventRegistry // 事件总线
 	cache    *ristretto.Cache        // 缓存实例
 	pool     *pool.MemoryPool        // 内存池
+	retry    *pool.RetryScheduler    // 失败片段的重试调度
+	workers  *worker.Pool            // 片段传输的工作池
+	throttle *throttle.Throttle      // 上传和下载的限速
+	store    store.ShardStore        // 文件片段存储
+	scrubber *scrub.Scrubber         // 本地文件片段的巡检(存储不支持巡检时为空)
+	repair   *repair.Coordinator     // 丢失片段的重建(没有节点间传输时为空)
+	acl      *acl.Manager            // 文件资产的访问控制
+	node     *identity.Identity      // 节点身份(没有设置身份时为清单签名)
+
+	uploadMu sync.Mutex
+	uploads  map[string]*uploadLock // 正在进行的上传，同一文件资产的上传依次进行
+
+	background sync.WaitGroup // 打开文件服务时启动的后台协程，关闭时等待其退出
+}
+
+// Open 根据选项打开文件服务，opt 为空时使用默认选项
+func Open(ctx context.Context, opt *Options) (*FS, error) {
+	if opt == nil {
+		opt = DefaultOptions()
+	}
+	if err := opt.Validate(); err != nil {
+		return nil, err
+	}
+
+	// 打开业务数据库并初始化数据库表
+	dbPath := filepath.Join(opt.rootPath, "db", "businessdbs")
+	if err := paths.DirExistsAndMkdirAll(dbPath); err != nil {
+		return nil, err
+	}
+	db, err := sqlites.NewSqliteDB(dbPath, sqlite.DbFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := sqlite.InitDBTable(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// 未设置文件片段存储时，使用根路径下的段文件存储
+	s := opt.shardStore
+	if s == nil {
+		if s, err = store.NewSegmentStore(filepath.Join(opt.rootPath, "files", "slices")); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("创建文件片段存储失败: %v", err)
+		}
+	}
+
+	// 从数据库恢复进程退出前未完成的任务
+	p, err := pool.NewWithDB(db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("恢复任务失败: %v", err)
+	}
+
+	// 节点身份保存在根路径下，重启后不变
+	node, err := loadNodeIdentity(opt.rootPath)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	th, err := throttle.New(throttle.Limits{Upload: opt.uploadRate, Download: opt.downloadRate}, opt.rateSchedule)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	// 进度事件中的当前速度取自限速器的统计
+	p.SetRateFunc(func(assetID string, operates int) float64 {
+		upload, download := th.TaskThroughput(assetID)
+		if operates == sqlite.OperateUpload {
+			return upload
+		}
+		return download
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	fs := &FS{
+		ctx:       ctx,
+		cancel:    cancel,
+		opt:       opt,
+		transport: opt.transport,
+		db:        db,
+		pool:      p,
+		retry:     pool.NewRetryScheduler(p, opt.retryPolicy()),
+		workers:   worker.New(opt.workerLimits(), p),
+		throttle:  th,
+		store:     s,
+		acl:       acl.NewManager(db, opt.aclPolicy),
+		node:      node,
+		uploads:   make(map[string]*uploadLock),
+	}
+
+	// 由本地文件片段存储响应其他节点的请求，响应同样受全局速率限制
+	if opt.transport != nil {
+		opt.transport.Serve(&throttledHandler{ctx: ctx, handler: s, throttle: th, manifests: newManifestCache(opt.transport, fs.acl)})
+	}
+
+	// 早期版本上传的文件资产补充到文件目录中
+	if err := fs.catalogUploaded(); err != nil {
+		cancel()
+		db.Close()
+		return nil, err
+	}
+
+	// 支持巡检的存储定期检查本地文件片段，损坏的片段由 serve 重新获取
+	if sc, ok := s.(store.Scrubbable); ok {
+		fs.scrubber = scrub.New(sc, db, opt.scrubRate, opt.scrubInterval)
+		fs.goBackground(fs.scrubber.Run)
+	}
+
+	// 存在节点间传输时跟踪已上传文件资产的持有情况，重建离线节点上丢失的片段
+	if fs.transport != nil {
+		fs.repair = repair.New(&throttledTransport{Transport: fs.transport, throttle: th, credential: fs.credential}, s, int(opt.repairSpare), opt.repairInterval)
+		if err := fs.watchUploaded(); err != nil {
+			cancel()
+			fs.background.Wait()
+			db.Close()
+			return nil, err
+		}
+		fs.goBackground(fs.repair.Run)
+	}
+
+	// 到期的重试和巡检发现的损坏片段由 serve 交给工作池
+	fs.goBackground(fs.retry.Run)
+	fs.goBackground(fs.serve)
+
+	return fs, nil
+}
+
+// goBackground 以全局上下文启动后台协程，关闭文件服务时等待其退出
+func (fs *FS) goBackground(run func(ctx context.Context)) {
+	fs.background.Add(1)
+	go func() {
+		defer fs.background.Done()
+		run(fs.ctx)
+	}()
+}
+
+// Close 关闭文件服务，中断正在进行的片段传输，等待后台协程退出后关闭数据库
+func (fs *FS) Close() error {
+	fs.cancel()
+	fs.background.Wait()
+	fs.workers.Close()
+	return fs.db.Close()
+}
+
+// Subscribe 订阅文件资产上传和下载的进度事件，assetID 为空时订阅所有任务
+func (fs *FS) Subscribe(assetID string) <-chan pool.ProgressEvent {
+	return fs.pool.Subscribe(assetID)
+}
+
+// Unsubscribe 取消订阅进度事件
+func (fs *FS) Unsubscribe(sub <-chan pool.ProgressEvent) {
+	fs.pool.Unsubscribe(sub)
+}
+
+// Failures 返回文件资产中各片段最近的失败原因和重试情况
+func (fs *FS) Failures(assetID string) []pool.PieceFailure {
+	return fs.retry.Failures(assetID)
+}
+
+// PauseUpload 暂停文件资产的上传，正在发送的片段立即让出并发名额
+func (fs *FS) PauseUpload(assetID string) error {
+	return fs.pool.PauseUploadTask(assetID)
+}
+
+// ResumeUpload 恢复文件资产的上传
+func (fs *FS) ResumeUpload(assetID string) error {
+	return fs.pool.ResumeUploadTask(assetID)
+}
+
+// PauseDownload 暂停文件资产的下载，正在获取的片段立即让出并发名额
+func (fs *FS) PauseDownload(assetID string) error {
+	return fs.pool.PauseDownloadTask(assetID)
+}
+
+// ResumeDownload 恢复文件资产的下载
+func (fs *FS) ResumeDownload(assetID string) error {
+	return fs.pool.ResumeDownloadTask(assetID)
 }
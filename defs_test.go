@@ -0,0 +1,254 @@
+package defs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/core/store"
+)
+
+// openTestFS 在临时目录中打开文件服务
+func openTestFS(t *testing.T, mode StorageMode) *FS {
+	t.Helper()
+
+	opt := DefaultOptions()
+	opt.rootPath = t.TempDir()
+	opt.downloadPath = filepath.Join(opt.rootPath, "downloads")
+	opt.storageMode = mode
+	opt.shardSize = 1 << 12
+	opt.dataShards = 4
+	opt.parityShards = 2
+
+	fs, err := Open(context.Background(), opt)
+	if err != nil {
+		t.Fatalf("打开文件服务失败: %v", err)
+	}
+	t.Cleanup(func() { fs.Close() })
+
+	return fs
+}
+
+// writeTestFile 在临时目录中写入随机内容的文件
+func writeTestFile(t *testing.T, size int) (string, []byte) {
+	t.Helper()
+
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "source.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, data
+}
+
+func TestUploadDownloadDelete(t *testing.T) {
+	modes := map[string]StorageMode{
+		"FileMode":      FileMode,
+		"SliceMode":     SliceMode,
+		"RS_Size":       RS_Size,
+		"RS_Proportion": RS_Proportion,
+	}
+
+	for name, mode := range modes {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			fs := openTestFS(t, mode)
+			path, data := writeTestFile(t, 50000)
+
+			assetID, err := fs.Upload(ctx, path)
+			if err != nil {
+				t.Fatalf("上传失败: %v", err)
+			}
+
+			// 重复上传相同内容的文件返回相同的标识
+			again, err := fs.Upload(ctx, path)
+			if err != nil || again != assetID {
+				t.Fatalf("重复上传返回 %s, %v", again, err)
+			}
+
+			if err := fs.Download(ctx, assetID, ""); err != nil {
+				t.Fatalf("下载失败: %v", err)
+			}
+			got, err := os.ReadFile(filepath.Join(fs.opt.downloadPath, "source.bin"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("下载的内容与原文件不一致")
+			}
+
+			if err := fs.Delete(ctx, assetID); err != nil {
+				t.Fatalf("删除失败: %v", err)
+			}
+			if err := fs.Download(ctx, assetID, ""); err == nil {
+				t.Fatal("删除后下载应当失败")
+			}
+		})
+	}
+}
+
+func TestDownloadReconstructsMissingShards(t *testing.T) {
+	ctx := context.Background()
+	fs := openTestFS(t, RS_Size)
+	path, data := writeTestFile(t, 30000)
+
+	assetID, err := fs.Upload(ctx, path)
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+
+	// 删除两个数据片段，仍可通过奇偶校验片段恢复
+	for _, index := range []int{0, 2} {
+		if err := fs.store.Delete(assetID, index); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := filepath.Join(t.TempDir(), "restored.bin")
+	if err := fs.Download(ctx, assetID, dst); err != nil {
+		t.Fatalf("下载失败: %v", err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("恢复的内容与原文件不一致")
+	}
+
+	// 再删除一个片段后超出奇偶校验片段的容错能力
+	if err := fs.store.Delete(assetID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Download(ctx, assetID, dst); err == nil {
+		t.Fatal("可用片段不足时下载应当失败")
+	}
+}
+
+func TestUploadStreamsLargeFile(t *testing.T) {
+	ctx := context.Background()
+	fs := openTestFS(t, RS_Size)
+	// 文件跨越多个条带且大于最大缓冲区，段文件存储支持流式写入，不受缓冲区大小的限制
+	fs.opt.maxBufferSize = 1 << 20
+	path, data := writeTestFile(t, 2*maxStripeSize+12345)
+
+	assetID, err := fs.Upload(ctx, path)
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	if err := fs.store.Delete(assetID, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "large.bin")
+	if err := fs.Download(ctx, assetID, dst); err != nil {
+		t.Fatalf("下载失败: %v", err)
+	}
+	if got, err := os.ReadFile(dst); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("按条带恢复的内容与原文件不一致: %v", err)
+	}
+
+	// 不支持流式写入的存储仍受最大缓冲区的限制
+	fs.store = store.NewMemoryStore()
+	if _, err := fs.Upload(ctx, path); err == nil {
+		t.Fatal("文件大于最大缓冲区时上传到内存存储应当失败")
+	}
+}
+
+// flakyStore 在指定片段第一次保存时返回错误，并记录每个片段的保存次数
+type flakyStore struct {
+	store.ShardStore
+	failIndex int
+	puts      map[int]int
+}
+
+func (s *flakyStore) Put(assetID string, index int, data []byte) error {
+	s.puts[index]++
+	if index == s.failIndex && s.puts[index] == 1 {
+		return fmt.Errorf("模拟保存失败")
+	}
+	return s.ShardStore.Put(assetID, index, data)
+}
+
+func TestUploadResumesAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	path, data := writeTestFile(t, 30000)
+	s := &flakyStore{ShardStore: store.NewMemoryStore(), failIndex: 3, puts: make(map[int]int)}
+
+	opt := DefaultOptions()
+	opt.rootPath = t.TempDir()
+	opt.storageMode = RS_Size
+	opt.shardSize = 1 << 12
+	opt.dataShards = 4
+	opt.parityShards = 2
+	opt.shardStore = s
+
+	fs, err := Open(ctx, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Upload(ctx, path); err == nil {
+		t.Fatal("保存片段失败时上传应当失败")
+	}
+	fs.Close()
+
+	// 重新打开文件服务后从中断处继续上传
+	fs, err = Open(ctx, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+
+	assetID, err := fs.Upload(ctx, path)
+	if err != nil {
+		t.Fatalf("继续上传失败: %v", err)
+	}
+	// 只有失败的片段被再次保存
+	for index, n := range s.puts {
+		want := 1
+		if index == s.failIndex {
+			want = 2
+		}
+		if n != want {
+			t.Fatalf("片段 %d 保存了 %d 次, 期望 %d 次", index, n, want)
+		}
+	}
+
+	dst := filepath.Join(t.TempDir(), "resumed.bin")
+	if err := fs.Download(ctx, assetID, dst); err != nil {
+		t.Fatalf("下载失败: %v", err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("继续上传后下载的内容与原文件不一致")
+	}
+}
+
+func TestDownloadName(t *testing.T) {
+	for name, want := range map[string]string{
+		"report.pdf":       "report.pdf",
+		"":                 "asset",
+		".":                "asset",
+		"..":               "asset",
+		"../../etc/passwd": "asset",
+		"/etc/passwd":      "asset",
+		`..\evil.exe`:      "asset",
+		"a/b.txt":          "asset",
+	} {
+		if got := downloadName(&sqlite.FileRecord{AssetID: "asset", Name: name}); got != want {
+			t.Errorf("文件名 %q 得到 %q, 期望 %q", name, got, want)
+		}
+	}
+}
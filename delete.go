@@ -0,0 +1,44 @@
+package defs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bpfs/defs/core/acl"
+	"github.com/bpfs/defs/core/delete"
+	"github.com/bpfs/defs/core/sqlite"
+)
+
+// Delete 删除文件资产，包括本地保存的文件片段、数据库记录和内存池中的任务
+// 文件资产有访问控制时，本节点的身份需要有写入权限
+func (fs *FS) Delete(ctx context.Context, assetID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	record, err := sqlite.SelectOneFileDatabase(fs.db, assetID, sqlite.OperateUpload)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return fmt.Errorf("文件资产 %s 不存在", assetID)
+	}
+	if err := fs.checkAccess(assetID, nil, nil, acl.Write); err != nil {
+		return err
+	}
+
+	fs.pool.DeleteUploadTask(assetID)
+	fs.pool.DeleteDownloadTask(assetID)
+	fs.throttle.RemoveTask(assetID)
+	if fs.repair != nil {
+		fs.repair.Unwatch(assetID)
+	}
+
+	if err := delete.Remove(fs.db, fs.store, assetID); err != nil {
+		return err
+	}
+	if err := sqlite.DeleteCatalogDatabase(fs.db, assetID); err != nil {
+		return err
+	}
+	return fs.acl.Delete(assetID)
+}
@@ -0,0 +1,303 @@
+package defs
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bpfs/defs/core/acl"
+	"github.com/bpfs/defs/core/erasure"
+	"github.com/bpfs/defs/core/manifest"
+	"github.com/bpfs/defs/core/pool"
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/core/store"
+	"github.com/bpfs/defs/core/transport"
+	"github.com/bpfs/defs/util"
+	"github.com/sirupsen/logrus"
+)
+
+// Download 下载文件资产并写入 dst，dst 为空时写入下载路径下与原文件同名的文件
+// 优先读取数据片段，数据片段缺失或损坏时使用奇偶校验片段按条带恢复
+// 本地没有文件资产或片段时，从网络中持有片段的节点获取；片段和恢复的内容都按签名的清单检查
+// 文件资产有访问控制时，本节点的身份需要有读取权限
+func (fs *FS) Download(ctx context.Context, assetID, dst string) error {
+	record, err := sqlite.SelectOneFileDatabase(fs.db, assetID, sqlite.OperateUpload)
+	if err != nil {
+		return err
+	}
+
+	var (
+		m       *manifest.Manifest
+		holders *transport.Holders
+	)
+	if record != nil && record.Status == sqlite.StatusSuccess {
+		m, err = fs.localManifest(assetID)
+	} else {
+		m, holders, err = fs.lookupRemoteAsset(ctx, assetID)
+	}
+	if err != nil {
+		return err
+	}
+	if record == nil || record.Status != sqlite.StatusSuccess {
+		record = manifestRecord(assetID, m)
+	}
+
+	if err := fs.checkAccess(assetID, m, holders, acl.Read); err != nil {
+		return err
+	}
+	// 已加密的文件资产需要为本节点的身份封装的数据密钥
+	if m.Encryption != "" {
+		if _, err := m.DataKey(fs.signer()); err != nil {
+			return fmt.Errorf("无法解密文件资产 %s: %v", assetID, err)
+		}
+	}
+
+	if dst == "" {
+		dst = filepath.Join(fs.opt.downloadPath, downloadName(record))
+	}
+
+	if err := fs.beginDownload(record); err != nil {
+		return err
+	}
+
+	// 下载失败时保留下载任务，记录已知的片段持有者
+	if err := fs.fetchAndJoin(ctx, m, record, holders, dst); err != nil {
+		_ = sqlite.UpdateFileDatabaseStatus(fs.db, assetID, sqlite.OperateDownload, sqlite.StatusFailed)
+		return err
+	}
+
+	if err := sqlite.UpdateFileDatabaseStatus(fs.db, assetID, sqlite.OperateDownload, sqlite.StatusSuccess); err != nil {
+		return err
+	}
+	fs.pool.DeleteDownloadTask(assetID)
+	fs.throttle.RemoveTask(assetID)
+
+	return nil
+}
+
+// downloadName 返回写入下载路径时使用的文件名
+// 文件名来自其他节点，只保留基本名称，不是合法的文件名时使用文件资产的唯一标识
+func downloadName(record *sqlite.FileRecord) string {
+	name := filepath.Base(record.Name)
+	if name != record.Name || name == "." || name == ".." || name == "" ||
+		strings.ContainsAny(name, `/\`) {
+		return record.AssetID
+	}
+	return name
+}
+
+// beginDownload 记录下载状态并创建下载任务
+func (fs *FS) beginDownload(record *sqlite.FileRecord) error {
+	downloaded, err := sqlite.SelectOneFileDatabase(fs.db, record.AssetID, sqlite.OperateDownload)
+	if err != nil {
+		return err
+	}
+	if downloaded != nil {
+		err = sqlite.UpdateFileDatabaseStatus(fs.db, record.AssetID, sqlite.OperateDownload, sqlite.StatusInProgress)
+	} else {
+		err = sqlite.InsertFilesDatabase(fs.db, &sqlite.FileRecord{
+			AssetID:     record.AssetID,
+			Name:        record.Name,
+			Size:        record.Size,
+			FileHash:    record.FileHash,
+			TotalPieces: record.TotalPieces,
+			DataPieces:  record.DataPieces,
+			Operates:    sqlite.OperateDownload,
+			Status:      sqlite.StatusInProgress,
+			Times:       time.Now(),
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	// 已下载的片段不会保留，重新开始上一次未完成的下载任务
+	if err := fs.pool.ResetDownloadTask(record.AssetID); err == nil {
+		return nil
+	}
+
+	return fs.pool.AddDownloadTask(record.AssetID, record.FileHash)
+}
+
+// shardOpener 打开一个可用的文件片段
+type shardOpener func() (io.ReadCloser, error)
+
+// fetchAndJoin 读取清单描述的文件片段，按条带恢复文件内容并写入 dst，恢复的内容与清单不符时删除 dst
+// 本地片段校验哈希值后直接读取，不足时从其他节点获取的片段暂存在临时目录中；
+// holders 为空时，在本地片段不足后才向网络查询片段的持有情况
+func (fs *FS) fetchAndJoin(ctx context.Context, m *manifest.Manifest, record *sqlite.FileRecord, holders *transport.Holders, dst string) error {
+	slices := manifestSlices(m)
+	sliceTable := make(map[int]pool.HashTable, len(slices))
+	for _, slice := range slices {
+		sliceTable[slice.SliceIndex] = pool.HashTable{
+			Hash:    slice.SliceHash,
+			RsCodes: int64(slice.SliceIndex) >= record.DataPieces,
+		}
+	}
+	fs.pool.UpdateDownloadPieceInfo("", record.AssetID, record.Name, record.Size, sliceTable, nil, record.FileHash)
+
+	em := m.Erasure()
+	shards := make([]shardOpener, record.TotalPieces)
+	report := new(erasure.Report)
+	enough := false
+	// 片段按索引升序排列，数据片段在前，足以恢复文件时停止检查
+	for _, slice := range slices {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if slice.SliceIndex < 0 || slice.SliceIndex >= len(shards) {
+			continue
+		}
+
+		index := slice.SliceIndex
+		ok, err := fs.checkLocalShard(record.AssetID, index, em)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			report.Missing = append(report.Missing, index)
+			continue
+		case err != nil || !ok:
+			report.Bad = append(report.Bad, index)
+			continue
+		}
+
+		shards[index] = func() (io.ReadCloser, error) {
+			return store.Open(fs.store, record.AssetID, index)
+		}
+		if fs.pool.MarkDownloadPieceComplete(record.AssetID, index) {
+			enough = true
+			break
+		}
+	}
+	// 本地损坏的片段在后台重新获取，不影响本次下载
+	for _, index := range report.Bad {
+		fs.refreshLocalShard(record.AssetID, index)
+	}
+	// 本地片段不足时，从其他节点并发获取
+	if !enough {
+		tmpPath := filepath.Join(fs.opt.rootPath, "files", "tmp")
+		if err := os.MkdirAll(tmpPath, 0755); err != nil {
+			return err
+		}
+		dir, err := os.MkdirTemp(tmpPath, record.AssetID+"-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		if err := fs.fetchShards(ctx, record, slices, holders, dir, shards); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	// 先写入同一目录下的临时文件，恢复和检查成功后才替换 dst，失败时不影响已有的文件
+	file, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := file.Name()
+
+	err = fs.decodeShards(file, shards, m)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// checkLocalShard 流式读取本地文件片段并根据清单检查其大小和哈希值
+// 片段不存在时返回 store.ErrNotFound
+func (fs *FS) checkLocalShard(assetID string, index int, m erasure.Manifest) (bool, error) {
+	r, err := store.Open(fs.store, assetID, index)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	return erasure.CheckShard(r, index, m)
+}
+
+// refreshLocalShard 从其他节点重新获取本地缺失或损坏的文件片段
+func (fs *FS) refreshLocalShard(assetID string, index int) {
+	if fs.transport == nil {
+		logrus.Warnf("文件资产 %s 的片段 %d 已损坏，没有可用的节点重新获取", assetID, index)
+		return
+	}
+	fs.submitRefreshDownload(assetID, index)
+}
+
+// decodeShards 由片段按条带恢复文件内容写入 w，并检查恢复的内容与清单中的哈希值一致
+// 加密的文件资产先恢复密文，再以本节点的身份解开数据密钥后逐块认证并解密；
+// 只打开足以恢复文件的片段，数据片段齐全时不读取奇偶校验片段
+func (fs *FS) decodeShards(w io.Writer, shards []shardOpener, m *manifest.Manifest) error {
+	readers := make([]io.Reader, len(shards))
+	opened := 0
+	for index, open := range shards {
+		if open == nil || opened == m.DataShards {
+			continue
+		}
+		r, err := open()
+		if err != nil {
+			continue
+		}
+		defer r.Close()
+		readers[index] = r
+		opened++
+	}
+
+	if m.Encryption == "" {
+		return m.Restore(w, readers)
+	}
+	return manifest.Unseal(w, readers, m, fs.signer())
+}
+
+// fetchShardFrom 从指定节点获取文件片段并校验哈希值
+func (fs *FS) fetchShardFrom(ctx context.Context, peerID, assetID string, slice *sqlite.SliceRecord) ([]byte, error) {
+	data, err := fs.receiveShard(ctx, peerID, assetID, slice.SliceIndex)
+	if err != nil {
+		return nil, err
+	}
+	if hex.EncodeToString(util.CalculateHash(data)) != slice.SliceHash {
+		return nil, fmt.Errorf("节点 %s 的文件片段 %d 的哈希值不匹配", peerID, slice.SliceIndex)
+	}
+	return data, nil
+}
+
+// fetchShard 从其他节点获取文件片段并校验哈希值，holders 为空时先查询片段的持有情况
+func (fs *FS) fetchShard(ctx context.Context, assetID string, slice *sqlite.SliceRecord, holders **transport.Holders) ([]byte, error) {
+	if fs.transport == nil {
+		return nil, fmt.Errorf("文件片段 %d 不可用", slice.SliceIndex)
+	}
+	if *holders == nil {
+		h, err := fs.transport.QueryHolders(ctx, assetID)
+		if err != nil {
+			return nil, err
+		}
+		*holders = h
+	}
+
+	data, peerID, err := fs.fetchRemoteShard(ctx, assetID, slice.SliceIndex, *holders)
+	if err != nil {
+		return nil, err
+	}
+	if hex.EncodeToString(util.CalculateHash(data)) != slice.SliceHash {
+		return nil, fmt.Errorf("文件片段 %d 的哈希值不匹配", slice.SliceIndex)
+	}
+
+	fs.pool.UpdateDownloadPieceInfo(peerID, assetID, "", 0, nil, map[int]string{slice.SliceIndex: slice.SliceHash})
+	return data, nil
+}
@@ -0,0 +1,90 @@
+package defs
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/bpfs/defs/core/acl"
+	"github.com/bpfs/defs/core/manifest"
+	"github.com/bpfs/defs/core/sqlite"
+)
+
+// previousDataKey 返回同一文件上一次加密上传时使用的数据密钥及其唯一标识，没有时返回 nil
+// 名称、长度和修改时间都相同的上传记录视为同一文件，数据密钥从其清单中为本节点身份封装的副本解出
+func (fs *FS) previousDataKey(info os.FileInfo) ([]byte, string, error) {
+	records, err := sqlite.SelectUploadsByFileDatabase(fs.db, info.Name(), info.Size())
+	if err != nil {
+		return nil, "", err
+	}
+	for _, record := range records {
+		if !record.Times.Equal(info.ModTime()) {
+			continue
+		}
+		m, err := fs.localManifest(record.AssetID)
+		if err != nil || m.Encryption == "" || m.Owner != fs.signer().DID() {
+			continue
+		}
+		if dataKey, err := m.DataKey(fs.signer()); err == nil {
+			return dataKey, record.AssetID, nil
+		}
+	}
+	return nil, "", nil
+}
+
+// ShareKey 为 did 封装已加密文件资产的数据密钥，使其可以下载并解密文件，需要写入权限
+// 清单由所有者重新签名，唯一标识不变；存在节点间传输时重新宣告文件资产信息
+// 已获得数据密钥的接收者无法被撤销，撤销访问需要重新上传文件
+func (fs *FS) ShareKey(ctx context.Context, assetID, did string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	record, err := sqlite.SelectOneFileDatabase(fs.db, assetID, sqlite.OperateUpload)
+	if err != nil {
+		return err
+	}
+	if record == nil || record.Status != sqlite.StatusSuccess {
+		return fmt.Errorf("文件资产 %s 不存在", assetID)
+	}
+	if err := fs.checkAccess(assetID, nil, nil, acl.Write); err != nil {
+		return err
+	}
+
+	m, err := fs.localManifest(assetID)
+	if err != nil {
+		return err
+	}
+	if m.Encryption == "" {
+		return fmt.Errorf("文件资产 %s 未加密", assetID)
+	}
+	if err := fs.grantDataKey(assetID, m, did); err != nil {
+		return err
+	}
+
+	return fs.reannounce(ctx, assetID)
+}
+
+// grantDataKey 为 did 封装清单中的数据密钥，由所有者重新签名后保存，未加密的清单不变
+// 只有清单的所有者可以重新签名，其他身份签名会改变唯一标识
+func (fs *FS) grantDataKey(assetID string, m *manifest.Manifest, did string) error {
+	if m.Encryption == "" {
+		return nil
+	}
+	owner := fs.signer()
+	if m.Owner != owner.DID() {
+		return fmt.Errorf("只有清单的所有者可以分享文件资产 %s 的数据密钥", assetID)
+	}
+
+	dataKey, err := m.DataKey(owner)
+	if err != nil {
+		return err
+	}
+	if err := m.AddRecipient(did, dataKey); err != nil {
+		return err
+	}
+	if err := m.Sign(owner); err != nil {
+		return err
+	}
+	return fs.saveManifest(assetID, m)
+}
@@ -22,4 +22,7 @@ package defs
     - WITH: 共享资产的目标DID。
     - AUTHORIZED BY: 执行操作的DID，必须有权限。
 
+以上操作由 core/acl 记录和检查：AUTHORIZED BY 的身份对操作签名，设置共同所有者和转让所有权按签名策略(all/any/quorum)验证，
+下载需要读取权限，修改和删除需要写入权限。
+
 */
@@ -16,4 +16,9 @@ package defs
     - 'filename': 要删除的文件的名称。
     - AUTHORIZED BY: 执行操作的DID，必须有权限。
 
+DID 使用 did:key 形式的 Ed25519 公钥，由 core/identity 生成和解析。
+
+以 ASYNC 开头的 CREATE FILE 立即返回任务的唯一标识，在工作池中执行，
+由 SHOW JOBS、SHOW JOB 'id' 查看状态，CANCEL JOB 'id' 取消。
+
 */
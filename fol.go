@@ -31,5 +31,10 @@ package defs
     SHOW FILES WHERE TAGS INCLUDE [tag1, tag2, ...] AND OWNED_BY='did'
     - TAGS: 文件的标签筛选条件。
     - OWNED_BY: 文件的拥有者DID筛选条件。
+    - ORDER BY、LIMIT 和 OFFSET: 可选。排序和分页，如 ORDER BY SIZE DESC LIMIT 10 OFFSET 20。
+    - EXPLAIN: 可选。写在语句开头时只返回生成的 SQL 查询，不执行。
+
+SHOW FILES 在本节点的文件目录中查询，上传成功的文件资产加入文件目录，删除时移出。
+FS.Exec 执行 FQL 语句，语句中的文件可以是文件资产的唯一标识、文件名称或自定义名称。
 
 */
@@ -0,0 +1,269 @@
+package defs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bpfs/defs/core/acl"
+	"github.com/bpfs/defs/core/sqlite"
+	bpfsfql "github.com/bpfs/defs/structured"
+)
+
+// Exec 执行一条 FQL 语句
+// 语句中的文件可以是文件资产的唯一标识，也可以是文件目录中的名称或自定义名称。
+// OWNED_BY、AUTHORIZED BY 和 FROM 的身份需要是本节点的身份，访问控制的检查与对应的方法相同。
+// ASYNC 语句在工作池中执行，立即返回的结果中只有任务的唯一标识，由 SHOW JOB 查看结果、CANCEL JOB 取消。
+// UPDATE FILE、CHECKOUT FILE 和 USE EXTENSION 返回 bpfsfql.ErrUnsupported。
+func (fs *FS) Exec(ctx context.Context, query string) (*bpfsfql.Result, error) {
+	stmt, err := fs.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Exec(ctx)
+}
+
+// Stmt 是在文件服务上执行的预处理 FQL 语句
+type Stmt struct {
+	fs    *FS
+	query string
+	stmt  *bpfsfql.Stmt
+}
+
+// Prepare 预处理一条带有 "?" 或 ":name" 参数的 FQL 语句，返回的语句可以多次以不同的参数执行
+// 文件名、DID、标签列表和时间等值应作为参数传入，而不是拼接到语句中。
+func (fs *FS) Prepare(query string) (*Stmt, error) {
+	stmt, err := bpfsfql.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{fs: fs, query: query, stmt: stmt}, nil
+}
+
+// Exec 绑定参数后执行语句，参数的规则见 bpfsfql.Stmt.Bind，按名称的参数使用 bpfsfql.Named
+// ASYNC 语句的任务中记录的是带有参数占位符的原文。
+func (s *Stmt) Exec(ctx context.Context, args ...interface{}) (*bpfsfql.Result, error) {
+	return s.stmt.Exec(ctx, &fqlExecutor{Catalog: bpfsfql.NewCatalog(s.fs.db), fs: s.fs, query: s.query}, args...)
+}
+
+// fqlExecutor 以文件服务的方法执行 FQL 语句，SHOW FILES 和 ADD TAGS 在文件目录中执行
+type fqlExecutor struct {
+	*bpfsfql.Catalog
+	fs    *FS
+	query string // 语句的原文，记录在 ASYNC 语句的任务中
+}
+
+// async 将语句提交到工作池，返回只包含任务唯一标识的结果
+func (e *fqlExecutor) async(run func(ctx context.Context) (*bpfsfql.Result, error)) (*bpfsfql.Result, error) {
+	id, err := e.fs.submitStatement(e.query, run)
+	if err != nil {
+		return nil, err
+	}
+	return &bpfsfql.Result{JobID: id, Message: fmt.Sprintf("已提交任务 %s", id)}, nil
+}
+
+// authorize 检查语句中的身份是否为本节点的身份，本节点只能以自己的身份签名
+func (e *fqlExecutor) authorize(did string) error {
+	id := e.fs.did()
+	if id == "" {
+		return fmt.Errorf("没有设置本节点的身份，不能以 %s 执行", did)
+	}
+	if did != id {
+		return fmt.Errorf("%s 不是本节点的身份", did)
+	}
+	return nil
+}
+
+// resolve 检查身份后返回语句中的文件对应的文件资产
+func (e *fqlExecutor) resolve(did, file string) (string, error) {
+	if err := e.authorize(did); err != nil {
+		return "", err
+	}
+	return e.Resolve(file)
+}
+
+func (e *fqlExecutor) Create(ctx context.Context, stmt *bpfsfql.CreateFileStmt) (*bpfsfql.Result, error) {
+	if err := e.authorize(stmt.Owner); err != nil {
+		return nil, err
+	}
+	if stmt.Async {
+		sync := *stmt
+		sync.Async = false
+		return e.async(func(ctx context.Context) (*bpfsfql.Result, error) {
+			return e.Create(ctx, &sync)
+		})
+	}
+
+	assetID, err := e.fs.Upload(ctx, stmt.File)
+	if err != nil {
+		return nil, err
+	}
+
+	if stmt.CustomName != "" || len(stmt.Metadata) > 0 {
+		record, err := sqlite.SelectCatalogDatabase(e.fs.db, assetID)
+		if err != nil {
+			return nil, err
+		}
+		// 文件目录中没有该文件资产时(如早期版本已上传成功的文件)，由上传记录生成
+		if record == nil {
+			upload, err := sqlite.SelectOneFileDatabase(e.fs.db, assetID, sqlite.OperateUpload)
+			if err != nil {
+				return nil, err
+			}
+			if upload == nil {
+				return nil, fmt.Errorf("文件资产 %s 不存在", assetID)
+			}
+			record = &sqlite.CatalogRecord{
+				AssetID:  assetID,
+				Name:     upload.Name,
+				Size:     upload.Size,
+				Modified: upload.Times,
+			}
+		}
+		if stmt.CustomName != "" {
+			record.CustomName = stmt.CustomName
+		}
+		if len(stmt.Metadata) > 0 {
+			record.Metadata = stmt.Metadata
+		}
+		if err := sqlite.SaveCatalogDatabase(e.fs.db, record); err != nil {
+			return nil, err
+		}
+	}
+	return &bpfsfql.Result{AssetIDs: []string{assetID}}, nil
+}
+
+func (e *fqlExecutor) Drop(ctx context.Context, stmt *bpfsfql.DropFileStmt) (*bpfsfql.Result, error) {
+	assetID, err := e.resolve(stmt.AuthorizedBy, stmt.File)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.fs.Delete(ctx, assetID); err != nil {
+		return nil, err
+	}
+	return &bpfsfql.Result{AssetIDs: []string{assetID}}, nil
+}
+
+func (e *fqlExecutor) Select(ctx context.Context, stmt *bpfsfql.SelectContentStmt) (*bpfsfql.Result, error) {
+	assetID, err := e.resolve(stmt.AuthorizedBy, stmt.File)
+	if err != nil {
+		return nil, err
+	}
+
+	// 下载到临时目录后读取内容
+	dir, err := os.MkdirTemp("", "defs-select-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	dst := filepath.Join(dir, "content")
+	if err := e.fs.Download(ctx, assetID, dst); err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(dst)
+	if err != nil {
+		return nil, err
+	}
+	return &bpfsfql.Result{AssetIDs: []string{assetID}, Content: content}, nil
+}
+
+func (e *fqlExecutor) BulkTransfer(ctx context.Context, stmt *bpfsfql.BulkTransferStmt) (*bpfsfql.Result, error) {
+	if err := e.authorize(stmt.From); err != nil {
+		return nil, err
+	}
+	if stmt.Async {
+		sync := *stmt
+		sync.Async = false
+		return e.async(func(ctx context.Context) (*bpfsfql.Result, error) {
+			return e.BulkTransfer(ctx, &sync)
+		})
+	}
+
+	// 先解析全部文件，任一文件无法确定时不转让任何文件资产
+	assetIDs := make([]string, len(stmt.Files))
+	for i, file := range stmt.Files {
+		assetID, err := e.Resolve(file)
+		if err != nil {
+			return nil, err
+		}
+		assetIDs[i] = assetID
+	}
+
+	result := new(bpfsfql.Result)
+	for _, assetID := range assetIDs {
+		if _, err := e.fs.Transfer(ctx, assetID, stmt.To); err != nil {
+			return nil, fmt.Errorf("已转让 %d 个文件资产，转让文件资产 %s 失败: %v", len(result.AssetIDs), assetID, err)
+		}
+		result.AssetIDs = append(result.AssetIDs, assetID)
+	}
+	return result, nil
+}
+
+func (e *fqlExecutor) AddTags(ctx context.Context, stmt *bpfsfql.AddTagsStmt) (*bpfsfql.Result, error) {
+	assetID, err := e.resolve(stmt.AuthorizedBy, stmt.File)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.fs.checkAccess(assetID, nil, nil, acl.Write); err != nil {
+		return nil, err
+	}
+	return e.Catalog.AddTags(ctx, stmt)
+}
+
+func (e *fqlExecutor) Transfer(ctx context.Context, stmt *bpfsfql.TransferFileStmt) (*bpfsfql.Result, error) {
+	assetID, err := e.resolve(stmt.AuthorizedBy, stmt.File)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := e.fs.Transfer(ctx, assetID, stmt.To); err != nil {
+		return nil, err
+	}
+	return &bpfsfql.Result{AssetIDs: []string{assetID}}, nil
+}
+
+func (e *fqlExecutor) SetCoOwners(ctx context.Context, stmt *bpfsfql.SetCoOwnersStmt) (*bpfsfql.Result, error) {
+	assetID, err := e.resolve(stmt.AuthorizedBy, stmt.File)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := e.fs.SetCoOwners(ctx, assetID, stmt.CoOwners); err != nil {
+		return nil, err
+	}
+	return &bpfsfql.Result{AssetIDs: []string{assetID}}, nil
+}
+
+func (e *fqlExecutor) Share(ctx context.Context, stmt *bpfsfql.ShareFileStmt) (*bpfsfql.Result, error) {
+	assetID, err := e.resolve(stmt.AuthorizedBy, stmt.File)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := e.fs.Share(ctx, assetID, stmt.With, acl.Read); err != nil {
+		return nil, err
+	}
+	return &bpfsfql.Result{AssetIDs: []string{assetID}}, nil
+}
+
+func (e *fqlExecutor) ShowJobs(ctx context.Context, stmt *bpfsfql.ShowJobsStmt) (*bpfsfql.Result, error) {
+	result := new(bpfsfql.Result)
+	for _, job := range e.fs.pool.StatementJobs() {
+		result.Jobs = append(result.Jobs, jobInfo(job))
+	}
+	return result, nil
+}
+
+func (e *fqlExecutor) ShowJob(ctx context.Context, stmt *bpfsfql.ShowJobStmt) (*bpfsfql.Result, error) {
+	info, err := e.fs.lookupJob(stmt.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &bpfsfql.Result{JobID: info.ID, AssetIDs: info.AssetIDs, Jobs: []bpfsfql.JobInfo{info}}, nil
+}
+
+func (e *fqlExecutor) CancelJob(ctx context.Context, stmt *bpfsfql.CancelJobStmt) (*bpfsfql.Result, error) {
+	if err := e.fs.cancelStatement(stmt.ID); err != nil {
+		return nil, err
+	}
+	return &bpfsfql.Result{JobID: stmt.ID}, nil
+}
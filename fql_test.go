@@ -0,0 +1,210 @@
+package defs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/core/identity"
+	"github.com/bpfs/defs/core/sqlite"
+	bpfsfql "github.com/bpfs/defs/structured"
+)
+
+func TestExecCatalog(t *testing.T) {
+	ctx := context.Background()
+	fs := openTestFS(t, FileMode)
+	id, err := identity.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.opt.identity = id
+	did := id.DID()
+	path, data := writeTestFile(t, 20000)
+
+	exec := func(format string, args ...interface{}) *bpfsfql.Result {
+		t.Helper()
+		result, err := fs.Exec(ctx, fmt.Sprintf(format, args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	created := exec(`CREATE FILE '%s' OWNED_BY='%s' CUSTOM_NAME=report METADATA="dept:sales"`, path, did)
+	assetID := created.AssetIDs[0]
+
+	// 文件目录中的自定义名称可以代替文件资产的唯一标识
+	exec(`ADD TAGS TO FILE report TAGS [q1, 'finance'] AUTHORIZED BY '%s'`, did)
+	shown := exec(`SHOW FILES WHERE TAGS INCLUDE [q1, finance] AND OWNED_BY='%s' AND SIZE < 20KB`, did)
+	want := []bpfsfql.FileInfo{{AssetID: assetID, Name: "source.bin", CustomName: "report", Size: 20000, Owner: did,
+		Tags: []string{"q1", "finance"}, Metadata: map[string]string{"dept": "sales"}}}
+	if len(shown.Files) == 1 {
+		shown.Files[0].Modified = want[0].Modified
+	}
+	if !reflect.DeepEqual(shown.Files, want) {
+		t.Fatalf("SHOW FILES 得到 %+v，期望 %+v", shown.Files, want)
+	}
+
+	if content := exec(`SELECT CONTENT FROM FILE report AUTHORIZED BY '%s'`, did).Content; !bytes.Equal(content, data) {
+		t.Fatal("SELECT CONTENT 读取的内容与原文件不一致")
+	}
+
+	// 只能以本节点的身份执行
+	if _, err := fs.Exec(ctx, `DROP FILE report AUTHORIZED BY 'did:key:other'`); err == nil {
+		t.Fatal("以其他身份删除应失败")
+	}
+	if _, err := fs.Exec(ctx, `CHECKOUT FILE report VERSION 1 AUTHORIZED BY 'did:key:other'`); !errors.Is(err, bpfsfql.ErrUnsupported) {
+		t.Fatalf("CHECKOUT FILE 返回 %v", err)
+	}
+
+	exec(`DROP FILE report AUTHORIZED BY '%s'`, did)
+	if files := exec(`SHOW FILES`).Files; len(files) != 0 {
+		t.Fatalf("删除后文件目录中仍有 %+v", files)
+	}
+}
+
+func TestExecCreateWithoutCatalog(t *testing.T) {
+	ctx := context.Background()
+	fs := openTestFS(t, FileMode)
+	id, err := identity.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.opt.identity = id
+	path, _ := writeTestFile(t, 2000)
+
+	// 已上传成功但不在文件目录中的文件资产再次创建时加入文件目录
+	assetID, err := fs.Upload(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sqlite.DeleteCatalogDatabase(fs.db, assetID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Exec(ctx, fmt.Sprintf(`CREATE FILE '%s' OWNED_BY='%s' CUSTOM_NAME=report`, path, id.DID())); err != nil {
+		t.Fatal(err)
+	}
+	record, err := sqlite.SelectCatalogDatabase(fs.db, assetID)
+	if err != nil || record == nil {
+		t.Fatalf("文件目录中没有文件资产: %v", err)
+	}
+	if record.Name != "source.bin" || record.CustomName != "report" || record.Size != 2000 {
+		t.Fatalf("文件目录中的记录为 %+v", record)
+	}
+}
+
+func TestExecAsync(t *testing.T) {
+	ctx := context.Background()
+	fs := openTestFS(t, FileMode)
+	id, err := identity.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.opt.identity = id
+	path, _ := writeTestFile(t, 20000)
+
+	query := fmt.Sprintf(`ASYNC CREATE FILE '%s' OWNED_BY='%s'`, path, id.DID())
+	submitted, err := fs.Exec(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if submitted.JobID == "" || len(submitted.AssetIDs) != 0 {
+		t.Fatalf("ASYNC 语句返回 %+v", submitted)
+	}
+
+	// 等待任务结束
+	var job bpfsfql.JobInfo
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		result, err := fs.Exec(ctx, fmt.Sprintf(`SHOW JOB '%s'`, submitted.JobID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job = result.Jobs[0]; job.Status != bpfsfql.JobPending && job.Status != bpfsfql.JobRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("任务没有结束: %+v", job)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if job.Status != bpfsfql.JobSucceeded || len(job.AssetIDs) != 1 || job.Statement != query {
+		t.Fatalf("任务结束时为 %+v", job)
+	}
+	if files := mustExec(t, fs, `SHOW FILES`).Files; len(files) != 1 || files[0].AssetID != job.AssetIDs[0] {
+		t.Fatalf("任务完成后文件目录为 %+v", files)
+	}
+
+	if jobs := mustExec(t, fs, `SHOW JOBS`).Jobs; len(jobs) != 1 || jobs[0].ID != submitted.JobID {
+		t.Fatalf("SHOW JOBS 得到 %+v", jobs)
+	}
+	if _, err := fs.Exec(ctx, fmt.Sprintf(`CANCEL JOB '%s'`, submitted.JobID)); err == nil {
+		t.Fatal("取消已结束的任务应失败")
+	}
+	if _, err := fs.Exec(ctx, `SHOW JOB 'job-missing'`); err == nil {
+		t.Fatal("查看不存在的任务应失败")
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	ctx := context.Background()
+	fs := openTestFS(t, FileMode)
+	id, err := identity.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.opt.identity = id
+	did := id.DID()
+	path, _ := writeTestFile(t, 20000)
+
+	create, err := fs.Prepare(`CREATE FILE :path OWNED_BY=:did CUSTOM_NAME=? METADATA=?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := create.Exec(ctx, "it's a report", map[string]string{"dept": "sales"},
+		bpfsfql.Named("path", path), bpfsfql.Named("did", did))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag, err := fs.Prepare(`ADD TAGS TO FILE ? TAGS ? AUTHORIZED BY ?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tag.Exec(ctx, "it's a report", []string{"q1", "finance"}, did); err != nil {
+		t.Fatal(err)
+	}
+
+	show, err := fs.Prepare(`SHOW FILES WHERE TAGS INCLUDE ? AND OWNED_BY = ? AND LAST_MODIFIED > ?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := time.Now().Add(-time.Hour)
+	for tags, want := range map[string][]string{
+		"q1":      created.AssetIDs,
+		"missing": nil,
+	} {
+		result, err := show.Exec(ctx, []string{tags}, did, since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result.AssetIDs, want) {
+			t.Fatalf("标签 %s 的文件为 %v，期望 %v", tags, result.AssetIDs, want)
+		}
+	}
+}
+
+// mustExec 执行 FQL 语句，失败时结束测试
+func mustExec(t *testing.T, fs *FS, query string) *bpfsfql.Result {
+	t.Helper()
+
+	result, err := fs.Exec(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
@@ -0,0 +1,101 @@
+package defs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/bpfs/defs/core/pool"
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/core/worker"
+	bpfsfql "github.com/bpfs/defs/structured"
+)
+
+// submitStatement 将 ASYNC 语句作为任务提交到工作池，立即返回任务的唯一标识
+// 任务不占用片段传输的全局并发名额，同时执行的任务数受 maxStatementJobs 限制，
+// 其中的上传和下载仍由工作池调度。
+func (fs *FS) submitStatement(statement string, run func(ctx context.Context) (*bpfsfql.Result, error)) (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := "job-" + hex.EncodeToString(buf)
+
+	if err := fs.pool.AddStatementJob(id, statement); err != nil {
+		return "", err
+	}
+
+	job := &worker.Job{
+		AssetID:  id,
+		Operates: sqlite.OperateStatement,
+		Priority: worker.PriorityNormal,
+		Detached: true,
+		Run: func(ctx context.Context) error {
+			if err := fs.pool.StartStatementJob(id); err != nil {
+				return err
+			}
+			result, err := run(ctx)
+			var assetIDs []string
+			if result != nil {
+				assetIDs = result.AssetIDs
+			}
+			fs.pool.FinishStatementJob(id, assetIDs, err)
+			return err
+		},
+		// 排队中被取消或工作池关闭时任务以失败结束，已取消的任务保持取消的状态
+		Done: func(err error) {
+			if err != nil {
+				fs.pool.FinishStatementJob(id, nil, err)
+			}
+		},
+	}
+	if err := fs.workers.Submit(job); err != nil {
+		fs.pool.FinishStatementJob(id, nil, err)
+		return "", err
+	}
+	return id, nil
+}
+
+// cancelStatement 取消 ASYNC 语句的任务，中断正在执行的语句
+func (fs *FS) cancelStatement(id string) error {
+	if err := fs.pool.CancelStatementJob(id); err != nil {
+		return err
+	}
+	fs.workers.Cancel(id, sqlite.OperateStatement)
+	return nil
+}
+
+// jobInfo 将内存池中的任务状态转换为 FQL 的任务信息
+func jobInfo(job pool.StatementJob) bpfsfql.JobInfo {
+	info := bpfsfql.JobInfo{
+		ID:        job.ID,
+		Statement: job.Statement,
+		Err:       job.Err,
+		AssetIDs:  job.AssetIDs,
+		Created:   job.Created,
+		Updated:   job.Updated,
+	}
+	switch job.Status {
+	case sqlite.StatusPending:
+		info.Status = bpfsfql.JobPending
+	case sqlite.StatusInProgress:
+		info.Status = bpfsfql.JobRunning
+	case sqlite.StatusSuccess:
+		info.Status = bpfsfql.JobSucceeded
+	case sqlite.StatusCancelled:
+		info.Status = bpfsfql.JobCancelled
+	default:
+		info.Status = bpfsfql.JobFailed
+	}
+	return info
+}
+
+// lookupJob 返回任务信息，任务不存在时返回错误
+func (fs *FS) lookupJob(id string) (bpfsfql.JobInfo, error) {
+	job, exists := fs.pool.GetStatementJob(id)
+	if !exists {
+		return bpfsfql.JobInfo{}, fmt.Errorf("任务 %s 不存在", id)
+	}
+	return jobInfo(job), nil
+}
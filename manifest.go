@@ -0,0 +1,226 @@
+package defs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bpfs/defs/core/acl"
+	"github.com/bpfs/defs/core/identity"
+	"github.com/bpfs/defs/core/manifest"
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/core/transport"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/defs/util/crypto"
+)
+
+// maxCachedManifests 是存储节点缓存的已验证清单的数量上限
+const maxCachedManifests = 1024
+
+// loadNodeIdentity 读取根路径下保存的节点身份，不存在时生成一个并保存
+// 没有设置身份时，本节点上传的清单由节点身份签名，重启后唯一标识和数据密钥保持不变
+func loadNodeIdentity(rootPath string) (*identity.Identity, error) {
+	path := filepath.Join(rootPath, "keys", "node.pem")
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return identity.ParsePrivateKey(data)
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取节点身份失败: %v", err)
+	}
+
+	id, err := identity.Generate()
+	if err != nil {
+		return nil, err
+	}
+	if data, err = id.MarshalPrivateKey(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("保存节点身份失败: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, fmt.Errorf("保存节点身份失败: %v", err)
+	}
+	return id, nil
+}
+
+// signer 返回为清单签名和解开数据密钥的身份，设置身份时为该身份，否则为节点身份
+func (fs *FS) signer() *identity.Identity {
+	if fs.opt.identity != nil {
+		return fs.opt.identity
+	}
+	return fs.node
+}
+
+// decodeManifest 解析清单，检查所有者的签名以及由清单计算的唯一标识与 assetID 一致
+func decodeManifest(assetID string, data []byte) (*manifest.Manifest, error) {
+	m, err := manifest.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Verify(); err != nil {
+		return nil, fmt.Errorf("文件资产 %s 的清单无效: %v", assetID, err)
+	}
+	id, err := m.AssetID()
+	if err != nil {
+		return nil, err
+	}
+	if id != assetID {
+		return nil, fmt.Errorf("清单与文件资产 %s 不符", assetID)
+	}
+	return m, nil
+}
+
+// localManifest 返回本节点上传的文件资产的清单，没有保存清单时返回错误
+func (fs *FS) localManifest(assetID string) (*manifest.Manifest, error) {
+	data, err := sqlite.SelectManifestDatabase(fs.db, assetID)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("文件资产 %s 没有清单", assetID)
+	}
+	return decodeManifest(assetID, data)
+}
+
+// saveManifest 保存本节点签名的清单
+func (fs *FS) saveManifest(assetID string, m *manifest.Manifest) error {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return sqlite.SaveManifestDatabase(fs.db, assetID, data)
+}
+
+// manifestRecord 由清单生成文件资产的记录，加密的文件资产的大小为明文的大小
+func manifestRecord(assetID string, m *manifest.Manifest) *sqlite.FileRecord {
+	size := m.Size
+	if m.Encryption != "" {
+		size = crypto.DecryptedSize(m.Size, m.ChunkSize)
+	}
+	return &sqlite.FileRecord{
+		AssetID:     assetID,
+		Name:        m.Name,
+		Size:        size,
+		FileHash:    m.ContentHash,
+		TotalPieces: int64(len(m.Shards)),
+		DataPieces:  int64(m.DataShards),
+		Operates:    sqlite.OperateUpload,
+		Status:      sqlite.StatusSuccess,
+		Times:       m.ModTime,
+	}
+}
+
+// manifestSlices 由清单生成按索引排列的片段记录
+func manifestSlices(m *manifest.Manifest) []*sqlite.SliceRecord {
+	slices := make([]*sqlite.SliceRecord, len(m.Shards))
+	for index, shard := range m.Shards {
+		slices[index] = &sqlite.SliceRecord{
+			SliceHash:  shard.Hash,
+			SliceIndex: index,
+			Status:     sqlite.StatusSuccess,
+		}
+	}
+	return slices
+}
+
+// decodeMeta 解析网络宣告的文件资产信息
+func decodeMeta(assetID string, holders *transport.Holders) (*assetMeta, error) {
+	if len(holders.Meta) == 0 {
+		return nil, fmt.Errorf("文件资产 %s 不存在", assetID)
+	}
+	meta := new(assetMeta)
+	if err := util.DecodeFromBytes(holders.Meta, meta); err != nil {
+		return nil, fmt.Errorf("解析文件资产信息失败: %v", err)
+	}
+	return meta, nil
+}
+
+// remoteManifest 解析网络宣告的文件资产信息中的清单并验证
+func remoteManifest(assetID string, holders *transport.Holders) (*manifest.Manifest, error) {
+	meta, err := decodeMeta(assetID, holders)
+	if err != nil {
+		return nil, err
+	}
+	return decodeManifest(assetID, meta.Manifest)
+}
+
+// manifestCache 缓存存储节点从网络查询并验证过的清单和访问控制，用于检查其他节点发送和请求的片段
+// 重新签名只改变封装的数据密钥，片段的哈希值不变，缓存的清单不需要更新
+type manifestCache struct {
+	transport transport.Transport
+	acl       *acl.Manager // 本节点上传的文件资产的访问控制，以及验证宣告的操作使用的策略
+	mu        sync.Mutex
+	manifests map[string]*manifest.Manifest
+	entries   map[string]*acl.Entry // 验证过的版本最高的访问控制
+}
+
+// newManifestCache 创建清单缓存
+func newManifestCache(t transport.Transport, m *acl.Manager) *manifestCache {
+	return &manifestCache{
+		transport: t,
+		acl:       m,
+		manifests: make(map[string]*manifest.Manifest),
+		entries:   make(map[string]*acl.Entry),
+	}
+}
+
+// get 返回文件资产已验证的清单，缓存中没有时从网络查询
+func (c *manifestCache) get(ctx context.Context, assetID string) (*manifest.Manifest, error) {
+	c.mu.Lock()
+	m, ok := c.manifests[assetID]
+	c.mu.Unlock()
+	if ok {
+		return m, nil
+	}
+
+	holders, err := c.transport.QueryHolders(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+	m, err = remoteManifest(assetID, holders)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	// 超出上限时清空缓存，之后的片段重新查询清单
+	if len(c.manifests) >= maxCachedManifests {
+		c.manifests = make(map[string]*manifest.Manifest)
+	}
+	c.manifests[assetID] = m
+	c.mu.Unlock()
+	return m, nil
+}
+
+// entry 返回受访问控制的文件资产经验证的访问控制，本节点上传的文件资产使用本地记录
+// 其他文件资产每次从网络查询宣告的操作并重放，使撤销及时生效；查询到的版本低于此前验证过的版本，
+// 或宣告的操作无法验证时使用此前验证过的访问控制，宣告的操作不能被回退
+func (c *manifestCache) entry(ctx context.Context, assetID string, m *manifest.Manifest) (*acl.Entry, error) {
+	if entry, err := c.acl.Get(assetID); err != nil || entry != nil {
+		return entry, err
+	}
+
+	holders, err := c.transport.QueryHolders(ctx, assetID)
+	var entry *acl.Entry
+	if err == nil {
+		entry, err = remoteACL(assetID, m, holders, c.acl.Policy())
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached := c.entries[assetID]; cached != nil && (err != nil || cached.Version > entry.Version) {
+		return cached, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(c.entries) >= maxCachedManifests {
+		c.entries = make(map[string]*acl.Entry)
+	}
+	c.entries[assetID] = entry
+	return entry, nil
+}
@@ -0,0 +1,140 @@
+package defs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bpfs/defs/core/acl"
+	"github.com/bpfs/defs/core/manifest"
+	"github.com/bpfs/defs/core/pool"
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/core/transport"
+	"github.com/bpfs/defs/util"
+)
+
+// assetMeta 描述通过网络宣告的文件资产信息，其他节点据此下载文件
+// 文件的描述和片段的哈希值只来自所有者签名的清单，接收的节点验证签名和唯一标识后才使用；
+// 访问控制不直接宣告，只宣告签名的操作，清单标记受访问控制时由接收的节点重放得到
+type assetMeta struct {
+	Manifest []byte          // 二进制编码的签名清单
+	ACL      []*acl.SignedOp // 访问控制已生效的签名操作，接收的节点由清单中的所有者开始重放验证
+}
+
+// checkPeers 检查可连接的节点数量是否满足路由表的最小要求
+func (fs *FS) checkPeers() error {
+	if fs.transport == nil {
+		return nil
+	}
+	if peers := len(fs.transport.Peers()); int64(peers) < fs.opt.routingTableLow {
+		return fmt.Errorf("可连接的节点数量 %d 小于 %d", peers, fs.opt.routingTableLow)
+	}
+
+	return nil
+}
+
+// sendPiece 将哈希值为 hash 的文件片段发送给其他节点保存，从轮询位置开始依次尝试各个节点
+// 返回接收片段的节点，没有节点接收时返回空字符串
+func (fs *FS) sendPiece(ctx context.Context, assetID string, index int, hash string, data []byte) (string, error) {
+	peers := fs.transport.Peers()
+	for i := range peers {
+		peerID := peers[(index+i)%len(peers)]
+		if err := fs.throttle.WaitUpload(ctx, assetID, len(data)); err != nil {
+			return "", err
+		}
+		if err := fs.transport.SendShard(ctx, peerID, assetID, index, data); err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			continue
+		}
+
+		fs.pool.UpdateUploadPieceInfo(assetID, hash, &pool.UploadPieceInfo{
+			Index:  index,
+			PeerID: []string{peerID},
+		})
+		return peerID, nil
+	}
+
+	return "", nil
+}
+
+// announce 向网络宣告文件资产的签名清单和访问控制，以及本节点持有的片段
+// 存储节点在保存片段前根据宣告的清单检查片段，因此清单需要在发送片段前宣告
+func (fs *FS) announce(ctx context.Context, assetID string, local []int) error {
+	data, err := sqlite.SelectManifestDatabase(fs.db, assetID)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return fmt.Errorf("文件资产 %s 没有清单", assetID)
+	}
+
+	meta := &assetMeta{Manifest: data}
+	if meta.ACL, err = fs.acl.Ops(assetID); err != nil {
+		return err
+	}
+	encoded, err := util.EncodeToBytes(meta)
+	if err != nil {
+		return err
+	}
+
+	return fs.transport.Announce(ctx, &transport.Announcement{
+		AssetID: assetID,
+		Indexes: local,
+		Meta:    encoded,
+	})
+}
+
+// lookupRemoteAsset 从网络查询文件资产，返回验证后的清单和持有情况
+func (fs *FS) lookupRemoteAsset(ctx context.Context, assetID string) (*manifest.Manifest, *transport.Holders, error) {
+	if fs.transport == nil {
+		return nil, nil, fmt.Errorf("文件资产 %s 不存在", assetID)
+	}
+
+	holders, err := fs.transport.QueryHolders(ctx, assetID)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := remoteManifest(assetID, holders)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return m, holders, nil
+}
+
+// fetchRemoteShard 依次从持有文件片段的节点获取片段
+func (fs *FS) fetchRemoteShard(ctx context.Context, assetID string, index int, holders *transport.Holders) ([]byte, string, error) {
+	if fs.transport == nil || holders == nil {
+		return nil, "", fmt.Errorf("文件片段 %d 不可用", index)
+	}
+
+	for _, peerID := range holders.Peers[index] {
+		if peerID == fs.transport.ID() {
+			continue
+		}
+		data, err := fs.receiveShard(ctx, peerID, assetID, index)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, "", ctx.Err()
+			}
+			continue
+		}
+		return data, peerID, nil
+	}
+
+	return nil, "", fmt.Errorf("文件片段 %d 不可用", index)
+}
+
+// receiveShard 从指定节点获取文件片段，请求附带本节点身份的凭证
+func (fs *FS) receiveShard(ctx context.Context, peerID, assetID string, index int) ([]byte, error) {
+	data, err := fs.transport.FetchShard(ctx, peerID, assetID, index, fs.credential(peerID, assetID, index))
+	if err != nil {
+		return nil, err
+	}
+	// 片段到达后按其大小扣除下载配额，使后续获取按限速进行
+	if err := fs.throttle.WaitDownload(ctx, assetID, len(data)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
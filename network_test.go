@@ -0,0 +1,842 @@
+package defs
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/core/acl"
+	"github.com/bpfs/defs/core/identity"
+	"github.com/bpfs/defs/core/pool"
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/core/transport"
+	"github.com/bpfs/defs/util"
+)
+
+// openNetworkFS 在模拟网络中创建节点并打开文件服务
+func openNetworkFS(t *testing.T, network *transport.Network, ids []string, localStorage bool) []*FS {
+	t.Helper()
+
+	services := make([]*FS, 0, len(ids))
+	for _, id := range ids {
+		node, err := network.NewNode(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opt := DefaultOptions()
+		opt.rootPath = t.TempDir()
+		opt.downloadPath = filepath.Join(opt.rootPath, "downloads")
+		opt.storageMode = RS_Size
+		opt.shardSize = 1 << 12
+		opt.dataShards = 4
+		opt.parityShards = 2
+		opt.localStorage = localStorage
+		opt.transport = node
+		opt.routingTableLow = 1
+		opt.maxRetries = 2
+		opt.retryInterval = time.Millisecond
+		opt.maxRetryInterval = 10 * time.Millisecond
+
+		fs, err := Open(context.Background(), opt)
+		if err != nil {
+			t.Fatalf("打开文件服务失败: %v", err)
+		}
+		t.Cleanup(func() { fs.Close() })
+		services = append(services, fs)
+	}
+
+	return services
+}
+
+func TestNetworkUploadDownload(t *testing.T) {
+	for _, localStorage := range []bool{true, false} {
+		ctx := context.Background()
+		network := transport.NewNetwork()
+		nodes := openNetworkFS(t, network, []string{"a", "b", "c"}, localStorage)
+		path, data := writeTestFile(t, 30000)
+
+		assetID, err := nodes[0].Upload(ctx, path)
+		if err != nil {
+			t.Fatalf("上传失败: %v", err)
+		}
+
+		// 节点 b 本地没有文件资产，从网络中获取片段
+		dst := filepath.Join(t.TempDir(), "remote.bin")
+		if err := nodes[1].Download(ctx, assetID, dst); err != nil {
+			t.Fatalf("localStorage=%v 时从网络下载失败: %v", localStorage, err)
+		}
+		got, err := os.ReadFile(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatal("从网络下载的内容与原文件不一致")
+		}
+
+		// 未开启本地存储时，上传节点的片段全部由其他节点保存
+		if !localStorage {
+			if err := nodes[0].Download(ctx, assetID, dst); err != nil {
+				t.Fatalf("上传节点从网络下载失败: %v", err)
+			}
+		}
+	}
+}
+
+func TestNetworkDownloadWithOfflinePeer(t *testing.T) {
+	ctx := context.Background()
+	network := transport.NewNetwork()
+	nodes := openNetworkFS(t, network, []string{"a", "b", "c", "d"}, false)
+	path, data := writeTestFile(t, 30000)
+
+	assetID, err := nodes[0].Upload(ctx, path)
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+
+	// 片段轮询分发给 b、c、d，节点 c 离线后仍可通过奇偶校验片段恢复
+	network.Disconnect("c")
+	dst := filepath.Join(t.TempDir(), "remote.bin")
+	if err := nodes[3].Download(ctx, assetID, dst); err != nil {
+		t.Fatalf("节点离线时下载失败: %v", err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("恢复的内容与原文件不一致")
+	}
+
+	// 节点 b 也离线后超出奇偶校验片段的容错能力
+	network.Disconnect("b")
+	if err := nodes[3].Download(ctx, assetID, dst); err == nil {
+		t.Fatal("可用片段不足时下载应当失败")
+	}
+	// 下载失败不影响已有的文件，也不留下临时文件
+	if got, _ := os.ReadFile(dst); !bytes.Equal(got, data) {
+		t.Fatal("下载失败后已有的文件被改变")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(dst)); len(entries) != 1 {
+		t.Fatalf("下载失败后目录中有 %d 个文件", len(entries))
+	}
+}
+
+func TestUploadRequiresPeers(t *testing.T) {
+	network := transport.NewNetwork()
+	nodes := openNetworkFS(t, network, []string{"a"}, true)
+	path, _ := writeTestFile(t, 1000)
+
+	if _, err := nodes[0].Upload(context.Background(), path); err == nil {
+		t.Fatal("可连接的节点数量不足时上传应当失败")
+	}
+}
+
+func TestUploadRetriesUnreachablePeers(t *testing.T) {
+	ctx := context.Background()
+	network := transport.NewNetwork()
+	nodes := openNetworkFS(t, network, []string{"a", "b"}, false)
+	path, _ := writeTestFile(t, 5000)
+	assetID := assetIDOf(t, nodes[0], path)
+	events := nodes[0].Subscribe(assetID)
+
+	// 所有请求都丢失，每个片段重试 maxRetries 次后放弃
+	network.SetDropRate(1, 1)
+	if _, err := nodes[0].Upload(ctx, path); err == nil {
+		t.Fatal("片段无法发送时上传应当失败")
+	}
+
+	// 片段并发发送，第一个超过最大重试次数的片段使任务失败
+	failures := nodes[0].Failures(assetID)
+	exhausted := false
+	for _, failure := range failures {
+		if failure.Reason == "" || failure.Attempts > 3 {
+			t.Fatalf("失败情况为 %+v", failures)
+		}
+		exhausted = exhausted || failure.Attempts == 3
+	}
+	if !exhausted {
+		t.Fatalf("没有片段超过最大重试次数 %+v", failures)
+	}
+	record, err := sqlite.SelectOneFileDatabase(nodes[0].db, assetID, sqlite.OperateUpload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != sqlite.StatusFailed {
+		t.Fatalf("上传状态为 %d, 期望失败", record.Status)
+	}
+
+	var last pool.ProgressEvent
+	for event := range events {
+		last = event
+	}
+	if last.Type != pool.EventFailed {
+		t.Fatalf("最后一个事件为 %v", last.Type)
+	}
+
+	// 网络恢复后重新上传，片段一次发送成功
+	network.SetDropRate(0, 1)
+	if _, err := nodes[0].Upload(ctx, path); err != nil {
+		t.Fatalf("网络恢复后上传失败: %v", err)
+	}
+	if failures := nodes[0].Failures(assetID); len(failures) != 0 {
+		t.Fatalf("上传成功后仍有失败记录 %+v", failures)
+	}
+}
+
+func TestNetworkUploadPauseResume(t *testing.T) {
+	ctx := context.Background()
+	network := transport.NewNetwork()
+	network.SetLatency(20 * time.Millisecond)
+	nodes := openNetworkFS(t, network, []string{"a", "b", "c"}, false)
+	path, data := writeTestFile(t, 30000)
+	assetID := assetIDOf(t, nodes[0], path)
+	events := nodes[0].Subscribe(assetID)
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := nodes[0].Upload(ctx, path)
+		result <- err
+	}()
+
+	// 第一个片段完成后暂停，暂停期间没有片段完成
+	for event := range events {
+		if event.Type == pool.EventPieceCompleted {
+			break
+		}
+	}
+	if err := nodes[0].PauseUpload(assetID); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond) // 等待暂停前已完成发送的片段
+	done := len(nodes[0].pool.GetIncompleteUploadPieces(assetID))
+	time.Sleep(100 * time.Millisecond)
+	if n := len(nodes[0].pool.GetIncompleteUploadPieces(assetID)); n != done {
+		t.Fatalf("暂停期间未完成的片段从 %d 个变为 %d 个", done, n)
+	}
+	if stats := nodes[0].workers.Stats(); stats.Running != 0 {
+		t.Fatalf("暂停后仍有 %d 个片段传输占用名额", stats.Running)
+	}
+	select {
+	case err := <-result:
+		t.Fatalf("暂停期间上传已返回: %v", err)
+	default:
+	}
+
+	if err := nodes[0].ResumeUpload(assetID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("恢复后上传失败: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("恢复后上传未完成")
+	}
+
+	dst := filepath.Join(t.TempDir(), "remote.bin")
+	if err := nodes[1].Download(ctx, assetID, dst); err != nil {
+		t.Fatalf("下载失败: %v", err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("下载的内容与原文件不一致")
+	}
+}
+
+func TestNetworkUploadThrottled(t *testing.T) {
+	ctx := context.Background()
+	network := transport.NewNetwork()
+	nodes := openNetworkFS(t, network, []string{"a", "b", "c"}, false)
+	path, _ := writeTestFile(t, 200000)
+	assetID := assetIDOf(t, nodes[0], path)
+
+	// 超出令牌桶容量的部分按 128KB/s 发送，至少需要 1 秒
+	const rate = 128 << 10
+	nodes[0].SetRateLimits(rate, 0)
+	if up, down := nodes[0].RateLimits(); up != rate || down != 0 {
+		t.Fatalf("全局速率为 %d/%d", up, down)
+	}
+	events := nodes[0].Subscribe(assetID)
+	defer nodes[0].Unsubscribe(events)
+
+	start := time.Now()
+	if _, err := nodes[0].Upload(ctx, path); err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Fatalf("限速后上传仅用时 %v", elapsed)
+	}
+
+	// 进度事件携带任务的当前速度
+	var rated bool
+	for event := range events {
+		if event.Type == pool.EventPieceCompleted && event.Rate > 0 {
+			rated = true
+		}
+		if event.Type == pool.EventCompleted {
+			break
+		}
+	}
+	if !rated {
+		t.Fatal("进度事件中没有上传速度")
+	}
+	if up, _ := nodes[0].Throughput(""); up <= 0 || up > rate*1.5 {
+		t.Fatalf("全局上传速度为 %.0f", up)
+	}
+}
+
+func TestNetworkScrubRepairsCorruptShard(t *testing.T) {
+	ctx := context.Background()
+	network := transport.NewNetwork()
+	nodes := openNetworkFS(t, network, []string{"a", "b", "c"}, true)
+	path, _ := writeTestFile(t, 30000)
+
+	assetID, err := nodes[0].Upload(ctx, path)
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	want, err := nodes[0].store.Get(assetID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 本地保留的片段 1 发生位翻转
+	file := filepath.Join(nodes[0].opt.rootPath, "files", "slices", assetID, "1")
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[len(raw)/2] ^= 0x01
+	if err := os.WriteFile(file, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := nodes[0].Scrub(ctx); err != nil {
+		t.Fatalf("巡检失败: %v", err)
+	}
+	if stats := nodes[0].ScrubStats(); stats.Corrupt != 1 || stats.Passes != 1 {
+		t.Fatalf("巡检统计为 %+v", stats)
+	}
+
+	// 损坏的片段从其他节点重新获取，数据库中的状态随之恢复
+	repaired := func() bool {
+		got, err := nodes[0].store.Get(assetID, 1)
+		if err != nil || !bytes.Equal(got, want) {
+			return false
+		}
+		slices, err := sqlite.SelectSlicesDatabase(nodes[0].db, assetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, slice := range slices {
+			if slice.Status != sqlite.StatusSuccess {
+				return false
+			}
+		}
+		return true
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !repaired() {
+		if time.Now().After(deadline) {
+			t.Fatal("损坏的片段没有被修复")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNetworkDownloadRefreshesBadShard(t *testing.T) {
+	ctx := context.Background()
+	network := transport.NewNetwork()
+	nodes := openNetworkFS(t, network, []string{"a", "b", "c"}, true)
+	path, data := writeTestFile(t, 30000)
+
+	assetID, err := nodes[0].Upload(ctx, path)
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	want, err := nodes[0].store.Get(assetID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 本地的片段 1 被替换为校验和正确但与清单不符的内容
+	if err := nodes[0].store.Put(assetID, 1, bytes.Repeat([]byte{1}, len(want))); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "local.bin")
+	if err := nodes[0].Download(ctx, assetID, dst); err != nil {
+		t.Fatalf("下载失败: %v", err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("下载的内容与原文件不一致")
+	}
+
+	// 下载时发现的损坏片段在后台从其他节点重新获取
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if got, err := nodes[0].store.Get(assetID, 1); err == nil && bytes.Equal(got, want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("损坏的片段没有被重新获取")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNetworkRepairRegeneratesLostShards(t *testing.T) {
+	ctx := context.Background()
+	network := transport.NewNetwork()
+	nodes := openNetworkFS(t, network, []string{"a", "b", "c", "d", "e", "f", "g"}, false)
+	path, data := writeTestFile(t, 30000)
+
+	assetID, err := nodes[0].Upload(ctx, path)
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	health, err := nodes[0].AssetHealth(ctx, assetID)
+	if err != nil || health.Spare != 2 {
+		t.Fatalf("上传后的持有情况为 %+v, %v", health, err)
+	}
+
+	// 持有片段 0 和片段 3 的节点离线后，余量降为 0
+	holders := mustHolders(t, nodes[0], assetID)
+	offline := map[string]bool{holders[0][0]: true, holders[3][0]: true}
+	for id := range offline {
+		network.Disconnect(id)
+	}
+	if health, _ := nodes[0].AssetHealth(ctx, assetID); health.Spare != 0 {
+		t.Fatalf("节点 %v 离线后的持有情况为 %+v", offline, health)
+	}
+
+	result, err := nodes[0].Repair(ctx, assetID)
+	if err != nil {
+		t.Fatalf("修复失败: %v", err)
+	}
+	if len(result.Repaired) != 2 {
+		t.Fatalf("重建了 %v", result.Repaired)
+	}
+	if health, _ := nodes[0].AssetHealth(ctx, assetID); health.Spare != 2 {
+		t.Fatalf("修复后的持有情况为 %+v", health)
+	}
+
+	// 其他节点仍能下载完整的文件
+	dst := filepath.Join(t.TempDir(), "repaired.bin")
+	for _, node := range nodes[1:] {
+		if offline[node.transport.ID()] {
+			continue
+		}
+		if err := node.Download(ctx, assetID, dst); err != nil {
+			t.Fatalf("修复后下载失败: %v", err)
+		}
+		break
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("修复后下载的内容与原文件不一致: %v", err)
+	}
+}
+
+func TestNetworkEncryptedUploadDownload(t *testing.T) {
+	ctx := context.Background()
+	network := transport.NewNetwork()
+	nodes := openNetworkFS(t, network, []string{"a", "b", "c", "d"}, true)
+	nodes[0].opt.encryption = true
+	path, data := writeTestFile(t, 30000)
+
+	assetID, err := nodes[0].Upload(ctx, path)
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	// 宣告的清单中的唯一标识、名称和哈希值都不来自明文
+	m, _, err := nodes[1].lookupRemoteAsset(ctx, assetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainHash := hex.EncodeToString(util.CalculateHash(data))
+	if assetID == plainHash || m.ContentHash == plainHash || m.Name != "" {
+		t.Fatalf("宣告的清单中包含明文的信息: %+v", m)
+	}
+
+	// 其他节点保存的片段中只有密文
+	for _, node := range nodes[1:] {
+		for index := range mustHolders(t, nodes[0], assetID) {
+			shard, err := node.store.Get(assetID, index)
+			if err == nil && bytes.Contains(shard, data[:64]) {
+				t.Fatalf("节点 %s 的片段 %d 中包含明文", node.transport.ID(), index)
+			}
+		}
+	}
+
+	// 清单中没有为其身份封装数据密钥的节点无法下载
+	dst := filepath.Join(t.TempDir(), "remote.bin")
+	if err := nodes[1].Download(ctx, assetID, dst); err == nil {
+		t.Fatal("没有数据密钥的节点下载成功")
+	}
+
+	// 分享数据密钥后清单重新签名，节点 b 从网络下载并解密
+	if err := nodes[0].ShareKey(ctx, assetID, nodes[1].signer().DID()); err != nil {
+		t.Fatalf("分享数据密钥失败: %v", err)
+	}
+	if err := nodes[1].Download(ctx, assetID, dst); err != nil {
+		t.Fatalf("获得数据密钥的节点下载失败: %v", err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("解密的内容与原文件不一致: %v", err)
+	}
+	if err := nodes[2].Download(ctx, assetID, dst); err == nil {
+		t.Fatal("未被分享的节点下载成功")
+	}
+
+	if err := nodes[0].Download(ctx, assetID, dst); err != nil {
+		t.Fatalf("上传节点下载失败: %v", err)
+	}
+	if got, _ := os.ReadFile(dst); !bytes.Equal(got, data) {
+		t.Fatal("上传节点解密的内容与原文件不一致")
+	}
+}
+
+func TestNetworkEncryptedUploadResume(t *testing.T) {
+	ctx := context.Background()
+	network := transport.NewNetwork()
+	nodes := openNetworkFS(t, network, []string{"a", "b"}, false)
+	nodes[0].opt.encryption = true
+	path, data := writeTestFile(t, 5000)
+
+	// 片段无法发送时上传失败，上传记录和清单保留
+	network.SetDropRate(1, 1)
+	if _, err := nodes[0].Upload(ctx, path); err == nil {
+		t.Fatal("片段无法发送时上传应当失败")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := sqlite.SelectUploadsByFileDatabase(nodes[0].db, info.Name(), info.Size())
+	if err != nil || len(records) != 1 {
+		t.Fatalf("上传记录为 %v: %v", records, err)
+	}
+
+	// 再次上传时从清单中解出数据密钥，得到相同的唯一标识
+	network.SetDropRate(0, 1)
+	assetID, err := nodes[0].Upload(ctx, path)
+	if err != nil {
+		t.Fatalf("网络恢复后上传失败: %v", err)
+	}
+	if assetID != records[0].AssetID {
+		t.Fatalf("继续上传的唯一标识为 %s, 期望 %s", assetID, records[0].AssetID)
+	}
+
+	// 相同的内容作为另一个文件上传时使用新的数据密钥，密文和唯一标识都不同
+	other := filepath.Join(t.TempDir(), "copy.bin")
+	if err := os.WriteFile(other, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	otherID, err := nodes[0].Upload(ctx, other)
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	first, err := nodes[0].localManifest(assetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := nodes[0].localManifest(otherID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherID == assetID || first.ContentHash == second.ContentHash {
+		t.Fatal("相同的明文得到了相同的密文")
+	}
+}
+
+func TestNetworkRejectsUnverifiedShards(t *testing.T) {
+	ctx := context.Background()
+	network := transport.NewNetwork()
+	nodes := openNetworkFS(t, network, []string{"a", "b", "c"}, true)
+	path, data := writeTestFile(t, 30000)
+
+	assetID, err := nodes[0].Upload(ctx, path)
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	shard, err := nodes[0].store.Get(assetID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 存储节点只保存与签名清单一致的片段
+	attacker, err := network.NewNode("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := append([]byte(nil), shard...)
+	forged[0] ^= 1
+	if err := attacker.SendShard(ctx, "b", assetID, 0, forged); err == nil {
+		t.Fatal("存储节点保存了与清单不符的片段")
+	}
+	if err := attacker.SendShard(ctx, "b", "unknown", 0, shard); err == nil {
+		t.Fatal("存储节点保存了没有清单的片段")
+	}
+
+	// 由其他身份重新签名的清单与唯一标识不符，下载时拒绝使用
+	m, err := nodes[0].localManifest(assetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := identity.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Sign(other); err != nil {
+		t.Fatal(err)
+	}
+	encoded, _ := m.MarshalBinary()
+	meta, _ := util.EncodeToBytes(&assetMeta{Manifest: encoded})
+	if err := attacker.Announce(ctx, &transport.Announcement{AssetID: assetID, Meta: meta}); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "remote.bin")
+	if err := nodes[1].Download(ctx, assetID, dst); err == nil {
+		t.Fatal("使用了与唯一标识不符的清单")
+	}
+
+	// 所有者重新宣告后恢复下载
+	if err := nodes[0].reannounce(ctx, assetID); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodes[1].Download(ctx, assetID, dst); err != nil {
+		t.Fatalf("下载失败: %v", err)
+	}
+	if got, _ := os.ReadFile(dst); !bytes.Equal(got, data) {
+		t.Fatal("下载的内容与原文件不一致")
+	}
+}
+
+func TestNetworkAccessControl(t *testing.T) {
+	ctx := context.Background()
+	network := transport.NewNetwork()
+	nodes := openNetworkFS(t, network, []string{"a", "b", "c"}, true)
+	ids := make([]*identity.Identity, len(nodes))
+	for i, node := range nodes {
+		id, err := identity.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+		node.opt.identity = id
+	}
+	path, data := writeTestFile(t, 30000)
+
+	assetID, err := nodes[0].Upload(ctx, path)
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	if entry, err := nodes[0].ACL(assetID); err != nil || entry.Owner != ids[0].DID() {
+		t.Fatalf("上传后的访问控制为 %+v, %v", entry, err)
+	}
+
+	// 未获得授权的节点不能下载
+	dst := filepath.Join(t.TempDir(), "remote.bin")
+	if err := nodes[1].Download(ctx, assetID, dst); !errors.Is(err, acl.ErrDenied) {
+		t.Fatalf("未授权的节点下载返回 %v", err)
+	}
+
+	if _, err := nodes[0].Share(ctx, assetID, ids[1].DID(), acl.Read); err != nil {
+		t.Fatalf("分享失败: %v", err)
+	}
+	if err := nodes[1].Download(ctx, assetID, dst); err != nil {
+		t.Fatalf("获得授权的节点下载失败: %v", err)
+	}
+	if got, _ := os.ReadFile(dst); !bytes.Equal(got, data) {
+		t.Fatal("下载的内容与原文件不一致")
+	}
+	if err := nodes[2].Download(ctx, assetID, dst); !errors.Is(err, acl.ErrDenied) {
+		t.Fatalf("未授权的节点下载返回 %v", err)
+	}
+
+	// 存储节点只向有读取权限的请求者提供片段，凭证需由请求者为本次请求签名
+	attacker, err := network.NewNode("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		peerID    string
+		peerIndex int
+	)
+	for index, peers := range mustHolders(t, nodes[0], assetID) {
+		for _, peer := range peers {
+			if peer != "a" {
+				if _, err := attacker.FetchShard(ctx, peer, assetID, index, nil); !errors.Is(err, acl.ErrDenied) {
+					t.Fatalf("没有凭证的请求返回 %v", err)
+				}
+				forged := nodes[1].credential(peer, assetID, index)
+				forged.Signature = ids[2].Sign([]byte("forged"))
+				if _, err := attacker.FetchShard(ctx, peer, assetID, index, forged); !errors.Is(err, acl.ErrDenied) {
+					t.Fatalf("伪造凭证的请求返回 %v", err)
+				}
+				if _, err := attacker.FetchShard(ctx, peer, assetID, index, nodes[1].credential(peer, assetID, index)); err != nil {
+					t.Fatalf("获得授权的请求者获取片段失败: %v", err)
+				}
+				peerID, peerIndex = peer, index
+			}
+		}
+	}
+	if peerID == "" {
+		t.Fatal("没有其他节点持有片段")
+	}
+
+	// 宣告未经所有者签名的访问控制操作时，节点拒绝使用
+	ops, err := nodes[0].acl.Ops(assetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grant := acl.NewOp(&acl.Entry{AssetID: assetID, Version: uint64(len(ops))}, acl.ActionShare, []string{ids[2].DID()}, acl.Read)
+	grant.Sign(ids[2])
+	manifestData, err := sqlite.SelectManifestDatabase(nodes[0].db, assetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, _ := util.EncodeToBytes(&assetMeta{Manifest: manifestData, ACL: append(ops, grant)})
+	if err := attacker.Announce(ctx, &transport.Announcement{AssetID: assetID, Meta: meta}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodes[2].Download(ctx, assetID, dst); err == nil {
+		t.Fatal("宣告的访问控制操作未经验证")
+	}
+	if _, err := attacker.FetchShard(ctx, peerID, assetID, peerIndex, nodes[2].credential(peerID, assetID, peerIndex)); !errors.Is(err, acl.ErrDenied) {
+		t.Fatalf("存储节点使用了未经验证的访问控制操作: %v", err)
+	}
+	if err := nodes[0].reannounce(ctx, assetID); err != nil {
+		t.Fatal(err)
+	}
+
+	// 转让所有权后，原所有者不能再删除文件资产
+	if _, err := nodes[0].Transfer(ctx, assetID, ids[2].DID()); err != nil {
+		t.Fatalf("转让失败: %v", err)
+	}
+	if err := nodes[0].Delete(ctx, assetID); !errors.Is(err, acl.ErrDenied) {
+		t.Fatalf("原所有者删除返回 %v", err)
+	}
+	if err := nodes[2].Download(ctx, assetID, dst); err != nil {
+		t.Fatalf("新的所有者下载失败: %v", err)
+	}
+}
+
+func TestNetworkShareEncrypted(t *testing.T) {
+	ctx := context.Background()
+	network := transport.NewNetwork()
+	nodes := openNetworkFS(t, network, []string{"a", "b", "c"}, true)
+	ids := make([]*identity.Identity, len(nodes))
+	for i, node := range nodes {
+		id, err := identity.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+		node.opt.identity = id
+	}
+	nodes[0].opt.encryption = true
+	path, data := writeTestFile(t, 30000)
+
+	assetID, err := nodes[0].Upload(ctx, path)
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+
+	// 授予读取权限时同时封装数据密钥，被分享者可以下载并解密
+	if _, err := nodes[0].Share(ctx, assetID, ids[1].DID(), acl.Read); err != nil {
+		t.Fatalf("分享失败: %v", err)
+	}
+	dst := filepath.Join(t.TempDir(), "remote.bin")
+	if err := nodes[1].Download(ctx, assetID, dst); err != nil {
+		t.Fatalf("被分享者下载失败: %v", err)
+	}
+	if got, _ := os.ReadFile(dst); !bytes.Equal(got, data) {
+		t.Fatal("解密的内容与原文件不一致")
+	}
+
+	// 只授予写入权限时不封装数据密钥
+	if _, err := nodes[0].Share(ctx, assetID, ids[2].DID(), acl.Write); err != nil {
+		t.Fatalf("分享失败: %v", err)
+	}
+	m, err := nodes[0].localManifest(assetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.DataKey(ids[2]); err == nil {
+		t.Fatal("只有写入权限的身份获得了数据密钥")
+	}
+	keys := len(m.Keys)
+
+	// 共同所有者不是清单的所有者，不能封装数据密钥，分享失败且访问控制不变
+	entry, err := nodes[0].SetCoOwners(ctx, assetID, []string{ids[2].DID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := identity.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes[0].opt.identity = ids[2]
+	if _, err := nodes[0].Share(ctx, assetID, reader.DID(), acl.Read); err == nil {
+		t.Fatal("不是清单所有者的身份分享了数据密钥")
+	}
+	nodes[0].opt.identity = ids[0]
+	if after, _ := nodes[0].ACL(assetID); after.Version != entry.Version {
+		t.Fatalf("分享失败后访问控制的版本为 %d", after.Version)
+	}
+	if m, _ := nodes[0].localManifest(assetID); len(m.Keys) != keys {
+		t.Fatal("分享失败后清单发生了变化")
+	}
+}
+
+// mustHolders 查询文件资产各片段的持有节点
+func mustHolders(t *testing.T, fs *FS, assetID string) map[int][]string {
+	t.Helper()
+
+	holders, err := fs.transport.QueryHolders(context.Background(), assetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return holders.Peers
+}
+
+// assetIDOf 返回节点上传文件时得到的唯一标识
+func assetIDOf(t *testing.T, fs *FS, path string) string {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _, err := fs.signManifest(context.Background(), file, info, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assetID, err := m.AssetID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return assetID
+}
@@ -4,8 +4,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/bpfs/defs/core/acl"
+	"github.com/bpfs/defs/core/identity"
+	"github.com/bpfs/defs/core/pool"
+	"github.com/bpfs/defs/core/store"
+	"github.com/bpfs/defs/core/throttle"
+	"github.com/bpfs/defs/core/transport"
+	"github.com/bpfs/defs/core/worker"
 	"github.com/bpfs/defs/paths"
 )
 
@@ -19,42 +27,431 @@ const (
 	RS_Proportion                    // 纠删码(比例)模式
 )
 
+// storageModeNames 是存储模式的名称
+var storageModeNames = map[StorageMode]string{
+	FileMode:      "FileMode",
+	SliceMode:     "SliceMode",
+	RS_Size:       "RS_Size",
+	RS_Proportion: "RS_Proportion",
+}
+
+// String 返回存储模式的名称
+func (mode StorageMode) String() string {
+	if name, ok := storageModeNames[mode]; ok {
+		return name
+	}
+	return fmt.Sprintf("StorageMode(%d)", int(mode))
+}
+
+// ParseStorageMode 根据名称解析存储模式，名称不区分大小写
+func ParseStorageMode(name string) (StorageMode, error) {
+	for mode, modeName := range storageModeNames {
+		if strings.EqualFold(modeName, name) {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("未知的存储模式 %q", name)
+}
+
 // Options 是用于创建文件存储对象的参数
 type Options struct {
-	storageMode     StorageMode   // 存储模式
-	defaultBufSize  int64         // 常用缓冲区的大小(在 Go 标准库中，常常使用的缓冲区大小是 4096 或 8192 字节)
-	maxBufferSize   int64         // 最大缓冲区的大小
-	maxSliceSize    int64         // 最大片段的大小(文件大于最大片段的大小时，自动切换至'切片模式')
-	minSliceSize    int64         // 最小片段的大小(文件小于最小片段的大小时，自动切换至'文件模式')
-	dataShards      int64         // 数据片段的数量
-	parityShards    int64         // 奇偶校验片段的数量
-	shardSize       int64         // 文件片段的大小
-	parityRatio     float64       // 奇偶校验片段占比(根据文件大小计算并向上取整)
-	rootPath        string        // 根路径
-	downloadPath    string        // 下载路径
-	maxRetries      int64         // 最大重试次数
-	retryInterval   time.Duration // 重试间隔
-	localStorage    bool          // 是否开启本地存储，上传成功后保留本地文件片段
-	routingTableLow int64         // 路由表中连接的最小节点数量
+	storageMode      StorageMode   // 存储模式
+	defaultBufSize   int64         // 常用缓冲区的大小(在 Go 标准库中，常常使用的缓冲区大小是 4096 或 8192 字节)
+	maxBufferSize    int64         // 最大缓冲区的大小(文件片段存储不支持流式写入时，上传文件的大小上限)
+	maxSliceSize     int64         // 最大片段的大小(文件大于最大片段的大小时，自动切换至'切片模式')
+	minSliceSize     int64         // 最小片段的大小(文件小于最小片段的大小时，自动切换至'文件模式')
+	dataShards       int64         // 数据片段的数量
+	parityShards     int64         // 奇偶校验片段的数量
+	shardSize        int64         // 文件片段的大小
+	parityRatio      float64       // 奇偶校验片段占比(根据文件大小计算并向上取整)
+	rootPath         string        // 根路径
+	downloadPath     string        // 下载路径
+	maxRetries       int64         // 每个文件片段的最大重试次数
+	retryInterval    time.Duration // 首次重试的间隔，之后按指数退避
+	maxRetryInterval time.Duration // 重试间隔的上限
+	localStorage     bool          // 是否开启本地存储，上传成功后保留本地文件片段
+	routingTableLow  int64         // 路由表中连接的最小节点数量
+
+	maxConcurrency     int64 // 同时进行的片段传输总数
+	maxTaskConcurrency int64 // 单个任务同时进行的片段传输数
+	maxPeerConcurrency int64 // 与单个节点同时进行的片段传输数
+	maxStatementJobs   int64 // 同时执行的异步语句任务数
+
+	uploadRate   int64             // 全局上传速率(字节/秒)，0 表示不限速
+	downloadRate int64             // 全局下载速率(字节/秒)，0 表示不限速
+	rateSchedule throttle.Schedule // 按一天中的时刻调整全局速率
+
+	scrubRate     int64         // 巡检本地文件片段的读取速率(字节/秒)，0 表示不限速
+	scrubInterval time.Duration // 两轮巡检的间隔，0 表示不定期巡检
+
+	repairSpare    int64         // 可用片段超出数据片段数量的最小余量，低于时重建丢失的片段，0 或超过奇偶校验片段的数量时任何片段丢失都重建
+	repairInterval time.Duration // 两轮检查文件资产持有情况的间隔，0 表示不定期检查
+
+	shardStore store.ShardStore    // 文件片段存储(为空时使用根路径下的段文件存储)
+	transport  transport.Transport // 节点间传输(为空时仅使用本地存储)
+	encryption bool                // 上传的文件是否在分片前加密
+
+	identity  *identity.Identity // 本节点操作文件资产的身份(为空时上传的文件资产不记录所有者，清单由节点的身份签名)
+	aclPolicy acl.Policy         // 变更共同所有者和转让所有权时要求的签名策略
 }
 
 // DefaultOptions 设置一个推荐选项列表以获得良好的性能。
 func DefaultOptions() *Options {
 	return &Options{
-		storageMode:     RS_Proportion,               // 纠删码(比例)模式
-		defaultBufSize:  1 << 12,                     // 4KB
-		maxBufferSize:   1 << 30,                     // 1GB
-		maxSliceSize:    1 << 25,                     // 32M
-		minSliceSize:    1 << 10,                     // 1KB
-		shardSize:       1 << 19,                     // 512KB
-		parityRatio:     0.3,                         // 30%
-		rootPath:        paths.RootPath,              // 默认根路径
-		downloadPath:    paths.DefaultDownloadPath(), // 默认下载路径
-		maxRetries:      5,                           // 最大重试次数
-		retryInterval:   50 * time.Second,            // 重试间隔为50秒
-		localStorage:    true,                        // 默认开启本地存储
-		routingTableLow: 2,                           // 路由表中连接的最小连接2个节点
+		storageMode:      RS_Proportion,               // 纠删码(比例)模式
+		defaultBufSize:   1 << 12,                     // 4KB
+		maxBufferSize:    1 << 30,                     // 1GB
+		maxSliceSize:     1 << 25,                     // 32M
+		minSliceSize:     1 << 10,                     // 1KB
+		shardSize:        1 << 19,                     // 512KB
+		parityRatio:      0.3,                         // 30%
+		rootPath:         paths.RootPath,              // 默认根路径
+		downloadPath:     paths.DefaultDownloadPath(), // 默认下载路径
+		maxRetries:       5,                           // 最大重试次数
+		retryInterval:    2 * time.Second,             // 首次重试间隔为2秒
+		maxRetryInterval: 5 * time.Minute,             // 重试间隔最长为5分钟
+		localStorage:     true,                        // 默认开启本地存储
+		routingTableLow:  2,                           // 路由表中连接的最小连接2个节点
+
+		maxConcurrency:     16, // 同时进行16个片段传输
+		maxTaskConcurrency: 4,  // 每个任务同时进行4个片段传输
+		maxPeerConcurrency: 2,  // 与每个节点同时进行2个片段传输
+		maxStatementJobs:   4,  // 同时执行4个异步语句任务
+
+		scrubRate:     4 << 20,        // 巡检以4MB/s读取本地文件片段
+		scrubInterval: 24 * time.Hour, // 每天巡检一轮
+
+		repairInterval: time.Hour, // 每小时检查一轮文件资产的持有情况
+
+		aclPolicy: acl.Policy{Mode: acl.PolicyAll}, // 所有者和全部共同所有者都签名
+	}
+}
+
+// Option 用于设置文件存储选项中的一项
+type Option func(*Options)
+
+// NewOptions 在默认选项的基础上依次应用 opts，并校验最终的选项
+func NewOptions(opts ...Option) (*Options, error) {
+	opt := DefaultOptions()
+	for _, o := range opts {
+		o(opt)
+	}
+
+	if err := opt.Validate(); err != nil {
+		return nil, err
+	}
+
+	return opt, nil
+}
+
+// WithStorageMode 设置存储模式
+func WithStorageMode(mode StorageMode) Option {
+	return func(opt *Options) { opt.storageMode = mode }
+}
+
+// WithDefaultBufSize 设置常用缓冲区的大小
+func WithDefaultBufSize(size int64) Option {
+	return func(opt *Options) { opt.defaultBufSize = size }
+}
+
+// WithMaxBufferSize 设置最大缓冲区的大小，文件片段存储不支持流式写入时限制上传文件的大小
+func WithMaxBufferSize(size int64) Option {
+	return func(opt *Options) { opt.maxBufferSize = size }
+}
+
+// WithMaxSliceSize 设置最大片段的大小
+func WithMaxSliceSize(size int64) Option {
+	return func(opt *Options) { opt.maxSliceSize = size }
+}
+
+// WithMinSliceSize 设置最小片段的大小
+func WithMinSliceSize(size int64) Option {
+	return func(opt *Options) { opt.minSliceSize = size }
+}
+
+// WithDataShards 设置数据片段的数量
+func WithDataShards(n int64) Option {
+	return func(opt *Options) { opt.dataShards = n }
+}
+
+// WithParityShards 设置奇偶校验片段的数量
+func WithParityShards(n int64) Option {
+	return func(opt *Options) { opt.parityShards = n }
+}
+
+// WithShardSize 设置文件片段的大小
+func WithShardSize(size int64) Option {
+	return func(opt *Options) { opt.shardSize = size }
+}
+
+// WithParityRatio 设置奇偶校验片段占比
+func WithParityRatio(ratio float64) Option {
+	return func(opt *Options) { opt.parityRatio = ratio }
+}
+
+// WithRootPath 设置根路径
+func WithRootPath(path string) Option {
+	return func(opt *Options) { opt.rootPath = path }
+}
+
+// WithDownloadPath 设置下载路径
+func WithDownloadPath(path string) Option {
+	return func(opt *Options) { opt.downloadPath = path }
+}
+
+// WithMaxRetries 设置最大重试次数
+func WithMaxRetries(n int64) Option {
+	return func(opt *Options) { opt.maxRetries = n }
+}
+
+// WithRetryInterval 设置首次重试的间隔
+func WithRetryInterval(interval time.Duration) Option {
+	return func(opt *Options) { opt.retryInterval = interval }
+}
+
+// WithMaxRetryInterval 设置重试间隔的上限
+func WithMaxRetryInterval(interval time.Duration) Option {
+	return func(opt *Options) { opt.maxRetryInterval = interval }
+}
+
+// WithMaxConcurrency 设置同时进行的片段传输总数，为 0 时不限制
+func WithMaxConcurrency(n int64) Option {
+	return func(opt *Options) { opt.maxConcurrency = n }
+}
+
+// WithMaxTaskConcurrency 设置单个任务同时进行的片段传输数，为 0 时不限制
+func WithMaxTaskConcurrency(n int64) Option {
+	return func(opt *Options) { opt.maxTaskConcurrency = n }
+}
+
+// WithMaxPeerConcurrency 设置与单个节点同时进行的片段传输数，为 0 时不限制
+func WithMaxPeerConcurrency(n int64) Option {
+	return func(opt *Options) { opt.maxPeerConcurrency = n }
+}
+
+// WithMaxStatementJobs 设置同时执行的异步语句任务数，为 0 时不限制
+// 异步语句任务不占用片段传输的并发名额，超出时排队等待
+func WithMaxStatementJobs(n int64) Option {
+	return func(opt *Options) { opt.maxStatementJobs = n }
+}
+
+// WithUploadRate 设置全局上传速率(字节/秒)，为 0 时不限速
+func WithUploadRate(rate int64) Option {
+	return func(opt *Options) { opt.uploadRate = rate }
+}
+
+// WithDownloadRate 设置全局下载速率(字节/秒)，为 0 时不限速
+func WithDownloadRate(rate int64) Option {
+	return func(opt *Options) { opt.downloadRate = rate }
+}
+
+// WithRateSchedule 设置按一天中的时刻调整全局速率的规则
+func WithRateSchedule(schedule throttle.Schedule) Option {
+	return func(opt *Options) { opt.rateSchedule = schedule }
+}
+
+// WithScrubRate 设置巡检本地文件片段的读取速率(字节/秒)，为 0 时不限速
+func WithScrubRate(rate int64) Option {
+	return func(opt *Options) { opt.scrubRate = rate }
+}
+
+// WithScrubInterval 设置两轮巡检的间隔，为 0 时不定期巡检
+func WithScrubInterval(interval time.Duration) Option {
+	return func(opt *Options) { opt.scrubInterval = interval }
+}
+
+// WithRepairSpare 设置可用片段超出数据片段数量的最小余量，低于时重建丢失的片段，为 0 时任何片段丢失都重建
+func WithRepairSpare(spare int64) Option {
+	return func(opt *Options) { opt.repairSpare = spare }
+}
+
+// WithRepairInterval 设置两轮检查文件资产持有情况的间隔，为 0 时不定期检查
+func WithRepairInterval(interval time.Duration) Option {
+	return func(opt *Options) { opt.repairInterval = interval }
+}
+
+// WithLocalStorage 设置是否开启本地存储
+func WithLocalStorage(isEnable bool) Option {
+	return func(opt *Options) { opt.localStorage = isEnable }
+}
+
+// WithRoutingTableLow 设置路由表中连接的最小节点数量
+func WithRoutingTableLow(low int64) Option {
+	return func(opt *Options) { opt.routingTableLow = low }
+}
+
+// WithShardStore 设置文件片段存储
+func WithShardStore(s store.ShardStore) Option {
+	return func(opt *Options) { opt.shardStore = s }
+}
+
+// WithTransport 设置节点间传输
+func WithTransport(t transport.Transport) Option {
+	return func(opt *Options) { opt.transport = t }
+}
+
+// WithEncryption 设置上传的文件是否在分片前加密，数据密钥为清单的所有者封装
+func WithEncryption(enabled bool) Option {
+	return func(opt *Options) { opt.encryption = enabled }
+}
+
+// WithIdentity 设置本节点操作文件资产的身份，上传的文件资产以其为所有者
+func WithIdentity(id *identity.Identity) Option {
+	return func(opt *Options) { opt.identity = id }
+}
+
+// WithACLPolicy 设置变更共同所有者和转让所有权时要求的签名策略
+func WithACLPolicy(policy acl.Policy) Option {
+	return func(opt *Options) { opt.aclPolicy = policy }
+}
+
+// ValidationError 描述一项选项的校验错误
+type ValidationError struct {
+	Field   string // 选项名称
+	Message string // 错误描述
+}
+
+// Error 实现 error 接口
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationErrors 汇总选项校验发现的全部错误
+type ValidationErrors []*ValidationError
+
+// Error 实现 error 接口
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
 	}
+	return fmt.Sprintf("选项校验失败: %s", strings.Join(msgs, "; "))
+}
+
+// Unwrap 返回每一项校验错误，用于 errors.As 查找
+func (errs ValidationErrors) Unwrap() []error {
+	list := make([]error, 0, len(errs))
+	for _, err := range errs {
+		list = append(list, err)
+	}
+	return list
+}
+
+// Validate 校验选项，返回发现的全部问题，没有问题时返回 nil
+func (opt *Options) Validate() error {
+	var errs ValidationErrors
+	addf := func(field, format string, args ...interface{}) {
+		errs = append(errs, &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if _, ok := storageModeNames[opt.storageMode]; !ok {
+		addf("storageMode", "未知的存储模式 %d", opt.storageMode)
+	}
+	if opt.defaultBufSize <= 0 {
+		addf("defaultBufSize", "常用缓冲区的大小 %d 必须大于 0", opt.defaultBufSize)
+	}
+	if opt.maxBufferSize <= 0 {
+		addf("maxBufferSize", "最大缓冲区的大小 %d 必须大于 0", opt.maxBufferSize)
+	}
+
+	// 片段大小的范围
+	if opt.maxSliceSize > 1<<25 {
+		addf("maxSliceSize", "最大片段的大小 %d 不可大于 %d", opt.maxSliceSize, 1<<25)
+	}
+	if opt.minSliceSize < 1<<10 {
+		addf("minSliceSize", "最小片段的大小 %d 不可小于 %d", opt.minSliceSize, 1<<10)
+	}
+	if opt.minSliceSize > opt.maxSliceSize {
+		addf("minSliceSize", "最小片段的大小 %d 不可大于最大片段的大小 %d", opt.minSliceSize, opt.maxSliceSize)
+	}
+	if opt.shardSize < opt.minSliceSize || opt.shardSize > opt.maxSliceSize {
+		addf("shardSize", "文件片段的大小 %d 必须介于 %d 和 %d 之间", opt.shardSize, opt.minSliceSize, opt.maxSliceSize)
+	}
+
+	// 奇偶校验片段不超过数据片段的一半，以防止过多的冗余
+	if opt.parityRatio < 0 || opt.parityRatio > 0.5 {
+		addf("parityRatio", "奇偶校验片段占比 %v 必须介于 0 和 0.5 之间", opt.parityRatio)
+	}
+	switch opt.storageMode {
+	case RS_Size:
+		if opt.dataShards <= 0 {
+			addf("dataShards", "数据片段的数量 %d 必须大于 0", opt.dataShards)
+		}
+		if opt.parityShards <= 0 {
+			addf("parityShards", "奇偶校验片段的数量 %d 必须大于 0", opt.parityShards)
+		} else if opt.parityShards > opt.dataShards/2 {
+			addf("parityShards", "奇偶校验片段的数量 %d 不可大于数据片段数量 %d 的一半", opt.parityShards, opt.dataShards)
+		}
+		if opt.dataShards+opt.parityShards > maxTotalShards {
+			addf("dataShards", "片段总数 %d 不可大于 %d", opt.dataShards+opt.parityShards, maxTotalShards)
+		}
+	case RS_Proportion:
+		if opt.parityRatio == 0 {
+			addf("parityRatio", "纠删码(比例)模式下奇偶校验片段占比不可为 0")
+		}
+	}
+
+	if opt.rootPath == "" {
+		addf("rootPath", "根路径不可为空")
+	}
+	if opt.downloadPath == "" {
+		addf("downloadPath", "下载路径不可为空")
+	}
+	if opt.maxRetries < 0 {
+		addf("maxRetries", "最大重试次数 %d 不可小于 0", opt.maxRetries)
+	}
+	if opt.retryInterval < 0 {
+		addf("retryInterval", "重试间隔 %v 不可小于 0", opt.retryInterval)
+	}
+	if opt.maxRetryInterval < 0 {
+		addf("maxRetryInterval", "重试间隔的上限 %v 不可小于 0", opt.maxRetryInterval)
+	} else if opt.maxRetryInterval > 0 && opt.maxRetryInterval < opt.retryInterval {
+		addf("maxRetryInterval", "重试间隔的上限 %v 不可小于首次重试的间隔 %v", opt.maxRetryInterval, opt.retryInterval)
+	}
+	if opt.routingTableLow < 0 {
+		addf("routingTableLow", "路由表中连接的最小节点数量 %d 不可小于 0", opt.routingTableLow)
+	}
+	if opt.maxConcurrency < 0 {
+		addf("maxConcurrency", "同时进行的片段传输总数 %d 不可小于 0", opt.maxConcurrency)
+	}
+	if opt.maxTaskConcurrency < 0 {
+		addf("maxTaskConcurrency", "单个任务同时进行的片段传输数 %d 不可小于 0", opt.maxTaskConcurrency)
+	}
+	if opt.maxPeerConcurrency < 0 {
+		addf("maxPeerConcurrency", "与单个节点同时进行的片段传输数 %d 不可小于 0", opt.maxPeerConcurrency)
+	}
+	if opt.maxStatementJobs < 0 {
+		addf("maxStatementJobs", "同时执行的异步语句任务数 %d 不可小于 0", opt.maxStatementJobs)
+	}
+	if opt.uploadRate < 0 {
+		addf("uploadRate", "上传速率 %d 不可小于 0", opt.uploadRate)
+	}
+	if opt.downloadRate < 0 {
+		addf("downloadRate", "下载速率 %d 不可小于 0", opt.downloadRate)
+	}
+	if err := opt.rateSchedule.Validate(); err != nil {
+		addf("rateSchedule", "%v", err)
+	}
+	if opt.scrubRate < 0 {
+		addf("scrubRate", "巡检的读取速率 %d 不可小于 0", opt.scrubRate)
+	}
+	if opt.scrubInterval < 0 {
+		addf("scrubInterval", "巡检的间隔 %v 不可小于 0", opt.scrubInterval)
+	}
+	if opt.repairSpare < 0 {
+		addf("repairSpare", "片段的最小余量 %d 不可小于 0", opt.repairSpare)
+	}
+	if opt.repairInterval < 0 {
+		addf("repairInterval", "检查持有情况的间隔 %v 不可小于 0", opt.repairInterval)
+	}
+	if err := opt.aclPolicy.Validate(); err != nil {
+		addf("aclPolicy", "%v", err)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
 }
 
 // BuildShardsOptions 设置奇偶分片大小选项
@@ -106,16 +503,16 @@ func (opt *Options) BuildSizeAndRatioOptions(shardSize int64, parityRatio float6
 		return fmt.Errorf("奇偶校验片段占比 %f 过大", parityRatio)
 	}
 
-	opt.storageMode = RS_Size     // 比例模式
-	opt.shardSize = shardSize     // 文件片段的大小
-	opt.parityRatio = parityRatio // 奇偶校验片段占比
+	opt.storageMode = RS_Proportion // 比例模式
+	opt.shardSize = shardSize       // 文件片段的大小
+	opt.parityRatio = parityRatio   // 奇偶校验片段占比
 
 	return nil
 }
 
 // GetSizeAndRatioOptions 获取奇偶分片比例选项
 func (opt *Options) GetSizeAndRatioOptions() (int64, float64, bool) {
-	if opt.storageMode == RS_Size {
+	if opt.storageMode == RS_Proportion {
 		return opt.shardSize, opt.parityRatio, true
 	}
 	return 0, 0, false
@@ -135,7 +532,7 @@ func (opt *Options) BuildMaxSliceSize(maxSliceSize int64) error {
 // BuildMinSliceSize 设置最小切片的大小
 func (opt *Options) BuildMinSliceSize(minSliceSize int64) error {
 	if minSliceSize < 1<<10 { // 1KB
-		return fmt.Errorf("最大切片的大小 %d 不可小于 %d", minSliceSize, 1<<10)
+		return fmt.Errorf("最小切片的大小 %d 不可小于 %d", minSliceSize, 1<<10)
 	}
 
 	opt.minSliceSize = minSliceSize
@@ -143,6 +540,104 @@ func (opt *Options) BuildMinSliceSize(minSliceSize int64) error {
 	return nil
 }
 
+// BuildRetryOptions 设置失败片段的最大重试次数、首次重试的间隔和重试间隔的上限
+func (opt *Options) BuildRetryOptions(maxRetries int64, interval, maxInterval time.Duration) error {
+	if maxRetries < 0 {
+		return fmt.Errorf("最大重试次数 %d 不可小于 0", maxRetries)
+	}
+	if interval < 0 || maxInterval < 0 {
+		return fmt.Errorf("重试间隔不可小于 0")
+	}
+	if maxInterval > 0 && maxInterval < interval {
+		return fmt.Errorf("重试间隔的上限 %v 不可小于首次重试的间隔 %v", maxInterval, interval)
+	}
+
+	opt.maxRetries = maxRetries
+	opt.retryInterval = interval
+	opt.maxRetryInterval = maxInterval
+
+	return nil
+}
+
+// retryPolicy 根据选项创建失败片段的重试策略
+func (opt *Options) retryPolicy() pool.RetryPolicy {
+	policy := pool.DefaultRetryPolicy()
+	policy.MaxRetries = int(opt.maxRetries)
+	policy.BaseInterval = opt.retryInterval
+	policy.MaxInterval = opt.maxRetryInterval
+
+	return policy
+}
+
+// BuildConcurrencyOptions 设置片段传输的总并发数、单个任务和单个节点的并发数，为 0 时不限制
+func (opt *Options) BuildConcurrencyOptions(global, perTask, perPeer int64) error {
+	if global < 0 || perTask < 0 || perPeer < 0 {
+		return fmt.Errorf("并发数不可小于 0")
+	}
+
+	opt.maxConcurrency = global
+	opt.maxTaskConcurrency = perTask
+	opt.maxPeerConcurrency = perPeer
+
+	return nil
+}
+
+// workerLimits 根据选项创建片段传输的并发限制
+func (opt *Options) workerLimits() worker.Limits {
+	return worker.Limits{
+		Global:   int(opt.maxConcurrency),
+		PerTask:  int(opt.maxTaskConcurrency),
+		PerPeer:  int(opt.maxPeerConcurrency),
+		Detached: int(opt.maxStatementJobs),
+	}
+}
+
+// BuildRateOptions 设置全局上传和下载速率(字节/秒)及按时刻调整速率的规则，速率为 0 时不限速
+func (opt *Options) BuildRateOptions(uploadRate, downloadRate int64, schedule throttle.Schedule) error {
+	if uploadRate < 0 || downloadRate < 0 {
+		return fmt.Errorf("速率不可小于 0")
+	}
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+
+	opt.uploadRate = uploadRate
+	opt.downloadRate = downloadRate
+	opt.rateSchedule = schedule
+
+	return nil
+}
+
+// BuildScrubOptions 设置巡检本地文件片段的读取速率(字节/秒)和两轮巡检的间隔
+func (opt *Options) BuildScrubOptions(rate int64, interval time.Duration) error {
+	if rate < 0 {
+		return fmt.Errorf("巡检的读取速率不可小于 0")
+	}
+	if interval < 0 {
+		return fmt.Errorf("巡检的间隔不可小于 0")
+	}
+
+	opt.scrubRate = rate
+	opt.scrubInterval = interval
+
+	return nil
+}
+
+// BuildRepairOptions 设置重建丢失片段的最小余量和两轮检查文件资产持有情况的间隔
+func (opt *Options) BuildRepairOptions(spare int64, interval time.Duration) error {
+	if spare < 0 {
+		return fmt.Errorf("片段的最小余量不可小于 0")
+	}
+	if interval < 0 {
+		return fmt.Errorf("检查持有情况的间隔不可小于 0")
+	}
+
+	opt.repairSpare = spare
+	opt.repairInterval = interval
+
+	return nil
+}
+
 // BuildLocalStorage 设置是否启动本地存储选项
 func (opt *Options) BuildLocalStorage(isEnable bool) {
 	opt.localStorage = isEnable
@@ -155,52 +650,55 @@ func (opt *Options) BuildRoutingTableLow(low int64) {
 	}
 }
 
-// BuildRootPath 设置文件根路径
-func (opt *Options) BuildRootPath(path string) {
-	// 检查路径是否为空
-	if path == "" {
-		return
-	}
+// BuildShardStore 设置文件片段存储
+func (opt *Options) BuildShardStore(s store.ShardStore) {
+	opt.shardStore = s
+}
 
-	// 检查路径是否是一个绝对路径
-	if !filepath.IsAbs(path) {
-		// 可以返回错误或记录日志
-		return
-	}
+// BuildTransport 设置节点间传输
+func (opt *Options) BuildTransport(t transport.Transport) {
+	opt.transport = t
+}
 
-	// 检查路径是否存在
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		// 如果路径不存在，尝试创建它
-		if err := os.MkdirAll(path, 0755); err != nil {
-			return
-		}
+// BuildRootPath 设置文件根路径，相对路径将转换为绝对路径
+func (opt *Options) BuildRootPath(path string) error {
+	path, err := preparePath(path)
+	if err != nil {
+		return fmt.Errorf("设置根路径失败: %v", err)
 	}
 
-	// 设置根路径
 	opt.rootPath = path
+	return nil
+}
+
+// BuildDownloadPath 设置下载路径，相对路径将转换为绝对路径
+func (opt *Options) BuildDownloadPath(path string) error {
+	path, err := preparePath(path)
+	if err != nil {
+		return fmt.Errorf("设置下载路径失败: %v", err)
+	}
+
+	opt.downloadPath = path
+	return nil
 }
 
-// BuildDownloadPath 设置下载路径
-func (opt *Options) BuildDownloadPath(path string) {
+// preparePath 将路径转换为绝对路径，路径不存在时创建它
+func preparePath(path string) (string, error) {
 	// 检查路径是否为空
 	if path == "" {
-		return
+		return "", fmt.Errorf("路径不可为空")
 	}
 
-	// 检查路径是否是一个绝对路径
-	if !filepath.IsAbs(path) {
-		// 可以返回错误或记录日志
-		return
+	// 相对路径转换为绝对路径
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
 	}
 
-	// 检查路径是否存在
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		// 如果路径不存在，尝试创建它
-		if err := os.MkdirAll(path, 0755); err != nil {
-			return
-		}
+	// 如果路径不存在，尝试创建它
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return "", err
 	}
 
-	// 设置下载路径
-	opt.downloadPath = path
+	return path, nil
 }
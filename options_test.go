@@ -0,0 +1,165 @@
+package defs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDefaultOptionsValid(t *testing.T) {
+	if err := DefaultOptions().Validate(); err != nil {
+		t.Fatalf("默认选项校验失败: %v", err)
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	opt, err := NewOptions(
+		WithStorageMode(RS_Size),
+		WithDataShards(8),
+		WithParityShards(3),
+		WithRetryInterval(time.Second),
+	)
+	if err != nil {
+		t.Fatalf("创建选项失败: %v", err)
+	}
+	if d, p, ok := opt.GetShardsOptions(); !ok || d != 8 || p != 3 {
+		t.Fatalf("奇偶分片选项为 %d, %d, %v", d, p, ok)
+	}
+	if opt.retryInterval != time.Second {
+		t.Fatalf("重试间隔为 %v", opt.retryInterval)
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	_, err := NewOptions(
+		WithStorageMode(RS_Size),
+		WithDataShards(4),
+		WithParityShards(3),
+		WithShardSize(100),
+		WithRootPath(""),
+	)
+
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("应当返回 ValidationErrors, 实际为 %v", err)
+	}
+
+	fields := make(map[string]bool)
+	for _, e := range errs {
+		fields[e.Field] = true
+	}
+	for _, field := range []string{"parityShards", "shardSize", "rootPath"} {
+		if !fields[field] {
+			t.Errorf("缺少选项 %s 的校验错误: %v", field, err)
+		}
+	}
+
+	var one *ValidationError
+	if !errors.As(err, &one) {
+		t.Fatal("errors.As 应当能够取出单项校验错误")
+	}
+}
+
+func TestBuildSizeAndRatioOptions(t *testing.T) {
+	opt := DefaultOptions()
+	opt.storageMode = RS_Size
+	if err := opt.BuildSizeAndRatioOptions(1<<20, 0.25); err != nil {
+		t.Fatal(err)
+	}
+	if opt.storageMode != RS_Proportion {
+		t.Fatalf("存储模式应当为 RS_Proportion, 实际为 %v", opt.storageMode)
+	}
+	if size, ratio, ok := opt.GetSizeAndRatioOptions(); !ok || size != 1<<20 || ratio != 0.25 {
+		t.Fatalf("奇偶分片比例选项为 %d, %v, %v", size, ratio, ok)
+	}
+}
+
+func TestBuildRootPath(t *testing.T) {
+	opt := DefaultOptions()
+	if err := opt.BuildRootPath(""); err == nil {
+		t.Fatal("空路径应当返回错误")
+	}
+
+	path := filepath.Join(t.TempDir(), "root")
+	if err := opt.BuildRootPath(path); err != nil {
+		t.Fatal(err)
+	}
+	if opt.rootPath != path {
+		t.Fatalf("根路径为 %s", opt.rootPath)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("根路径应当已创建: %v", err)
+	}
+}
+
+func TestLoadOptions(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlPath := filepath.Join(dir, "defs.yaml")
+	yamlData := "storage_mode: rs_size\ndata_shards: 6\nparity_shards: 2\nretry_interval: 10s\nlocal_storage: false\n"
+	if err := os.WriteFile(yamlPath, []byte(yamlData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opt, err := LoadOptions(yamlPath, WithMaxRetries(9))
+	if err != nil {
+		t.Fatalf("加载 YAML 配置失败: %v", err)
+	}
+	if opt.storageMode != RS_Size || opt.dataShards != 6 || opt.parityShards != 2 {
+		t.Fatalf("YAML 配置的分片选项为 %v, %d, %d", opt.storageMode, opt.dataShards, opt.parityShards)
+	}
+	if opt.retryInterval != 10*time.Second || opt.localStorage || opt.maxRetries != 9 {
+		t.Fatalf("YAML 配置的选项为 %v, %v, %d", opt.retryInterval, opt.localStorage, opt.maxRetries)
+	}
+
+	// 限速规则的时刻按 HH:MM 解析
+	ratePath := filepath.Join(dir, "rate.yaml")
+	rateData := "upload_rate: 1048576\nrate_schedule:\n  - start: \"22:00\"\n    end: \"06:00\"\n    download_rate: 2048\n"
+	if err := os.WriteFile(ratePath, []byte(rateData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opt, err = LoadOptions(ratePath)
+	if err != nil {
+		t.Fatalf("加载限速配置失败: %v", err)
+	}
+	if opt.uploadRate != 1<<20 || len(opt.rateSchedule) != 1 {
+		t.Fatalf("限速配置为 %d, %+v", opt.uploadRate, opt.rateSchedule)
+	}
+	if rule := opt.rateSchedule[0]; rule.Start != 22*time.Hour || rule.End != 6*time.Hour || rule.Download != 2048 {
+		t.Fatalf("限速规则为 %+v", rule)
+	}
+	if err := os.WriteFile(ratePath, []byte("rate_schedule:\n  - start: \"25:00\"\n    end: \"06:00\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadOptions(ratePath); err == nil {
+		t.Fatal("无效的时刻应当返回错误")
+	}
+
+	jsonPath := filepath.Join(dir, "defs.json")
+	if err := os.WriteFile(jsonPath, []byte(`{"shard_size": 2048, "parity_ratio": 0.2, "acl_policy": "quorum:2"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opt, err = LoadOptions(jsonPath)
+	if err != nil {
+		t.Fatalf("加载 JSON 配置失败: %v", err)
+	}
+	if opt.shardSize != 2048 || opt.parityRatio != 0.2 || opt.aclPolicy.String() != "quorum:2" {
+		t.Fatalf("JSON 配置的选项为 %d, %v, %v", opt.shardSize, opt.parityRatio, opt.aclPolicy)
+	}
+
+	// 未知的配置项和不合法的选项均返回错误
+	if err := os.WriteFile(jsonPath, []byte(`{"shard_sise": 2048}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadOptions(jsonPath); err == nil {
+		t.Fatal("未知的配置项应当返回错误")
+	}
+	if err := os.WriteFile(yamlPath, []byte("parity_ratio: 0.9\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var errs ValidationErrors
+	if _, err := LoadOptions(yamlPath); !errors.As(err, &errs) {
+		t.Fatalf("不合法的选项应当返回 ValidationErrors, 实际为 %v", err)
+	}
+}
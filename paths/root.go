@@ -17,9 +17,10 @@ var (
 	RootPath = filepath.Join(ObtainRootPath(), "defsdata")
 
 	// 二级目录
-	Files = filepath.Join(RootPath, "files") // 文件目录
-	DB    = filepath.Join(RootPath, "db")    // 数据库目录
-	Logs  = filepath.Join(RootPath, "logs")  // 日志目录
+	Files    = filepath.Join(RootPath, "files")    // 文件目录
+	DB       = filepath.Join(RootPath, "db")       // 数据库目录
+	Logs     = filepath.Join(RootPath, "logs")     // 日志目录
+	Keystore = filepath.Join(RootPath, "keystore") // 密钥库目录
 
 	// 三级目录
 	UploadPath     = filepath.Join(Files, "uploads")   // 上传目录
@@ -0,0 +1,124 @@
+package defs
+
+import (
+	"math"
+
+	"github.com/bpfs/defs/core/erasure"
+)
+
+// maxTotalShards 是不依赖大分片编码时，数据片段与奇偶校验片段之和的上限
+const maxTotalShards = 256
+
+// maxStripeSize 是流式编码时一个条带的大小上限，编码和恢复文件时只保留一个条带的数据
+const maxStripeSize = 4 << 20
+
+// StoragePlan 描述文件实际采用的存储方式
+type StoragePlan struct {
+	Mode         StorageMode // 实际的存储模式
+	DataShards   int         // 数据片段的数量
+	ParityShards int         // 奇偶校验片段的数量
+	ShardSize    int64       // 每个文件片段的大小
+}
+
+// TotalShards 返回文件片段的总数
+func (p StoragePlan) TotalShards() int {
+	return p.DataShards + p.ParityShards
+}
+
+// Erasure 返回按条带流式编码时使用的分片方式
+func (p StoragePlan) Erasure() erasure.Plan {
+	return erasure.Plan{
+		DataShards:   p.DataShards,
+		ParityShards: p.ParityShards,
+		BlockSize:    stripeBlockSize(p.DataShards),
+	}
+}
+
+// stripeBlockSize 返回条带中每个块的大小，只取决于数据片段的数量，所有节点得到相同的结果
+func stripeBlockSize(dataShards int) int {
+	return ceilDiv(maxStripeSize, int64(dataShards))
+}
+
+// PlanStorage 根据文件大小和选项计算文件的存储方式
+// 文件小于最小片段的大小时使用文件模式，大于最大片段的大小时使用切片模式，否则使用选项中的存储模式
+// 计算只使用整数运算，所有节点对相同大小的文件得到相同的结果
+func PlanStorage(size int64, opt *Options) StoragePlan {
+	if size <= 0 {
+		return StoragePlan{Mode: FileMode, DataShards: 1}
+	}
+
+	mode := opt.storageMode
+	switch {
+	case size < opt.minSliceSize:
+		mode = FileMode
+	case opt.maxSliceSize > 0 && size > opt.maxSliceSize:
+		mode = SliceMode
+	}
+
+	plan := StoragePlan{Mode: mode}
+	switch mode {
+	case FileMode:
+		// 文件模式，整个文件作为一个片段
+		plan.DataShards = 1
+
+	case SliceMode:
+		// 切片模式，按片段大小分割，不使用纠删码
+		plan.DataShards = ceilDiv(size, opt.shardSize)
+
+	case RS_Size:
+		// 纠删码(大小)模式，片段数量固定
+		plan.DataShards = int(opt.dataShards)
+		plan.ParityShards = int(opt.parityShards)
+
+	default:
+		// 纠删码(比例)模式，按片段大小分割，奇偶校验片段按比例向上取整
+		plan.DataShards = ceilDiv(size, opt.shardSize)
+		plan.ParityShards = parityCount(plan.DataShards, opt.parityRatio)
+	}
+
+	if plan.DataShards < 1 {
+		plan.DataShards = 1
+	}
+	if plan.ParityShards < 0 {
+		plan.ParityShards = 0
+	}
+	if int64(plan.DataShards) > size {
+		plan.DataShards = int(size)
+		if mode == RS_Proportion {
+			plan.ParityShards = parityCount(plan.DataShards, opt.parityRatio)
+		}
+	}
+
+	// 片段总数超过上限时，减少数据片段的数量(即增大片段的大小)
+	for plan.DataShards > 1 && plan.TotalShards() > maxTotalShards {
+		plan.DataShards--
+		if mode == RS_Proportion {
+			plan.ParityShards = parityCount(plan.DataShards, opt.parityRatio)
+		}
+	}
+	if plan.TotalShards() > maxTotalShards {
+		plan.ParityShards = maxTotalShards - plan.DataShards
+	}
+
+	plan.ShardSize = int64(ceilDiv(size, int64(plan.DataShards)))
+
+	return plan
+}
+
+// ceilDiv 返回 a 除以 b 向上取整的结果，b 不大于 0 时返回 1
+func ceilDiv(a, b int64) int {
+	if b <= 0 {
+		return 1
+	}
+	return int((a + b - 1) / b)
+}
+
+// parityCount 按奇偶校验片段占比计算奇偶校验片段的数量并向上取整
+// 占比先换算为千分比，避免浮点误差导致不同节点的取整结果不一致(如 10*0.3)
+func parityCount(dataShards int, parityRatio float64) int {
+	permille := int64(math.Round(parityRatio * 1000))
+	if permille <= 0 {
+		return 0
+	}
+	return int((int64(dataShards)*permille + 999) / 1000)
+}
@@ -0,0 +1,82 @@
+package defs
+
+import "testing"
+
+func TestPlanStorage(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int64
+		modify func(opt *Options)
+		want   StoragePlan
+	}{
+		{
+			name: "空文件",
+			size: 0,
+			want: StoragePlan{Mode: FileMode, DataShards: 1},
+		},
+		{
+			name: "小于最小片段的大小时使用文件模式",
+			size: 100,
+			want: StoragePlan{Mode: FileMode, DataShards: 1, ShardSize: 100},
+		},
+		{
+			name: "大于最大片段的大小时使用切片模式",
+			size: 40 << 20,
+			want: StoragePlan{Mode: SliceMode, DataShards: 80, ShardSize: 1 << 19},
+		},
+		{
+			name: "比例模式的奇偶校验片段不受浮点误差影响",
+			size: 10 << 19,
+			want: StoragePlan{Mode: RS_Proportion, DataShards: 10, ParityShards: 3, ShardSize: 1 << 19},
+		},
+		{
+			name: "比例模式向上取整",
+			size: 1<<19 + 1,
+			want: StoragePlan{Mode: RS_Proportion, DataShards: 2, ParityShards: 1, ShardSize: 1<<18 + 1},
+		},
+		{
+			name: "大小模式使用固定的片段数量",
+			size: 10000,
+			modify: func(opt *Options) {
+				opt.storageMode = RS_Size
+				opt.dataShards = 4
+				opt.parityShards = 2
+			},
+			want: StoragePlan{Mode: RS_Size, DataShards: 4, ParityShards: 2, ShardSize: 2500},
+		},
+		{
+			name: "比例模式的片段总数不超过上限",
+			size: 1 << 20,
+			modify: func(opt *Options) {
+				opt.shardSize = 1 << 10
+			},
+			want: StoragePlan{Mode: RS_Proportion, DataShards: 196, ParityShards: 59, ShardSize: 5350},
+		},
+		{
+			name: "切片模式的片段总数不超过上限",
+			size: 1 << 20,
+			modify: func(opt *Options) {
+				opt.storageMode = SliceMode
+				opt.shardSize = 1 << 10
+			},
+			want: StoragePlan{Mode: SliceMode, DataShards: 256, ShardSize: 1 << 12},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := DefaultOptions()
+			if tt.modify != nil {
+				tt.modify(opt)
+			}
+
+			got := PlanStorage(tt.size, opt)
+			if got != tt.want {
+				t.Fatalf("PlanStorage(%d) = %+v, 期望 %+v", tt.size, got, tt.want)
+			}
+			if again := PlanStorage(tt.size, opt); again != got {
+				t.Fatalf("相同的输入得到不同的结果: %+v, %+v", got, again)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package defs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bpfs/defs/core/repair"
+	"github.com/bpfs/defs/core/sqlite"
+)
+
+// Repair 检查文件资产在网络中的持有情况，余量低于阈值时重建丢失的片段并发送给其他节点
+func (fs *FS) Repair(ctx context.Context, assetID string) (*repair.Result, error) {
+	if fs.repair == nil {
+		return nil, fmt.Errorf("没有节点间传输，无法修复文件资产")
+	}
+	return fs.repair.Repair(ctx, assetID)
+}
+
+// AssetHealth 查询文件资产各片段的在线持有者数量
+func (fs *FS) AssetHealth(ctx context.Context, assetID string) (*repair.Health, error) {
+	if fs.repair == nil {
+		return nil, fmt.Errorf("没有节点间传输，无法查询持有情况")
+	}
+	return fs.repair.Check(ctx, assetID)
+}
+
+// watchUploaded 跟踪所有已上传成功的文件资产
+func (fs *FS) watchUploaded() error {
+	assetIDs, err := sqlite.SelectAssetIDsDatabase(fs.db, sqlite.OperateUpload, sqlite.StatusSuccess)
+	if err != nil {
+		return err
+	}
+	for _, assetID := range assetIDs {
+		if err := fs.watchAsset(assetID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchAsset 根据上传记录跟踪文件资产的持有情况
+func (fs *FS) watchAsset(assetID string) error {
+	record, err := sqlite.SelectOneFileDatabase(fs.db, assetID, sqlite.OperateUpload)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return fmt.Errorf("文件资产 %s 不存在", assetID)
+	}
+	slices, err := sqlite.SelectSlicesDatabase(fs.db, assetID)
+	if err != nil {
+		return err
+	}
+
+	asset := repair.Asset{
+		ID:           assetID,
+		DataShards:   int(record.DataPieces),
+		ParityShards: int(record.TotalPieces - record.DataPieces),
+	}
+	// 片段记录完整时校验获取和重建的片段
+	if len(slices) == int(record.TotalPieces) {
+		asset.Hashes = make([]string, len(slices))
+		for _, slice := range slices {
+			if slice.SliceIndex < 0 || slice.SliceIndex >= len(slices) {
+				asset.Hashes = nil
+				break
+			}
+			asset.Hashes[slice.SliceIndex] = slice.SliceHash
+		}
+	}
+
+	return fs.repair.Watch(asset)
+}
@@ -0,0 +1,36 @@
+package defs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bpfs/defs/core/scrub"
+)
+
+// Scrub 立即巡检一轮本地文件片段，损坏的片段被隔离后从其他节点重新获取
+func (fs *FS) Scrub(ctx context.Context) error {
+	if fs.scrubber == nil {
+		return fmt.Errorf("文件片段存储不支持巡检")
+	}
+	return fs.scrubber.Scrub(ctx)
+}
+
+// ScrubStats 返回本地文件片段巡检的累计统计
+func (fs *FS) ScrubStats() scrub.Stats {
+	if fs.scrubber == nil {
+		return scrub.Stats{}
+	}
+	return fs.scrubber.Stats()
+}
+
+// SetScrubRate 修改巡检的读取速率(字节/秒)，为 0 时不限速
+func (fs *FS) SetScrubRate(rate int64) {
+	if fs.scrubber != nil {
+		fs.scrubber.SetRate(rate)
+	}
+}
+
+// repairShard 从其他节点重新获取巡检发现的损坏片段
+func (fs *FS) repairShard(event scrub.Event) {
+	fs.refreshLocalShard(event.AssetID, event.Index)
+}
@@ -346,6 +346,7 @@ func (db *SqliteDB) AddColumnsIfNotExists(tableName string, columnNames map[stri
 		// 检查列是否存在
 		rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", tableName))
 		if err != nil {
+			_ = tx.Rollback()
 			return fmt.Errorf("获取表信息失败: %v", err)
 		}
 
@@ -360,6 +361,7 @@ func (db *SqliteDB) AddColumnsIfNotExists(tableName string, columnNames map[stri
 
 			err := rows.Scan(&cid, &name, &dataType, &notnull, &dflt_value, &pk)
 			if err != nil {
+				rows.Close()
 				_ = tx.Rollback()
 				return fmt.Errorf("扫描表信息失败: %v", err)
 			}
@@ -369,6 +371,7 @@ func (db *SqliteDB) AddColumnsIfNotExists(tableName string, columnNames map[stri
 				break
 			}
 		}
+		rows.Close()
 
 		if !exists {
 			// 如果列不存在，添加列
@@ -377,8 +380,6 @@ func (db *SqliteDB) AddColumnsIfNotExists(tableName string, columnNames map[stri
 				_ = tx.Rollback()
 				return fmt.Errorf("添加列失败: %v", err)
 			}
-		} else {
-			fmt.Printf("列 %s 已存在于表 %s 中", columnName, tableName)
 		}
 	}
 
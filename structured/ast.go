@@ -1,6 +1,10 @@
 // AST: 语法树
 package bpfsfql
 
+import (
+	"strings"
+)
+
 // Node 是所有AST节点都必须实现的接口。
 type Node interface {
 	TokenLiteral() string // 获取Token的文字内容
@@ -12,119 +16,101 @@ type Statement interface {
 	statementNode() // 仅用于区分其他节点
 }
 
-// Expression 代表FQL中的表达式。
+// Expression 代表FQL中的表达式，用于 WHERE 子句。
 type Expression interface {
 	Node
+	String() string  // 返回表达式的FQL形式
 	expressionNode() // 仅用于区分其他节点
 }
 
-// ActionStatement 代表FQL中的操作指令，例如CREATE、DROP等。
-type ActionStatement struct {
-	Token      Token                 // 操作指令的Token，例如CREATE、DROP等
-	Name       string                // 操作指令的名称
-	Target     Expression            // 命令的目标，如FILE、FILES、EXTENSION等
-	Parameters []Expression          // 命令的参数列表，如OWNED_BY、METADATA等
-	Lists      []ListExpression      // 新增: 命令的LIST列表，如[file1, file2]
-	Conditions []ConditionExpression // 新增: 命令的条件列表，如SIZE < 5000
-}
-
-func (as *ActionStatement) statementNode() {}
-func (as *ActionStatement) TokenLiteral() string {
-	return as.Token.Literal
-}
-
-// TargetExpression 代表命令的目标，例如FILE、FILES等。
-type TargetExpression struct {
-	Token Token  // 目标的Token
-	Name  string // 目标的名称，如"FILE"
-}
-
-func (te *TargetExpression) expressionNode() {}
-func (te *TargetExpression) TokenLiteral() string {
-	return te.Token.Literal
-}
-
-// AliasExpression 代表FQL中的别名。
-type AliasExpression struct {
-	Token Token  // 别名的Token
-	Name  string // 别名，例如filename、version_number
+// Field 代表文件属性，例如SIZE、LAST_MODIFIED、TAGS、OWNED_BY。
+type Field struct {
+	Name string // 属性名称，统一为大写
+	Pos  Pos    // 属性在语句中的位置
 }
 
-func (ae *AliasExpression) expressionNode() {}
-func (ae *AliasExpression) TokenLiteral() string {
-	return ae.Token.Literal
-}
+func (f *Field) expressionNode()      {}
+func (f *Field) TokenLiteral() string { return f.Name }
+func (f *Field) String() string       { return f.Name }
 
-// ParameterExpression 代表FQL中的参数。
-type ParameterExpression struct {
-	Token Token      // 参数的Token
-	Key   string     // 参数的键，如OWNED_BY、METADATA
-	Value Expression // 参数的值，可以是StringLiteral, ListExpression, ConditionExpression等
+// Literal 代表字符串、标识符、数字或日期的值。
+type Literal struct {
+	Type  TokenType // 值的Token类型：STRING、IDENT、NUMBER 或 DATE
+	Value string    // 值的内容，字符串为转义后的内容
+	Pos   Pos       // 值在语句中的位置
 }
 
-func (pe *ParameterExpression) expressionNode() {}
-func (pe *ParameterExpression) TokenLiteral() string {
-	return pe.Token.Literal
+func (l *Literal) expressionNode()      {}
+func (l *Literal) TokenLiteral() string { return l.Value }
+func (l *Literal) String() string {
+	if l.Type == STRING {
+		return quote(l.Value)
+	}
+	return l.Value
 }
 
-// StringLiteral 代表字符串字面值。
-type StringLiteral struct {
-	Token Token  // 字符串Token
-	Value string // 字符串的具体内容
+// ListLiteral 代表一个列表，例如[tag1, tag2]。
+type ListLiteral struct {
+	Items []*Literal // 列表中的元素
+	Pos   Pos        // 列表开始的位置
 }
 
-func (sl *StringLiteral) expressionNode() {}
-func (sl *StringLiteral) TokenLiteral() string {
-	return sl.Token.Literal
+func (ll *ListLiteral) expressionNode()      {}
+func (ll *ListLiteral) TokenLiteral() string { return "[" }
+func (ll *ListLiteral) String() string {
+	items := make([]string, len(ll.Items))
+	for i, item := range ll.Items {
+		items[i] = item.String()
+	}
+	return "[" + strings.Join(items, ", ") + "]"
 }
 
-// ListExpression 代表一个列表。
-type ListExpression struct {
-	Token    Token        // 列表的Token
-	Elements []Expression // 列表中的元素
+// Values 返回列表中元素的内容
+func (ll *ListLiteral) Values() []string {
+	values := make([]string, len(ll.Items))
+	for i, item := range ll.Items {
+		values[i] = item.Value
+	}
+	return values
 }
 
-func (le *ListExpression) expressionNode() {}
-func (le *ListExpression) TokenLiteral() string {
-	return le.Token.Literal
+// ComparisonExpr 代表一个比较条件，例如SIZE < 5000、TAGS INCLUDE [tag1, tag2]、NAME LIKE 'a%'。
+type ComparisonExpr struct {
+	Field    *Field     // 比较的文件属性
+	Operator string     // 操作符：<、<=、>、>=、=、!=、INCLUDE 或 LIKE
+	Value    Expression // 比较的值：*Literal，INCLUDE 时也可以是 *ListLiteral
 }
 
-// ConditionExpression 代表一个条件表达式。
-type ConditionExpression struct {
-	Token    Token                // 条件的Token
-	Left     Expression           // 条件的左侧表达式
-	Operator string               // 条件的操作符，如<、>等
-	Right    Expression           // 条件的右侧表达式
-	Next     *ConditionExpression // 附加的条件，用于AND或OR连接的多个条件
+func (ce *ComparisonExpr) expressionNode()      {}
+func (ce *ComparisonExpr) TokenLiteral() string { return ce.Operator }
+func (ce *ComparisonExpr) String() string {
+	return ce.Field.String() + " " + ce.Operator + " " + ce.Value.String()
 }
 
-func (ce *ConditionExpression) expressionNode() {}
-func (ce *ConditionExpression) TokenLiteral() string {
-	return ce.Token.Literal
+// BinaryExpr 代表以AND或OR连接的两个条件。
+type BinaryExpr struct {
+	Operator string     // AND 或 OR
+	Left     Expression // 左侧的条件
+	Right    Expression // 右侧的条件
 }
 
-// ListStatement 表示一个列表，例如[file1, file2]
-type ListStatement struct {
-	Token  Token   // the '[' token
-	Values []Token // the elements in the list
+func (be *BinaryExpr) expressionNode()      {}
+func (be *BinaryExpr) TokenLiteral() string { return be.Operator }
+func (be *BinaryExpr) String() string {
+	return "(" + be.Left.String() + " " + be.Operator + " " + be.Right.String() + ")"
 }
 
-func (ls *ListStatement) statementNode() {}
-func (ls *ListStatement) TokenLiteral() string {
-	return ls.Token.Literal
+// NotExpr 代表取反的条件。
+type NotExpr struct {
+	Expr Expression // 被取反的条件
 }
 
-// ConditionStatement 表示一个条件语句，例如SIZE < 5000
-type ConditionStatement struct {
-	Token    Token // the 'WHERE' token
-	Operator Token // the '<' token
-	Left     Token // the 'SIZE' token
-	Right    Token // the '5000' token
-}
+func (ne *NotExpr) expressionNode()      {}
+func (ne *NotExpr) TokenLiteral() string { return "NOT" }
+func (ne *NotExpr) String() string       { return "NOT " + ne.Expr.String() }
 
-func (cs *ConditionStatement) statementNode() {}
-func (cs *ConditionStatement) TokenLiteral() string {
-	return cs.Token.Literal
+// quote 返回单引号包围的字符串，并转义其中的单引号和反斜杠
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
 }
-
-// 您可以根据需要进一步完善和调整AST的结构和定义。
@@ -0,0 +1,130 @@
+// Catalog: 文件目录
+package bpfsfql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/sqlites"
+)
+
+// Catalog 在 sqlite 中的文件目录上执行 SHOW FILES 和 ADD TAGS，其他语句返回 ErrUnsupported
+// Catalog 不检查 AUTHORIZED BY 的身份，由嵌入它的执行器在调用前检查权限。
+type Catalog struct {
+	UnsupportedExecutor
+	db *sqlites.SqliteDB
+}
+
+// NewCatalog 创建使用 db 中文件目录的 Catalog，db 需要已由 sqlite.InitDBTable 初始化
+func NewCatalog(db *sqlites.SqliteDB) *Catalog {
+	return &Catalog{db: db}
+}
+
+// ShowFiles 将筛选条件编译为参数化的查询后在文件目录中执行，EXPLAIN 时只返回生成的查询
+func (c *Catalog) ShowFiles(ctx context.Context, stmt *ShowFilesStmt) (*Result, error) {
+	query, err := CompileShowFiles(stmt)
+	if err != nil {
+		return nil, err
+	}
+	if stmt.Explain {
+		return &Result{Query: query, Message: query.String()}, nil
+	}
+
+	files, err := c.Files(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Files: files}
+	for _, file := range files {
+		result.AssetIDs = append(result.AssetIDs, file.AssetID)
+	}
+	return result, nil
+}
+
+// AddTags 为文件目录中的文件添加标签，已有的标签保持不变
+func (c *Catalog) AddTags(ctx context.Context, stmt *AddTagsStmt) (*Result, error) {
+	assetID, err := c.Resolve(stmt.File)
+	if err != nil {
+		return nil, err
+	}
+	record, err := sqlite.SelectCatalogDatabase(c.db, assetID)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("文件目录中没有文件 %s", stmt.File)
+	}
+	if err := sqlite.AddCatalogTagsDatabase(c.db, assetID, stmt.Tags); err != nil {
+		return nil, err
+	}
+	return &Result{AssetIDs: []string{assetID}}, nil
+}
+
+// Files 执行 CompileShowFiles 生成的查询，返回文件及其标签
+func (c *Catalog) Files(ctx context.Context, query *Query) ([]FileInfo, error) {
+	start, limit := query.Range()
+	rows, err := c.db.Select(query.Table, query.Columns, query.Conditions, query.Args, start, limit, query.OrderBy)
+	if err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+	defer rows.Close()
+
+	var files []FileInfo
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var (
+			file     FileInfo
+			modified int64
+			metadata string
+		)
+		if err := rows.Scan(&file.AssetID, &file.Name, &file.CustomName, &file.Size, &modified, &metadata, &file.Owner); err != nil {
+			return nil, fmt.Errorf("数据库操作失败: %v", err)
+		}
+		file.Modified = time.Unix(modified, 0)
+		if err := json.Unmarshal([]byte(metadata), &file.Metadata); err != nil {
+			return nil, fmt.Errorf("解析文件属性失败: %v", err)
+		}
+		files = append(files, file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("数据库操作失败: %v", err)
+	}
+	rows.Close()
+
+	// 标签在查询结束后读取，避免在读取结果时占用第二个数据库连接
+	for i := range files {
+		if files[i].Tags, err = sqlite.SelectCatalogTagsDatabase(c.db, files[i].AssetID); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Resolve 返回语句中的文件对应的文件资产
+// 文件可以是文件资产的唯一标识，也可以是文件目录中唯一的名称或自定义名称；都不匹配时原样作为唯一标识返回。
+func (c *Catalog) Resolve(file string) (string, error) {
+	record, err := sqlite.SelectCatalogDatabase(c.db, file)
+	if err != nil {
+		return "", err
+	}
+	if record != nil {
+		return file, nil
+	}
+
+	assetIDs, err := sqlite.SelectCatalogAssetIDsDatabase(c.db, file)
+	if err != nil {
+		return "", err
+	}
+	switch len(assetIDs) {
+	case 0:
+		return file, nil
+	case 1:
+		return assetIDs[0], nil
+	}
+	return "", fmt.Errorf("文件目录中有 %d 个名为 %s 的文件，请使用文件资产的唯一标识", len(assetIDs), file)
+}
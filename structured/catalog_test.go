@@ -0,0 +1,179 @@
+package bpfsfql
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/sqlites"
+)
+
+// openTestCatalog 在临时目录中创建文件目录，写入三个文件
+func openTestCatalog(t *testing.T) *Catalog {
+	t.Helper()
+
+	db, err := sqlites.NewSqliteDB(t.TempDir(), sqlite.DbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := sqlite.InitDBTable(db); err != nil {
+		t.Fatal(err)
+	}
+
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		return d
+	}
+	for _, file := range []struct {
+		record   sqlite.CatalogRecord
+		owner    string
+		coOwners []string
+		tags     []string
+	}{
+		{sqlite.CatalogRecord{AssetID: "a1", Name: "report.pdf", Size: 3000, Modified: day("2022-12-31 23:00")},
+			"did:alice", nil, []string{"work", "2022"}},
+		{sqlite.CatalogRecord{AssetID: "a2", Name: "photo.jpg", CustomName: "holiday", Size: 2 << 20, Modified: day("2023-01-01 12:00"),
+			Metadata: map[string]string{"camera": "x100"}},
+			"did:alice", []string{"did:bob", "did:carol"}, []string{"photo"}},
+		{sqlite.CatalogRecord{AssetID: "a3", Name: "notes.txt", Size: 100, Modified: day("2023-03-01 08:00")},
+			"did:bob", nil, []string{"work"}},
+	} {
+		record := file.record
+		if err := sqlite.SaveCatalogDatabase(db, &record); err != nil {
+			t.Fatal(err)
+		}
+		if err := sqlite.AddCatalogTagsDatabase(db, record.AssetID, file.tags); err != nil {
+			t.Fatal(err)
+		}
+		if err := sqlite.SaveACLDatabase(db, &sqlite.ACLRecord{
+			AssetID: record.AssetID, Owner: file.owner, CoOwners: file.coOwners, Version: 1,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewCatalog(db)
+}
+
+func TestCatalogShowFiles(t *testing.T) {
+	catalog := openTestCatalog(t)
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{`SHOW FILES`, []string{"a1", "a2", "a3"}},
+		{`SHOW FILES WHERE TAGS INCLUDE [work, '2022'] AND OWNED_BY='did:alice'`, []string{"a1"}},
+		{`SHOW FILES WHERE TAGS INCLUDE work ORDER BY size`, []string{"a3", "a1"}},
+		{`SHOW FILES WHERE SIZE < 5000 AND LAST_MODIFIED > '2023-01-01'`, []string{"a3"}},
+		{`SHOW FILES WHERE LAST_MODIFIED = 2023-01-01`, []string{"a2"}},
+		{`SHOW FILES WHERE LAST_MODIFIED <= 2023-01-01 ORDER BY LAST_MODIFIED DESC`, []string{"a2", "a1"}},
+		{`SHOW FILES WHERE size >= 1MB OR name LIKE '%.txt'`, []string{"a2", "a3"}},
+		{`SHOW FILES WHERE CO_OWNERS INCLUDE 'did:carol'`, []string{"a2"}},
+		{`SHOW FILES WHERE NOT OWNED_BY = 'did:alice'`, []string{"a3"}},
+		{`SHOW FILES WHERE OWNED_BY != 'did:bob' AND TAGS LIKE 'ph%'`, []string{"a2"}},
+		{`SHOW FILES WHERE custom_name = holiday`, []string{"a2"}},
+		// 值中的引号作为参数传递，不会改变查询
+		{`SHOW FILES WHERE name = "x' OR '1'='1"`, nil},
+		{`SHOW FILES ORDER BY size DESC LIMIT 2`, []string{"a2", "a1"}},
+		{`SHOW FILES ORDER BY size DESC LIMIT 2 OFFSET 2`, []string{"a3"}},
+		{`SHOW FILES OFFSET 1`, []string{"a2", "a3"}},
+	} {
+		result, err := Exec(context.Background(), tc.query, catalog)
+		if err != nil {
+			t.Fatalf("执行 %q 失败: %v", tc.query, err)
+		}
+		if !reflect.DeepEqual(result.AssetIDs, tc.want) {
+			t.Errorf("执行 %q 得到 %v，期望 %v", tc.query, result.AssetIDs, tc.want)
+		}
+	}
+
+	result, err := Exec(context.Background(), `SHOW FILES WHERE name = 'photo.jpg'`, catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := FileInfo{AssetID: "a2", Name: "photo.jpg", CustomName: "holiday", Size: 2 << 20, Owner: "did:alice",
+		Tags: []string{"photo"}, Metadata: map[string]string{"camera": "x100"}}
+	got := result.Files[0]
+	if got.Modified.IsZero() {
+		t.Errorf("文件没有修改时间")
+	}
+	got.Modified = time.Time{}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("得到文件 %+v，期望 %+v", got, want)
+	}
+}
+
+func TestCatalogExplain(t *testing.T) {
+	catalog := openTestCatalog(t)
+
+	result, err := Exec(context.Background(),
+		`EXPLAIN SHOW FILES WHERE TAGS INCLUDE [a, b] AND SIZE < 5KB ORDER BY name DESC LIMIT 10`, catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files != nil || result.Query == nil {
+		t.Fatalf("EXPLAIN 应只返回查询，得到 %+v", result)
+	}
+	sql := result.Query.SQL()
+	for _, part := range []string{
+		"FROM catalog WHERE ((EXISTS (SELECT 1 FROM catalog_tags WHERE catalog_tags.assetID = catalog.assetID AND catalog_tags.tag = ?) AND EXISTS",
+		"AND catalog.size < ?)",
+		"ORDER BY catalog.name DESC, catalog.id ASC LIMIT 0,10",
+	} {
+		if !strings.Contains(sql, part) {
+			t.Errorf("生成的查询 %s 中没有 %s", sql, part)
+		}
+	}
+	if want := []interface{}{"a", "b", int64(5 << 10)}; !reflect.DeepEqual(result.Query.Args, want) {
+		t.Errorf("查询的参数为 %v，期望 %v", result.Query.Args, want)
+	}
+	if !strings.HasSuffix(result.Message, "参数: ['a', 'b', 5120]") {
+		t.Errorf("EXPLAIN 的说明为 %s", result.Message)
+	}
+}
+
+func TestCatalogCompileErrors(t *testing.T) {
+	catalog := openTestCatalog(t)
+
+	for query, want := range map[string]Pos{
+		`SHOW FILES WHERE COLOR = 'red'`:           {1, 18},
+		`SHOW FILES WHERE SIZE LIKE '5%'`:          {1, 18},
+		`SHOW FILES WHERE SIZE > large`:            {1, 25},
+		`SHOW FILES WHERE LAST_MODIFIED > 'today'`: {1, 34},
+		`SHOW FILES WHERE NAME INCLUDE [a]`:        {1, 18},
+		`SHOW FILES WHERE TAGS = work`:             {1, 18},
+		`SHOW FILES ORDER BY owned_by`:             {1, 21},
+	} {
+		_, err := Exec(context.Background(), query, catalog)
+		var perr *ParseError
+		if !errors.As(err, &perr) || perr.Pos != want {
+			t.Errorf("执行 %q 得到错误 %v，期望位置 %v 的错误", query, err, want)
+		}
+	}
+}
+
+func TestCatalogAddTags(t *testing.T) {
+	catalog := openTestCatalog(t)
+	ctx := context.Background()
+
+	if _, err := Exec(ctx, `ADD TAGS TO FILE holiday TAGS [photo, family] AUTHORIZED BY 'did:alice'`, catalog); err != nil {
+		t.Fatal(err)
+	}
+	result, err := Exec(ctx, `SHOW FILES WHERE TAGS INCLUDE family`, catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Files) != 1 || !reflect.DeepEqual(result.Files[0].Tags, []string{"photo", "family"}) {
+		t.Fatalf("添加标签后得到 %+v", result.Files)
+	}
+
+	if _, err := Exec(ctx, `ADD TAGS TO FILE missing TAGS [x] AUTHORIZED BY 'did:alice'`, catalog); err == nil {
+		t.Fatal("为文件目录中没有的文件添加标签应失败")
+	}
+}
@@ -0,0 +1,178 @@
+// Executor: 语句的执行
+package bpfsfql
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrUnsupported 表示执行器不支持该语句
+var ErrUnsupported = errors.New("不支持的语句")
+
+// Executor 执行解析后的语句，每种语句对应一个方法
+// 方法返回的结果为空时，Exec 返回只包含语句名称的结果。
+type Executor interface {
+	Create(ctx context.Context, stmt *CreateFileStmt) (*Result, error)
+	Drop(ctx context.Context, stmt *DropFileStmt) (*Result, error)
+	Update(ctx context.Context, stmt *UpdateFileStmt) (*Result, error)
+	Select(ctx context.Context, stmt *SelectContentStmt) (*Result, error)
+	BulkTransfer(ctx context.Context, stmt *BulkTransferStmt) (*Result, error)
+	AddTags(ctx context.Context, stmt *AddTagsStmt) (*Result, error)
+	ShowFiles(ctx context.Context, stmt *ShowFilesStmt) (*Result, error)
+	Transfer(ctx context.Context, stmt *TransferFileStmt) (*Result, error)
+	SetCoOwners(ctx context.Context, stmt *SetCoOwnersStmt) (*Result, error)
+	Share(ctx context.Context, stmt *ShareFileStmt) (*Result, error)
+	Checkout(ctx context.Context, stmt *CheckoutFileStmt) (*Result, error)
+	UseExtension(ctx context.Context, stmt *UseExtensionStmt) (*Result, error)
+	ShowJobs(ctx context.Context, stmt *ShowJobsStmt) (*Result, error)
+	ShowJob(ctx context.Context, stmt *ShowJobStmt) (*Result, error)
+	CancelJob(ctx context.Context, stmt *CancelJobStmt) (*Result, error)
+}
+
+// Result 是语句的执行结果
+type Result struct {
+	Statement string     // 执行的语句，如 "CREATE FILE"
+	AssetIDs  []string   // 创建或受影响的文件资产
+	Content   []byte     // SELECT CONTENT 读取的文件内容
+	Files     []FileInfo // SHOW FILES 列出的文件
+	Query     *Query     // EXPLAIN SHOW FILES 生成的查询，查询不会执行
+	JobID     string     // ASYNC 语句提交的任务
+	Jobs      []JobInfo  // SHOW JOBS 和 SHOW JOB 列出的任务
+	Message   string     // 执行器附加的说明
+}
+
+// FileInfo 是 SHOW FILES 列出的文件信息
+type FileInfo struct {
+	AssetID    string            // 文件资产的唯一标识
+	Name       string            // 文件的名称
+	CustomName string            // 为文件设定的自定义名称
+	Size       int64             // 文件的大小
+	Owner      string            // 文件的拥有者的DID
+	Tags       []string          // 文件的标签
+	Metadata   map[string]string // 为文件附加的额外信息或属性
+	Modified   time.Time         // 文件的最后修改时间
+}
+
+// JobStatus 是 ASYNC 语句的任务状态
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"   // 待开始
+	JobRunning   JobStatus = "running"   // 进行中
+	JobSucceeded JobStatus = "succeeded" // 成功
+	JobFailed    JobStatus = "failed"    // 失败
+	JobCancelled JobStatus = "cancelled" // 已取消
+)
+
+// JobInfo 是 ASYNC 语句的任务信息
+type JobInfo struct {
+	ID        string    // 任务的唯一标识
+	Statement string    // 语句的原文
+	Status    JobStatus // 任务的状态
+	Err       string    // 失败的原因
+	AssetIDs  []string  // 创建或受影响的文件资产
+	Created   time.Time // 提交的时间
+	Updated   time.Time // 状态最后变化的时间
+}
+
+// UnsupportedExecutor 对所有语句返回 ErrUnsupported
+// 嵌入到只支持部分语句的执行器中，使其满足 Executor 接口。
+type UnsupportedExecutor struct{}
+
+func (UnsupportedExecutor) Create(context.Context, *CreateFileStmt) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+func (UnsupportedExecutor) Drop(context.Context, *DropFileStmt) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+func (UnsupportedExecutor) Update(context.Context, *UpdateFileStmt) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+func (UnsupportedExecutor) Select(context.Context, *SelectContentStmt) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+func (UnsupportedExecutor) BulkTransfer(context.Context, *BulkTransferStmt) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+func (UnsupportedExecutor) AddTags(context.Context, *AddTagsStmt) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+func (UnsupportedExecutor) ShowFiles(context.Context, *ShowFilesStmt) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+func (UnsupportedExecutor) Transfer(context.Context, *TransferFileStmt) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+func (UnsupportedExecutor) SetCoOwners(context.Context, *SetCoOwnersStmt) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+func (UnsupportedExecutor) Share(context.Context, *ShareFileStmt) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+func (UnsupportedExecutor) Checkout(context.Context, *CheckoutFileStmt) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+func (UnsupportedExecutor) UseExtension(context.Context, *UseExtensionStmt) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+func (UnsupportedExecutor) ShowJobs(context.Context, *ShowJobsStmt) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+func (UnsupportedExecutor) ShowJob(context.Context, *ShowJobStmt) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+func (UnsupportedExecutor) CancelJob(context.Context, *CancelJobStmt) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+// dispatch 将语句交给执行器中对应的方法
+func dispatch(ctx context.Context, stmt Statement, executor Executor) (*Result, error) {
+	switch s := stmt.(type) {
+	case *CreateFileStmt:
+		return executor.Create(ctx, s)
+	case *DropFileStmt:
+		return executor.Drop(ctx, s)
+	case *UpdateFileStmt:
+		return executor.Update(ctx, s)
+	case *SelectContentStmt:
+		return executor.Select(ctx, s)
+	case *BulkTransferStmt:
+		return executor.BulkTransfer(ctx, s)
+	case *AddTagsStmt:
+		return executor.AddTags(ctx, s)
+	case *ShowFilesStmt:
+		return executor.ShowFiles(ctx, s)
+	case *TransferFileStmt:
+		return executor.Transfer(ctx, s)
+	case *SetCoOwnersStmt:
+		return executor.SetCoOwners(ctx, s)
+	case *ShareFileStmt:
+		return executor.Share(ctx, s)
+	case *CheckoutFileStmt:
+		return executor.Checkout(ctx, s)
+	case *UseExtensionStmt:
+		return executor.UseExtension(ctx, s)
+	case *ShowJobsStmt:
+		return executor.ShowJobs(ctx, s)
+	case *ShowJobStmt:
+		return executor.ShowJob(ctx, s)
+	case *CancelJobStmt:
+		return executor.CancelJob(ctx, s)
+	}
+	return nil, ErrUnsupported
+}
@@ -2,106 +2,45 @@
 package bpfsfql
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"strings"
 )
 
-// Exec 函数用于执行给定的 FQL 查询
-func Exec(query string) (string, error) {
-	// 1. 词法分析
-	tokens, err := Lex(query)
-	if err != nil {
-		return "", fmt.Errorf("词法分析错误: %w", err)
-	}
-
-	// 打印Token列表
-	printTokens(tokens)
+// ParseErrors 是一条语句中的全部语法错误
+type ParseErrors []ParseError
 
-	// 2. 语法分析
-	parser := NewParser(tokens)
-	statement := parser.ParseStatement() // 注意首字母大写，以适应外部调用
-
-	// 根据语法分析的结果来判断查询的类型并执行相应操作
-	switch stmt := statement.(type) {
-	case *ActionStatement:
-		return "", execActionStatement(stmt)
-	default:
-		return "", fmt.Errorf("unsupported statement type")
+func (e ParseErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i := range e {
+		msgs[i] = e[i].Error()
 	}
+	return "语法错误: " + strings.Join(msgs, "; ")
 }
 
-// printTokens 函数用于打印词法分析的结果
-func printTokens(tokens []Token) {
-	fmt.Println("Tokens:")
-	for _, t := range tokens {
-		fmt.Printf("{Type:%s Literal:%s}\n", t.Type, t.Literal)
-	}
-	fmt.Println()
-}
-
-// execActionStatement 函数用于执行动作语句
-func execActionStatement(stmt *ActionStatement) error {
-	// 打印语句的主要信息
-	fmt.Printf("Action: %s\n", stmt.Token.Literal)
-	fmt.Printf("Type: %s\n", stmt.Token.Type)
-	fmt.Printf("Target: %s\n", stmt.Target.TokenLiteral())
-
-	// 打印参数信息
-	for _, param := range stmt.Parameters {
-		if p, ok := param.(*ParameterExpression); ok {
-			fmt.Printf("Param Key: %s, Value: %s\n", p.Key, p.Value.TokenLiteral())
+// Parse 对 FQL 语句进行词法分析和语法分析，返回类型化的语句和全部语法错误
+// 词法分析出错时只返回该错误；语法分析出错时返回的语句可能不完整，也可能为空。
+func Parse(query string) (Statement, []ParseError) {
+	// 1. 词法分析
+	tokens, err := Lex(query)
+	if err != nil {
+		var perr *ParseError
+		if errors.As(err, &perr) {
+			return nil, []ParseError{*perr}
 		}
+		return nil, []ParseError{{Pos: Pos{Line: 1, Column: 1}, Msg: err.Error()}}
 	}
 
-	// 根据动作语句的类型执行相应操作
-	// 目前仅支持创建文件操作
-	if stmt.Token.Literal == "CREATE" && stmt.Target.TokenLiteral() == "FILE" {
-		return createFile(stmt.Parameters)
-	}
-	return fmt.Errorf("不支持的动作语句")
+	// 2. 语法分析
+	return NewParser(tokens).ParseStatement()
 }
 
-// createFile 函数用于处理文件创建操作
-func createFile(params []Expression) error {
-	var filepath string
-	var owned string
-	var customName string
-	metadata := make(map[string]string)
-
-	// 解析参数
-	for _, expr := range params {
-		if param, ok := expr.(*ParameterExpression); ok {
-			switch param.Key {
-			case "filename":
-				filepath = param.Value.TokenLiteral()
-			case "OWNED_BY":
-				owned = strings.Trim(param.Value.TokenLiteral(), "\"")
-			case "CUSTOM_NAME":
-				customName = strings.Trim(param.Value.TokenLiteral(), "\"")
-			case "METADATA":
-				// 对元数据字符串进行解析
-				metaStr := strings.Trim(param.Value.TokenLiteral(), "\"")
-				pairs := strings.Split(metaStr, ",")
-				for _, pair := range pairs {
-					kv := strings.Split(pair, ":")
-					if len(kv) == 2 {
-						metadata[kv[0]] = kv[1]
-					} else {
-						return fmt.Errorf("元数据格式不正确: %s", pair)
-					}
-				}
-			}
-		}
+// Exec 解析给定的 FQL 语句，并交给执行器中对应的方法执行
+// 语句中有参数占位符时返回错误，带参数的语句使用 Prepare。
+func Exec(ctx context.Context, query string, executor Executor) (*Result, error) {
+	stmt, err := Prepare(query)
+	if err != nil {
+		return nil, err
 	}
-
-	// 打印获取到的信息
-	fmt.Println("创建文件:")
-	fmt.Printf("原文件路径: %s\n", filepath)
-	fmt.Printf("拥有者: %s\n", owned)
-	fmt.Printf("自定义名称: %s\n", customName)
-	fmt.Printf("元数据: %+v\n", metadata)
-
-	// TODO: 在此处添加实际的文件创建逻辑
-
-	return nil
+	return stmt.Exec(ctx, executor)
 }
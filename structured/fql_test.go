@@ -1,16 +1,72 @@
 package bpfsfql
 
 import (
+	"context"
+	"errors"
 	"testing"
 )
 
-func TestExecCreateFile(t *testing.T) {
+// recordingExecutor 记录收到的语句，只支持创建文件和读取文件内容
+type recordingExecutor struct {
+	UnsupportedExecutor
+	stmts []Statement
+}
+
+func (e *recordingExecutor) Create(_ context.Context, stmt *CreateFileStmt) (*Result, error) {
+	e.stmts = append(e.stmts, stmt)
+	return &Result{AssetIDs: []string{"asset-" + stmt.File}}, nil
+}
+
+func (e *recordingExecutor) Select(_ context.Context, stmt *SelectContentStmt) (*Result, error) {
+	e.stmts = append(e.stmts, stmt)
+	return &Result{Content: []byte("content of " + stmt.File)}, nil
+}
 
-	// query := `CREATE FILE filename OWNED_BY=did CUSTOM_NAME=custom_name METADATA="key1:value1,key2:value2"`
+func TestExecCreateFile(t *testing.T) {
+	executor := new(recordingExecutor)
 	query := `CREATE FILE "filename" OWNED_BY="did" CUSTOM_NAME="custom_name" METADATA="key1:value1,key2:value2"`
-	_, err := Exec(query)
+	result, err := Exec(context.Background(), query, executor)
 	if err != nil {
 		t.Fatalf("Exec failed: %s", err)
 	}
+	if result.Statement != "CREATE FILE" || len(result.AssetIDs) != 1 || result.AssetIDs[0] != "asset-filename" {
+		t.Fatalf("执行结果为 %+v", result)
+	}
+
+	stmt := executor.stmts[0].(*CreateFileStmt)
+	if stmt.Owner != "did" || stmt.CustomName != "custom_name" || stmt.Metadata["key2"] != "value2" {
+		t.Fatalf("执行器收到 %+v", stmt)
+	}
+}
+
+func TestExecDispatch(t *testing.T) {
+	executor := new(recordingExecutor)
+	ctx := context.Background()
+
+	result, err := Exec(ctx, `SELECT CONTENT FROM FILE 'report' AUTHORIZED BY 'did'`, executor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Statement != "SELECT CONTENT" || string(result.Content) != "content of report" {
+		t.Fatalf("执行结果为 %+v", result)
+	}
 
+	// 执行器不支持的语句返回 ErrUnsupported
+	if _, err := Exec(ctx, `DROP FILE 'report' AUTHORIZED BY 'did'`, executor); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("执行不支持的语句返回 %v", err)
+	}
+
+	// 语法错误不会交给执行器
+	if _, err := Exec(ctx, `DROP FILE 'report'`, executor); err == nil {
+		t.Fatal("执行语法错误的语句成功")
+	}
+	if len(executor.stmts) != 1 {
+		t.Fatalf("执行器收到 %d 条语句", len(executor.stmts))
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := Exec(cancelled, `SELECT CONTENT FROM FILE 'report' AUTHORIZED BY 'did'`, executor); !errors.Is(err, context.Canceled) {
+		t.Fatalf("已取消时执行返回 %v", err)
+	}
 }
@@ -4,345 +4,403 @@ package bpfsfql
 
 import (
 	"fmt"
-	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // TokenType 用于标记Token的类型
 type TokenType string
 
 const (
-	// ACTION 表示操作类型（如CREATE、DROP、UPDATE等）
-	ACTION TokenType = "ACTION"
-	// FILENAME 表示文件名
-	FILENAME = "FILENAME"
-	// ALIAS 表示别名或者自定义名称
-	ALIAS = "ALIAS"
-	// DID 表示分布式身份标识（Decentralized Identifier）
-	DID = "DID"
-	// PARAM 表示参数（如 METADATA, SIZE 等）
-	PARAM = "PARAM"
-	// OPTION 表示选项（用于扩展功能）
-	OPTION = "OPTION"
-	// OPERATOR 表示操作符（如 <, >, =, ... ）
-	OPERATOR = "OPERATOR"
-	// NUMBER 表示数字
-	NUMBER = "NUMBER"
-	// ASYNC 表示异步操作
-	ASYNC = "ASYNC"
-	// KEYVALUE 表示键值对（如 "key1:value1" ）
-	KEYVALUE = "KEYVALUE"
-	// LIST 表示列表格式
-	LIST = "LIST"
-	// DATE 表示日期格式
-	DATE = "DATE"
-	// CONTENT 表示文件的内容
-	CONTENT = "CONTENT"
-	// WHERE 表示查询条件
-	WHERE = "WHERE"
-	// TAGS 表示文件的标签
-	TAGS = "TAGS"
-	// TRANSFER 表示文件的转移操作
-	TRANSFER = "TRANSFER"
-	// CO_OWNERS 表示文件的共有者
-	CO_OWNERS = "CO_OWNERS"
-	// VERSION 表示文件的版本
-	VERSION = "VERSION"
-	// EXTENSION 表示扩展
-	EXTENSION = "EXTENSION"
-	// FILES 表示多个文件
-	FILES = "FILES"
-	// ATTRIBUTE 表示文件属性，如 SIZE, LAST_MODIFIED 等
-	ATTRIBUTE = "ATTRIBUTE"
+	// EOF 表示输入结束
+	EOF TokenType = "EOF"
+	// KEYWORD 表示关键字（如CREATE、FILE、WHERE等），字面值为大写
+	KEYWORD TokenType = "KEYWORD"
+	// IDENT 表示未加引号的标识符（如文件名、参数名、DID）
+	IDENT TokenType = "IDENT"
+	// STRING 表示单引号或双引号中的字符串，字面值为转义后的内容
+	STRING TokenType = "STRING"
+	// NUMBER 表示数字，可以带有大小单位（如 5000、1.5、5MB）
+	NUMBER TokenType = "NUMBER"
+	// DATE 表示未加引号的日期（如 2023-01-01）
+	DATE TokenType = "DATE"
+	// OPERATOR 表示比较操作符（<、<=、>、>=、=、!=）
+	OPERATOR TokenType = "OPERATOR"
+	// LBRACKET 表示列表的开始 "["
+	LBRACKET TokenType = "["
+	// RBRACKET 表示列表的结束 "]"
+	RBRACKET TokenType = "]"
+	// LPAREN 表示 "("
+	LPAREN TokenType = "("
+	// RPAREN 表示 ")"
+	RPAREN TokenType = ")"
+	// COMMA 表示列表元素之间的 ","
+	COMMA TokenType = ","
+	// PLACEHOLDER 表示预处理语句中的参数，"?" 按位置绑定，":name" 按名称绑定
+	PLACEHOLDER TokenType = "PLACEHOLDER"
 )
 
-// 用于匹配关键字的映射
-var keywordMap = map[string]TokenType{
-	"CREATE":        ACTION,
-	"DROP":          ACTION,
-	"UPDATE":        ACTION,
-	"SELECT":        ACTION,
-	"BULK":          ACTION,
-	"ADD":           ACTION,
-	"SHOW":          ACTION,
-	"SET":           ACTION,
-	"SHARE":         ACTION,
-	"CHECKOUT":      ACTION,
-	"USE":           ACTION,
-	"ASYNC":         ASYNC,
-	"FILE":          FILENAME,
-	"AUTHORIZED":    PARAM,
-	"BY":            PARAM,
-	"OWNER":         PARAM,
-	"CONTENT":       CONTENT,
-	"WHERE":         WHERE,
-	"TAGS":          TAGS,
-	"TRANSFER":      TRANSFER,
-	"CO_OWNERS":     CO_OWNERS,
-	"VERSION":       VERSION,
-	"EXTENSION":     EXTENSION,
-	"FILES":         FILES,
-	"SIZE":          ATTRIBUTE,
-	"LAST_MODIFIED": ATTRIBUTE,
+// 用于匹配关键字的集合，关键字不区分大小写
+var keywords = map[string]bool{
+	"CREATE": true, "DROP": true, "UPDATE": true, "SELECT": true, "BULK": true, "ADD": true,
+	"SHOW": true, "SET": true, "SHARE": true, "CHECKOUT": true, "USE": true, "TRANSFER": true,
+	"ASYNC": true, "FILE": true, "FILES": true, "AUTHORIZED": true, "BY": true,
+	"CONTENT": true, "WHERE": true, "TAGS": true, "CO_OWNERS": true, "VERSION": true, "EXTENSION": true,
+	"AND": true, "OR": true, "NOT": true, "INCLUDE": true, "LIKE": true,
+	"TO": true, "FOR": true, "FROM": true, "WITH": true,
+	"EXPLAIN": true, "ORDER": true, "ASC": true, "DESC": true, "LIMIT": true, "OFFSET": true,
+	"CANCEL": true, "JOB": true, "JOBS": true,
 	// ... 根据需求增加其他关键词
 }
 
-// 用于匹配操作符的映射
-var operatorMap = map[string]TokenType{
-	"<":       OPERATOR,
-	">":       OPERATOR,
-	"=":       OPERATOR,
-	"AND":     OPERATOR,
-	"TO":      OPERATOR,
-	"FOR":     OPERATOR,
-	"FROM":    OPERATOR,
-	"INCLUDE": OPERATOR,
-	"SET":     OPERATOR,
-	"WITH":    OPERATOR,
-	// ... 根据需求增加其他操作符
+// 数字可以带有的大小单位，不区分大小写
+var sizeUnits = map[string]int64{
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+}
+
+// Pos 是Token在输入中的位置，行和列都从 1 开始，列按字符计算
+type Pos struct {
+	Line   int
+	Column int
+}
+
+// String 返回 "行:列" 形式的位置
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 // Token 表示一个词法单元
 type Token struct {
-	Type    TokenType // 词法单元类型：如 ACTION, FILENAME 等
+	Type    TokenType // 词法单元类型：如 KEYWORD, STRING 等
 	Literal string    // 词法单元的字面值
+	Pos     Pos       // 词法单元开始的位置
 }
 
-// parseKeyValue: 识别键值对格式的Token。
-// 支持的格式有:
-// 1. "key:value"
-// 2. 'key:value'
-// 3. key: value (无外部引号, 内部可能有多个空格)
-func parseKeyValue(input string) (Token, bool) {
-	pattern := regexp.MustCompile(`^["']?([^:]+)["']?\s*:\s*["']?([^"']+)["']?$`)
-	if matches := pattern.FindStringSubmatch(input); matches != nil {
-		// 避免处理特定的前缀内容
-		prefixes := []string{"filename", "did", "custom_name", "extension_name", "version_number"}
-		for _, prefix := range prefixes {
-			if strings.HasPrefix(matches[1], prefix) {
-				return Token{}, false
-			}
-		}
-		return Token{Type: KEYVALUE, Literal: input}, true
+// Is 检查Token是否为指定的关键字
+func (t Token) Is(keyword string) bool {
+	return t.Type == KEYWORD && t.Literal == keyword
+}
+
+// String 返回便于在错误中展示的字面值
+func (t Token) String() string {
+	switch t.Type {
+	case EOF:
+		return "输入结束"
+	case STRING:
+		return strconv.Quote(t.Literal)
 	}
-	return Token{}, false
+	return t.Literal
 }
 
-// parseList: 识别列表格式的Token。
-// 支持的格式有:
-// 1. [item1, item2, item3]
-// 2. ['item1', 'item2', 'item3']
-// 3. ["item1", "item2", "item3"]
-// 列表之间的项可以有多个空格，也可以被单/双引号包围。
-func parseList(input string) ([]Token, bool) {
-	// 正则表达式匹配 参数名=列表 这种形式
-	paramListPattern := regexp.MustCompile(`^(\w+)=\[.*\]$`)
-
-	if matches := paramListPattern.FindStringSubmatch(input); matches != nil {
-		// 取出参数名和参数值
-		paramName := matches[1]
-		listContent := strings.Trim(strings.Trim(input, paramName+"="), "[]")
-
-		itemsSlice := strings.Split(listContent, ",")
-		cleanItemsSlice := []string{}
-		for _, item := range itemsSlice {
-			item = strings.TrimSpace(item)
-			item = strings.Trim(item, "\"'")
-			if item == "" {
-				return nil, false
-			}
-			cleanItemsSlice = append(cleanItemsSlice, item)
-		}
-		cleanItems := "[" + strings.Join(cleanItemsSlice, ", ") + "]"
+// ParseError 是词法分析或语法分析的错误，指出出错的行和列
+type ParseError struct {
+	Pos Pos
+	Msg string
+}
 
-		return []Token{
-			{Type: PARAM, Literal: paramName},
-			{Type: LIST, Literal: cleanItems},
-		}, true
-	}
-	return nil, false
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("第 %d 行第 %d 列: %s", e.Pos.Line, e.Pos.Column, e.Msg)
 }
 
-// parseParam: 识别参数格式的Token。
-// 支持的格式有:
-// 1. param=value
-// 2. param="value"
-// 3. param='value'
-// 参数和它的值之间可能有多个空格，值也可能被单/双引号包围。
-func parseParam(input string) (Token, bool) {
-	// 不再匹配列表，因为这个已经在 parseList 中处理了
-	paramPattern := regexp.MustCompile(`([^=]+)\s*=\s*(["']?[^ ]+["']?)`)
-	if paramPattern.MatchString(input) {
-		return Token{Type: PARAM, Literal: input}, true
-	}
-	return Token{}, false
+// scanner 逐个字符扫描输入
+type scanner struct {
+	input []rune
+	off   int // 下一个字符的下标
+	pos   Pos // 下一个字符的位置
 }
 
-// parseDate: 识别日期格式的Token。
-// 支持的格式有:
-// 1. '2023-09-19'
-// 2. 2023-09-19 (无引号)
-// 这个方法还会识别被单引号包围的任意内容作为别名Token。
-func parseDate(input string) (Token, bool) {
-	datePattern := regexp.MustCompile(`^'?\d{4}-\d{2}-\d{2}'?$`)
-	if datePattern.MatchString(input) {
-		return Token{Type: DATE, Literal: input}, true
-	} else if strings.HasPrefix(input, "'") && strings.HasSuffix(input, "'") {
-		return Token{Type: ALIAS, Literal: input}, true
+// Lex 是词法分析器，将输入字符串转换为Token序列，序列以 EOF 结束
+// 支持单引号和双引号的字符串及其中的转义、带单位的数字、日期、列表、注释和任意的标识符。
+// 注释为 "--" 到行尾，或者 "/*" 与 "*/" 之间的内容；"?" 和 ":name" 是预处理语句的参数。
+func Lex(input string) ([]Token, error) {
+	s := &scanner{input: []rune(input), pos: Pos{Line: 1, Column: 1}}
+	var tokens []Token
+	for {
+		tok, err := s.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.Type == EOF {
+			return tokens, nil
+		}
 	}
-	return Token{}, false
 }
 
-// parseNumber: 识别数字格式的Token。
-// 支持的格式有:
-// 1. 整数，如 123
-// 2. 浮点数，如 123.45
-func parseNumber(input string) (Token, bool) {
-	numberPattern := regexp.MustCompile(`^\d+(\.\d+)?$`)
-	if numberPattern.MatchString(input) {
-		return Token{Type: NUMBER, Literal: input}, true
+// peek 返回之后第 n 个字符，超出输入时返回 0
+func (s *scanner) peek(n int) rune {
+	if s.off+n < len(s.input) {
+		return s.input[s.off+n]
 	}
-	return Token{}, false
+	return 0
 }
 
-// encodeSpaces 用于编码字符串中的空格
-// 找到所有的单引号和双引号之间的字符串，并将这些字符串中的空格替换为 "_SPACE_"。
-// 在分割字符串后，这些空格将会被还原。
-// 这样就可以保持字符串中的空格，而不影响其它部分的分割。
-func encodeSpaces(input string) (string, map[string]string) {
-	re := regexp.MustCompile(`'([^']*)'|"([^"]*)"`)
-
-	matches := re.FindAllStringSubmatch(input, -1)
-	replacements := make(map[string]string)
-
-	for _, match := range matches {
-		var original string
-		if match[1] != "" {
-			original = "'" + match[1] + "'"
-		} else {
-			original = "\"" + match[2] + "\""
-		}
-
-		replaced := strings.ReplaceAll(original, " ", "_SPACE_")
-		replacements[replaced] = original
-		input = strings.Replace(input, original, replaced, 1)
+// read 读取一个字符并更新位置
+func (s *scanner) read() rune {
+	r := s.input[s.off]
+	s.off++
+	if r == '\n' {
+		s.pos.Line++
+		s.pos.Column = 1
+	} else {
+		s.pos.Column++
 	}
+	return r
+}
 
-	return input, replacements
+// errorf 返回指向 pos 的错误
+func (s *scanner) errorf(pos Pos, format string, args ...interface{}) error {
+	return &ParseError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
 }
 
-// decodeSpaces 解码字符串中的空格
-func decodeSpaces(input string, replacements map[string]string) string {
-	for replaced, original := range replacements {
-		input = strings.Replace(input, replaced, original, 1)
+// skip 跳过空白和注释
+func (s *scanner) skip() error {
+	for s.off < len(s.input) {
+		r := s.peek(0)
+		switch {
+		case unicode.IsSpace(r):
+			s.read()
+		case r == '-' && s.peek(1) == '-':
+			for s.off < len(s.input) && s.peek(0) != '\n' {
+				s.read()
+			}
+		case r == '/' && s.peek(1) == '*':
+			start := s.pos
+			s.read()
+			s.read()
+			for {
+				if s.off >= len(s.input) {
+					return s.errorf(start, "未结束的注释")
+				}
+				if s.peek(0) == '*' && s.peek(1) == '/' {
+					s.read()
+					s.read()
+					break
+				}
+				s.read()
+			}
+		default:
+			return nil
+		}
 	}
-
-	return input
+	return nil
 }
 
-// Lex 是词法分析器，将输入字符串转换为Token序列
-func Lex(input string) ([]Token, error) {
-	// 首先对输入字符串中带引号的部分进行空格的编码
-	// 为了在分割字符串时能保留带引号的部分中的空格
-	input, replacements := encodeSpaces(input)
+// next 返回下一个Token
+func (s *scanner) next() (Token, error) {
+	if err := s.skip(); err != nil {
+		return Token{}, err
+	}
+	start := s.pos
+	if s.off >= len(s.input) {
+		return Token{Type: EOF, Pos: start}, nil
+	}
 
-	// 使用 strings.FieldsFunc 来分割字符串，按空格分割，但保留带引号的部分
-	f := func(c rune) bool {
-		return c == ' ' && !strings.ContainsRune("\"'", c)
+	r := s.peek(0)
+	switch {
+	case r == '\'' || r == '"':
+		return s.scanString()
+	case isDigit(r):
+		return s.scanNumber()
+	case isIdentStart(r):
+		return s.scanIdent(), nil
 	}
-	parts := strings.FieldsFunc(input, f)
-	tokens := []Token{}
-
-	// 用于处理跨多个part的Token，例如处理 "[tag1, tag2]"
-	var isProcessingList bool
-	var tempListContent string
-
-	// 遍历所有的部分并将它们转换为Token
-	for index := 0; index < len(parts); index++ {
-		part := parts[index]
-
-		// 当词法分析器遇到 "FILE" 时，它需要检查下一个 token，捕获文件名并返回正确的 Literal。
-		if part == "FILE" {
-			if index+1 < len(parts) {
-				filenameToken := strings.Trim(parts[index+1], "'")
-				tokens = append(tokens, Token{Type: FILENAME, Literal: filenameToken})
-				index++ // skip the filename token
-				continue
-			}
-		}
 
-		if part == "AUTHORIZED" {
-			if index+2 < len(parts) && parts[index+1] == "BY" {
-				didToken := strings.Trim(parts[index+2], "'")
-				tokens = append(tokens, Token{Type: DID, Literal: didToken})
-				index += 2 // skip the BY and did token
-				continue
+	s.read()
+	switch r {
+	case '[':
+		return Token{Type: LBRACKET, Literal: "[", Pos: start}, nil
+	case ']':
+		return Token{Type: RBRACKET, Literal: "]", Pos: start}, nil
+	case '(':
+		return Token{Type: LPAREN, Literal: "(", Pos: start}, nil
+	case ')':
+		return Token{Type: RPAREN, Literal: ")", Pos: start}, nil
+	case ',':
+		return Token{Type: COMMA, Literal: ",", Pos: start}, nil
+	case '?':
+		return Token{Type: PLACEHOLDER, Literal: "?", Pos: start}, nil
+	case ':':
+		if isLetter(s.peek(0)) {
+			lit := []rune{r}
+			for r := s.peek(0); isLetter(r) || unicode.IsDigit(r); r = s.peek(0) {
+				lit = append(lit, s.read())
 			}
+			return Token{Type: PLACEHOLDER, Literal: string(lit), Pos: start}, nil
 		}
+	case '=':
+		return Token{Type: OPERATOR, Literal: "=", Pos: start}, nil
+	case '<', '>':
+		if s.peek(0) == '=' {
+			s.read()
+			return Token{Type: OPERATOR, Literal: string(r) + "=", Pos: start}, nil
+		}
+		if r == '<' && s.peek(0) == '>' {
+			s.read()
+			return Token{Type: OPERATOR, Literal: "!=", Pos: start}, nil
+		}
+		return Token{Type: OPERATOR, Literal: string(r), Pos: start}, nil
+	case '!':
+		if s.peek(0) == '=' {
+			s.read()
+			return Token{Type: OPERATOR, Literal: "!=", Pos: start}, nil
+		}
+	}
+	return Token{}, s.errorf(start, "非法的字符 %q", r)
+}
 
-		// 检查是否在处理列表或带空格的字符串
-		if isProcessingList || strings.HasPrefix(part, "'") {
-			tempListContent += " " + part
-			if strings.HasSuffix(part, "]") || strings.HasSuffix(part, "'") {
-				isProcessingList = false
-				// 尝试将组合的内容处理为列表或日期Token
-				if token, handled := parseList(tempListContent); handled {
-					tokens = append(tokens, token...)
-					tempListContent = ""
-				} else if token, handled := parseDate(tempListContent); handled {
-					tokens = append(tokens, token)
-					tempListContent = ""
+// scanString 扫描单引号或双引号中的字符串，支持 \\、\'、\"、\n、\t、\r 和 \uXXXX 转义
+func (s *scanner) scanString() (Token, error) {
+	start := s.pos
+	quote := s.read()
+	var b strings.Builder
+	for {
+		if s.off >= len(s.input) {
+			return Token{}, s.errorf(start, "未结束的字符串")
+		}
+		escPos := s.pos
+		r := s.read()
+		switch r {
+		case quote:
+			return Token{Type: STRING, Literal: b.String(), Pos: start}, nil
+		case '\\':
+			if s.off >= len(s.input) {
+				return Token{}, s.errorf(start, "未结束的字符串")
+			}
+			e := s.read()
+			switch e {
+			case '\\', '\'', '"':
+				b.WriteRune(e)
+			case 'n':
+				b.WriteRune('\n')
+			case 't':
+				b.WriteRune('\t')
+			case 'r':
+				b.WriteRune('\r')
+			case 'u':
+				var hex []rune
+				for i := 0; i < 4 && s.off < len(s.input); i++ {
+					hex = append(hex, s.read())
 				}
+				code, err := strconv.ParseUint(string(hex), 16, 32)
+				if err != nil || len(hex) != 4 || !utf8.ValidRune(rune(code)) {
+					return Token{}, s.errorf(escPos, "非法的转义 \\u%s", string(hex))
+				}
+				b.WriteRune(rune(code))
+			default:
+				return Token{}, s.errorf(escPos, "非法的转义 \\%c", e)
 			}
-			continue
+		default:
+			b.WriteRune(r)
 		}
+	}
+}
+
+// scanNumber 扫描数字或日期，数字可以带有大小单位
+func (s *scanner) scanNumber() (Token, error) {
+	start := s.pos
+	if s.isDate() {
+		lit := string(s.input[s.off : s.off+10])
+		for i := 0; i < 10; i++ {
+			s.read()
+		}
+		return Token{Type: DATE, Literal: lit, Pos: start}, nil
+	}
 
-		// 检查当前部分是否是已定义的关键词
-		if tokenType, exists := keywordMap[part]; exists {
-			// 如果关键字是一个文件属性并且后续还有两个token（操作符和数字）
-			if tokenType == ATTRIBUTE && index+2 < len(parts) && operatorMap[parts[index+1]] == OPERATOR {
-				combinedToken := part + " " + parts[index+1] + " " + parts[index+2]
-				tokens = append(tokens, Token{Type: ATTRIBUTE, Literal: combinedToken})
-				index += 2 // skip the next two tokens
-				continue
-			} else {
-				tokens = append(tokens, Token{Type: tokenType, Literal: part})
-				continue
+	begin := s.off
+	for isDigit(s.peek(0)) {
+		s.read()
+	}
+	if s.peek(0) == '.' && isDigit(s.peek(1)) {
+		s.read()
+		for isDigit(s.peek(0)) {
+			s.read()
+		}
+	}
+	unitPos := s.pos
+	unitBegin := s.off
+	for isLetter(s.peek(0)) {
+		s.read()
+	}
+	if unit := string(s.input[unitBegin:s.off]); unit != "" {
+		if _, ok := sizeUnits[strings.ToUpper(unit)]; !ok {
+			return Token{}, s.errorf(unitPos, "未知的单位 %q", unit)
+		}
+	}
+	if isIdentPart(s.peek(0)) {
+		return Token{}, s.errorf(s.pos, "非法的数字 %q", string(s.input[begin:s.off+1]))
+	}
+	return Token{Type: NUMBER, Literal: string(s.input[begin:s.off]), Pos: start}, nil
+}
+
+// isDate 检查接下来的字符是否为 YYYY-MM-DD 形式的日期
+func (s *scanner) isDate() bool {
+	for i := 0; i < 10; i++ {
+		r := s.peek(i)
+		if i == 4 || i == 7 {
+			if r != '-' {
+				return false
 			}
-		} else if tokenType, exists := operatorMap[part]; exists {
-			// 检查当前部分是否是已定义的操作符
-			tokens = append(tokens, Token{Type: tokenType, Literal: part})
-		} else if token, handled := parseKeyValue(part); handled {
-			// 尝试将当前部分处理为键值对Token
-			tokens = append(tokens, token)
-		} else if token, handled := parseParam(part); handled {
-			// 尝试将当前部分处理为KEY=VALUE格式的参数Token
-			tokens = append(tokens, token)
-		} else if token, handled := parseDate(part); handled {
-			// 尝试将当前部分处理为日期Token
-			tokens = append(tokens, token)
-		} else if token, handled := parseNumber(part); handled {
-			// 尝试将当前部分处理为数字Token
-			tokens = append(tokens, token)
-		} else if strings.HasPrefix(part, "[") {
-			// 开始处理列表，例如 "[tag1"
-			isProcessingList = true
-			tempListContent = part
-		} else if strings.HasPrefix(part, "filename") || strings.HasPrefix(part, "did") ||
-			strings.HasPrefix(part, "custom_name") || strings.HasPrefix(part, "extension_name") ||
-			strings.HasPrefix(part, "version_number") {
-			// 如果当前部分是某些已知的前缀，则将其处理为别名Token
-			tokens = append(tokens, Token{Type: ALIAS, Literal: part})
-		} else {
-			// 如果当前部分不能被任何规则处理，那么它是一个未知的Token
-			return nil, fmt.Errorf("未知的Token: " + part)
+		} else if !isDigit(r) {
+			return false
 		}
 	}
+	return !isIdentPart(s.peek(10))
+}
+
+// scanIdent 扫描标识符或关键字
+// 标识符可以包含字母、数字和 _ . - : /，因此未加引号的DID和文件名可以直接书写。
+func (s *scanner) scanIdent() Token {
+	start := s.pos
+	begin := s.off
+	for isIdentPart(s.peek(0)) && !(s.peek(0) == '-' && s.peek(1) == '-') {
+		s.read()
+	}
+	lit := string(s.input[begin:s.off])
+	if upper := strings.ToUpper(lit); keywords[upper] {
+		return Token{Type: KEYWORD, Literal: upper, Pos: start}
+	}
+	return Token{Type: IDENT, Literal: lit, Pos: start}
+}
 
-	// 对tokens中的字面值进行空格的解码，以还原被编码过的空格
-	for i := range tokens {
-		tokens[i].Literal = decodeSpaces(tokens[i].Literal, replacements)
+// ParseSize 解析可以带有单位的数字（如 5000、1.5KB、5MB），返回字节数
+func ParseSize(s string) (int64, error) {
+	i := len(s)
+	for i > 0 && isLetter(rune(s[i-1])) {
+		i--
+	}
+	mult := int64(1)
+	if unit := s[i:]; unit != "" {
+		var ok bool
+		if mult, ok = sizeUnits[strings.ToUpper(unit)]; !ok {
+			return 0, fmt.Errorf("未知的单位 %q", unit)
+		}
 	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("非法的数字 %q", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+func isDigit(r rune) bool {
+	return '0' <= r && r <= '9'
+}
+
+func isLetter(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentStart(r rune) bool {
+	return isLetter(r)
+}
 
-	return tokens, nil
+func isIdentPart(r rune) bool {
+	return isLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == ':' || r == '/'
 }
@@ -1,71 +1,88 @@
 package bpfsfql
 
 import (
-	"fmt"
+	"errors"
+	"reflect"
 	"testing"
 )
 
 func TestLex(t *testing.T) {
-	// 示例代码
-	inputs := []string{
-		`CREATE FILE 'filepath' OWNER 'did' CUSTOM_NAME 'custom_name' METADATA [key1:value1, key2:value2]`,
-		`DROP FILE 'filehash' AUTHORIZED BY 'did'`,
-		`UPDATE FILE 'filehash' SET CONTENT 'new content' WHERE SIZE < 5000 AND LAST_MODIFIED > '2023-01-01' AUTHORIZED BY 'did'`,
-		`SELECT CONTENT FROM FILE 'filehash' AUTHORIZED BY 'did'`,
-		`BULK TRANSFER FILES [filehash1, filehash2, ...] FROM 'did_from' TO 'did_to'`,
-		`ALTER FILE 'filehash' ADD TAGS [tag1, tag2, ...] AUTHORIZED BY 'did'`,
-		`SELECT FILES WHERE TAGS INCLUDE [tag1, tag2, ...] AND OWNER 'did'`,
-		`TRANSFER FILE 'filehash' TO 'did' AUTHORIZED BY 'did'`,
-		`ALTER FILE 'filehash' SET CO_OWNERS [did1, did2, ...] AUTHORIZED BY 'did'`,
-		`SHARE FILE 'filehash' WITH 'did' AUTHORIZED BY 'did'`,
-		`CHECKOUT FILE 'filehash' VERSION 'version_number' AUTHORIZED BY 'did'`,
-		`USE EXTENSION 'extension_name' PARAMETERS [key1:value1, key2:value2]`,
-		`ASYNC CREATE FILE 'filepath' OWNER 'did'`,
+	input := "SHOW files -- 注释\nWHERE size <= 5MB /* 多行\n注释 */ AND name != 'it\\'s \"ok\"'\n" +
+		`OR LAST_MODIFIED > 2023-01-01 AND TAGS INCLUDE ["a", b] AND OWNED_BY=did:key:z6Mk`
 
-		// `CREATE FILE filename OWNED_BY=did CUSTOM_NAME=custom_name METADATA=\"key1:value1,key2:value2\"`,
-		// `DROP FILE filename AUTHORIZED BY did`,
-		// `CREATE FILE filename OWNED_BY=did CUSTOM_NAME=custom_name METADATA="key1:value1,key2:value2"`,
-		// `DROP FILE filename AUTHORIZED BY did`,
-		// `UPDATE FILE filename SET CONTENT='new content' WHERE SIZE < 5000 AND LAST_MODIFIED > '2023-01-01' AUTHORIZED BY did`,
-		// `SELECT CONTENT FROM FILE filename AUTHORIZED BY did`,
-		// `BULK TRANSFER FILES [file1, file2] TO did_from did_to`,
-		// `ADD TAGS TO FILE filename TAGS [tag1, tag2] AUTHORIZED BY did`,
-		// `SHOW FILES WHERE TAGS INCLUDE [tag1, tag2] AND OWNED_BY=did`,
-		// `TRANSFER FILE filename TO did AUTHORIZED BY did`,
-		// `SET CO_OWNERS FOR FILE filename CO_OWNERS [did1, did2] AUTHORIZED BY did`,
-		// `SHARE FILE filename WITH did AUTHORIZED BY did`,
-		// `CHECKOUT FILE filename VERSION version_number AUTHORIZED BY did`,
-		// `USE EXTENSION extension_name PARAMETERS="key1:value1,key2:value2"`,
-		// `ASYNC CREATE FILE filename OWNED_BY=did`,
-
-		// `CREATE FILE 'filename' OWNED_BY='did' CUSTOM_NAME='custom_name' METADATA='key1:value1, key2:value2'`,
-		// `DROP FILE 'filename' AUTHORIZED BY 'did'`,
-		// `UPDATE FILE 'filename' SET CONTENT='new content' WHERE SIZE < 5000 AND LAST_MODIFIED > '2023-01-01' AUTHORIZED BY 'did'`,
-		// `SELECT CONTENT FROM FILE 'filename' AUTHORIZED BY 'did'`,
-		// `BULK TRANSFER FILES ['file1', 'file2'] FROM 'did_from' TO 'did_to'`,
-		// `ADD TAGS TO FILE 'filename' TAGS ['tag1', 'tag2'] AUTHORIZED BY 'did'`,
-		// `SHOW FILES WHERE TAGS INCLUDE ['tag1', 'tag2'] AND OWNED_BY='did'`,
-		// `TRANSFER FILE 'filename' TO 'did' AUTHORIZED BY 'did'`,
-		// `SET CO_OWNERS FOR FILE 'filename' CO_OWNERS=['did1', 'did2'] AUTHORIZED BY 'did'`,
-		// `SHARE FILE 'filename' WITH 'did' AUTHORIZED BY 'did'`,
-		// `CHECKOUT FILE 'filename' VERSION 'version_number' AUTHORIZED BY 'did'`,
-		// `USE EXTENSION 'extension_name' PARAMETERS='key1:value1, key2:value2'`,
-		// `ASYNC CREATE FILE 'filename' OWNED_BY='did'`,
+	want := []Token{
+		{KEYWORD, "SHOW", Pos{1, 1}},
+		{KEYWORD, "FILES", Pos{1, 6}},
+		{KEYWORD, "WHERE", Pos{2, 1}},
+		{IDENT, "size", Pos{2, 7}},
+		{OPERATOR, "<=", Pos{2, 12}},
+		{NUMBER, "5MB", Pos{2, 15}},
+		{KEYWORD, "AND", Pos{3, 7}},
+		{IDENT, "name", Pos{3, 11}},
+		{OPERATOR, "!=", Pos{3, 16}},
+		{STRING, `it's "ok"`, Pos{3, 19}},
+		{KEYWORD, "OR", Pos{4, 1}},
+		{IDENT, "LAST_MODIFIED", Pos{4, 4}},
+		{OPERATOR, ">", Pos{4, 18}},
+		{DATE, "2023-01-01", Pos{4, 20}},
+		{KEYWORD, "AND", Pos{4, 31}},
+		{KEYWORD, "TAGS", Pos{4, 35}},
+		{KEYWORD, "INCLUDE", Pos{4, 40}},
+		{LBRACKET, "[", Pos{4, 48}},
+		{STRING, "a", Pos{4, 49}},
+		{COMMA, ",", Pos{4, 52}},
+		{IDENT, "b", Pos{4, 54}},
+		{RBRACKET, "]", Pos{4, 55}},
+		{KEYWORD, "AND", Pos{4, 57}},
+		{IDENT, "OWNED_BY", Pos{4, 61}},
+		{OPERATOR, "=", Pos{4, 69}},
+		{IDENT, "did:key:z6Mk", Pos{4, 70}},
+		{EOF, "", Pos{4, 82}},
+	}
 
-		// ... 添加其他测试语句
+	tokens, err := Lex(input)
+	if err != nil {
+		t.Fatal(err)
 	}
+	if !reflect.DeepEqual(tokens, want) {
+		for i := range tokens {
+			if i >= len(want) || tokens[i] != want[i] {
+				t.Fatalf("第 %d 个Token为 %+v", i, tokens[i])
+			}
+		}
+		t.Fatalf("Token数量为 %d，期望 %d", len(tokens), len(want))
+	}
+}
 
-	for _, input := range inputs {
-		fmt.Println("Parsing:", input)
-		tokens, err := Lex(input)
-		if err != nil {
-			fmt.Printf("错误:%v\n\n", err)
-			continue
+func TestLexErrors(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		pos   Pos
+	}{
+		{`DROP FILE 'filename AUTHORIZED BY did`, Pos{1, 11}},
+		{`SHOW FILES WHERE SIZE < 5XB`, Pos{1, 26}},
+		{"SHOW FILES\nWHERE SIZE # 5", Pos{2, 12}},
+		{`USE EXTENSION "a\qb"`, Pos{1, 17}},
+		{`SHOW FILES /* 注释`, Pos{1, 12}},
+	} {
+		_, err := Lex(tc.input)
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Fatalf("%q 返回 %v", tc.input, err)
 		}
-		for _, token := range tokens {
-			fmt.Printf("%+v\n", token)
+		if perr.Pos != tc.pos {
+			t.Fatalf("%q 的错误位置为 %v，期望 %v: %v", tc.input, perr.Pos, tc.pos, err)
 		}
+	}
+}
 
-		fmt.Printf("\n\n")
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]int64{"5000": 5000, "5MB": 5 << 20, "1.5kb": 1536, "2GB": 2 << 30} {
+		if n, err := ParseSize(s); err != nil || n != want {
+			t.Fatalf("ParseSize(%q) = %d, %v", s, n, err)
+		}
+	}
+	if _, err := ParseSize("5XB"); err == nil {
+		t.Fatal("解析未知的单位成功")
 	}
 }
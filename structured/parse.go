@@ -1,161 +1,639 @@
 // Parse: 语法分析
 package bpfsfql
 
-import "strings"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
-// Parser 结构体
+// Parser 是递归下降的语法分析器
+// 遇到错误时记录错误并继续分析，使一条语句中的多个错误可以一次报告。
 type Parser struct {
-	tokens  []Token
-	current int
+	tokens       []Token
+	current      int
+	errors       []ParseError
+	placeholders bool // 是否允许参数占位符，只有 Prepare 允许
 }
 
-// NewParser 创建一个新的Parser实例
+// NewParser 创建一个新的Parser实例，tokens 由 Lex 生成
 func NewParser(tokens []Token) *Parser {
 	return &Parser{tokens: tokens}
 }
 
-// ParseStatement 解析一个语句
-func (p *Parser) ParseStatement() Statement {
+// ParseStatement 解析一个语句，返回对应的类型化语句和全部语法错误
+// 存在错误时返回的语句可能不完整，也可能为空。
+func (p *Parser) ParseStatement() (Statement, []ParseError) {
+	explain := p.currentToken()
+	if explain.Is("EXPLAIN") {
+		p.advance()
+	}
+	async := false
+	if p.currentToken().Is("ASYNC") {
+		async = true
+		p.advance()
+	}
+
+	var stmt Statement
+	tok := p.currentToken()
 	switch {
-	// case p.currentToken().Type == CREATE:
-	// return p.parseCreateStatement()
-	case p.currentToken().Type == ACTION:
-		return p.parseActionStatement()
+	case tok.Is("CREATE"):
+		stmt = p.parseCreateFile(async)
+	case tok.Is("DROP"):
+		stmt = p.parseDropFile()
+	case tok.Is("UPDATE"):
+		stmt = p.parseUpdateFile()
+	case tok.Is("SELECT"):
+		stmt = p.parseSelectContent()
+	case tok.Is("BULK"):
+		stmt = p.parseBulkTransfer(async)
+	case tok.Is("ADD"):
+		stmt = p.parseAddTags()
+	case tok.Is("SHOW"):
+		stmt = p.parseShow()
+	case tok.Is("TRANSFER"):
+		stmt = p.parseTransferFile()
+	case tok.Is("SET"):
+		stmt = p.parseSetCoOwners()
+	case tok.Is("SHARE"):
+		stmt = p.parseShareFile()
+	case tok.Is("CHECKOUT"):
+		stmt = p.parseCheckoutFile()
+	case tok.Is("USE"):
+		stmt = p.parseUseExtension()
+	case tok.Is("CANCEL"):
+		stmt = p.parseCancelJob()
+	case tok.Type == EOF:
+		p.errorf(tok, "空的语句")
+		return nil, p.errors
 	default:
-		// Handle other cases or throw error
-		return nil
+		p.errorf(tok, "未知的语句 %s", tok)
+		return nil, p.errors
+	}
+
+	if async {
+		switch stmt.(type) {
+		case *CreateFileStmt, *BulkTransferStmt:
+		default:
+			p.errorf(tok, "%s 不支持 ASYNC", stmt.TokenLiteral())
+		}
+	}
+	if explain.Is("EXPLAIN") {
+		if show, ok := stmt.(*ShowFilesStmt); ok {
+			show.Explain = true
+		} else {
+			p.errorf(explain, "%s 不支持 EXPLAIN", stmt.TokenLiteral())
+		}
+	}
+	if tok := p.currentToken(); tok.Type != EOF {
+		p.errorf(tok, "%s 语句中多余的 %s", stmt.TokenLiteral(), tok)
 	}
+	return stmt, p.errors
 }
 
-func (p *Parser) parseCreateStatement() *ActionStatement {
-	stmt := &ActionStatement{Token: p.currentToken()}
-	p.advance() // Move past CREATE
-	stmt.Target = p.parseTargetExpression()
+// parseCreateFile 解析 CREATE FILE 'filename' OWNED_BY='did' CUSTOM_NAME=custom_name METADATA="key1:value1,key2:value2"
+func (p *Parser) parseCreateFile(async bool) *CreateFileStmt {
+	start := p.currentToken()
+	p.advance() // 跳过 CREATE
+	stmt := &CreateFileStmt{Async: async, File: p.parseFilename()}
 
-	for p.currentToken().Type == PARAM {
-		param := p.parseParameterExpression()
-		stmt.Parameters = append(stmt.Parameters, param)
-		p.advance()
+	seen := make(map[string]bool)
+	for p.currentToken().Type == IDENT {
+		tok := p.currentToken()
+		key, value := p.parseParameter()
+		if seen[key] {
+			p.errorf(tok, "重复的参数 %s", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "OWNED_BY", "OWNER":
+			stmt.Owner = value
+		case "CUSTOM_NAME":
+			stmt.CustomName = value
+		case "METADATA":
+			stmt.Metadata = p.parseMetadata(tok, value)
+		default:
+			p.errorf(tok, "CREATE FILE 不支持参数 %s", key)
+		}
+	}
+	if !seen["OWNED_BY"] && !seen["OWNER"] {
+		p.errorf(start, "CREATE FILE 缺少 OWNED_BY")
 	}
+	return stmt
+}
 
+// parseDropFile 解析 DROP FILE 'filename' AUTHORIZED BY 'did'
+func (p *Parser) parseDropFile() *DropFileStmt {
+	p.advance() // 跳过 DROP
+	stmt := &DropFileStmt{File: p.parseFilename()}
+	stmt.AuthorizedBy = p.parseAuthorizedBy()
 	return stmt
 }
 
-// parseActionStatement 解析一个动作语句，例如 CREATE, DROP 等
-func (p *Parser) parseActionStatement() *ActionStatement {
-	stmt := &ActionStatement{Token: p.currentToken()}
-	stmt.Name = p.currentToken().Literal
-	p.advance() // Move to next token
+// parseUpdateFile 解析 UPDATE FILE 'filename' SET CONTENT='new content' WHERE ... AUTHORIZED BY 'did'
+func (p *Parser) parseUpdateFile() *UpdateFileStmt {
+	p.advance() // 跳过 UPDATE
+	stmt := &UpdateFileStmt{File: p.parseFilename()}
+	p.expectKeyword("SET")
+	p.expectKeyword("CONTENT")
+	p.expectOperator("=")
+	stmt.Content = p.parseValue()
+	stmt.Where = p.parseWhere()
+	stmt.AuthorizedBy = p.parseAuthorizedBy()
+	return stmt
+}
 
-	stmt.Target = p.parseTargetExpression()
+// parseSelectContent 解析 SELECT CONTENT FROM FILE 'filename' AUTHORIZED BY 'did'
+func (p *Parser) parseSelectContent() *SelectContentStmt {
+	p.advance() // 跳过 SELECT
+	p.expectKeyword("CONTENT")
+	p.expectKeyword("FROM")
+	stmt := &SelectContentStmt{File: p.parseFilename()}
+	stmt.AuthorizedBy = p.parseAuthorizedBy()
+	return stmt
+}
 
-	// 根据语法结构，循环解析参数、列表和条件
-	for {
-		switch {
-		case p.currentToken().Type == PARAM:
-			param := p.parseParameterExpression()
-			stmt.Parameters = append(stmt.Parameters, param)
-		case p.currentToken().Type == LIST:
-			list := p.parseListStatement()
-			stmt.Lists = append(stmt.Lists, *list)
-		case p.currentToken().Type == OPERATOR:
-			cond := p.parseConditionStatement()
-			stmt.Conditions = append(stmt.Conditions, *cond)
-		default:
-			return stmt // 如果遇到其他Token类型，则返回stmt
-		}
+// parseBulkTransfer 解析 BULK TRANSFER FILES [file1, file2, ...] FROM did_from TO did_to
+func (p *Parser) parseBulkTransfer(async bool) *BulkTransferStmt {
+	p.advance() // 跳过 BULK
+	p.expectKeyword("TRANSFER")
+	p.expectKeyword("FILES")
+	stmt := &BulkTransferStmt{Async: async}
+	if list := p.parseList(); list != nil {
+		stmt.Files = list.Values()
+	}
+	p.expectKeyword("FROM")
+	stmt.From = p.parseValue()
+	p.expectKeyword("TO")
+	stmt.To = p.parseValue()
+	return stmt
+}
+
+// parseAddTags 解析 ADD TAGS TO FILE 'filename' TAGS [tag1, tag2, ...] AUTHORIZED BY 'did'
+func (p *Parser) parseAddTags() *AddTagsStmt {
+	p.advance() // 跳过 ADD
+	p.expectKeyword("TAGS")
+	p.expectKeyword("TO")
+	stmt := &AddTagsStmt{File: p.parseFilename()}
+	p.expectKeyword("TAGS")
+	if list := p.parseList(); list != nil {
+		stmt.Tags = list.Values()
+	}
+	stmt.AuthorizedBy = p.parseAuthorizedBy()
+	return stmt
+}
+
+// parseShow 解析 SHOW JOBS、SHOW JOB 'id' 和 SHOW FILES
+func (p *Parser) parseShow() Statement {
+	p.advance() // 跳过 SHOW
+	switch tok := p.currentToken(); {
+	case tok.Is("JOBS"):
 		p.advance()
+		return &ShowJobsStmt{}
+	case tok.Is("JOB"):
+		p.advance()
+		return &ShowJobStmt{ID: p.parseValue()}
 	}
+	return p.parseShowFiles()
 }
 
-// parseTargetExpression 解析目标表达式，例如 FILE
-func (p *Parser) parseTargetExpression() Expression {
-	expr := &TargetExpression{
-		Token: p.currentToken(),
-		Name:  p.currentToken().Literal,
+// parseShowFiles 解析 SHOW FILES WHERE ... ORDER BY field [ASC|DESC], ... LIMIT n OFFSET m
+func (p *Parser) parseShowFiles() *ShowFilesStmt {
+	p.expectKeyword("FILES")
+	stmt := &ShowFilesStmt{Where: p.parseWhere()}
+
+	if p.currentToken().Is("ORDER") {
+		p.advance()
+		p.expectKeyword("BY")
+		for {
+			tok := p.currentToken()
+			if tok.Type != IDENT {
+				p.errorf(tok, "期望文件属性，实际为 %s", tok)
+				break
+			}
+			p.advance()
+			item := OrderItem{Field: &Field{Name: strings.ToUpper(tok.Literal), Pos: tok.Pos}}
+			if dir := p.currentToken(); dir.Is("ASC") || dir.Is("DESC") {
+				item.Desc = dir.Is("DESC")
+				p.advance()
+			}
+			stmt.OrderBy = append(stmt.OrderBy, item)
+
+			if p.currentToken().Type != COMMA {
+				break
+			}
+			p.advance()
+		}
 	}
-	p.advance() // Move to next token
-	return expr
+
+	if p.currentToken().Is("LIMIT") {
+		p.advance()
+		stmt.Limit = p.parseCount("LIMIT", 1)
+	}
+	if p.currentToken().Is("OFFSET") {
+		p.advance()
+		stmt.Offset = p.parseCount("OFFSET", 0)
+	}
+	return stmt
 }
 
-// parseParameterExpression 解析一个参数表达式
-func (p *Parser) parseParameterExpression() Expression {
-	param := &ParameterExpression{
-		Token: p.currentToken(),
-		Key:   p.currentToken().Literal,
+// parseCount 解析 LIMIT 和 OFFSET 之后不带单位的整数，不能小于 min
+func (p *Parser) parseCount(keyword string, min int) int {
+	tok := p.currentToken()
+	if tok.Type == PLACEHOLDER {
+		p.parseLiteral()
+		return 0
+	}
+	if tok.Type != NUMBER {
+		p.errorf(tok, "期望 %s 的数量，实际为 %s", keyword, tok)
+		return 0
 	}
 	p.advance()
-	param.Value = p.parseExpression()
-	return param
+	n, err := strconv.Atoi(tok.Literal)
+	if err != nil || n < min {
+		p.errorf(tok, "%s 的数量必须是不小于 %d 的整数: %s", keyword, min, tok.Literal)
+		return 0
+	}
+	return n
 }
 
-// parseListStatement 解析一个列表
-func (p *Parser) parseListStatement() *ListExpression {
-	list := &ListExpression{Token: p.currentToken()}
-	p.advance()
-	for p.currentToken().Type != OPTION {
-		elem := p.parseExpression()
-		list.Elements = append(list.Elements, elem)
+// parseTransferFile 解析 TRANSFER FILE 'filename' TO did AUTHORIZED BY 'did'
+func (p *Parser) parseTransferFile() *TransferFileStmt {
+	p.advance() // 跳过 TRANSFER
+	stmt := &TransferFileStmt{File: p.parseFilename()}
+	p.expectKeyword("TO")
+	stmt.To = p.parseValue()
+	stmt.AuthorizedBy = p.parseAuthorizedBy()
+	return stmt
+}
+
+// parseSetCoOwners 解析 SET CO_OWNERS FOR FILE 'filename' CO_OWNERS=[did1, did2, ...] AUTHORIZED BY 'did'
+func (p *Parser) parseSetCoOwners() *SetCoOwnersStmt {
+	p.advance() // 跳过 SET
+	p.expectKeyword("CO_OWNERS")
+	p.expectKeyword("FOR")
+	stmt := &SetCoOwnersStmt{File: p.parseFilename()}
+	p.expectKeyword("CO_OWNERS")
+	// 等号可以省略：CO_OWNERS [did1, did2]
+	if tok := p.currentToken(); tok.Type == OPERATOR && tok.Literal == "=" {
 		p.advance()
 	}
-	return list
+	if list := p.parseList(); list != nil {
+		stmt.CoOwners = list.Values()
+	}
+	stmt.AuthorizedBy = p.parseAuthorizedBy()
+	return stmt
+}
+
+// parseShareFile 解析 SHARE FILE 'filename' WITH 'did' AUTHORIZED BY 'did'
+func (p *Parser) parseShareFile() *ShareFileStmt {
+	p.advance() // 跳过 SHARE
+	stmt := &ShareFileStmt{File: p.parseFilename()}
+	p.expectKeyword("WITH")
+	stmt.With = p.parseValue()
+	stmt.AuthorizedBy = p.parseAuthorizedBy()
+	return stmt
 }
 
-// parseConditionStatement 解析一个条件语句
-func (p *Parser) parseConditionStatement() *ConditionExpression {
-	cond := &ConditionExpression{
-		Token:    p.currentToken(),
-		Left:     p.parseExpression(),
-		Operator: p.peekToken().Literal,
+// parseCheckoutFile 解析 CHECKOUT FILE 'filename' VERSION version_number AUTHORIZED BY 'did'
+func (p *Parser) parseCheckoutFile() *CheckoutFileStmt {
+	p.advance() // 跳过 CHECKOUT
+	stmt := &CheckoutFileStmt{File: p.parseFilename()}
+	p.expectKeyword("VERSION")
+	stmt.Version = p.parseValue()
+	stmt.AuthorizedBy = p.parseAuthorizedBy()
+	return stmt
+}
+
+// parseUseExtension 解析 USE EXTENSION 'extension_name' PARAMETERS="key1:value1,key2:value2"
+func (p *Parser) parseUseExtension() *UseExtensionStmt {
+	p.advance() // 跳过 USE
+	p.expectKeyword("EXTENSION")
+	stmt := &UseExtensionStmt{Name: p.parseValue()}
+	if tok := p.currentToken(); tok.Type == IDENT {
+		key, value := p.parseParameter()
+		if key != "PARAMETERS" {
+			p.errorf(tok, "USE EXTENSION 不支持参数 %s", key)
+		}
+		stmt.Parameters = p.parseMetadata(tok, value)
+	}
+	return stmt
+}
+
+// parseCancelJob 解析 CANCEL JOB 'id'
+func (p *Parser) parseCancelJob() *CancelJobStmt {
+	p.advance() // 跳过 CANCEL
+	p.expectKeyword("JOB")
+	return &CancelJobStmt{ID: p.parseValue()}
+}
+
+// parseWhere 解析可选的 WHERE 子句，没有 WHERE 时返回空
+func (p *Parser) parseWhere() Expression {
+	if !p.currentToken().Is("WHERE") {
+		return nil
 	}
 	p.advance()
+	return p.parseOr()
+}
+
+// parseOr 解析以 OR 连接的条件，OR 的优先级低于 AND
+func (p *Parser) parseOr() Expression {
+	left := p.parseAnd()
+	for left != nil && p.currentToken().Is("OR") {
+		p.advance()
+		right := p.parseAnd()
+		if right == nil {
+			return nil
+		}
+		left = &BinaryExpr{Operator: "OR", Left: left, Right: right}
+	}
+	return left
+}
+
+// parseAnd 解析以 AND 连接的条件
+func (p *Parser) parseAnd() Expression {
+	left := p.parseNot()
+	for left != nil && p.currentToken().Is("AND") {
+		p.advance()
+		right := p.parseNot()
+		if right == nil {
+			return nil
+		}
+		left = &BinaryExpr{Operator: "AND", Left: left, Right: right}
+	}
+	return left
+}
+
+// parseNot 解析以 NOT 取反的条件
+func (p *Parser) parseNot() Expression {
+	if p.currentToken().Is("NOT") {
+		p.advance()
+		expr := p.parseNot()
+		if expr == nil {
+			return nil
+		}
+		return &NotExpr{Expr: expr}
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary 解析括号中的条件或者一个比较条件
+func (p *Parser) parsePrimary() Expression {
+	if p.currentToken().Type != LPAREN {
+		return p.parseComparison()
+	}
 	p.advance()
-	cond.Right = p.parseExpression()
-	return cond
+	expr := p.parseOr()
+	if expr == nil || !p.expect(RPAREN) {
+		return nil
+	}
+	return expr
 }
 
-// parseExpression 解析基本的表达式
-func (p *Parser) parseExpression() Expression {
+// parseComparison 解析比较条件，如 SIZE < 5000、TAGS INCLUDE [tag1, tag2]、NAME NOT LIKE 'tmp%'
+func (p *Parser) parseComparison() Expression {
+	tok := p.currentToken()
+	if tok.Type != IDENT && !tok.Is("TAGS") && !tok.Is("CO_OWNERS") && !tok.Is("CONTENT") && !tok.Is("VERSION") {
+		p.errorf(tok, "期望文件属性，实际为 %s", tok)
+		return nil
+	}
+	p.advance()
+	field := &Field{Name: strings.ToUpper(tok.Literal), Pos: tok.Pos}
+
+	op := p.currentToken()
 	switch {
-	// case p.currentToken().Type == STRING_LITERAL:
-	// 	return &StringLiteral{
-	// 		Token: p.currentToken(),
-	// 		Value: p.currentToken().Literal,
-	// 	}
+	case op.Is("INCLUDE"):
+		p.advance()
+		if p.currentToken().Type == LBRACKET {
+			if list := p.parseList(); list != nil {
+				return &ComparisonExpr{Field: field, Operator: "INCLUDE", Value: list}
+			}
+			return nil
+		}
+		if value := p.parseLiteral(); value != nil {
+			return &ComparisonExpr{Field: field, Operator: "INCLUDE", Value: value}
+		}
+
+	case op.Is("LIKE"):
+		p.advance()
+		if value := p.parseLiteral(); value != nil {
+			return &ComparisonExpr{Field: field, Operator: "LIKE", Value: value}
+		}
+
+	case op.Is("NOT") && p.peekToken().Is("LIKE"):
+		p.advance()
+		p.advance()
+		if value := p.parseLiteral(); value != nil {
+			return &NotExpr{Expr: &ComparisonExpr{Field: field, Operator: "LIKE", Value: value}}
+		}
+
+	case op.Type == OPERATOR:
+		p.advance()
+		if value := p.parseLiteral(); value != nil {
+			return &ComparisonExpr{Field: field, Operator: op.Literal, Value: value}
+		}
+
 	default:
-		// Handle other expression types or throw error
-		return nil
+		p.errorf(op, "期望操作符，实际为 %s", op)
+	}
+	return nil
+}
+
+// parseFilename 解析 FILE 'filename'
+func (p *Parser) parseFilename() string {
+	p.expectKeyword("FILE")
+	tok := p.currentToken()
+	name := p.parseValue()
+	if name == "" && tok.Type == STRING {
+		p.errorf(tok, "文件名不能为空")
 	}
+	return name
 }
 
-func parseMetadata(data string) map[string]string {
+// parseAuthorizedBy 解析 AUTHORIZED BY 'did'
+func (p *Parser) parseAuthorizedBy() string {
+	p.expectKeyword("AUTHORIZED")
+	p.expectKeyword("BY")
+	return p.parseValue()
+}
+
+// parseParameter 解析 KEY=VALUE 形式的参数，返回大写的参数名和值
+func (p *Parser) parseParameter() (string, string) {
+	tok := p.currentToken()
+	p.advance()
+	p.expectOperator("=")
+	return strings.ToUpper(tok.Literal), p.parseValue()
+}
+
+// parseMetadata 解析 key1:value1,key2:value2 形式的键值对，tok 是参数名用于报告错误
+// 值为参数占位符时返回空，由绑定参数后的解析生成键值对。
+func (p *Parser) parseMetadata(tok Token, data string) map[string]string {
+	if p.current > 0 && p.tokens[p.current-1].Type == PLACEHOLDER {
+		return nil
+	}
 	metadata := make(map[string]string)
+	for _, pair := range strings.Split(data, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, found := strings.Cut(pair, ":")
+		if !found || strings.TrimSpace(key) == "" {
+			p.errorf(tok, "%s 的格式不正确: %s", strings.ToUpper(tok.Literal), pair)
+			continue
+		}
+		metadata[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return metadata
+}
 
-	// 移除双引号
-	data = strings.Trim(data, "\"")
+// parseList 解析 [item1, item2, ...] 形式的列表，出错时跳过到列表结束并返回空
+// 参数占位符可以代替整个列表。
+func (p *Parser) parseList() *ListLiteral {
+	tok := p.currentToken()
+	if tok.Type == PLACEHOLDER {
+		if item := p.parseLiteral(); item != nil {
+			return &ListLiteral{Items: []*Literal{item}, Pos: tok.Pos}
+		}
+		return nil
+	}
+	if !p.expect(LBRACKET) {
+		return nil
+	}
 
-	pairs := strings.Split(data, ",")
-	for _, pair := range pairs {
-		kv := strings.Split(pair, ":")
-		if len(kv) == 2 {
-			metadata[kv[0]] = kv[1]
+	list := &ListLiteral{Pos: tok.Pos}
+	if tok := p.currentToken(); tok.Type == RBRACKET {
+		p.errorf(tok, "列表不能为空")
+		p.advance()
+		return nil
+	}
+	for {
+		item := p.parseLiteral()
+		if item == nil {
+			p.skipList()
+			return nil
+		}
+		list.Items = append(list.Items, item)
+
+		tok := p.currentToken()
+		switch tok.Type {
+		case RBRACKET:
+			p.advance()
+			return list
+		case COMMA:
+			p.advance()
+		default:
+			p.errorf(tok, "期望 \",\" 或 \"]\"，实际为 %s", tok)
+			p.skipList()
+			return nil
 		}
 	}
+}
 
-	return metadata
+// skipList 跳过到列表结束的 "]"，没有 "]" 时停在语句结尾
+func (p *Parser) skipList() {
+	for tok := p.currentToken(); tok.Type != EOF; tok = p.currentToken() {
+		p.advance()
+		if tok.Type == RBRACKET {
+			return
+		}
+	}
+}
+
+// parseLiteral 解析字符串、标识符、数字、日期或参数占位符，出错时返回空
+func (p *Parser) parseLiteral() *Literal {
+	tok := p.currentToken()
+	switch tok.Type {
+	case STRING, IDENT, NUMBER, DATE:
+		p.advance()
+		return &Literal{Type: tok.Type, Value: tok.Literal, Pos: tok.Pos}
+	case PLACEHOLDER:
+		p.advance()
+		if !p.placeholders {
+			p.errorf(tok, "参数 %s 只能用于 Prepare 的语句", tok)
+			return nil
+		}
+		return &Literal{Type: tok.Type, Value: tok.Literal, Pos: tok.Pos}
+	}
+	p.errorf(tok, "期望值，实际为 %s", tok)
+	// 跳过错误的值，使之后的部分可以继续分析；关键字和括号可能属于之后的部分，不跳过
+	switch tok.Type {
+	case LBRACKET:
+		p.skipList()
+	case COMMA, OPERATOR:
+		p.advance()
+	}
+	return nil
 }
 
+// parseValue 解析单独的值，如文件名、DID、版本号，出错时返回空字符串
+func (p *Parser) parseValue() string {
+	if lit := p.parseLiteral(); lit != nil {
+		return lit.Value
+	}
+	return ""
+}
+
+// expect 检查当前Token的类型并前进，不匹配时记录错误并停在当前Token
+func (p *Parser) expect(typ TokenType) bool {
+	if tok := p.currentToken(); tok.Type != typ {
+		p.errorf(tok, "期望 %s，实际为 %s", typ, tok)
+		return false
+	}
+	p.advance()
+	return true
+}
+
+// expectKeyword 检查当前Token是否为指定的关键字并前进，不匹配时记录错误并停在当前Token
+func (p *Parser) expectKeyword(keyword string) bool {
+	if tok := p.currentToken(); !tok.Is(keyword) {
+		p.errorf(tok, "期望 %s，实际为 %s", keyword, tok)
+		return false
+	}
+	p.advance()
+	return true
+}
+
+// expectOperator 检查当前Token是否为指定的操作符并前进，不匹配时记录错误并停在当前Token
+func (p *Parser) expectOperator(op string) bool {
+	if tok := p.currentToken(); tok.Type != OPERATOR || tok.Literal != op {
+		p.errorf(tok, "期望 %s，实际为 %s", op, tok)
+		return false
+	}
+	p.advance()
+	return true
+}
+
+// errorf 记录指向 tok 所在位置的错误
+// 同一位置只记录第一个错误，避免一个错误引起的后续错误淹没原因。
+func (p *Parser) errorf(tok Token, format string, args ...interface{}) {
+	if n := len(p.errors); n > 0 && p.errors[n-1].Pos == tok.Pos {
+		return
+	}
+	p.errors = append(p.errors, ParseError{Pos: tok.Pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// currentToken 返回当前的Token，已到结尾时返回 EOF
 func (p *Parser) currentToken() Token {
-	return p.tokens[p.current]
+	if p.current < len(p.tokens) {
+		return p.tokens[p.current]
+	}
+	if len(p.tokens) > 0 {
+		return Token{Type: EOF, Pos: p.tokens[len(p.tokens)-1].Pos}
+	}
+	return Token{Type: EOF, Pos: Pos{Line: 1, Column: 1}}
 }
 
+// peekToken 返回当前Token之后的Token
 func (p *Parser) peekToken() Token {
 	if p.current+1 < len(p.tokens) {
 		return p.tokens[p.current+1]
 	}
-	return Token{} // Return an empty token if out of bounds
+	return Token{Type: EOF}
 }
 
 func (p *Parser) advance() {
-	p.current++
+	if p.current < len(p.tokens) {
+		p.current++
+	}
 }
@@ -1,107 +1,163 @@
 package bpfsfql
 
 import (
-	"fmt"
+	"reflect"
 	"testing"
 )
 
 func TestParse(t *testing.T) {
-	// 示例代码
-	inputs := []string{
-		`CREATE FILE filename OWNED_BY=did CUSTOM_NAME=custom_name METADATA=\"key1:value1,key2:value2\"`,
-		// `DROP FILE filename AUTHORIZED BY did`,
-		// `CREATE FILE filename OWNED_BY=did CUSTOM_NAME=custom_name METADATA="key1:value1,key2:value2"`,
-		// `DROP FILE filename AUTHORIZED BY did`,
-		// `UPDATE FILE filename SET CONTENT='new content' WHERE SIZE < 5000 AND LAST_MODIFIED > '2023-01-01' AUTHORIZED BY did`,
-		// `SELECT CONTENT FROM FILE filename AUTHORIZED BY did`,
-		// `BULK TRANSFER FILES [file1, file2] TO did_from did_to`,
-		// `ADD TAGS TO FILE filename TAGS [tag1, tag2] AUTHORIZED BY did`,
-		// `SHOW FILES WHERE TAGS INCLUDE [tag1, tag2] AND OWNED_BY=did`,
-		// `TRANSFER FILE filename TO did AUTHORIZED BY did`,
-		// `SET CO_OWNERS FOR FILE filename CO_OWNERS [did1, did2] AUTHORIZED BY did`,
-		// `SHARE FILE filename WITH did AUTHORIZED BY did`,
-		// `CHECKOUT FILE filename VERSION version_number AUTHORIZED BY did`,
-		// `USE EXTENSION extension_name PARAMETERS="key1:value1,key2:value2"`,
-		// `ASYNC CREATE FILE filename OWNED_BY=did`,
-		// ... 添加其他测试语句
+	tests := []struct {
+		input string
+		want  Statement
+	}{
+		{
+			`CREATE FILE 'filename' OWNED_BY='did' CUSTOM_NAME=custom_name METADATA="key1:value1,key2:value2"`,
+			&CreateFileStmt{File: "filename", Owner: "did", CustomName: "custom_name",
+				Metadata: map[string]string{"key1": "value1", "key2": "value2"}},
+		},
+		{
+			`DROP FILE 'filename' AUTHORIZED BY 'did'`,
+			&DropFileStmt{File: "filename", AuthorizedBy: "did"},
+		},
+		{
+			`UPDATE FILE 'filename' SET CONTENT='new content' WHERE SIZE < 5000 AND LAST_MODIFIED > '2023-01-01' AUTHORIZED BY 'did'`,
+			&UpdateFileStmt{File: "filename", Content: "new content", AuthorizedBy: "did"},
+		},
+		{
+			`SELECT CONTENT FROM FILE 'filename' AUTHORIZED BY 'did'`,
+			&SelectContentStmt{File: "filename", AuthorizedBy: "did"},
+		},
+		{
+			`BULK TRANSFER FILES [file1, 'file2'] FROM 'did_from' TO did_to`,
+			&BulkTransferStmt{Files: []string{"file1", "file2"}, From: "did_from", To: "did_to"},
+		},
+		{
+			`ADD TAGS TO FILE 'filename' TAGS ['tag1', 'tag2'] AUTHORIZED BY 'did'`,
+			&AddTagsStmt{File: "filename", Tags: []string{"tag1", "tag2"}, AuthorizedBy: "did"},
+		},
+		{
+			`SHOW FILES WHERE TAGS INCLUDE [tag1, tag2] AND OWNED_BY='did'`,
+			&ShowFilesStmt{},
+		},
+		{
+			`SHOW FILES`,
+			&ShowFilesStmt{},
+		},
+		{
+			`EXPLAIN SHOW FILES ORDER BY size DESC, name LIMIT 10 OFFSET 20`,
+			&ShowFilesStmt{Explain: true, OrderBy: []OrderItem{
+				{Field: &Field{Name: "SIZE", Pos: Pos{1, 29}}, Desc: true},
+				{Field: &Field{Name: "NAME", Pos: Pos{1, 40}}},
+			}, Limit: 10, Offset: 20},
+		},
+		{
+			`SHOW FILES WHERE SIZE > 1KB OFFSET 5`,
+			&ShowFilesStmt{Offset: 5},
+		},
+		{
+			`TRANSFER FILE 'filename' TO did_to AUTHORIZED BY 'did'`,
+			&TransferFileStmt{File: "filename", To: "did_to", AuthorizedBy: "did"},
+		},
+		{
+			`SET CO_OWNERS FOR FILE 'filename' CO_OWNERS=['did1', 'did2'] AUTHORIZED BY 'did'`,
+			&SetCoOwnersStmt{File: "filename", CoOwners: []string{"did1", "did2"}, AuthorizedBy: "did"},
+		},
+		{
+			`SHARE FILE 'filename' WITH 'did:key:z6Mk' AUTHORIZED BY 'did'`,
+			&ShareFileStmt{File: "filename", With: "did:key:z6Mk", AuthorizedBy: "did"},
+		},
+		{
+			`CHECKOUT FILE 'filename' VERSION 3 AUTHORIZED BY 'did'`,
+			&CheckoutFileStmt{File: "filename", Version: "3", AuthorizedBy: "did"},
+		},
+		{
+			`USE EXTENSION 'extension_name' PARAMETERS="key1:value1,key2:value2"`,
+			&UseExtensionStmt{Name: "extension_name", Parameters: map[string]string{"key1": "value1", "key2": "value2"}},
+		},
+		{
+			`ASYNC CREATE FILE 'filename' OWNED_BY='did'`,
+			&CreateFileStmt{Async: true, File: "filename", Owner: "did"},
+		},
+		{
+			`ASYNC BULK TRANSFER FILES [file1] FROM did_from TO did_to`,
+			&BulkTransferStmt{Async: true, Files: []string{"file1"}, From: "did_from", To: "did_to"},
+		},
+		{`SHOW JOBS`, &ShowJobsStmt{}},
+		{`show job 'job-1f2e3d'`, &ShowJobStmt{ID: "job-1f2e3d"}},
+		{`CANCEL JOB job-1f2e3d`, &CancelJobStmt{ID: "job-1f2e3d"}},
 	}
 
-	for _, input := range inputs {
-		fmt.Println("Parsing:\t", input)
-		tokens, err := Lex(input)
-		if err != nil {
-			fmt.Printf("词法分析错误:\t%v\n\n", err)
+	for _, tc := range tests {
+		got, errs := Parse(tc.input)
+		if len(errs) > 0 {
+			t.Errorf("解析 %q 失败: %v", tc.input, ParseErrors(errs))
 			continue
 		}
-
-		// 2. 语法分析
-		parser := NewParser(tokens)
-		statement := parser.ParseStatement() // 注意首字母大写，以适应外部调用
-		fmt.Printf("%v\n\n", statement)
+		// WHERE 子句由 TestParseWhere 检查
+		switch stmt := got.(type) {
+		case *UpdateFileStmt:
+			stmt.Where = nil
+		case *ShowFilesStmt:
+			stmt.Where = nil
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("解析 %q 得到 %+v，期望 %+v", tc.input, got, tc.want)
+		}
 	}
 }
 
-// for _, c := range cmd {
-// fmt.Printf("Action:\t\t%+v\n", cmd.Action)
-// fmt.Printf("FileType:\t%+v\n", cmd.FileType)
-// fmt.Printf("Filename:\t%+v\n", cmd.Filename)
-// fmt.Printf("Params:\t\t%+v\n", cmd.Params)
-// fmt.Printf("Condition:\t%+v\n", cmd.Condition)
-// fmt.Printf("Tags:\t\t%+v\n", cmd.Tags)
-// fmt.Printf("CoOwners:\t%+v\n", cmd.CoOwners)
-// fmt.Printf("Content:\t%+v\n", cmd.Content)
-// fmt.Printf("Transfer:\t\t%+v\n", cmd.Transfer)
-// fmt.Printf("Extension:\t%+v\n", cmd.Extension)
-// fmt.Printf("Version:\t\t%+v\n", cmd.Version)
-// fmt.Printf("AuthorizedBy:\t%+v\n", cmd.AuthorizedBy)
-// }
-
-// func TestParse(t *testing.T) {
-// 	tests := []struct {
-// 		input string
-// 		// 预期的解析输出
-// 		expectedOutput *Command // 假设Command是您解析的输出结构
-// 		expectError    bool
-// 	}{
-// 		{
-// 			input: `CREATE FILE filename OWNED_BY=did CUSTOM_NAME=custom_name METADATA="key1:value1,key2:value2"`,
-// 			expectedOutput: &Command{
-// 				Action:   "CREATE",
-// 				FileType: "FILE",
-// 				Params: map[TokenType]string{
-// 					FILENAME: "filename",
-// 					DID:      "did",
-// 					ALIAS:    "custom_name",
-// 					METADATA: "key1:value1,key2:value2",
-// 				},
-// 				// ... 其他预期字段
-// 			},
-// 		},
-// 		// ... 添加其他测试用例
-// 	}
-
-// 	for _, test := range tests {
-// 		tokens, err := Lex(test.input)
-// 		if err != nil {
-// 			if test.expectError {
-// 				return
-// 			}
-// 			t.Errorf("unexpected error during Lex: %v", err)
-// 			continue
-// 		}
-
-// 		actualOutput, err := Parse(tokens)
-// 		if err != nil {
-// 			if test.expectError {
-// 				return
-// 			}
-// 			t.Errorf("unexpected error during Parse: %v", err)
-// 			continue
-// 		}
+func TestParseWhere(t *testing.T) {
+	for input, want := range map[string]string{
+		`SIZE < 5000 AND LAST_MODIFIED > '2023-01-01'`:    `(SIZE < 5000 AND LAST_MODIFIED > '2023-01-01')`,
+		`TAGS INCLUDE [tag1, 'tag 2'] AND OWNED_BY='did'`: `(TAGS INCLUDE [tag1, 'tag 2'] AND OWNED_BY = 'did')`,
+		`a = 1 OR b = 2 AND c = 3`:                        `(A = 1 OR (B = 2 AND C = 3))`,
+		`(a = 1 OR b = 2) AND NOT c != 3`:                 `((A = 1 OR B = 2) AND NOT C != 3)`,
+		`name LIKE 'rep%' OR name NOT LIKE "tmp%"`:        `(NAME LIKE 'rep%' OR NOT NAME LIKE 'tmp%')`,
+		`size >= 5MB AND size <= 1GB AND TAGS INCLUDE x`:  `((SIZE >= 5MB AND SIZE <= 1GB) AND TAGS INCLUDE x)`,
+	} {
+		stmt, errs := Parse("SHOW FILES WHERE " + input)
+		if len(errs) > 0 {
+			t.Fatalf("解析 %q 失败: %v", input, ParseErrors(errs))
+		}
+		if got := stmt.(*ShowFilesStmt).Where.String(); got != want {
+			t.Fatalf("解析 %q 得到 %s，期望 %s", input, got, want)
+		}
+	}
+}
 
-// 		// 检查实际的输出和期望的输出是否一致
-// 		if !reflect.DeepEqual(actualOutput, test.expectedOutput) {
-// 			t.Errorf("for input %q, expected %+v, got %+v", test.input, test.expectedOutput, actualOutput)
-// 		}
-// 	}
-// }
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  []Pos
+	}{
+		{``, []Pos{{1, 1}}},
+		{`CREATE FILE 'filename'`, []Pos{{1, 1}}},
+		{`DROP FILE 'filename'`, []Pos{{1, 21}}},
+		{`SELECT CONTENT FILE 'filename' AUTHORIZED BY 'did'`, []Pos{{1, 16}}},
+		{`ASYNC DROP FILE 'filename' AUTHORIZED BY 'did'`, []Pos{{1, 7}}},
+		{`SHOW FILES WHERE TAGS INCLUDE [tag1`, []Pos{{1, 36}}},
+		{`SHOW FILES WHERE (SIZE < 5000`, []Pos{{1, 30}}},
+		{`SHOW FILES WHERE SIZE 5000`, []Pos{{1, 23}}},
+		{`SHARE FILE 'filename' WITH 'did' AUTHORIZED BY 'did' 5000`, []Pos{{1, 54}}},
+		{`SHOW FILES ORDER size`, []Pos{{1, 18}}},
+		{`SHOW FILES LIMIT 0`, []Pos{{1, 18}}},
+		{`SHOW FILES LIMIT 5KB`, []Pos{{1, 18}}},
+		{`SHOW FILES OFFSET 5 LIMIT 10`, []Pos{{1, 21}}},
+		{`EXPLAIN DROP FILE 'filename' AUTHORIZED BY 'did'`, []Pos{{1, 1}}},
+		{`SHOW JOB`, []Pos{{1, 9}}},
+		{`CANCEL 'id'`, []Pos{{1, 8}}},
+		{`ASYNC SHOW JOBS`, []Pos{{1, 7}}},
+		// 一条语句中的多个错误一次报告
+		{`CREATE FILE 'f' SIZE=1 METADATA='a'`, []Pos{{1, 17}, {1, 24}, {1, 1}}},
+		{`TRANSFER FILE [a] TO AUTHORIZED BY did`, []Pos{{1, 15}, {1, 22}}},
+	} {
+		stmt, errs := Parse(tc.input)
+		got := make([]Pos, len(errs))
+		for i, err := range errs {
+			got[i] = err.Pos
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("解析 %q 得到 %+v 和错误 %v，期望错误位置 %v", tc.input, stmt, ParseErrors(errs), tc.want)
+		}
+	}
+}
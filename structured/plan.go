@@ -0,0 +1,315 @@
+// Plan: 将 SHOW FILES 编译为文件目录上的 SQL 查询
+package bpfsfql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Query 是由 SHOW FILES 编译成的参数化 SQL 查询，按 sqlites.SqliteDB.Select 的参数组织
+// 语句中的值都以 ? 占位并放入 Args，不会拼接到 SQL 中。
+type Query struct {
+	Table      string        // 查询的表
+	Columns    []string      // 查询的列
+	Conditions []string      // 以 AND 连接的条件
+	Args       []interface{} // 条件中占位符对应的值
+	OrderBy    string        // 排序，如 "catalog.size DESC, catalog.id ASC"
+	Offset     int           // 跳过的行数
+	Limit      int           // 最多返回的行数，0 表示不限制
+}
+
+// Range 返回传给 Select 的起始行和行数，只有 OFFSET 时行数为 -1 表示不限制
+func (q *Query) Range() (start, limit int) {
+	if q.Limit == 0 && q.Offset > 0 {
+		return q.Offset, -1
+	}
+	return q.Offset, q.Limit
+}
+
+// SQL 返回 Select 执行的 SQL 语句
+func (q *Query) SQL() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "SELECT %s FROM %s", strings.Join(q.Columns, ", "), q.Table)
+	if len(q.Conditions) > 0 {
+		b.WriteString(" WHERE " + strings.Join(q.Conditions, " AND "))
+	}
+	if q.OrderBy != "" {
+		b.WriteString(" ORDER BY " + q.OrderBy)
+	}
+	if start, limit := q.Range(); limit != 0 {
+		fmt.Fprintf(&b, " LIMIT %d,%d", start, limit)
+	}
+	return b.String()
+}
+
+// String 返回 SQL 语句和参数，用于 EXPLAIN
+func (q *Query) String() string {
+	args := make([]string, len(q.Args))
+	for i, arg := range q.Args {
+		if s, ok := arg.(string); ok {
+			args[i] = quote(s)
+		} else {
+			args[i] = fmt.Sprint(arg)
+		}
+	}
+	return q.SQL() + "\n参数: [" + strings.Join(args, ", ") + "]"
+}
+
+// fieldKind 是文件属性的类型，决定支持的操作符和值
+type fieldKind int
+
+const (
+	textField     fieldKind = iota // 文本，如 NAME
+	sizeField                      // 字节数，值可以带有单位
+	timeField                      // 时间，值为日期或时间
+	ownerField                     // 所有者，取自访问控制
+	coOwnersField                  // 共同所有者，取自访问控制
+	tagsField                      // 标签
+)
+
+// catalogField 是文件目录中的一个文件属性
+type catalogField struct {
+	kind   fieldKind
+	column string // 对应的列，为空时不能排序
+}
+
+// catalogFields 是 WHERE 和 ORDER BY 中可以使用的文件属性
+// 文件目录由 core/sqlite 中的 catalog 和 catalog_tags 表记录，所有者取自访问控制的 acl 表。
+var catalogFields = map[string]catalogField{
+	"ASSET_ID":      {textField, "catalog.assetID"},
+	"NAME":          {textField, "catalog.name"},
+	"CUSTOM_NAME":   {textField, "catalog.customName"},
+	"SIZE":          {sizeField, "catalog.size"},
+	"LAST_MODIFIED": {timeField, "catalog.modified"},
+	"MODIFIED":      {timeField, "catalog.modified"},
+	"OWNED_BY":      {ownerField, ""},
+	"OWNER":         {ownerField, ""},
+	"CO_OWNERS":     {coOwnersField, ""},
+	"TAGS":          {tagsField, ""},
+}
+
+// catalogColumns 是 SHOW FILES 查询的列，由 Catalog 按顺序读取
+var catalogColumns = []string{
+	"catalog.assetID",
+	"catalog.name",
+	"catalog.customName",
+	"catalog.size",
+	"catalog.modified",
+	"catalog.metadata",
+	"IFNULL((SELECT acl.owner FROM acl WHERE acl.assetID = catalog.assetID), '')",
+}
+
+// 时间值可以使用的格式，没有时区时按本地时间
+var timeLayouts = []string{"2006-01-02", "2006-01-02 15:04:05", time.RFC3339}
+
+// CompileShowFiles 将 SHOW FILES 语句编译为文件目录上的查询
+// 未知的文件属性、不支持的操作符和类型不符的值返回指向其位置的 *ParseError。
+func CompileShowFiles(stmt *ShowFilesStmt) (*Query, error) {
+	query := &Query{
+		Table:   "catalog",
+		Columns: catalogColumns,
+		Offset:  stmt.Offset,
+		Limit:   stmt.Limit,
+	}
+
+	if stmt.Where != nil {
+		c := new(compiler)
+		cond, err := c.compile(stmt.Where)
+		if err != nil {
+			return nil, err
+		}
+		query.Conditions = []string{cond}
+		query.Args = c.args
+	}
+
+	var orderBy []string
+	for _, item := range stmt.OrderBy {
+		field, ok := catalogFields[item.Field.Name]
+		if !ok {
+			return nil, fieldError(item.Field, "未知的文件属性 %s", item.Field.Name)
+		}
+		if field.column == "" {
+			return nil, fieldError(item.Field, "不能按 %s 排序", item.Field.Name)
+		}
+		dir := "ASC"
+		if item.Desc {
+			dir = "DESC"
+		}
+		orderBy = append(orderBy, field.column+" "+dir)
+	}
+	// 排序的值相同时按加入文件目录的顺序，使分页的结果稳定
+	query.OrderBy = strings.Join(append(orderBy, "catalog.id ASC"), ", ")
+
+	return query, nil
+}
+
+// compiler 将 WHERE 子句编译为 SQL 条件，并按出现的顺序收集参数
+type compiler struct {
+	args []interface{}
+}
+
+func (c *compiler) compile(expr Expression) (string, error) {
+	switch e := expr.(type) {
+	case *BinaryExpr:
+		left, err := c.compile(e.Left)
+		if err != nil {
+			return "", err
+		}
+		right, err := c.compile(e.Right)
+		if err != nil {
+			return "", err
+		}
+		return "(" + left + " " + e.Operator + " " + right + ")", nil
+
+	case *NotExpr:
+		inner, err := c.compile(e.Expr)
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + inner + ")", nil
+
+	case *ComparisonExpr:
+		return c.compileComparison(e)
+	}
+	return "", fmt.Errorf("不支持的条件 %s", expr.String())
+}
+
+// compileComparison 按文件属性的类型编译比较条件
+func (c *compiler) compileComparison(e *ComparisonExpr) (string, error) {
+	field, ok := catalogFields[e.Field.Name]
+	if !ok {
+		return "", fieldError(e.Field, "未知的文件属性 %s", e.Field.Name)
+	}
+
+	// INCLUDE 只用于共同所有者和标签，其值可以是列表
+	if field.kind == coOwnersField || field.kind == tagsField {
+		return c.compileInclude(e, field)
+	}
+	if e.Operator == "INCLUDE" {
+		return "", fieldError(e.Field, "%s 不支持 INCLUDE", e.Field.Name)
+	}
+	lit := e.Value.(*Literal)
+
+	switch field.kind {
+	case textField:
+		return c.bind(field.column+" "+e.Operator+" ?", lit.Value), nil
+
+	case sizeField:
+		if e.Operator == "LIKE" {
+			return "", fieldError(e.Field, "%s 不支持 LIKE", e.Field.Name)
+		}
+		if lit.Type != NUMBER && lit.Type != STRING {
+			return "", valueError(lit, "%s 的值应为数字，实际为 %s", e.Field.Name, lit)
+		}
+		size, err := ParseSize(lit.Value)
+		if err != nil {
+			return "", valueError(lit, "%v", err)
+		}
+		return c.bind(field.column+" "+e.Operator+" ?", size), nil
+
+	case timeField:
+		if e.Operator == "LIKE" {
+			return "", fieldError(e.Field, "%s 不支持 LIKE", e.Field.Name)
+		}
+		return c.compileTime(e, field, lit)
+
+	case ownerField:
+		if e.Operator != "=" && e.Operator != "!=" && e.Operator != "LIKE" {
+			return "", fieldError(e.Field, "%s 不支持 %s", e.Field.Name, e.Operator)
+		}
+		if e.Operator == "!=" {
+			return c.bind("NOT EXISTS (SELECT 1 FROM acl WHERE acl.assetID = catalog.assetID AND acl.owner = ?)", lit.Value), nil
+		}
+		return c.bind("EXISTS (SELECT 1 FROM acl WHERE acl.assetID = catalog.assetID AND acl.owner "+e.Operator+" ?)", lit.Value), nil
+	}
+	return "", fieldError(e.Field, "不支持的文件属性 %s", e.Field.Name)
+}
+
+// compileInclude 编译 CO_OWNERS 和 TAGS 的条件
+// INCLUDE 的列表要求包含其中全部的值；TAGS LIKE 要求至少有一个标签匹配。
+func (c *compiler) compileInclude(e *ComparisonExpr, field catalogField) (string, error) {
+	var pattern string
+	switch {
+	case field.kind == coOwnersField && e.Operator == "INCLUDE":
+		pattern = "EXISTS (SELECT 1 FROM acl WHERE acl.assetID = catalog.assetID AND instr(',' || acl.coOwners || ',', ',' || ? || ',') > 0)"
+	case field.kind == tagsField && e.Operator == "INCLUDE":
+		pattern = "EXISTS (SELECT 1 FROM catalog_tags WHERE catalog_tags.assetID = catalog.assetID AND catalog_tags.tag = ?)"
+	case field.kind == tagsField && e.Operator == "LIKE":
+		return c.bind("EXISTS (SELECT 1 FROM catalog_tags WHERE catalog_tags.assetID = catalog.assetID AND catalog_tags.tag LIKE ?)",
+			e.Value.(*Literal).Value), nil
+	default:
+		return "", fieldError(e.Field, "%s 不支持 %s", e.Field.Name, e.Operator)
+	}
+
+	var values []string
+	switch v := e.Value.(type) {
+	case *ListLiteral:
+		values = v.Values()
+	case *Literal:
+		values = []string{v.Value}
+	}
+	conds := make([]string, len(values))
+	for i, value := range values {
+		conds[i] = c.bind(pattern, value)
+	}
+	if len(conds) == 1 {
+		return conds[0], nil
+	}
+	return "(" + strings.Join(conds, " AND ") + ")", nil
+}
+
+// compileTime 编译时间的比较条件，时间以 Unix 时间戳记录
+// 只有日期时按整天比较：= 表示当天之内，> 表示当天之后，<= 表示当天结束之前。
+func (c *compiler) compileTime(e *ComparisonExpr, field catalogField, lit *Literal) (string, error) {
+	if lit.Type != DATE && lit.Type != STRING {
+		return "", valueError(lit, "%s 的值应为日期，实际为 %s", e.Field.Name, lit)
+	}
+
+	var (
+		t   time.Time
+		err error
+	)
+	for _, layout := range timeLayouts {
+		if t, err = time.ParseInLocation(layout, lit.Value, time.Local); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return "", valueError(lit, "无法识别的时间 %s", lit)
+	}
+
+	column := field.column
+	if len(lit.Value) != len(timeLayouts[0]) {
+		return c.bind(column+" "+e.Operator+" ?", t.Unix()), nil
+	}
+
+	begin, end := t.Unix(), t.AddDate(0, 0, 1).Unix()
+	switch e.Operator {
+	case "=":
+		return c.bind(c.bind("("+column+" >= ? AND "+column+" < ?)", begin), end), nil
+	case "!=":
+		return c.bind(c.bind("("+column+" < ? OR "+column+" >= ?)", begin), end), nil
+	case "<", ">=":
+		return c.bind(column+" "+e.Operator+" ?", begin), nil
+	default: // "<=", ">"
+		op := map[string]string{"<=": "<", ">": ">="}[e.Operator]
+		return c.bind(column+" "+op+" ?", end), nil
+	}
+}
+
+// bind 记录参数并原样返回条件
+func (c *compiler) bind(cond string, arg interface{}) string {
+	c.args = append(c.args, arg)
+	return cond
+}
+
+// fieldError 返回指向文件属性位置的错误
+func fieldError(field *Field, format string, args ...interface{}) error {
+	return &ParseError{Pos: field.Pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// valueError 返回指向值位置的错误
+func valueError(lit *Literal, format string, args ...interface{}) error {
+	return &ParseError{Pos: lit.Pos, Msg: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,201 @@
+// Prepare: 带参数的预处理语句
+package bpfsfql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stmt 是预处理的 FQL 语句，语句中的值可以是参数占位符
+// "?" 按位置依次绑定参数，":name" 绑定同名的 NamedArg，同一名称可以出现多次。
+// 参数替换为字符串、数字或列表的Token后再进行语法分析，不会再经过词法分析，
+// 因此参数中的引号、括号和关键字只是值的一部分，不会改变语句的结构。
+// 同一个 Stmt 可以并发地以不同的参数执行。
+type Stmt struct {
+	tokens     []Token         // 词法分析的结果
+	positional int             // "?" 的数量
+	names      map[string]bool // ":name" 的名称，不含冒号
+}
+
+// NamedArg 是按名称绑定到 ":name" 的参数
+type NamedArg struct {
+	Name  string      // 参数名，不含冒号
+	Value interface{} // 参数的值
+}
+
+// Named 返回绑定到 ":name" 的参数
+func Named(name string, value interface{}) NamedArg {
+	return NamedArg{Name: strings.TrimPrefix(name, ":"), Value: value}
+}
+
+// Prepare 对 FQL 语句进行词法分析和语法检查，返回可以多次绑定参数执行的语句
+// 参数可以出现在值的位置，包括文件名、DID、比较的值、LIMIT 和 OFFSET 的数量、
+// METADATA 和 PARAMETERS 的键值对，以及整个列表，如 TAGS INCLUDE ?、BULK TRANSFER FILES ?。
+func Prepare(query string) (*Stmt, error) {
+	// 1. 词法分析
+	tokens, err := Lex(query)
+	if err != nil {
+		var perr *ParseError
+		if errors.As(err, &perr) {
+			return nil, ParseErrors{*perr}
+		}
+		return nil, err
+	}
+
+	// 2. 语法检查，参数在执行时才绑定
+	p := NewParser(tokens)
+	p.placeholders = true
+	if _, errs := p.ParseStatement(); len(errs) > 0 {
+		return nil, ParseErrors(errs)
+	}
+
+	stmt := &Stmt{tokens: tokens, names: make(map[string]bool)}
+	for _, tok := range tokens {
+		if tok.Type != PLACEHOLDER {
+			continue
+		}
+		if tok.Literal == "?" {
+			stmt.positional++
+		} else {
+			stmt.names[tok.Literal[1:]] = true
+		}
+	}
+	return stmt, nil
+}
+
+// NumInput 返回语句中 "?" 和不同名称的 ":name" 的数量
+func (s *Stmt) NumInput() int {
+	return s.positional + len(s.names)
+}
+
+// Bind 绑定参数后进行语法分析，返回类型化的语句
+// 参数可以是 string、[]string（列表）、time.Time（时间）、整数和浮点数（数字或大小）
+// 以及 map[string]string（METADATA 和 PARAMETERS 的键值对）。
+// 参数的类型或绑定后的语法不正确时返回 ParseErrors，错误指向对应参数所在的位置。
+func (s *Stmt) Bind(args ...interface{}) (Statement, error) {
+	// 1. 区分按位置和按名称的参数
+	var positional []interface{}
+	named := make(map[string]interface{})
+	for _, arg := range args {
+		if arg, ok := arg.(NamedArg); ok {
+			if !s.names[arg.Name] {
+				return nil, fmt.Errorf("语句中没有参数 :%s", arg.Name)
+			}
+			if _, exists := named[arg.Name]; exists {
+				return nil, fmt.Errorf("重复的参数 :%s", arg.Name)
+			}
+			named[arg.Name] = arg.Value
+			continue
+		}
+		positional = append(positional, arg)
+	}
+	if len(positional) != s.positional {
+		return nil, fmt.Errorf("语句需要 %d 个按位置的参数，实际为 %d", s.positional, len(positional))
+	}
+
+	// 2. 将占位符替换为参数的Token
+	tokens := make([]Token, 0, len(s.tokens))
+	for _, tok := range s.tokens {
+		if tok.Type != PLACEHOLDER {
+			tokens = append(tokens, tok)
+			continue
+		}
+
+		var value interface{}
+		if tok.Literal == "?" {
+			value, positional = positional[0], positional[1:]
+		} else {
+			var exists bool
+			if value, exists = named[tok.Literal[1:]]; !exists {
+				return nil, fmt.Errorf("缺少参数 %s", tok.Literal)
+			}
+		}
+		bound, err := bindTokens(tok.Pos, value)
+		if err != nil {
+			return nil, ParseErrors{{Pos: tok.Pos, Msg: fmt.Sprintf("参数 %s: %v", tok.Literal, err)}}
+		}
+		tokens = append(tokens, bound...)
+	}
+
+	// 3. 语法分析
+	stmt, errs := NewParser(tokens).ParseStatement()
+	if len(errs) > 0 {
+		return nil, ParseErrors(errs)
+	}
+	return stmt, nil
+}
+
+// Exec 绑定参数后交给执行器中对应的方法执行
+func (s *Stmt) Exec(ctx context.Context, executor Executor, args ...interface{}) (*Result, error) {
+	stmt, err := s.Bind(args...)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result, err := dispatch(ctx, stmt, executor)
+	if err != nil {
+		return nil, fmt.Errorf("执行 %s 失败: %w", stmt.TokenLiteral(), err)
+	}
+	if result == nil {
+		result = new(Result)
+	}
+	if result.Statement == "" {
+		result.Statement = stmt.TokenLiteral()
+	}
+	return result, nil
+}
+
+// bindTokens 将参数转换为位于 pos 的Token，列表转换为 "[" 与 "]" 之间以 "," 分隔的字符串
+func bindTokens(pos Pos, value interface{}) ([]Token, error) {
+	str := func(s string) Token { return Token{Type: STRING, Literal: s, Pos: pos} }
+	num := func(s string) Token { return Token{Type: NUMBER, Literal: s, Pos: pos} }
+
+	switch v := value.(type) {
+	case string:
+		return []Token{str(v)}, nil
+	case []string:
+		tokens := []Token{{Type: LBRACKET, Literal: "[", Pos: pos}}
+		for i, item := range v {
+			if i > 0 {
+				tokens = append(tokens, Token{Type: COMMA, Literal: ",", Pos: pos})
+			}
+			tokens = append(tokens, str(item))
+		}
+		return append(tokens, Token{Type: RBRACKET, Literal: "]", Pos: pos}), nil
+	case time.Time:
+		return []Token{str(v.Format(time.RFC3339))}, nil
+	case map[string]string:
+		pairs := make([]string, 0, len(v))
+		for key, value := range v {
+			if strings.ContainsAny(key, ":,") || strings.Contains(value, ",") {
+				return nil, fmt.Errorf("键值对 %s:%s 中不能包含 \",\"，键中不能包含 \":\"", key, value)
+			}
+			pairs = append(pairs, key+":"+value)
+		}
+		sort.Strings(pairs)
+		return []Token{str(strings.Join(pairs, ","))}, nil
+	case int:
+		return []Token{num(strconv.FormatInt(int64(v), 10))}, nil
+	case int32:
+		return []Token{num(strconv.FormatInt(int64(v), 10))}, nil
+	case int64:
+		return []Token{num(strconv.FormatInt(v, 10))}, nil
+	case uint:
+		return []Token{num(strconv.FormatUint(uint64(v), 10))}, nil
+	case uint32:
+		return []Token{num(strconv.FormatUint(uint64(v), 10))}, nil
+	case uint64:
+		return []Token{num(strconv.FormatUint(v, 10))}, nil
+	case float64:
+		return []Token{num(strconv.FormatFloat(v, 'f', -1, 64))}, nil
+	}
+	return nil, fmt.Errorf("不支持的类型 %T", value)
+}
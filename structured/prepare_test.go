@@ -0,0 +1,149 @@
+package bpfsfql
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPrepare(t *testing.T) {
+	catalog := openTestCatalog(t)
+	ctx := context.Background()
+
+	stmt, err := Prepare(`SHOW FILES WHERE TAGS INCLUDE :tags AND OWNED_BY = ? AND LAST_MODIFIED > ? ORDER BY size LIMIT ?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := stmt.NumInput(); n != 4 {
+		t.Fatalf("NumInput 为 %d", n)
+	}
+	since := time.Date(2022, 12, 31, 22, 0, 0, 0, time.Local)
+	for _, tc := range []struct {
+		args []interface{}
+		want []string
+	}{
+		{[]interface{}{"did:alice", since, 10, Named("tags", []string{"work"})}, []string{"a1"}},
+		{[]interface{}{"did:bob", since, int64(1), Named(":tags", []string{"work"})}, []string{"a3"}},
+		{[]interface{}{"did:alice", since.Add(time.Hour), 10, Named("tags", []string{"work"})}, nil},
+		{[]interface{}{"did:alice", since, 10, Named("tags", []string{"work", "2022"})}, []string{"a1"}},
+	} {
+		result, err := stmt.Exec(ctx, catalog, tc.args...)
+		if err != nil {
+			t.Fatalf("以 %v 执行失败: %v", tc.args, err)
+		}
+		if !reflect.DeepEqual(result.AssetIDs, tc.want) {
+			t.Errorf("以 %v 执行得到 %v，期望 %v", tc.args, result.AssetIDs, tc.want)
+		}
+	}
+
+	// 参数中的引号和关键字不会改变语句
+	byName, err := Prepare(`SHOW FILES WHERE name = ? OR custom_name = ?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string][]string{
+		"report.pdf":                 {"a1"},
+		"x' OR '1'='1":               nil,
+		"holiday] OR SIZE > 0 -- x":  nil,
+		`notes.txt" OR name LIKE "%`: nil,
+	} {
+		result, err := byName.Exec(ctx, catalog, name, name)
+		if err != nil {
+			t.Fatalf("以 %q 执行失败: %v", name, err)
+		}
+		if !reflect.DeepEqual(result.AssetIDs, want) {
+			t.Errorf("以 %q 执行得到 %v，期望 %v", name, result.AssetIDs, want)
+		}
+	}
+
+	addTags, err := Prepare(`ADD TAGS TO FILE ? TAGS ? AUTHORIZED BY ?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := addTags.Exec(ctx, catalog, "notes.txt", []string{"draft, final", "work"}, "did:bob"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := Exec(ctx, `SHOW FILES WHERE TAGS INCLUDE 'draft, final'`, catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Files) != 1 || !reflect.DeepEqual(result.Files[0].Tags, []string{"work", "draft, final"}) {
+		t.Fatalf("添加标签后得到 %+v", result.Files)
+	}
+}
+
+func TestPrepareBind(t *testing.T) {
+	stmt, err := Prepare(`CREATE FILE :file OWNED_BY=:owner CUSTOM_NAME=? METADATA=?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound, err := stmt.Bind("it's", map[string]string{"dept": "sales", "year": "2023"},
+		Named("file", "/tmp/a b.txt"), Named("owner", "did:key:z6Mk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &CreateFileStmt{File: "/tmp/a b.txt", Owner: "did:key:z6Mk", CustomName: "it's",
+		Metadata: map[string]string{"dept": "sales", "year": "2023"}}
+	if !reflect.DeepEqual(bound, want) {
+		t.Fatalf("绑定得到 %+v，期望 %+v", bound, want)
+	}
+
+	for _, args := range [][]interface{}{
+		{"name", map[string]string{}},
+		{"name", map[string]string{}, Named("file", "f"), Named("owner", "did"), "extra"},
+		{"name", map[string]string{}, Named("file", "f"), Named("other", "did")},
+		{"name", map[string]string{}, Named("file", "f"), Named("file", "g"), Named("owner", "did")},
+	} {
+		if _, err := stmt.Bind(args...); err == nil {
+			t.Errorf("以 %v 绑定应失败", args)
+		}
+	}
+
+	// 绑定后的错误指向参数的位置
+	for _, tc := range []struct {
+		query string
+		args  []interface{}
+		pos   Pos
+	}{
+		{`DROP FILE ? AUTHORIZED BY ?`, []interface{}{"", "did"}, Pos{1, 11}},
+		{`ADD TAGS TO FILE f TAGS ? AUTHORIZED BY did`, []interface{}{[]string{}}, Pos{1, 25}},
+		{`SHOW FILES WHERE SIZE < ?`, []interface{}{struct{}{}}, Pos{1, 25}},
+		{`SHOW FILES LIMIT ?`, []interface{}{0}, Pos{1, 18}},
+		{`USE EXTENSION x PARAMETERS=?`, []interface{}{map[string]string{"a:b": "c"}}, Pos{1, 28}},
+	} {
+		stmt, err := Prepare(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = stmt.Bind(tc.args...)
+		var perrs ParseErrors
+		if !errors.As(err, &perrs) || perrs[0].Pos != tc.pos {
+			t.Errorf("绑定 %q 得到错误 %v，期望位置 %v 的错误", tc.query, err, tc.pos)
+		}
+	}
+}
+
+func TestPrepareErrors(t *testing.T) {
+	// 没有经过 Prepare 的语句不能包含参数
+	if _, errs := Parse(`DROP FILE ? AUTHORIZED BY did`); len(errs) != 1 || errs[0].Pos != (Pos{1, 11}) {
+		t.Fatalf("解析带参数的语句得到 %v", ParseErrors(errs))
+	}
+	if _, err := Exec(context.Background(), `SHOW FILES WHERE name = :name`, UnsupportedExecutor{}); err == nil {
+		t.Fatal("没有绑定参数时执行应失败")
+	}
+
+	for query, want := range map[string]Pos{
+		`SHOW FILES WHERE ? = 'a'`:    {1, 18},
+		`SHOW FILES ORDER BY ?`:       {1, 21},
+		`SHOW FILES WHERE name = :1a`: {1, 25},
+		`? FILE f`:                    {1, 1},
+	} {
+		_, err := Prepare(query)
+		var perrs ParseErrors
+		if !errors.As(err, &perrs) || perrs[0].Pos != want {
+			t.Errorf("预处理 %q 得到错误 %v，期望位置 %v 的错误", query, err, want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Stmt: 类型化的语句
+package bpfsfql
+
+// CreateFileStmt 创建文件
+// CREATE FILE 'filename' OWNED_BY='did' CUSTOM_NAME=custom_name METADATA="key1:value1,key2:value2"
+type CreateFileStmt struct {
+	Async      bool              // 是否异步执行
+	File       string            // 要创建的文件的路径
+	Owner      string            // 文件的拥有者的DID
+	CustomName string            // 为文件设定的自定义名称
+	Metadata   map[string]string // 为文件附加的额外信息或属性
+}
+
+// DropFileStmt 删除文件
+// DROP FILE 'filename' AUTHORIZED BY 'did'
+type DropFileStmt struct {
+	File         string // 要删除的文件
+	AuthorizedBy string // 执行操作的DID
+}
+
+// UpdateFileStmt 更新文件内容
+// UPDATE FILE 'filename' SET CONTENT='new content' WHERE SIZE < 5000 AND LAST_MODIFIED > '2023-01-01' AUTHORIZED BY 'did'
+type UpdateFileStmt struct {
+	File         string     // 要更新的文件
+	Content      string     // 更新后的文件内容
+	Where        Expression // 文件需要满足的条件，为空时不限制
+	AuthorizedBy string     // 执行操作的DID
+}
+
+// SelectContentStmt 读取文件内容
+// SELECT CONTENT FROM FILE 'filename' AUTHORIZED BY 'did'
+type SelectContentStmt struct {
+	File         string // 要读取的文件
+	AuthorizedBy string // 执行操作的DID
+}
+
+// BulkTransferStmt 批量文件转移
+// BULK TRANSFER FILES [file1, file2, ...] FROM did_from TO did_to
+type BulkTransferStmt struct {
+	Async bool     // 是否异步执行
+	Files []string // 要转移的文件列表
+	From  string   // 转移方的DID
+	To    string   // 接收方的DID
+}
+
+// AddTagsStmt 添加标签
+// ADD TAGS TO FILE 'filename' TAGS [tag1, tag2, ...] AUTHORIZED BY 'did'
+type AddTagsStmt struct {
+	File         string   // 要添加标签的文件
+	Tags         []string // 要添加的标签列表
+	AuthorizedBy string   // 执行操作的DID
+}
+
+// ShowFilesStmt 列出文件
+// [EXPLAIN] SHOW FILES WHERE TAGS INCLUDE [tag1, tag2, ...] AND OWNED_BY='did' ORDER BY SIZE DESC LIMIT 10 OFFSET 20
+type ShowFilesStmt struct {
+	Explain bool        // 是否只返回生成的查询而不执行
+	Where   Expression  // 文件的筛选条件，为空时列出所有文件
+	OrderBy []OrderItem // 排序的文件属性，为空时按加入文件目录的顺序
+	Limit   int         // 最多列出的文件数量，0 表示不限制
+	Offset  int         // 跳过的文件数量
+}
+
+// OrderItem 是 ORDER BY 中的一个文件属性
+type OrderItem struct {
+	Field *Field // 排序的文件属性
+	Desc  bool   // 是否降序
+}
+
+// TransferFileStmt 资产转移
+// TRANSFER FILE 'filename' TO did AUTHORIZED BY 'did'
+type TransferFileStmt struct {
+	File         string // 要转移的文件
+	To           string // 接收资产的DID
+	AuthorizedBy string // 执行操作的DID
+}
+
+// SetCoOwnersStmt 共有产权设置
+// SET CO_OWNERS FOR FILE 'filename' CO_OWNERS=[did1, did2, ...] AUTHORIZED BY 'did'
+type SetCoOwnersStmt struct {
+	File         string   // 要设置共有产权的文件
+	CoOwners     []string // 共有者的DID列表
+	AuthorizedBy string   // 执行操作的DID
+}
+
+// ShareFileStmt 资产共享
+// SHARE FILE 'filename' WITH 'did' AUTHORIZED BY 'did'
+type ShareFileStmt struct {
+	File         string // 要共享的文件
+	With         string // 共享资产的目标DID
+	AuthorizedBy string // 执行操作的DID
+}
+
+// CheckoutFileStmt 检出特定版本
+// CHECKOUT FILE 'filename' VERSION version_number AUTHORIZED BY 'did'
+type CheckoutFileStmt struct {
+	File         string // 要检出的文件
+	Version      string // 文件的特定版本号
+	AuthorizedBy string // 执行操作的DID
+}
+
+// UseExtensionStmt 使用扩展
+// USE EXTENSION 'extension_name' PARAMETERS="key1:value1,key2:value2"
+type UseExtensionStmt struct {
+	Name       string            // 扩展或插件的名称
+	Parameters map[string]string // 扩展或插件所需的参数
+}
+
+// ShowJobsStmt 列出 ASYNC 语句的任务
+// SHOW JOBS
+type ShowJobsStmt struct{}
+
+// ShowJobStmt 查看 ASYNC 语句的任务
+// SHOW JOB 'id'
+type ShowJobStmt struct {
+	ID string // 任务的唯一标识
+}
+
+// CancelJobStmt 取消 ASYNC 语句的任务
+// CANCEL JOB 'id'
+type CancelJobStmt struct {
+	ID string // 任务的唯一标识
+}
+
+func (*CreateFileStmt) statementNode()    {}
+func (*DropFileStmt) statementNode()      {}
+func (*UpdateFileStmt) statementNode()    {}
+func (*SelectContentStmt) statementNode() {}
+func (*BulkTransferStmt) statementNode()  {}
+func (*AddTagsStmt) statementNode()       {}
+func (*ShowFilesStmt) statementNode()     {}
+func (*TransferFileStmt) statementNode()  {}
+func (*SetCoOwnersStmt) statementNode()   {}
+func (*ShareFileStmt) statementNode()     {}
+func (*CheckoutFileStmt) statementNode()  {}
+func (*UseExtensionStmt) statementNode()  {}
+func (*ShowJobsStmt) statementNode()      {}
+func (*ShowJobStmt) statementNode()       {}
+func (*CancelJobStmt) statementNode()     {}
+
+// TokenLiteral 返回语句开头的关键字
+func (*CreateFileStmt) TokenLiteral() string    { return "CREATE FILE" }
+func (*DropFileStmt) TokenLiteral() string      { return "DROP FILE" }
+func (*UpdateFileStmt) TokenLiteral() string    { return "UPDATE FILE" }
+func (*SelectContentStmt) TokenLiteral() string { return "SELECT CONTENT" }
+func (*BulkTransferStmt) TokenLiteral() string  { return "BULK TRANSFER" }
+func (*AddTagsStmt) TokenLiteral() string       { return "ADD TAGS" }
+func (*ShowFilesStmt) TokenLiteral() string     { return "SHOW FILES" }
+func (*TransferFileStmt) TokenLiteral() string  { return "TRANSFER FILE" }
+func (*SetCoOwnersStmt) TokenLiteral() string   { return "SET CO_OWNERS" }
+func (*ShareFileStmt) TokenLiteral() string     { return "SHARE FILE" }
+func (*CheckoutFileStmt) TokenLiteral() string  { return "CHECKOUT FILE" }
+func (*UseExtensionStmt) TokenLiteral() string  { return "USE EXTENSION" }
+func (*ShowJobsStmt) TokenLiteral() string      { return "SHOW JOBS" }
+func (*ShowJobStmt) TokenLiteral() string       { return "SHOW JOB" }
+func (*CancelJobStmt) TokenLiteral() string     { return "CANCEL JOB" }
@@ -0,0 +1,131 @@
+package defs
+
+import (
+	"context"
+	"time"
+
+	"github.com/bpfs/defs/core/acl"
+	"github.com/bpfs/defs/core/throttle"
+	"github.com/bpfs/defs/core/transport"
+)
+
+// throttledHandler 在响应其他节点的请求时扣除全局的上传和下载配额
+type throttledHandler struct {
+	ctx       context.Context
+	handler   transport.Store
+	throttle  *throttle.Throttle
+	manifests *manifestCache // 检查接收和请求的片段使用的已验证清单和访问控制
+}
+
+// Put 保存其他节点发送的文件片段，接收的数据计入下载速率
+// 片段需要与网络宣告的签名清单一致，清单的签名或唯一标识无效时拒绝保存
+func (h *throttledHandler) Put(assetID string, index int, data []byte) error {
+	if err := h.throttle.WaitDownload(h.ctx, "", len(data)); err != nil {
+		return err
+	}
+	m, err := h.manifests.get(h.ctx, assetID)
+	if err != nil {
+		return err
+	}
+	if err := m.VerifyShard(index, data); err != nil {
+		return err
+	}
+	return h.handler.Put(assetID, index, data)
+}
+
+// Get 读取其他节点请求的文件片段，发送的数据计入上传速率
+// 受访问控制的文件资产需要请求者的凭证，且请求者有读取权限
+func (h *throttledHandler) Get(assetID string, index int, cred *transport.Credential) ([]byte, error) {
+	if err := h.authorize(assetID, index, cred); err != nil {
+		return nil, err
+	}
+	data, err := h.handler.Get(assetID, index)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.throttle.WaitUpload(h.ctx, "", len(data)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// authorize 检查请求者对文件资产是否有读取权限，不受访问控制的文件资产不检查
+func (h *throttledHandler) authorize(assetID string, index int, cred *transport.Credential) error {
+	m, err := h.manifests.get(h.ctx, assetID)
+	if err != nil {
+		return err
+	}
+	if !m.Controlled {
+		return nil
+	}
+	entry, err := h.manifests.entry(h.ctx, assetID, m)
+	if err != nil {
+		return err
+	}
+	did, err := verifyCredential(cred, h.manifests.transport.ID(), assetID, index, time.Now())
+	if err != nil {
+		return err
+	}
+	return entry.Check(did, acl.Read)
+}
+
+// throttledTransport 在修复文件片段时按文件资产扣除上传和下载配额
+type throttledTransport struct {
+	transport.Transport
+	throttle   *throttle.Throttle
+	credential func(peerID, assetID string, index int) *transport.Credential // 为获取片段的请求签名
+}
+
+// SendShard 发送文件片段前等待上传配额
+func (t *throttledTransport) SendShard(ctx context.Context, peerID, assetID string, index int, data []byte) error {
+	if err := t.throttle.WaitUpload(ctx, assetID, len(data)); err != nil {
+		return err
+	}
+	return t.Transport.SendShard(ctx, peerID, assetID, index, data)
+}
+
+// FetchShard 获取文件片段后按其大小扣除下载配额，没有凭证时附带本节点身份的凭证
+func (t *throttledTransport) FetchShard(ctx context.Context, peerID, assetID string, index int, cred *transport.Credential) ([]byte, error) {
+	if cred == nil {
+		cred = t.credential(peerID, assetID, index)
+	}
+	data, err := t.Transport.FetchShard(ctx, peerID, assetID, index, cred)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.throttle.WaitDownload(ctx, assetID, len(data)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// SetRateLimits 修改全局的上传和下载速率(字节/秒)，0 表示不限速，立即生效
+// 时刻表中的时间段内仍以时刻表的速率为准
+func (fs *FS) SetRateLimits(upload, download int64) {
+	fs.throttle.SetLimits(throttle.Limits{Upload: upload, Download: download})
+}
+
+// SetTaskRateLimits 设置文件资产的上传和下载速率(字节/秒)，该任务同时受全局速率限制
+// 任务完成或文件资产删除后设置失效
+func (fs *FS) SetTaskRateLimits(assetID string, upload, download int64) {
+	fs.throttle.SetTaskLimits(assetID, throttle.Limits{Upload: upload, Download: download})
+}
+
+// SetRateSchedule 修改全局速率的时刻表，立即生效
+func (fs *FS) SetRateSchedule(schedule throttle.Schedule) error {
+	return fs.throttle.SetSchedule(schedule)
+}
+
+// RateLimits 返回当前生效的全局上传和下载速率
+func (fs *FS) RateLimits() (upload, download int64) {
+	limits := fs.throttle.Limits()
+	return limits.Upload, limits.Download
+}
+
+// Throughput 返回最近几秒内的上传和下载速度(字节/秒)，assetID 为空时返回全局速度
+func (fs *FS) Throughput(assetID string) (upload, download float64) {
+	if assetID == "" {
+		return fs.throttle.Throughput()
+	}
+	return fs.throttle.TaskThroughput(assetID)
+}
@@ -0,0 +1,420 @@
+package defs
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/bpfs/defs/core/download"
+	"github.com/bpfs/defs/core/pool"
+	"github.com/bpfs/defs/core/scrub"
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/core/transport"
+	"github.com/bpfs/defs/core/worker"
+	"github.com/bpfs/defs/util"
+	"github.com/sirupsen/logrus"
+)
+
+// serve 将到期的重试和巡检发现的损坏片段转换为工作池中的片段传输，直到上下文结束
+func (fs *FS) serve(ctx context.Context) {
+	var repairs <-chan scrub.Event
+	if fs.scrubber != nil {
+		repairs = fs.scrubber.Events()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case retry := <-fs.retry.Ready():
+			// 经由 Dispatch 提交，交付后被取消的重试不再提交
+			fs.retry.Dispatch(retry, func(retry *pool.Retry) {
+				if retry.Operates == sqlite.OperateUpload {
+					fs.submitUpload(retry.AssetID, retry.PieceIndex, worker.PriorityNormal)
+				} else {
+					fs.submitRefreshDownload(retry.AssetID, retry.PieceIndex)
+				}
+			})
+
+		case event := <-repairs:
+			fs.repairShard(event)
+		}
+	}
+}
+
+// transferPieces 通过工作池并发发送上传任务中的文件片段，等待任务完成或失败
+func (fs *FS) transferPieces(ctx context.Context, assetID string, indexes []int) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	// 先订阅再提交，避免错过任务结束的事件
+	events := fs.pool.Subscribe(assetID)
+	defer fs.pool.Unsubscribe(events)
+
+	closed := make(chan struct{})
+	for _, index := range indexes {
+		job := fs.uploadJob(assetID, index, worker.PriorityNormal)
+		job.Done = func(err error) {
+			if errors.Is(err, worker.ErrClosed) {
+				select {
+				case <-closed:
+				default:
+					close(closed)
+				}
+			}
+		}
+		if err := fs.workers.Submit(job); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			fs.cancelTransfers(assetID, sqlite.OperateUpload)
+			return ctx.Err()
+
+		case <-closed:
+			return worker.ErrClosed
+
+		case event, ok := <-events:
+			if !ok {
+				return fmt.Errorf("上传任务 %s 已结束", assetID)
+			}
+			switch event.Type {
+			case pool.EventCompleted:
+				return nil
+			case pool.EventFailed:
+				fs.cancelTransfers(assetID, sqlite.OperateUpload)
+				return event.Err
+			case pool.EventCancelled:
+				return fmt.Errorf("上传任务 %s 已取消", assetID)
+			}
+		}
+	}
+}
+
+// cancelTransfers 取消任务排队中和正在运行的片段传输及等待中的重试，等待正在运行的传输返回后才返回
+// 等待期间这些传输的失败不再重新排队，返回后不会再有该任务此前提交的传输读取或删除片段
+func (fs *FS) cancelTransfers(assetID string, operates int) {
+	release := fs.retry.Hold(assetID)
+	defer release()
+	fs.workers.Cancel(assetID, operates)
+}
+
+// uploadLock 是一个文件资产的上传锁，refs 为持有或等待该锁的上传数
+type uploadLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockUpload 锁定文件资产的上传，返回解锁的函数，没有上传持有或等待时释放该锁
+func (fs *FS) lockUpload(assetID string) func() {
+	fs.uploadMu.Lock()
+	lock, exists := fs.uploads[assetID]
+	if !exists {
+		lock = new(uploadLock)
+		fs.uploads[assetID] = lock
+	}
+	lock.refs++
+	fs.uploadMu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		fs.uploadMu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(fs.uploads, assetID)
+		}
+		fs.uploadMu.Unlock()
+	}
+}
+
+// submitUpload 提交一次文件片段的上传
+func (fs *FS) submitUpload(assetID string, index int, priority worker.Priority) {
+	if err := fs.workers.Submit(fs.uploadJob(assetID, index, priority)); err != nil {
+		logrus.Errorf("提交文件片段 %d 的上传失败: %v", index, err)
+	}
+}
+
+// uploadJob 创建发送本地文件片段的传输，首选节点与 sendPiece 的轮询顺序一致
+func (fs *FS) uploadJob(assetID string, index int, priority worker.Priority) *worker.Job {
+	job := &worker.Job{
+		AssetID:    assetID,
+		Operates:   sqlite.OperateUpload,
+		PieceIndex: index,
+		Priority:   priority,
+		Run: func(ctx context.Context) error {
+			return fs.uploadPiece(ctx, assetID, index)
+		},
+	}
+	if fs.transport != nil {
+		if peers := fs.transport.Peers(); len(peers) > 0 {
+			job.PeerID = peers[index%len(peers)]
+		}
+	}
+
+	return job
+}
+
+// uploadPiece 将本地文件片段发送给其他节点
+// 没有节点接收时，开启本地存储则片段保留在本节点，否则按退避策略重新排队
+func (fs *FS) uploadPiece(ctx context.Context, assetID string, index int) error {
+	data, err := fs.store.Get(assetID, index)
+	if err != nil {
+		err = fmt.Errorf("读取文件片段 %d 失败: %v", index, err)
+		fs.markUploadFailed(assetID, err)
+		return err
+	}
+
+	peerID, err := fs.sendPiece(ctx, assetID, index, hex.EncodeToString(util.CalculateHash(data)), data)
+	if err != nil {
+		return err
+	}
+
+	if peerID == "" {
+		if fs.opt.localStorage {
+			fs.pool.MarkUploadPieceComplete(assetID, index)
+			return nil
+		}
+		reason := fmt.Errorf("文件片段 %d 未能发送给任何节点", index)
+		fs.retry.Requeue(assetID, sqlite.OperateUpload, index, reason)
+		return reason
+	}
+
+	fs.retry.Succeed(assetID, sqlite.OperateUpload, index)
+	// 未开启本地存储时，片段由其他节点保存，删除本地副本
+	if !fs.opt.localStorage {
+		if err := fs.store.Delete(assetID, index); err != nil {
+			fs.markUploadFailed(assetID, err)
+			return err
+		}
+	}
+	fs.pool.MarkUploadPieceComplete(assetID, index)
+
+	return nil
+}
+
+// markUploadFailed 将上传任务标记为失败，等待中的 Upload 随即返回 reason
+func (fs *FS) markUploadFailed(assetID string, reason error) {
+	if err := fs.pool.MarkTaskFailed(assetID, sqlite.OperateUpload, reason); err != nil {
+		logrus.Errorf("标记上传任务 %s 失败时出错: %v", assetID, err)
+	}
+}
+
+// fetchShards 按下载计划通过工作池并发获取缺失的文件片段，获取到足以恢复文件的片段后停止
+// 获取的片段校验后写入 dir 下的临时文件，可用的片段记录在 shards 中；
+// 本地已检查的片段在下载任务中标记为完成，不会再从其他节点获取
+func (fs *FS) fetchShards(ctx context.Context, record *sqlite.FileRecord, slices []*sqlite.SliceRecord, holders *transport.Holders, dir string, shards []shardOpener) error {
+	if fs.transport == nil {
+		return fmt.Errorf("文件资产 %s 的可用片段不足", record.AssetID)
+	}
+	if holders == nil {
+		h, err := fs.transport.QueryHolders(ctx, record.AssetID)
+		if err != nil {
+			return err
+		}
+		holders = h
+	}
+
+	bySlice := make(map[int]*sqlite.SliceRecord, len(slices))
+	for _, slice := range slices {
+		bySlice[slice.SliceIndex] = slice
+	}
+	// 将片段的持有节点记录到下载任务中，作为下载计划的依据
+	byPeer := make(map[string]map[int]string)
+	for index, peers := range holders.Peers {
+		slice, exists := bySlice[index]
+		if !exists {
+			continue
+		}
+		for _, peerID := range peers {
+			if byPeer[peerID] == nil {
+				byPeer[peerID] = make(map[int]string)
+			}
+			byPeer[peerID][index] = slice.SliceHash
+		}
+	}
+	for peerID, pieceHashes := range byPeer {
+		fs.pool.UpdateDownloadPieceInfo(peerID, record.AssetID, "", 0, nil, pieceHashes)
+	}
+
+	task, exists := fs.pool.GetDownloadTask(record.AssetID)
+	if !exists {
+		return fmt.Errorf("下载任务 %s 不存在", record.AssetID)
+	}
+	plan := download.NewPlanner(task, fs.transport.ID())
+
+	type fetched struct {
+		index int
+		path  string // 暂存片段的临时文件
+		err   error
+	}
+	results := make(chan *fetched)
+	stop := make(chan struct{})
+	// 返回后只取消本次提交的剩余获取，同一文件资产的后台刷新和修复继续进行
+	// 结束的获取不再等待接收结果
+	var submitted []*worker.Job
+	defer func() { fs.workers.CancelJobs(submitted...) }()
+	defer close(stop)
+
+	submit := func(f download.Fetch) error {
+		slice := bySlice[f.Index]
+		result := &fetched{index: f.Index, path: filepath.Join(dir, strconv.Itoa(f.Index))}
+		job := &worker.Job{
+			AssetID:    record.AssetID,
+			Operates:   sqlite.OperateDownload,
+			PieceIndex: f.Index,
+			PeerID:     f.PeerID,
+			Priority:   worker.PriorityInteractive,
+			Run: func(ctx context.Context) error {
+				data, err := fs.fetchShardFrom(ctx, f.PeerID, record.AssetID, slice)
+				if err != nil {
+					return err
+				}
+				return os.WriteFile(result.path, data, 0600)
+			},
+			Done: func(err error) {
+				result.err = err
+				select {
+				case results <- result:
+				case <-stop:
+				}
+			},
+		}
+		if err := fs.workers.Submit(job); err != nil {
+			return err
+		}
+		submitted = append(submitted, job)
+		return nil
+	}
+	// fill 按计划提交片段的获取，直到正在获取的片段足以恢复文件
+	fill := func() error {
+		for {
+			f, ok := plan.Next()
+			if !ok {
+				return nil
+			}
+			if err := submit(f); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := fill(); err != nil {
+		return err
+	}
+	for plan.Inflight() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case result := <-results:
+			if result.err != nil {
+				if errors.Is(result.err, worker.ErrClosed) {
+					return result.err
+				}
+				fs.pool.MarkDownloadPieceFailed(record.AssetID, result.index, result.err)
+				// 节点不可用，改由其他节点或奇偶校验片段补足
+				plan.Fail(result.index)
+				if err := fill(); err != nil {
+					return err
+				}
+				continue
+			}
+
+			path := result.path
+			shards[result.index] = func() (io.ReadCloser, error) {
+				return os.Open(path)
+			}
+			fs.pool.MarkDownloadPieceComplete(record.AssetID, result.index)
+			if plan.Succeed(result.index) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("文件资产 %s 的可用片段不足", record.AssetID)
+}
+
+// submitRefreshDownload 提交一次文件片段的刷新下载，获取的片段保存在本地存储中
+func (fs *FS) submitRefreshDownload(assetID string, index int) {
+	job := &worker.Job{
+		AssetID:    assetID,
+		Operates:   sqlite.OperateDownload,
+		PieceIndex: index,
+		Priority:   worker.PriorityBackground,
+		Run: func(ctx context.Context) error {
+			return fs.refreshDownload(ctx, assetID, index)
+		},
+	}
+	if err := fs.workers.Submit(job); err != nil {
+		logrus.Errorf("提交文件片段 %d 的刷新下载失败: %v", index, err)
+	}
+}
+
+// refreshDownload 从其他节点获取文件片段并保存在本地存储中，失败时按退避策略重新排队
+func (fs *FS) refreshDownload(ctx context.Context, assetID string, index int) error {
+	slice, holders, err := fs.lookupSlice(ctx, assetID, index)
+	if err == nil {
+		var data []byte
+		if data, err = fs.fetchShard(ctx, assetID, slice, &holders); err == nil {
+			if err = fs.store.Put(assetID, index, data); err == nil {
+				// 巡检标记为失败的片段重新获取后恢复状态
+				if slice.Status != sqlite.StatusSuccess {
+					if err := sqlite.UpdateSlicesDatabaseStatus(fs.db, assetID, slice.SliceHash, sqlite.StatusSuccess); err != nil {
+						logrus.Warnf("更新文件片段 %d 的状态失败: %v", index, err)
+					}
+				}
+				fs.retry.Succeed(assetID, sqlite.OperateDownload, index)
+				fs.pool.MarkDownloadPieceComplete(assetID, index)
+				return nil
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	fs.retry.Requeue(assetID, sqlite.OperateDownload, index, err)
+	return err
+}
+
+// lookupSlice 查询文件片段的信息，本地没有上传记录时从网络宣告的签名清单中查询
+func (fs *FS) lookupSlice(ctx context.Context, assetID string, index int) (*sqlite.SliceRecord, *transport.Holders, error) {
+	var (
+		slices  []*sqlite.SliceRecord
+		holders *transport.Holders
+	)
+
+	record, err := sqlite.SelectOneFileDatabase(fs.db, assetID, sqlite.OperateUpload)
+	if err != nil {
+		return nil, nil, err
+	}
+	if record != nil && record.Status == sqlite.StatusSuccess {
+		if slices, err = sqlite.SelectSlicesDatabase(fs.db, assetID); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		m, h, err := fs.lookupRemoteAsset(ctx, assetID)
+		if err != nil {
+			return nil, nil, err
+		}
+		slices, holders = manifestSlices(m), h
+	}
+
+	for _, slice := range slices {
+		if slice.SliceIndex == index {
+			return slice, holders, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("文件资产 %s 中不存在片段 %d", assetID, index)
+}
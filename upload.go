@@ -0,0 +1,356 @@
+package defs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bpfs/defs/core/delete"
+	"github.com/bpfs/defs/core/erasure"
+	"github.com/bpfs/defs/core/manifest"
+	"github.com/bpfs/defs/core/pool"
+	"github.com/bpfs/defs/core/sqlite"
+	"github.com/bpfs/defs/core/store"
+	"github.com/bpfs/defs/util/crypto"
+	"github.com/sirupsen/logrus"
+)
+
+// Upload 上传本地文件，返回文件资产的唯一标识
+// 文件按存储模式流式编码，由本节点签名的清单描述，唯一标识由清单计算；
+// 片段直接写入文件片段存储，并在数据库中记录上传状态，清单在发送片段前向网络宣告
+func (fs *FS) Upload(ctx context.Context, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s 是一个目录", path)
+	}
+	if info.Size() == 0 {
+		return "", fmt.Errorf("文件 %s 的内容为空", path)
+	}
+
+	// 存储不支持流式写入时，片段在保存前保留在内存中
+	if _, ok := fs.store.(store.Streamer); !ok && info.Size() > fs.opt.maxBufferSize {
+		return "", fmt.Errorf("文件的大小 %d 不可大于 %d", info.Size(), fs.opt.maxBufferSize)
+	}
+
+	// 文件资产的唯一标识由签名的清单计算，先编码一遍得到清单，片段在确定唯一标识后再编码写入存储
+	m, assetID, dataKey, err := fs.uploadManifest(ctx, file, info)
+	if err != nil {
+		return "", err
+	}
+	// 同一文件资产的上传依次进行，继续上传时不会与上一次上传剩余的传输交错
+	unlock := fs.lockUpload(assetID)
+	defer unlock()
+
+	record, err := sqlite.SelectOneFileDatabase(fs.db, assetID, sqlite.OperateUpload)
+	if err != nil {
+		return "", err
+	}
+	// 相同的身份已上传成功相同的文件
+	if record != nil && record.Status == sqlite.StatusSuccess {
+		return assetID, nil
+	}
+
+	if err := fs.checkPeers(); err != nil {
+		return "", err
+	}
+
+	total := len(m.Shards)
+
+	// 上一次未完成的上传与本次的分片方式相同时从中断处继续，否则清理后重新上传
+	resumed := false
+	if record != nil {
+		pieces, exists := fs.pool.GetUploadTaskPieces(assetID)
+		if exists && pieces == total && record.TotalPieces == int64(total) {
+			resumed = true
+		} else {
+			fs.pool.DeleteUploadTask(assetID)
+			if err := delete.Remove(fs.db, fs.store, assetID); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if resumed {
+		if err := sqlite.UpdateFileDatabaseStatus(fs.db, assetID, sqlite.OperateUpload, sqlite.StatusInProgress); err != nil {
+			return "", err
+		}
+	} else {
+		record = &sqlite.FileRecord{
+			AssetID:     assetID,
+			Name:        info.Name(),
+			Size:        info.Size(),
+			FileHash:    m.ContentHash,
+			TotalPieces: int64(total),
+			DataPieces:  int64(m.DataShards),
+			Operates:    sqlite.OperateUpload,
+			Status:      sqlite.StatusInProgress,
+			Times:       info.ModTime(),
+		}
+		if err := sqlite.InsertFilesDatabase(fs.db, record); err != nil {
+			return "", err
+		}
+		if err := fs.pool.AddUploadTask(assetID, total); err != nil {
+			return "", err
+		}
+		fs.pool.SetUploadTaskSize(assetID, info.Size(), m.DataShards)
+	}
+	if err := fs.saveManifest(assetID, m); err != nil {
+		return "", err
+	}
+
+	// fail 将上传状态标记为失败并返回错误，上传任务保留以便下次继续
+	fail := func(err error) (string, error) {
+		_ = sqlite.UpdateFileDatabaseStatus(fs.db, assetID, sqlite.OperateUpload, sqlite.StatusFailed)
+		return "", err
+	}
+
+	content, err := uploadContent(ctx, file, m, dataKey)
+	if err != nil {
+		return fail(err)
+	}
+
+	// 片段写入存储后记录，存在节点间传输时随后由工作池分发给其他节点
+	pending, err := fs.encodeShards(content, assetID, m, resumed)
+	if err != nil {
+		return fail(err)
+	}
+
+	// 设置身份时以其为文件资产的所有者，访问控制随文件资产信息宣告
+	if id := fs.did(); id != "" {
+		if _, err := fs.acl.Create(assetID, id); err != nil {
+			return fail(err)
+		}
+	}
+
+	if fs.transport != nil {
+		// 存储节点根据宣告的清单检查接收的片段
+		if err := fs.announce(ctx, assetID, nil); err != nil {
+			return fail(fmt.Errorf("宣告文件资产失败: %v", err))
+		}
+		if err := fs.transferPieces(ctx, assetID, pending); err != nil {
+			return fail(err)
+		}
+
+		// 本节点保留的片段
+		var local []int
+		for index := range m.Shards {
+			if ok, _ := fs.store.Has(assetID, index); ok {
+				local = append(local, index)
+			}
+		}
+		if err := fs.announce(ctx, assetID, local); err != nil {
+			return fail(fmt.Errorf("宣告文件资产失败: %v", err))
+		}
+	}
+
+	if err := sqlite.UpdateFileDatabaseStatus(fs.db, assetID, sqlite.OperateUpload, sqlite.StatusSuccess); err != nil {
+		return "", err
+	}
+	if err := fs.saveCatalog(record); err != nil {
+		return "", err
+	}
+	fs.pool.DeleteUploadTask(assetID)
+	fs.retry.Reset(assetID)
+	fs.throttle.RemoveTask(assetID)
+	if fs.repair != nil {
+		if err := fs.watchAsset(assetID); err != nil {
+			logrus.Warnf("跟踪文件资产 %s 的持有情况失败: %v", assetID, err)
+		}
+	}
+
+	return assetID, nil
+}
+
+// uploadManifest 返回上传文件使用的清单、唯一标识和数据密钥
+// 开启加密时每次上传使用随机的数据密钥；同一文件上一次的加密上传仍可解出数据密钥时以其再次编码，
+// 内容未变时得到相同的清单，从而继续或跳过上一次的上传，否则以新的数据密钥重新编码
+func (fs *FS) uploadManifest(ctx context.Context, file *os.File, info os.FileInfo) (*manifest.Manifest, string, []byte, error) {
+	var (
+		previous string
+		dataKey  []byte
+	)
+	if fs.opt.encryption {
+		var err error
+		if dataKey, previous, err = fs.previousDataKey(info); err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	m, dataKey, err := fs.signManifest(ctx, file, info, dataKey)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	assetID, err := m.AssetID()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if previous == "" || assetID == previous {
+		return m, assetID, dataKey, nil
+	}
+
+	// 文件的内容已改变，数据密钥不再用于其他内容
+	if m, dataKey, err = fs.signManifest(ctx, file, info, nil); err != nil {
+		return nil, "", nil, err
+	}
+	if assetID, err = m.AssetID(); err != nil {
+		return nil, "", nil, err
+	}
+	return m, assetID, dataKey, nil
+}
+
+// signManifest 按存储方式编码文件内容并由本节点签名清单，片段不写入任何位置
+// 开启加密时以 dataKey 加密内容，dataKey 为 nil 时生成随机的数据密钥，返回的数据密钥用于再次加密；
+// 加密的清单只描述密文，文件名称和修改时间只保存在本地的上传记录中
+func (fs *FS) signManifest(ctx context.Context, file *os.File, info os.FileInfo, dataKey []byte) (*manifest.Manifest, []byte, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	content := &contextReader{ctx: ctx, r: file}
+
+	var m *manifest.Manifest
+	if !fs.opt.encryption {
+		plan := PlanStorage(info.Size(), fs.opt)
+		encoded, err := erasure.EncodeTo(content, discardShards(plan.TotalShards()), plan.Erasure())
+		if err != nil {
+			return nil, nil, err
+		}
+		m = manifest.New(info.Name(), info.ModTime(), plan.Mode.String(), encoded)
+		dataKey = nil
+	} else {
+		var err error
+		if dataKey == nil {
+			if dataKey, err = crypto.NewDataKey(); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		plan := PlanStorage(crypto.EncryptedSize(info.Size(), crypto.DefaultChunkSize), fs.opt)
+		if m, err = manifest.Seal(content, discardShards(plan.TotalShards()), plan.Mode.String(), plan.Erasure(), dataKey, fs.signer()); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// 设置身份时文件资产受访问控制，由清单签名，其他节点不会接受省略了访问控制的宣告
+	m.Controlled = fs.opt.identity != nil
+	if err := m.Sign(fs.signer()); err != nil {
+		return nil, nil, err
+	}
+	return m, dataKey, nil
+}
+
+// discardShards 返回丢弃写入内容的片段
+func discardShards(total int) []io.Writer {
+	shards := make([]io.Writer, total)
+	for i := range shards {
+		shards[i] = io.Discard
+	}
+	return shards
+}
+
+// uploadContent 返回从头读取文件的内容，清单加密时返回以数据密钥加密的密文
+func uploadContent(ctx context.Context, file *os.File, m *manifest.Manifest, dataKey []byte) (io.Reader, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var content io.Reader = &contextReader{ctx: ctx, r: file}
+	if m.Encryption == "" {
+		return content, nil
+	}
+	return crypto.NewEncryptReader(content, dataKey, m.ChunkSize)
+}
+
+// encodeShards 按清单的分片方式流式编码 r 的内容，片段直接写入文件片段存储并逐个记录，返回等待发送的片段索引
+// 编码得到的片段与清单不一致时(如文件在上传过程中被修改)不保存任何片段；继续上传时已完成的片段只参与编码，不再写入
+func (fs *FS) encodeShards(r io.Reader, assetID string, m *manifest.Manifest, resumed bool) ([]int, error) {
+	enc, err := erasure.NewStreamEncoder(m.DataShards, m.ParityShards, m.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	total := len(m.Shards)
+	writers := make([]io.Writer, total)
+	shards := make([]store.ShardWriter, total)
+	// abort 丢弃尚未保存的片段
+	abort := func() {
+		for _, w := range shards {
+			if w != nil {
+				w.Abort()
+			}
+		}
+	}
+	for index := range writers {
+		if resumed && fs.pool.IsUploadPieceComplete(assetID, index) {
+			writers[index] = io.Discard
+			continue
+		}
+		w, err := store.Create(fs.store, assetID, index)
+		if err != nil {
+			abort()
+			return nil, fmt.Errorf("创建文件片段 %d 失败: %v", index, err)
+		}
+		shards[index], writers[index] = w, w
+	}
+
+	result, err := enc.Encode(r, writers)
+	if err != nil {
+		abort()
+		return nil, err
+	}
+	for index, shard := range m.Shards {
+		if result.ShardHashes[index] != shard.Hash {
+			abort()
+			return nil, fmt.Errorf("文件的内容与清单不符，可能在上传过程中被修改")
+		}
+	}
+
+	var pending []int
+	for index, w := range shards {
+		if w == nil {
+			continue
+		}
+		shards[index] = nil
+		if err := w.Close(); err != nil {
+			abort()
+			fs.pool.MarkUploadPieceFailed(assetID, index, err)
+			return nil, fmt.Errorf("保存文件片段 %d 失败: %v", index, err)
+		}
+
+		hash := m.Shards[index].Hash
+		if err := sqlite.InsertSlicesDatabase(fs.db, assetID, hash, index, sqlite.StatusSuccess); err != nil {
+			abort()
+			return nil, err
+		}
+		fs.pool.UpdateUploadPieceInfo(assetID, hash, &pool.UploadPieceInfo{Index: index})
+
+		if fs.transport == nil {
+			fs.pool.MarkUploadPieceComplete(assetID, index)
+			continue
+		}
+		pending = append(pending, index)
+	}
+
+	return pending, nil
+}
+
+// contextReader 在每次读取前检查上下文，上下文结束后读取返回其错误
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -2,6 +2,8 @@ package crypto
 
 import (
 	"bytes"
+	"crypto/rand"
+	"io"
 	"testing"
 )
 
@@ -58,7 +60,7 @@ func TestEncryptDecryptWithAESCTR(t *testing.T) {
 	plaintext := []byte("hello world")
 
 	// 正常情况：加密和解密
-	ciphertext, err := Encrypt(plaintext, key)
+	ciphertext, err := Encrypt(key, plaintext)
 	if err != nil {
 		t.Fatalf("加密失败: %v", err)
 	}
@@ -74,7 +76,7 @@ func TestEncryptDecryptWithAESCTR(t *testing.T) {
 
 	// 错误情况1：密钥长度不正确
 	wrongKey := []byte("wrongkey")
-	_, err = Encrypt(plaintext, wrongKey)
+	_, err = Encrypt(wrongKey, plaintext)
 	if err == nil {
 		t.Fatalf("应当失败，因为密钥长度不正确")
 	}
@@ -91,3 +93,72 @@ func TestEncryptDecryptWithAESCTR(t *testing.T) {
 		t.Fatalf("应当失败，因为密文格式不正确")
 	}
 }
+
+func TestEncryptDecryptStream(t *testing.T) {
+	key, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 覆盖空内容、不足一块、恰好整块和多块的情况
+	for _, size := range []int{0, 100, 1024, 5000} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+
+		r, err := NewEncryptReader(bytes.NewReader(plaintext), key, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ciphertext, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("加密失败: %v", err)
+		}
+		if int64(len(ciphertext)) != EncryptedSize(int64(size), 1024) {
+			t.Fatalf("%d 字节的明文加密后为 %d 字节, 预期 %d 字节", size, len(ciphertext), EncryptedSize(int64(size), 1024))
+		}
+		if got := DecryptedSize(int64(len(ciphertext)), 1024); got != int64(size) {
+			t.Fatalf("%d 字节的密文中明文为 %d 字节, 预期 %d 字节", len(ciphertext), got, size)
+		}
+		if size > 0 && bytes.Contains(ciphertext, plaintext) {
+			t.Fatal("密文中包含明文")
+		}
+
+		dr, err := NewDecryptReader(bytes.NewReader(ciphertext), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decrypted, err := io.ReadAll(dr)
+		if err != nil {
+			t.Fatalf("解密 %d 字节的明文失败: %v", size, err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Fatalf("%d 字节的明文解密后不一致", size)
+		}
+	}
+
+	plaintext := make([]byte, 3000)
+	r, _ := NewEncryptReader(bytes.NewReader(plaintext), key, 1024)
+	ciphertext, _ := io.ReadAll(r)
+	decrypt := func(data, key []byte) error {
+		dr, err := NewDecryptReader(bytes.NewReader(data), key)
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadAll(dr)
+		return err
+	}
+
+	// 篡改、截断到块的边界和使用错误的密钥都会失败
+	tampered := append([]byte(nil), ciphertext...)
+	tampered[len(tampered)/2] ^= 1
+	if err := decrypt(tampered, key); err == nil {
+		t.Fatal("篡改的密文解密成功")
+	}
+	if err := decrypt(ciphertext[:headerSize+2*(1024+tagSize)], key); err == nil {
+		t.Fatal("截断的密文解密成功")
+	}
+	other, _ := NewDataKey()
+	if err := decrypt(ciphertext, other); err == nil {
+		t.Fatal("使用错误的密钥解密成功")
+	}
+}
@@ -0,0 +1,214 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+/**
+分块的 AES-GCM
+内容按固定大小分块，每块单独加密并带有认证标签，加密和解密时只需保留一块的数据。
+每块的 nonce 由块的序号和是否为最后一块组成，调换、删除或截断任意块都会导致解密失败。
+同一个数据密钥只用于加密一份内容，因此 nonce 不需要随机数。
+
+格式: 文件头 | 块 0 | 块 1 | ... | 最后一块
+文件头: "DEFSENC" | 版本(1 字节) | 块的大小(4 字节，大端)
+块: 密文 | 认证标签(16 字节)，最后一块的明文少于块的大小(可以为空)
+*/
+
+const (
+	// DataKeySize 是数据密钥的长度，使用 AES-256
+	DataKeySize = 32
+	// DefaultChunkSize 是分块加密时每块明文的默认大小
+	DefaultChunkSize = 64 << 10
+
+	streamMagic   = "DEFSENC"
+	streamVersion = 1
+	headerSize    = len(streamMagic) + 1 + 4
+	tagSize       = 16
+)
+
+// NewDataKey 生成一个随机的数据密钥
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, DataKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("生成数据密钥失败: %v", err)
+	}
+	return key, nil
+}
+
+// EncryptedSize 返回大小为 size 的明文按 chunkSize 分块加密后的大小
+func EncryptedSize(size int64, chunkSize int) int64 {
+	// 明文恰好为块的整数倍时，最后追加一个空块
+	chunks := size/int64(chunkSize) + 1
+	return int64(headerSize) + size + chunks*tagSize
+}
+
+// DecryptedSize 返回按 chunkSize 分块加密后大小为 size 的密文中明文的大小，密文的大小不合法时返回 -1
+func DecryptedSize(size int64, chunkSize int) int64 {
+	body := size - int64(headerSize) - tagSize
+	if chunkSize <= 0 || body < 0 {
+		return -1
+	}
+	// 除最后一块外每块密文为 chunkSize + tagSize 字节，最后一块的明文不足一块
+	full := body / int64(chunkSize+tagSize)
+	if body%int64(chunkSize+tagSize) >= int64(chunkSize) {
+		return -1
+	}
+	return body - full*tagSize
+}
+
+// newGCM 创建分块加密使用的 AES-GCM
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("创建cipher.Block失败: " + err.Error())
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("创建GCM模式失败: " + err.Error())
+	}
+	return gcm, nil
+}
+
+// chunkNonce 返回第 seq 块的 nonce，最后一块的首字节为 1
+func chunkNonce(seq uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	if last {
+		nonce[0] = 1
+	}
+	binary.BigEndian.PutUint64(nonce[4:], seq)
+	return nonce
+}
+
+// encryptReader 读取明文并按块输出密文
+type encryptReader struct {
+	r     io.Reader
+	gcm   cipher.AEAD
+	plain []byte       // 一块明文的缓冲区
+	out   bytes.Buffer // 待读取的密文
+	seq   uint64
+	done  bool
+}
+
+// NewEncryptReader 返回读取 r 的明文并输出分块加密的密文的 Reader，chunkSize 不大于 0 时使用 DefaultChunkSize
+func NewEncryptReader(r io.Reader, key []byte, chunkSize int) (io.Reader, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &encryptReader{r: r, gcm: gcm, plain: make([]byte, chunkSize)}
+	e.out.WriteString(streamMagic)
+	e.out.WriteByte(streamVersion)
+	binary.Write(&e.out, binary.BigEndian, uint32(chunkSize))
+	return e, nil
+}
+
+// Read 输出密文，缓冲的密文读完后加密下一块
+func (e *encryptReader) Read(p []byte) (int, error) {
+	for e.out.Len() == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.next(); err != nil {
+			return 0, err
+		}
+	}
+	return e.out.Read(p)
+}
+
+// next 读取并加密一块明文，明文不足一块时为最后一块
+func (e *encryptReader) next() error {
+	n, err := io.ReadFull(e.r, e.plain)
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		e.done = true
+	default:
+		return fmt.Errorf("读取明文失败: %v", err)
+	}
+
+	e.out.Write(e.gcm.Seal(nil, chunkNonce(e.seq, e.done), e.plain[:n], nil))
+	e.seq++
+	return nil
+}
+
+// decryptReader 读取密文并按块输出明文
+type decryptReader struct {
+	r      io.Reader
+	gcm    cipher.AEAD
+	sealed []byte // 一块密文的缓冲区
+	out    []byte // 待读取的明文
+	seq    uint64
+	done   bool
+}
+
+// NewDecryptReader 返回读取 r 中 NewEncryptReader 输出的密文并输出明文的 Reader
+// 每块在认证通过后才输出，密文被篡改或截断时 Read 返回错误
+func NewDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("非法的密文格式")
+	}
+	if string(header[:len(streamMagic)]) != streamMagic {
+		return nil, fmt.Errorf("非法的密文格式")
+	}
+	if header[len(streamMagic)] != streamVersion {
+		return nil, fmt.Errorf("不支持的密文版本 %d", header[len(streamMagic)])
+	}
+	chunkSize := binary.BigEndian.Uint32(header[len(streamMagic)+1:])
+	if chunkSize == 0 || chunkSize > 1<<30 {
+		return nil, fmt.Errorf("密文的块大小 %d 无效", chunkSize)
+	}
+
+	return &decryptReader{r: r, gcm: gcm, sealed: make([]byte, int(chunkSize)+tagSize)}, nil
+}
+
+// Read 输出明文，缓冲的明文读完后解密下一块
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+// next 读取并解密一块密文，不足一整块的密文为最后一块
+func (d *decryptReader) next() error {
+	n, err := io.ReadFull(d.r, d.sealed)
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		d.done = true
+	default:
+		return fmt.Errorf("读取密文失败: %v", err)
+	}
+
+	plain, err := d.gcm.Open(d.sealed[:0], chunkNonce(d.seq, d.done), d.sealed[:n], nil)
+	if err != nil {
+		return fmt.Errorf("解密第 %d 块失败: %v", d.seq, err)
+	}
+	d.out = plain
+	d.seq++
+	return nil
+}
@@ -1,20 +1,32 @@
-package defs
+package sign
 
 import (
 	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
-	"math/big"
-	mathrand "math/rand"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
 )
 
 // GenerateKeysFromSeed 使用种子数据生成 RSA 密钥对
+// 种子的全部内容经 HKDF-SHA256 派生为 AES-CTR 的密钥，以其密钥流作为生成密钥的随机数；rsa.GenerateKey 不保证相同的随机数得到相同的密钥，
+// 因此相同的种子不一定生成相同的密钥对。
+//
+// Deprecated: 需要由种子确定的身份时使用 identity.FromSeed。
 func GenerateKeysFromSeed(seedData []byte, bits int) (*rsa.PrivateKey, *rsa.PublicKey, error) {
-	seed := big.NewInt(0).SetBytes(seedData).Int64()
-	mathrand.Seed(seed)
-	customRand := mathrand.New(mathrand.NewSource(seed))
-	privateKey, err := rsa.GenerateKey(customRand, bits)
+	if len(seedData) == 0 {
+		return nil, nil, fmt.Errorf("种子数据为空")
+	}
+	random, err := seedReader(seedData)
+	if err != nil {
+		return nil, nil, err
+	}
+	privateKey, err := rsa.GenerateKey(random, bits)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -22,8 +34,32 @@ func GenerateKeysFromSeed(seedData []byte, bits int) (*rsa.PrivateKey, *rsa.Publ
 	return privateKey, publicKey, nil
 }
 
-// 使用RSA私钥为数据签名
-func signData(privateKey *rsa.PrivateKey, data []byte) ([]byte, error) {
+// zeroReader 输出全零的字节
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// seedReader 返回由种子派生的密钥流
+func seedReader(seedData []byte) (io.Reader, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, seedData, nil, []byte("defs rsa key")), key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	stream := cipher.NewCTR(block, make([]byte, aes.BlockSize))
+	return cipher.StreamReader{S: stream, R: zeroReader{}}, nil
+}
+
+// SignData 使用RSA私钥为数据签名
+func SignData(privateKey *rsa.PrivateKey, data []byte) ([]byte, error) {
 	// Sum256 返回数据的 SHA256 校验和。
 	hashed := sha256.Sum256(data)
 	// SignPKCS1v15 使用 RSA PKCS #1 v1.5 中的 RSASSA-PKCS1-V1_5-SIGN 计算散列签名。
@@ -35,8 +71,8 @@ func signData(privateKey *rsa.PrivateKey, data []byte) ([]byte, error) {
 	return signature, nil
 }
 
-// 使用RSA公钥验证数据的签名
-func verifySignature(publicKey *rsa.PublicKey, data []byte, signature []byte) bool {
+// VerifySignature 使用RSA公钥验证数据的签名
+func VerifySignature(publicKey *rsa.PublicKey, data []byte, signature []byte) bool {
 	hashed := sha256.Sum256(data)
 	// verifyPKCS1v15 验证 RSA PKCS #1 v1.5 签名。
 	// hashed 是使用给定哈希函数对输入消息进行哈希处理的结果，sig 是签名。 返回零错误表明签名有效。 如果哈希值为零，则直接使用哈希值。 除了互操作性之外，这是不可取的。
@@ -1,4 +1,4 @@
-package defs
+package sign
 
 import (
 	"testing"
@@ -19,14 +19,14 @@ func TestSignData(t *testing.T) {
 	data := []byte("Hello, World!")
 
 	// 签名
-	signature, err := signData(privateKey, data)
+	signature, err := SignData(privateKey, data)
 	if err != nil {
 		t.Error("Error signing data:", err)
 		return
 	}
 
 	// 验证签名
-	isVerified := verifySignature(publicKey, data, signature)
+	isVerified := VerifySignature(publicKey, data, signature)
 	if isVerified {
 		logrus.Printf("Signature verified.")
 	} else {